@@ -0,0 +1,418 @@
+package billing
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/storage"
+	"github.com/kubecost/cost-model/pkg/util/json"
+)
+
+// Columns of the standard billing schema, named as by the FinOps Open Cost
+// and Usage Specification (FOCUS). Each may be mapped to a differently named
+// column of the exports by Config.Columns.
+const (
+	ColumnChargePeriodStart = "ChargePeriodStart"
+	ColumnChargePeriodEnd   = "ChargePeriodEnd"
+	ColumnBilledCost        = "BilledCost"
+	ColumnChargeCategory    = "ChargeCategory"
+	ColumnProviderName      = "ProviderName"
+	ColumnBillingAccountID  = "BillingAccountId"
+	ColumnSubAccountID      = "SubAccountId"
+	ColumnServiceName       = "ServiceName"
+	ColumnServiceCategory   = "ServiceCategory"
+	ColumnResourceID        = "ResourceId"
+	ColumnResourceName      = "ResourceName"
+	ColumnTags              = "Tags"
+)
+
+// chargeCategoryCredit is the ChargeCategory of credits, the costs of which
+// are negative
+const chargeCategoryCredit = "credit"
+
+// timeLayouts are the layouts by which charge periods are parsed, unless a
+// layout is configured
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// Config configures the ingestion of billing exports.
+type Config struct {
+	// Storage is the type of storage from which exports are read; i.e.
+	// "file" or "s3"
+	Storage string `json:"storage"`
+
+	// Path is the directory, or prefix of keys, within which exports are
+	// stored. Files ending in ".csv" or ".csv.gz" are read.
+	Path string `json:"path"`
+
+	// Bucket, Region, Endpoint, Insecure, AccessKeyID and SecretAccessKey
+	// configure "s3" storage; see storage.S3Config.
+	Bucket          string `json:"bucket,omitempty"`
+	Region          string `json:"region,omitempty"`
+	Endpoint        string `json:"endpoint,omitempty"`
+	Insecure        bool   `json:"insecure,omitempty"`
+	AccessKeyID     string `json:"accessKeyID,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+
+	// Provider is the provider of assets which are not named by a
+	// ProviderName column; e.g. "OnPrem"
+	Provider string `json:"provider,omitempty"`
+
+	// Columns maps standard columns to the columns of the exports which
+	// contain them; e.g. {"BilledCost": "amount"}
+	Columns map[string]string `json:"columns,omitempty"`
+
+	// TagColumns are columns of the exports, the values of which are set as
+	// tags named by the column; e.g. ["namespace"]
+	TagColumns []string `json:"tagColumns,omitempty"`
+
+	// TimeLayout is the layout by which charge periods are parsed, if they
+	// are not in RFC 3339 or date format
+	TimeLayout string `json:"timeLayout,omitempty"`
+}
+
+// LoadConfig loads the Config from the JSON file at the given path. If no
+// file exists, it returns nil; i.e. ingestion is not configured.
+func LoadConfig(configPath string) (*Config, error) {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	config := &Config{}
+	err = json.Unmarshal(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", configPath, err)
+	}
+
+	return config, nil
+}
+
+// NewStorage creates the Storage from which the configured exports are read.
+func (c *Config) NewStorage() (storage.Storage, error) {
+	switch strings.ToLower(c.Storage) {
+	case "", "file":
+		if c.Path == "" {
+			return nil, fmt.Errorf("path is required for file storage")
+		}
+		return storage.NewFileStorage(c.Path), nil
+	case "s3":
+		return storage.NewS3Storage(storage.S3Config{
+			Bucket:          c.Bucket,
+			Prefix:          c.Path,
+			Region:          c.Region,
+			Endpoint:        c.Endpoint,
+			Insecure:        c.Insecure,
+			AccessKeyID:     c.AccessKeyID,
+			SecretAccessKey: c.SecretAccessKey,
+		})
+	}
+
+	return nil, fmt.Errorf("unsupported storage: %s", c.Storage)
+}
+
+// column returns the name of the export column containing the given
+// standard column.
+func (c *Config) column(name string) string {
+	if col, ok := c.Columns[name]; ok && col != "" {
+		return col
+	}
+	return name
+}
+
+// charge is one row of a billing export
+type charge struct {
+	start      time.Time
+	end        time.Time
+	cost       float64
+	credit     bool
+	provider   string
+	account    string
+	project    string
+	service    string
+	category   string
+	providerID string
+	name       string
+	tags       map[string]string
+}
+
+// exportFile is a parsed billing export, which is parsed again only if the
+// file is modified
+type exportFile struct {
+	modTime time.Time
+	charges []*charge
+}
+
+// Ingester reads billing exports in a standard column schema from storage,
+// producing Cloud assets of the charges they contain, so that the billing
+// data of any cloud, or of an on-prem chargeback system, can be reported
+// alongside the cluster's own costs.
+type Ingester struct {
+	lock   sync.Mutex
+	store  storage.Storage
+	config *Config
+	files  map[string]*exportFile
+}
+
+// NewIngester creates an Ingester, which reads exports from the given
+// Storage, as configured.
+func NewIngester(store storage.Storage, config *Config) (*Ingester, error) {
+	if store == nil {
+		return nil, fmt.Errorf("Ingester: storage is nil")
+	}
+	if config == nil {
+		return nil, fmt.Errorf("Ingester: config is nil")
+	}
+
+	return &Ingester{
+		store:  store,
+		config: config,
+		files:  map[string]*exportFile{},
+	}, nil
+}
+
+// ExternalAssets returns a Cloud asset for each charge of the exports which
+// overlaps the given times, and which is tagged with any of the given
+// external query labels, as cloud.Provider.ExternalAssets does. Assets span
+// their charge periods, so costs are not prorated to the given times.
+func (ing *Ingester) ExternalAssets(start, end time.Time, queryLabels map[string]string) ([]*kubecost.Cloud, error) {
+	charges, err := ing.charges()
+	if err != nil {
+		return nil, err
+	}
+
+	var assets []*kubecost.Cloud
+	for _, c := range charges {
+		if !c.start.Before(end) || !c.end.After(start) {
+			continue
+		}
+
+		labels, ok := cloud.ExternalAssetLabels(c.tags, queryLabels)
+		if !ok {
+			continue
+		}
+
+		asset := kubecost.NewCloud(c.category, c.providerID, c.start, c.end, kubecost.NewWindow(&c.start, &c.end))
+		props := asset.Properties()
+		props.Provider = c.provider
+		props.Account = c.account
+		props.Project = c.project
+		props.Service = c.service
+		props.Name = c.name
+		asset.SetLabels(labels)
+		if c.credit {
+			asset.Credit = c.cost
+		} else {
+			asset.Cost = c.cost
+		}
+		assets = append(assets, asset)
+	}
+
+	return assets, nil
+}
+
+// charges returns the charges of every export in storage, parsing those
+// which are new or modified since they were last parsed.
+func (ing *Ingester) charges() ([]*charge, error) {
+	ing.lock.Lock()
+	defer ing.lock.Unlock()
+
+	infos, err := ing.store.List("")
+	if err != nil {
+		return nil, fmt.Errorf("Ingester: error listing exports: %s", err)
+	}
+
+	files := map[string]*exportFile{}
+	var charges []*charge
+	for _, info := range infos {
+		if !strings.HasSuffix(info.Name, ".csv") && !strings.HasSuffix(info.Name, ".csv.gz") {
+			continue
+		}
+
+		file, ok := ing.files[info.Name]
+		if !ok || !file.modTime.Equal(info.ModTime) {
+			file, err = ing.parseFile(info)
+			if err != nil {
+				log.Warningf("Ingester: error parsing %s: %s", ing.store.FullPath(info.Name), err)
+				continue
+			}
+		}
+
+		files[info.Name] = file
+		charges = append(charges, file.charges...)
+	}
+	ing.files = files
+
+	return charges, nil
+}
+
+// parseFile reads and parses the export with the given StorageInfo.
+func (ing *Ingester) parseFile(info *storage.StorageInfo) (*exportFile, error) {
+	data, err := ing.store.Read(info.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader = bytes.NewReader(data)
+	if path.Ext(info.Name) == ".gz" {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	charges, err := parseCSV(csv.NewReader(reader), ing.config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &exportFile{modTime: info.ModTime, charges: charges}, nil
+}
+
+// parseCSV parses the charges of a billing export, the columns of which are
+// mapped to the standard schema by the given config. Rows which cannot be
+// parsed are skipped.
+func parseCSV(reader *csv.Reader, config *Config) ([]*charge, error) {
+	reader.FieldsPerRecord = -1
+
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %s", err)
+	}
+	headerMap := map[string]int{}
+	for i, header := range headers {
+		headerMap[strings.TrimSpace(strings.TrimPrefix(header, "\ufeff"))] = i
+	}
+
+	for _, required := range []string{ColumnChargePeriodStart, ColumnBilledCost} {
+		if _, ok := headerMap[config.column(required)]; !ok {
+			return nil, fmt.Errorf("missing column: %s", config.column(required))
+		}
+	}
+
+	// value returns the value of the given standard column of the record
+	value := func(record []string, name string) string {
+		if i, ok := headerMap[config.column(name)]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var charges []*charge
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start, err := parseTime(value(record, ColumnChargePeriodStart), config.TimeLayout)
+		if err != nil {
+			log.DedupedWarningf(5, "Ingester: failed to parse charge period start: '%s'", value(record, ColumnChargePeriodStart))
+			continue
+		}
+		end, err := parseTime(value(record, ColumnChargePeriodEnd), config.TimeLayout)
+		if err != nil || !end.After(start) {
+			// Exports without charge period ends are assumed to be daily
+			end = start.AddDate(0, 0, 1)
+		}
+
+		cost, err := strconv.ParseFloat(value(record, ColumnBilledCost), 64)
+		if err != nil {
+			log.DedupedWarningf(5, "Ingester: failed to parse cost: '%s'", value(record, ColumnBilledCost))
+			continue
+		}
+
+		tags := map[string]string{}
+		if t := value(record, ColumnTags); t != "" {
+			err = json.Unmarshal([]byte(t), &tags)
+			if err != nil {
+				log.DedupedWarningf(5, "Ingester: failed to parse tags: '%s'", t)
+			}
+		}
+		for _, col := range config.TagColumns {
+			if i, ok := headerMap[col]; ok && i < len(record) && record[i] != "" {
+				tags[col] = strings.TrimSpace(record[i])
+			}
+		}
+
+		provider := value(record, ColumnProviderName)
+		if provider == "" {
+			provider = config.Provider
+		}
+
+		charges = append(charges, &charge{
+			start:      start,
+			end:        end,
+			cost:       cost,
+			credit:     strings.ToLower(value(record, ColumnChargeCategory)) == chargeCategoryCredit,
+			provider:   provider,
+			account:    value(record, ColumnBillingAccountID),
+			project:    value(record, ColumnSubAccountID),
+			service:    value(record, ColumnServiceName),
+			category:   assetCategory(value(record, ColumnServiceCategory)),
+			providerID: value(record, ColumnResourceID),
+			name:       value(record, ColumnResourceName),
+			tags:       tags,
+		})
+	}
+
+	return charges, nil
+}
+
+// parseTime parses the given time by the given layout, or, if none is given,
+// by any of the default layouts. Times without zones are UTC.
+func parseTime(value, layout string) (time.Time, error) {
+	if layout != "" {
+		return time.Parse(layout, value)
+	}
+
+	var err error
+	for _, l := range timeLayouts {
+		var t time.Time
+		t, err = time.Parse(l, value)
+		if err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// assetCategory returns the Asset category of a FOCUS ServiceCategory.
+func assetCategory(serviceCategory string) string {
+	switch strings.ToLower(serviceCategory) {
+	case "compute":
+		return kubecost.ComputeCategory
+	case "storage":
+		return kubecost.StorageCategory
+	case "networking", "network":
+		return kubecost.NetworkCategory
+	case "management and governance", "management":
+		return kubecost.ManagementCategory
+	}
+	return kubecost.OtherCategory
+}
@@ -0,0 +1,155 @@
+package billing
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/storage"
+)
+
+const focusCSV = `BillingAccountId,SubAccountId,ChargePeriodStart,ChargePeriodEnd,ChargeCategory,BilledCost,ServiceName,ServiceCategory,ResourceId,Tags
+acct1,proj1,2021-03-01T00:00:00Z,2021-03-02T00:00:00Z,Usage,10.00,Cloud SQL,Databases,db-1,"{""kubernetes_namespace"":""db""}"
+acct1,proj1,2021-03-01T00:00:00Z,2021-03-02T00:00:00Z,Credit,-2.00,Cloud SQL,Databases,db-1,"{""kubernetes_namespace"":""db""}"
+acct1,proj1,2021-03-02T00:00:00Z,2021-03-03T00:00:00Z,Usage,12.00,Cloud SQL,Databases,db-1,"{""kubernetes_namespace"":""db""}"
+acct1,proj1,2021-03-01T00:00:00Z,2021-03-02T00:00:00Z,Usage,99.00,Compute Engine,Compute,vm-1,"{""team"":""infra""}"
+acct1,proj1,not-a-date,2021-03-02T00:00:00Z,Usage,1.00,Compute Engine,Compute,vm-1,"{""kubernetes_namespace"":""db""}"
+`
+
+const chargebackCSV = `date,amount,system,namespace
+2021-03-01,5.50,storage-array,web
+2021-03-01,3.00,storage-array,
+`
+
+func writeGzip(t *testing.T, path, data string) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(data))
+	gz.Close()
+
+	err := ioutil.WriteFile(path, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestIngester_ExternalAssets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "billing")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "focus.csv"), []byte(focusCSV), 0644)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	writeGzip(t, filepath.Join(dir, "chargeback.csv.gz"), chargebackCSV)
+	err = ioutil.WriteFile(filepath.Join(dir, "README.txt"), []byte("not an export"), 0644)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	config := &Config{
+		Path:     dir,
+		Provider: "OnPrem",
+		Columns: map[string]string{
+			ColumnChargePeriodStart: "date",
+			ColumnBilledCost:        "amount",
+			ColumnServiceName:       "system",
+		},
+		TagColumns: []string{"namespace"},
+	}
+
+	// The FOCUS export does not match the configured columns, so only the
+	// chargeback export is ingested
+	ing, err := NewIngester(storage.NewFileStorage(dir), config)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	queryLabels := map[string]string{"namespace": "namespace_external_label"}
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 3)
+	assets, err := ing.ExternalAssets(start, end, queryLabels)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(assets) != 1 {
+		t.Fatalf("expected 1 asset; got %d", len(assets))
+	}
+	asset := assets[0]
+	if asset.Properties().Provider != "OnPrem" || asset.Properties().Service != "storage-array" || asset.Labels()["namespace"] != "web" {
+		t.Fatalf("unexpected asset: %s %v", asset.Properties(), asset.Labels())
+	}
+	if asset.TotalCost() != 5.5 || !asset.Start().Equal(start) || !asset.End().Equal(start.AddDate(0, 0, 1)) {
+		t.Fatalf("expected a daily cost of 5.5 from %s; got %f from %s to %s", start, asset.TotalCost(), asset.Start(), asset.End())
+	}
+
+	// The standard columns of the FOCUS export are ingested by default
+	ing, err = NewIngester(storage.NewFileStorage(dir), &Config{Path: dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	queryLabels = map[string]string{"kubernetes_namespace": "namespace_external_label"}
+	assets, err = ing.ExternalAssets(start, start.AddDate(0, 0, 1), queryLabels)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(assets) != 2 {
+		t.Fatalf("expected 2 assets; got %d", len(assets))
+	}
+	total := 0.0
+	for _, asset := range assets {
+		props := asset.Properties()
+		if props.Account != "acct1" || props.Project != "proj1" || props.ProviderID != "db-1" || props.Category != kubecost.OtherCategory {
+			t.Fatalf("unexpected properties: %s", props)
+		}
+		if asset.Labels()["namespace"] != "db" {
+			t.Fatalf("expected label namespace=db; got %v", asset.Labels())
+		}
+		total += asset.TotalCost()
+	}
+	if math.Abs(total-8.0) > 1e-9 {
+		t.Fatalf("expected total cost 8, net of credits; got %f", total)
+	}
+
+	// Modified exports are parsed again
+	err = ioutil.WriteFile(filepath.Join(dir, "focus.csv"), []byte(focusCSV[:len(focusCSV)/2]), 0644)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "focus.csv"), later, later)
+	assets, err = ing.ExternalAssets(start, end, queryLabels)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(assets) >= 3 {
+		t.Fatalf("expected modified export to be parsed again; got %d assets", len(assets))
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	expected := time.Date(2021, time.March, 1, 12, 30, 0, 0, time.UTC)
+	for _, value := range []string{"2021-03-01T12:30:00Z", "2021-03-01T14:30:00+02:00", "2021-03-01T12:30:00", "2021-03-01 12:30:00"} {
+		t1, err := parseTime(value, "")
+		if err != nil || !t1.Equal(expected) {
+			t.Fatalf("%s: expected %s; got %s, %v", value, expected, t1, err)
+		}
+	}
+
+	t1, err := parseTime("03/01/2021 12:30", "01/02/2006 15:04")
+	if err != nil || !t1.Equal(expected) {
+		t.Fatalf("layout: expected %s; got %s, %v", expected, t1, err)
+	}
+
+	if _, err := parseTime("yesterday", ""); err == nil {
+		t.Fatalf("expected error")
+	}
+}
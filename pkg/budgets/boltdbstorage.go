@@ -0,0 +1,71 @@
+package budgets
+
+import (
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltDBBudgetStorage is a BudgetStorage persisted in a bucket of a BoltDB.
+type BoltDBBudgetStorage struct {
+	bucket []byte
+	db     *bolt.DB
+}
+
+func NewBoltDBBudgetStorage(bucket string, db *bolt.DB) (BudgetStorage, error) {
+	bucketKey := []byte(bucket)
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketKey)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &BoltDBBudgetStorage{
+		bucket: bucketKey,
+		db:     db,
+	}, nil
+}
+
+// Adds the encoded value to storage if it doesn't exist. Otherwise, update the existing
+// value with the provided.
+func (bs *BoltDBBudgetStorage) AddOrUpdate(key string, value []byte) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bs.bucket)
+
+		return bucket.Put([]byte(key), value)
+	})
+}
+
+// Removes a key from the storage
+func (bs *BoltDBBudgetStorage) Remove(key string) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bs.bucket)
+
+		return bucket.Delete([]byte(key))
+	})
+}
+
+// Iterates through all key/values for the storage and calls the handler func. If a handler returns
+// an error, the iteration stops.
+func (bs *BoltDBBudgetStorage) Each(handler func(string, []byte) error) error {
+	return bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bs.bucket)
+
+		return bucket.ForEach(func(k, v []byte) error {
+			// Allow the bytes to live outside transaction by copy
+			key := make([]byte, len(k))
+			value := make([]byte, len(v))
+
+			copy(key, k)
+			copy(value, v)
+
+			return handler(string(key), value)
+		})
+	})
+}
+
+// Closes the backing storage
+func (bs *BoltDBBudgetStorage) Close() error {
+	return bs.db.Close()
+}
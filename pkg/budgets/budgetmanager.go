@@ -0,0 +1,441 @@
+package budgets
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/kubecost/cost-model/pkg/errors"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/util/json"
+)
+
+// AllocationComputer computes the AllocationSet of a window, against which
+// budgets are evaluated.
+type AllocationComputer interface {
+	ComputeAllocation(start, end time.Time, resolution time.Duration) (*kubecost.AllocationSet, error)
+}
+
+// BudgetManagerConfig configures the evaluation of budgets.
+type BudgetManagerConfig struct {
+	// Resolution is the resolution at which allocations are computed
+	Resolution time.Duration
+
+	// Interval is the time between evaluations of every budget
+	Interval time.Duration
+
+	// UTCOffset defines the time zone in which budget periods begin
+	UTCOffset time.Duration
+}
+
+// BudgetStatus is the result of the most recent evaluation of a Budget,
+// over the Budget's current period.
+type BudgetStatus struct {
+	ID             string       `json:"id"`
+	Name           string       `json:"name"`
+	Start          time.Time    `json:"start"`
+	End            time.Time    `json:"end"`
+	Amount         float64      `json:"amount"`
+	Spend          float64      `json:"spend"`
+	PercentUsed    float64      `json:"percentUsed"`
+	ProjectedSpend float64      `json:"projectedSpend"`
+	Alerted        []float64    `json:"alerted"`
+	LastEvaluated  time.Time    `json:"lastEvaluated"`
+	LastAlert      *BudgetAlert `json:"lastAlert,omitempty"`
+	Error          string       `json:"error,omitempty"`
+}
+
+// BudgetAlert is sent to each of a Budget's notifications when its spend
+// crosses one or more of its thresholds within a period.
+type BudgetAlert struct {
+	BudgetID       string    `json:"budgetId"`
+	BudgetName     string    `json:"budgetName"`
+	Property       string    `json:"property"`
+	Value          string    `json:"value"`
+	Period         string    `json:"period"`
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	Threshold      float64   `json:"threshold"`
+	Amount         float64   `json:"amount"`
+	Spend          float64   `json:"spend"`
+	PercentUsed    float64   `json:"percentUsed"`
+	ProjectedSpend float64   `json:"projectedSpend"`
+	Message        string    `json:"message"`
+	Time           time.Time `json:"time"`
+}
+
+// BudgetManager stores Budgets and their statuses, and periodically
+// evaluates each Budget against the allocations of its current period,
+// sending alerts as thresholds are crossed.
+type BudgetManager struct {
+	lock          sync.Mutex
+	storage       BudgetStorage
+	statusStorage BudgetStorage
+	computer      AllocationComputer
+	config        BudgetManagerConfig
+	loc           *time.Location
+	notifier      *notifier
+	stop          chan struct{}
+}
+
+// Creates a new BudgetManager instance, storing Budgets and their statuses
+// in the provided storages
+func NewBudgetManager(storage, statusStorage BudgetStorage, computer AllocationComputer, config BudgetManagerConfig) *BudgetManager {
+	return &BudgetManager{
+		storage:       storage,
+		statusStorage: statusStorage,
+		computer:      computer,
+		config:        config,
+		loc:           time.FixedZone("", int(config.UTCOffset.Seconds())),
+		notifier:      newNotifier(),
+	}
+}
+
+// AddOrUpdate validates and stores the given Budget, assigning it an ID if
+// it does not have one.
+func (bm *BudgetManager) AddOrUpdate(budget Budget) (*Budget, error) {
+	err := budget.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	// First time add
+	if budget.ID == "" {
+		budget.ID = uuid.New().String()
+	}
+
+	data, err := json.Marshal(budget)
+	if err != nil {
+		return nil, err
+	}
+
+	bm.lock.Lock()
+	defer bm.lock.Unlock()
+
+	err = bm.storage.AddOrUpdate(budget.ID, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &budget, nil
+}
+
+// Remove deletes the Budget with the given ID, and its status.
+func (bm *BudgetManager) Remove(id string) error {
+	bm.lock.Lock()
+	defer bm.lock.Unlock()
+
+	err := bm.storage.Remove(id)
+	if err != nil {
+		return err
+	}
+
+	return bm.statusStorage.Remove(id)
+}
+
+// GetAll returns every Budget, sorted by name.
+func (bm *BudgetManager) GetAll() []*Budget {
+	budgets := []*Budget{}
+
+	err := bm.storage.Each(func(key string, data []byte) error {
+		var b Budget
+		err := json.Unmarshal(data, &b)
+		if err != nil {
+			log.Warningf("Budgets: failed to unmarshal budget for key: %s", key)
+			return nil
+		}
+
+		budgets = append(budgets, &b)
+		return nil
+	})
+	if err != nil {
+		log.Errorf("Budgets: failed to load budgets: %s", err)
+	}
+
+	sort.Slice(budgets, func(i, j int) bool {
+		if budgets[i].Name == budgets[j].Name {
+			return budgets[i].ID < budgets[j].ID
+		}
+		return budgets[i].Name < budgets[j].Name
+	})
+
+	return budgets
+}
+
+// Status returns the BudgetStatus of every Budget, sorted by name. Budgets
+// which have not yet been evaluated are omitted.
+func (bm *BudgetManager) Status() []*BudgetStatus {
+	statuses := bm.statuses()
+
+	result := []*BudgetStatus{}
+	for _, b := range bm.GetAll() {
+		if status, ok := statuses[b.ID]; ok {
+			result = append(result, status)
+		}
+	}
+
+	return result
+}
+
+// statuses returns the stored BudgetStatus of each Budget, keyed by ID.
+func (bm *BudgetManager) statuses() map[string]*BudgetStatus {
+	statuses := map[string]*BudgetStatus{}
+
+	err := bm.statusStorage.Each(func(key string, data []byte) error {
+		var s BudgetStatus
+		err := json.Unmarshal(data, &s)
+		if err != nil {
+			log.Warningf("Budgets: failed to unmarshal budget status for key: %s", key)
+			return nil
+		}
+
+		statuses[key] = &s
+		return nil
+	})
+	if err != nil {
+		log.Errorf("Budgets: failed to load budget statuses: %s", err)
+	}
+
+	return statuses
+}
+
+// Start evaluates every Budget at the configured interval, in the
+// background, until Stop is called.
+func (bm *BudgetManager) Start() {
+	bm.stop = make(chan struct{})
+
+	go func(stop chan struct{}) {
+		defer errors.HandlePanic()
+
+		for {
+			bm.Evaluate(time.Now())
+
+			select {
+			case <-stop:
+				return
+			case <-time.After(bm.config.Interval):
+			}
+		}
+	}(bm.stop)
+}
+
+// Stop stops the background evaluation started by Start.
+func (bm *BudgetManager) Stop() {
+	if bm.stop != nil {
+		close(bm.stop)
+		bm.stop = nil
+	}
+}
+
+// Close closes the backing storages.
+func (bm *BudgetManager) Close() error {
+	err := bm.storage.Close()
+	if err != nil {
+		return err
+	}
+	return bm.statusStorage.Close()
+}
+
+// Evaluate computes the spend of every Budget over its period, up to the
+// given time, and sends an alert for each Budget which has crossed one or
+// more of its thresholds since it was last alerted in the period.
+func (bm *BudgetManager) Evaluate(now time.Time) {
+	now = now.In(bm.loc)
+
+	budgets := bm.GetAll()
+	statuses := bm.statuses()
+
+	// Compute each distinct period's allocations only once, no matter how
+	// many budgets share the period
+	sets := map[string]*kubecost.AllocationSet{}
+	errs := map[string]error{}
+
+	ids := map[string]bool{}
+	for _, b := range budgets {
+		ids[b.ID] = true
+
+		window := b.PeriodWindow(now)
+		key := window.String()
+		if _, ok := sets[key]; !ok && errs[key] == nil {
+			sets[key], errs[key] = bm.compute(window, now)
+		}
+
+		status := bm.evaluate(b, statuses[b.ID], window, now, sets[key], errs[key])
+
+		bm.saveStatus(b.ID, status)
+	}
+
+	// Delete the statuses of budgets that no longer exist
+	for id := range statuses {
+		if !ids[id] {
+			bm.lock.Lock()
+			bm.statusStorage.Remove(id)
+			bm.lock.Unlock()
+		}
+	}
+}
+
+// compute returns the AllocationSet of the given period, up to the given
+// time, rounded back to the configured resolution. The completed days of the
+// period are computed separately from the current, partial day, so that they
+// are day-aligned and can be served by the ETL; only the partial day needs
+// to be queried from Prometheus.
+func (bm *BudgetManager) compute(window kubecost.Window, now time.Time) (*kubecost.AllocationSet, error) {
+	start := *window.Start()
+	end := kubecost.RoundBack(now, bm.config.Resolution)
+	if end.After(*window.End()) {
+		end = *window.End()
+	}
+	if !end.After(start) {
+		return kubecost.NewAllocationSet(start, start), nil
+	}
+
+	today := kubecost.RoundBack(end, 24*time.Hour)
+	if !today.After(start) || !today.Before(end) {
+		return bm.computer.ComputeAllocation(start, end, bm.config.Resolution)
+	}
+
+	days, err := bm.computer.ComputeAllocation(start, today, bm.config.Resolution)
+	if err != nil {
+		return nil, err
+	}
+
+	partial, err := bm.computer.ComputeAllocation(today, end, bm.config.Resolution)
+	if err != nil {
+		return nil, err
+	}
+
+	return kubecost.NewAllocationSetRange(days, partial).Accumulate()
+}
+
+// evaluate returns the new BudgetStatus of the given Budget, given its
+// previous status (which may be nil) and the AllocationSet of its period,
+// sending an alert if a threshold has been crossed.
+func (bm *BudgetManager) evaluate(b *Budget, prev *BudgetStatus, window kubecost.Window, now time.Time, as *kubecost.AllocationSet, err error) *BudgetStatus {
+	status := &BudgetStatus{
+		ID:            b.ID,
+		Name:          b.Name,
+		Start:         *window.Start(),
+		End:           *window.End(),
+		Amount:        b.Amount,
+		Alerted:       []float64{},
+		LastEvaluated: now,
+	}
+
+	// Carry over the thresholds already alerted within the same period
+	if prev != nil && prev.Start.Equal(status.Start) {
+		status.Alerted = prev.Alerted
+		status.LastAlert = prev.LastAlert
+	}
+
+	if err != nil {
+		status.Error = err.Error()
+		if prev != nil && prev.Start.Equal(status.Start) {
+			status.Spend = prev.Spend
+			status.PercentUsed = prev.PercentUsed
+			status.ProjectedSpend = prev.ProjectedSpend
+		}
+		log.Warningf("Budgets: %s: error computing allocation: %s", b.Name, err)
+		return status
+	}
+
+	as.Each(func(name string, alloc *kubecost.Allocation) {
+		if b.Matches(alloc) {
+			status.Spend += alloc.TotalCost()
+		}
+	})
+	status.PercentUsed = 100.0 * status.Spend / b.Amount
+
+	// Project spend linearly over the remainder of the period
+	status.ProjectedSpend = status.Spend
+	if elapsed := as.End().Sub(status.Start); elapsed > 0 {
+		status.ProjectedSpend = status.Spend * float64(status.End.Sub(status.Start)) / float64(elapsed)
+	}
+
+	// Alert once, for the highest threshold crossed since the last alert
+	alerted := map[float64]bool{}
+	for _, t := range status.Alerted {
+		alerted[t] = true
+	}
+	crossed := 0.0
+	for _, t := range b.thresholds() {
+		if status.PercentUsed >= t && !alerted[t] {
+			crossed = t
+			status.Alerted = append(status.Alerted, t)
+		}
+	}
+	if crossed > 0 {
+		alert := newBudgetAlert(b, status, crossed, now)
+		status.LastAlert = alert
+		bm.notify(b, alert)
+	}
+
+	return status
+}
+
+// notify sends the given alert to each of the Budget's notifications.
+func (bm *BudgetManager) notify(b *Budget, alert *BudgetAlert) {
+	log.Infof("Budgets: %s", alert.Message)
+
+	for _, n := range b.Notifications {
+		err := bm.notifier.notify(n, alert)
+		if err != nil {
+			log.Warningf("Budgets: %s: failed to send %s notification: %s", b.Name, n.Type, err)
+		}
+	}
+}
+
+// saveStatus stores the given status, unless the Budget has been removed
+// since the evaluation began.
+func (bm *BudgetManager) saveStatus(id string, status *BudgetStatus) {
+	data, err := json.Marshal(status)
+	if err != nil {
+		log.Warningf("Budgets: failed to marshal status of %s: %s", status.Name, err)
+		return
+	}
+
+	bm.lock.Lock()
+	defer bm.lock.Unlock()
+
+	exists := false
+	bm.storage.Each(func(key string, _ []byte) error {
+		if key == id {
+			exists = true
+		}
+		return nil
+	})
+	if !exists {
+		return
+	}
+
+	err = bm.statusStorage.AddOrUpdate(id, data)
+	if err != nil {
+		log.Warningf("Budgets: failed to store status of %s: %s", status.Name, err)
+	}
+}
+
+// newBudgetAlert creates the alert of the given Budget crossing the given
+// threshold.
+func newBudgetAlert(b *Budget, status *BudgetStatus, threshold float64, now time.Time) *BudgetAlert {
+	return &BudgetAlert{
+		BudgetID:       b.ID,
+		BudgetName:     b.Name,
+		Property:       b.Property,
+		Value:          b.Value,
+		Period:         b.Period,
+		Start:          status.Start,
+		End:            status.End,
+		Threshold:      threshold,
+		Amount:         b.Amount,
+		Spend:          status.Spend,
+		PercentUsed:    status.PercentUsed,
+		ProjectedSpend: status.ProjectedSpend,
+		Message: fmt.Sprintf("Budget %q for %s %q has reached %.0f%% of its %s amount: %.2f of %.2f spent since %s (projected %.2f)",
+			b.Name, b.Property, b.Value, threshold, b.Period, status.Spend, b.Amount, status.Start.Format("2006-01-02"), status.ProjectedSpend),
+		Time: now,
+	}
+}
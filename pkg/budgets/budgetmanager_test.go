@@ -0,0 +1,260 @@
+package budgets
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/util/json"
+)
+
+// mockAllocationComputer returns a single allocation in the "web" namespace
+// costing the given amount per hour, and records the windows requested of it.
+type mockAllocationComputer struct {
+	hourlyCost float64
+	calls      int
+	windows    []kubecost.Window
+	err        error
+}
+
+func (mac *mockAllocationComputer) ComputeAllocation(start, end time.Time, resolution time.Duration) (*kubecost.AllocationSet, error) {
+	mac.calls++
+	mac.windows = append(mac.windows, kubecost.NewWindow(&start, &end))
+	if mac.err != nil {
+		return nil, mac.err
+	}
+
+	alloc := &kubecost.Allocation{
+		Name:       "web",
+		Start:      start,
+		End:        end,
+		Properties: &kubecost.AllocationProperties{Namespace: "web"},
+		CPUCost:    mac.hourlyCost * end.Sub(start).Hours(),
+	}
+	return kubecost.NewAllocationSet(start, end, alloc), nil
+}
+
+// mockNotificationServer records the body of each request made to it.
+type mockNotificationServer struct {
+	sync.Mutex
+	*httptest.Server
+	bodies []string
+}
+
+func newMockNotificationServer() *mockNotificationServer {
+	mns := &mockNotificationServer{}
+	mns.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mns.Lock()
+		mns.bodies = append(mns.bodies, string(body))
+		mns.Unlock()
+	}))
+	return mns
+}
+
+func newTestBudgetManager(computer AllocationComputer) *BudgetManager {
+	return NewBudgetManager(NewMapDBBudgetStorage(), NewMapDBBudgetStorage(), computer, BudgetManagerConfig{
+		Resolution: time.Hour,
+		Interval:   time.Hour,
+	})
+}
+
+func TestBudgetManager_CRUD(t *testing.T) {
+	bm := newTestBudgetManager(&mockAllocationComputer{})
+
+	_, err := bm.AddOrUpdate(Budget{Name: "invalid"})
+	if err == nil {
+		t.Fatalf("expected error adding invalid budget")
+	}
+
+	b, err := bm.AddOrUpdate(Budget{Name: "web", Property: PropertyNamespace, Value: "web", Amount: 100.0, Period: PeriodDaily})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b.ID == "" {
+		t.Fatalf("expected ID to be assigned")
+	}
+
+	b.Amount = 200.0
+	_, err = bm.AddOrUpdate(*b)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	all := bm.GetAll()
+	if len(all) != 1 || all[0].Amount != 200.0 {
+		t.Fatalf("expected 1 budget with amount 200; got %+v", all)
+	}
+
+	err = bm.Remove(b.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(bm.GetAll()) != 0 {
+		t.Fatalf("expected no budgets")
+	}
+}
+
+func TestBudgetManager_Evaluate(t *testing.T) {
+	server := newMockNotificationServer()
+	defer server.Close()
+
+	// $10/hour against a $240/day budget with thresholds at 50% and 100%
+	computer := &mockAllocationComputer{hourlyCost: 10.0}
+	bm := newTestBudgetManager(computer)
+
+	web, err := bm.AddOrUpdate(Budget{
+		Name:       "web",
+		Property:   PropertyNamespace,
+		Value:      "web",
+		Amount:     240.0,
+		Period:     PeriodDaily,
+		Thresholds: []float64{50.0, 100.0},
+		Notifications: []BudgetNotification{
+			{Type: NotificationWebhook, URL: server.URL},
+			{Type: NotificationSlack, URL: server.URL},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Never matches, but shares the daily period
+	_, err = bm.AddOrUpdate(Budget{Name: "kubecost", Property: PropertyNamespace, Value: "kubecost", Amount: 10.0, Period: PeriodDaily})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	day := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	// 06:00: $60 spent; 25% used; no alert
+	bm.Evaluate(day.Add(6 * time.Hour))
+	if computer.calls != 1 {
+		t.Fatalf("expected shared period to be computed once; got %d calls", computer.calls)
+	}
+
+	status := bm.Status()
+	if len(status) != 2 {
+		t.Fatalf("expected 2 statuses; got %d", len(status))
+	}
+	s := status[1]
+	if s.ID != web.ID || s.Spend != 60.0 || s.PercentUsed != 25.0 || s.ProjectedSpend != 240.0 {
+		t.Fatalf("unexpected status: %+v", s)
+	}
+	if s.LastAlert != nil || len(server.bodies) != 0 {
+		t.Fatalf("expected no alert")
+	}
+	if status[0].Spend != 0.0 || status[0].LastAlert != nil {
+		t.Fatalf("expected no spend on kubecost: %+v", status[0])
+	}
+
+	// 12:30: $120 spent (rounded back to 12:00); 50% used; alert at 50%
+	bm.Evaluate(day.Add(12*time.Hour + 30*time.Minute))
+	s = bm.Status()[1]
+	if s.LastAlert == nil || s.LastAlert.Threshold != 50.0 {
+		t.Fatalf("expected alert at 50%%; got %+v", s.LastAlert)
+	}
+	if len(server.bodies) != 2 {
+		t.Fatalf("expected 2 notifications; got %d", len(server.bodies))
+	}
+
+	alert := &BudgetAlert{}
+	err = json.Unmarshal([]byte(server.bodies[0]), alert)
+	if err != nil || alert.BudgetID != web.ID || alert.Spend != 120.0 {
+		t.Fatalf("unexpected webhook payload: %s", server.bodies[0])
+	}
+	if !strings.Contains(server.bodies[1], `"text":`) || !strings.Contains(server.bodies[1], "50%") {
+		t.Fatalf("unexpected slack payload: %s", server.bodies[1])
+	}
+
+	// 13:00: still over 50%, but already alerted
+	bm.Evaluate(day.Add(13 * time.Hour))
+	if len(server.bodies) != 2 {
+		t.Fatalf("expected no new notifications; got %d", len(server.bodies))
+	}
+
+	// Next day 00:00 marks a new period; the previous day's spend is not
+	// counted, and thresholds are reset
+	bm.Evaluate(day.Add(24 * time.Hour))
+	s = bm.Status()[1]
+	if s.Spend != 0.0 || len(s.Alerted) != 0 || s.LastAlert != nil {
+		t.Fatalf("expected reset status for new period; got %+v", s)
+	}
+
+	// Next day 23:00 at $20/hour: $460 spent; crosses both thresholds, but
+	// alerts once, for the highest
+	computer.hourlyCost = 20.0
+	bm.Evaluate(day.Add(47 * time.Hour))
+	s = bm.Status()[1]
+	if s.LastAlert == nil || s.LastAlert.Threshold != 100.0 {
+		t.Fatalf("expected alert at 100%%; got %+v", s.LastAlert)
+	}
+	if len(s.Alerted) != 2 || len(server.bodies) != 4 {
+		t.Fatalf("expected one more alert; got alerted %v and %d notifications", s.Alerted, len(server.bodies))
+	}
+}
+
+func TestBudgetManager_EvaluateDayAligned(t *testing.T) {
+	computer := &mockAllocationComputer{hourlyCost: 10.0}
+	bm := newTestBudgetManager(computer)
+
+	_, err := bm.AddOrUpdate(Budget{Name: "web", Property: PropertyNamespace, Value: "web", Amount: 10000.0, Period: PeriodMonthly})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// March 3rd 06:30: the two completed days are computed separately from
+	// the partial day, so that they can be served by the ETL
+	month := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	bm.Evaluate(month.Add(54*time.Hour + 30*time.Minute))
+
+	if len(computer.windows) != 2 {
+		t.Fatalf("expected 2 computations; got %d", len(computer.windows))
+	}
+	days, partial := computer.windows[0], computer.windows[1]
+	if !days.Start().Equal(month) || !days.End().Equal(month.Add(48*time.Hour)) {
+		t.Fatalf("unexpected completed days window: %s", days)
+	}
+	if !partial.Start().Equal(month.Add(48*time.Hour)) || !partial.End().Equal(month.Add(54*time.Hour)) {
+		t.Fatalf("unexpected partial day window: %s", partial)
+	}
+
+	status := bm.Status()
+	if len(status) != 1 || status[0].Spend != 540.0 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+}
+
+func TestBudgetManager_EvaluateError(t *testing.T) {
+	computer := &mockAllocationComputer{hourlyCost: 10.0}
+	bm := newTestBudgetManager(computer)
+
+	b, err := bm.AddOrUpdate(Budget{Name: "web", Property: PropertyNamespace, Value: "web", Amount: 240.0, Period: PeriodDaily})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	day := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	bm.Evaluate(day.Add(6 * time.Hour))
+
+	// Failing to compute keeps the previous spend, and records the error
+	computer.err = fmt.Errorf("prometheus unavailable")
+	bm.Evaluate(day.Add(7 * time.Hour))
+
+	status := bm.Status()
+	if len(status) != 1 || status[0].Spend != 60.0 || status[0].Error == "" {
+		t.Fatalf("unexpected status: %+v", status[0])
+	}
+
+	// Removing the budget removes its status
+	bm.Remove(b.ID)
+	if len(bm.statuses()) != 0 {
+		t.Fatalf("expected status to be removed")
+	}
+}
@@ -0,0 +1,196 @@
+package budgets
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/prom"
+)
+
+// Properties to which a budget may apply
+const (
+	PropertyCluster    = "cluster"
+	PropertyNamespace  = "namespace"
+	PropertyController = "controller"
+	PropertyLabel      = "label"
+)
+
+// Periods over which a budget's amount is allowed to be spent
+const (
+	PeriodDaily   = "daily"
+	PeriodWeekly  = "weekly"
+	PeriodMonthly = "monthly"
+)
+
+// Types of BudgetNotification
+const (
+	NotificationWebhook = "webhook"
+	NotificationSlack   = "slack"
+)
+
+// DefaultThresholds are the threshold percentages of a budget which does not
+// define any.
+var DefaultThresholds = []float64{100.0}
+
+// BudgetNotification defines an endpoint which is notified when a budget
+// crosses one of its thresholds: either a generic webhook, which receives
+// the BudgetAlert as JSON, or a Slack incoming webhook, which receives a
+// formatted message.
+type BudgetNotification struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// Budget defines an amount which may be spent, per period, by the
+// allocations matching a single property value; e.g. the namespace
+// "kubecost", or the label "app:web". Controllers may be given with or
+// without their kind; e.g. "deployment:cost-analyzer" or "cost-analyzer".
+// Thresholds are percentages of the amount, crossing each of which sends
+// an alert to each of the notifications.
+type Budget struct {
+	ID            string               `json:"id,omitempty"`
+	Name          string               `json:"name"`
+	Property      string               `json:"property"`
+	Value         string               `json:"value"`
+	Amount        float64              `json:"amount"`
+	Period        string               `json:"period"`
+	Thresholds    []float64            `json:"thresholds,omitempty"`
+	Notifications []BudgetNotification `json:"notifications,omitempty"`
+}
+
+// Validate returns an error if the Budget is not well-defined, sorts its
+// thresholds in increasing order, and sanitizes its label name, if any.
+func (b *Budget) Validate() error {
+	if strings.TrimSpace(b.Name) == "" {
+		return fmt.Errorf("budget name is required")
+	}
+
+	switch b.Property {
+	case PropertyCluster, PropertyNamespace, PropertyController:
+		if b.Value == "" {
+			return fmt.Errorf("budget value is required")
+		}
+	case PropertyLabel:
+		kv := strings.SplitN(b.Value, ":", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("budget label must be of the form name:value; got %q", b.Value)
+		}
+		// Allocation labels are keyed by their sanitized Prometheus names,
+		// e.g. app.kubernetes.io/name becomes app_kubernetes_io_name
+		b.Value = fmt.Sprintf("%s:%s", prom.SanitizeLabelName(strings.TrimSpace(kv[0])), strings.TrimSpace(kv[1]))
+	default:
+		return fmt.Errorf("unsupported budget property: %q", b.Property)
+	}
+
+	if b.Amount <= 0 {
+		return fmt.Errorf("budget amount must be positive; got %f", b.Amount)
+	}
+
+	switch b.Period {
+	case PeriodDaily, PeriodWeekly, PeriodMonthly:
+	default:
+		return fmt.Errorf("unsupported budget period: %q", b.Period)
+	}
+
+	for _, t := range b.Thresholds {
+		if t <= 0 {
+			return fmt.Errorf("budget thresholds must be positive; got %f", t)
+		}
+	}
+	sort.Float64s(b.Thresholds)
+
+	for _, n := range b.Notifications {
+		if n.Type != NotificationWebhook && n.Type != NotificationSlack {
+			return fmt.Errorf("unsupported notification type: %q", n.Type)
+		}
+		u, err := url.Parse(n.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("illegal notification url: %q", n.URL)
+		}
+	}
+
+	return nil
+}
+
+// thresholds returns the Budget's thresholds, or the default thresholds if
+// it defines none.
+func (b *Budget) thresholds() []float64 {
+	if len(b.Thresholds) == 0 {
+		return DefaultThresholds
+	}
+	return b.Thresholds
+}
+
+// Matches returns true if the given Allocation matches the Budget's property
+// value, and so counts towards its spend.
+func (b *Budget) Matches(alloc *kubecost.Allocation) bool {
+	props := alloc.Properties
+	if props == nil {
+		return false
+	}
+
+	switch b.Property {
+	case PropertyCluster:
+		return props.Cluster == b.Value
+	case PropertyNamespace:
+		return props.Namespace == b.Value
+	case PropertyController:
+		if i := strings.Index(b.Value, ":"); i >= 0 {
+			return strings.EqualFold(props.ControllerKind, b.Value[:i]) && props.Controller == b.Value[i+1:]
+		}
+		return props.Controller == b.Value
+	case PropertyLabel:
+		kv := strings.SplitN(b.Value, ":", 2)
+		if len(kv) != 2 {
+			return false
+		}
+		v, ok := props.Labels[prom.SanitizeLabelName(kv[0])]
+		return ok && v == kv[1]
+	}
+
+	return false
+}
+
+// PeriodWindow returns the window of the Budget's period containing the
+// given time, evaluated in the location of the given time. Weeks begin on
+// Sunday.
+func (b *Budget) PeriodWindow(t time.Time) kubecost.Window {
+	loc := t.Location()
+
+	var start, end time.Time
+	switch b.Period {
+	case PeriodWeekly:
+		start = time.Date(t.Year(), t.Month(), t.Day()-int(t.Weekday()), 0, 0, 0, 0, loc)
+		end = start.AddDate(0, 0, 7)
+	case PeriodMonthly:
+		start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		end = start.AddDate(0, 1, 0)
+	default:
+		start = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		end = start.AddDate(0, 0, 1)
+	}
+
+	return kubecost.NewWindow(&start, &end)
+}
+
+// BudgetStorage interface defines an implementation prototype for a storage
+// responsible for encoded Budget and BudgetStatus instances
+type BudgetStorage interface {
+	// Adds the encoded value to storage if it doesn't exist. Otherwise, update the existing
+	// value with the provided.
+	AddOrUpdate(key string, value []byte) error
+
+	// Removes a key from the storage
+	Remove(key string) error
+
+	// Iterates through all key/values for the storage and calls the handler func. If a handler returns
+	// an error, the iteration stops.
+	Each(handler func(string, []byte) error) error
+
+	// Closes the backing storage
+	Close() error
+}
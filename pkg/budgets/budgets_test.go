@@ -0,0 +1,133 @@
+package budgets
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/kubecost"
+)
+
+func TestBudget_Validate(t *testing.T) {
+	valid := func() *Budget {
+		return &Budget{
+			Name:       "web",
+			Property:   PropertyNamespace,
+			Value:      "web",
+			Amount:     100.0,
+			Period:     PeriodMonthly,
+			Thresholds: []float64{100.0, 50.0},
+			Notifications: []BudgetNotification{
+				{Type: NotificationSlack, URL: "https://hooks.slack.com/services/T/B/X"},
+			},
+		}
+	}
+
+	b := valid()
+	if err := b.Validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b.Thresholds[0] != 50.0 || b.Thresholds[1] != 100.0 {
+		t.Fatalf("expected sorted thresholds; got %v", b.Thresholds)
+	}
+
+	b = valid()
+	b.Property = PropertyLabel
+	b.Value = "app.kubernetes.io/name: web"
+	if err := b.Validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b.Value != "app_kubernetes_io_name:web" {
+		t.Fatalf("expected sanitized label; got %q", b.Value)
+	}
+
+	cases := map[string]func(b *Budget){
+		"missing name":      func(b *Budget) { b.Name = " " },
+		"illegal property":  func(b *Budget) { b.Property = "pod" },
+		"missing value":     func(b *Budget) { b.Value = "" },
+		"illegal label":     func(b *Budget) { b.Property = PropertyLabel; b.Value = "app" },
+		"zero amount":       func(b *Budget) { b.Amount = 0 },
+		"illegal period":    func(b *Budget) { b.Period = "yearly" },
+		"illegal threshold": func(b *Budget) { b.Thresholds = []float64{-10.0} },
+		"illegal type":      func(b *Budget) { b.Notifications[0].Type = "email" },
+		"illegal url":       func(b *Budget) { b.Notifications[0].URL = "hooks.slack.com" },
+	}
+	for name, modify := range cases {
+		b := valid()
+		modify(b)
+		if err := b.Validate(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestBudget_Matches(t *testing.T) {
+	alloc := &kubecost.Allocation{
+		Name: "cluster1/node1/web/web-abc/nginx",
+		Properties: &kubecost.AllocationProperties{
+			Cluster:        "cluster1",
+			Namespace:      "web",
+			ControllerKind: "deployment",
+			Controller:     "web",
+			Labels:         map[string]string{"app": "nginx", "app_kubernetes_io_name": "web"},
+		},
+	}
+
+	cases := []struct {
+		property string
+		value    string
+		expected bool
+	}{
+		{PropertyCluster, "cluster1", true},
+		{PropertyCluster, "cluster2", false},
+		{PropertyNamespace, "web", true},
+		{PropertyNamespace, "kubecost", false},
+		{PropertyController, "web", true},
+		{PropertyController, "deployment:web", true},
+		{PropertyController, "statefulset:web", false},
+		{PropertyLabel, "app:nginx", true},
+		{PropertyLabel, "app:web", false},
+		{PropertyLabel, "env:nginx", false},
+		{PropertyLabel, "app.kubernetes.io/name:web", true},
+		{PropertyLabel, "app_kubernetes_io_name:web", true},
+	}
+
+	for _, c := range cases {
+		b := &Budget{Property: c.property, Value: c.value}
+		if actual := b.Matches(alloc); actual != c.expected {
+			t.Errorf("%s=%s: expected %t; got %t", c.property, c.value, c.expected, actual)
+		}
+	}
+
+	if (&Budget{Property: PropertyNamespace, Value: "web"}).Matches(&kubecost.Allocation{}) {
+		t.Errorf("expected allocation without properties not to match")
+	}
+}
+
+func TestBudget_PeriodWindow(t *testing.T) {
+	loc := time.FixedZone("UTC-6", -6*60*60)
+
+	// Wednesday, March 10, 2021
+	now := time.Date(2021, time.March, 10, 15, 30, 0, 0, loc)
+
+	cases := map[string][2]time.Time{
+		PeriodDaily: {
+			time.Date(2021, time.March, 10, 0, 0, 0, 0, loc),
+			time.Date(2021, time.March, 11, 0, 0, 0, 0, loc),
+		},
+		PeriodWeekly: {
+			time.Date(2021, time.March, 7, 0, 0, 0, 0, loc),
+			time.Date(2021, time.March, 14, 0, 0, 0, 0, loc),
+		},
+		PeriodMonthly: {
+			time.Date(2021, time.March, 1, 0, 0, 0, 0, loc),
+			time.Date(2021, time.April, 1, 0, 0, 0, 0, loc),
+		},
+	}
+
+	for period, expected := range cases {
+		w := (&Budget{Period: period}).PeriodWindow(now)
+		if !w.Start().Equal(expected[0]) || !w.End().Equal(expected[1]) {
+			t.Errorf("%s: expected %s to %s; got %s", period, expected[0], expected[1], w)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package budgets
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/util/json"
+)
+
+// DataEnvelope is a generic wrapper struct for http response data
+type DataEnvelope struct {
+	Code   int         `json:"code"`
+	Status string      `json:"status"`
+	Data   interface{} `json:"data"`
+}
+
+type BudgetEndpoints struct {
+	manager *BudgetManager
+}
+
+func NewBudgetEndpoints(manager *BudgetManager) *BudgetEndpoints {
+	return &BudgetEndpoints{
+		manager: manager,
+	}
+}
+
+// GetAllBudgets returns every Budget.
+func (be *BudgetEndpoints) GetAllBudgets(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	w.Write(wrapData(be.manager.GetAll(), nil))
+}
+
+// PutBudget creates or updates the Budget in the request body. Budgets
+// without an ID are created with a new ID.
+func (be *BudgetEndpoints) PutBudget(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.Write(wrapData(nil, err))
+		return
+	}
+
+	var budget Budget
+	err = json.Unmarshal(data, &budget)
+	if err != nil {
+		w.Write(wrapData(nil, err))
+		return
+	}
+
+	b, err := be.manager.AddOrUpdate(budget)
+	if err != nil {
+		w.Write(wrapData(nil, err))
+		return
+	}
+
+	w.Write(wrapData(b, nil))
+}
+
+// DeleteBudget deletes the Budget with the given ID.
+func (be *BudgetEndpoints) DeleteBudget(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	budgetID := ps.ByName("id")
+	if budgetID == "" {
+		w.Write(wrapData(nil, errors.New("Failed to locate budget with empty id.")))
+		return
+	}
+
+	err := be.manager.Remove(budgetID)
+	if err != nil {
+		w.Write(wrapData(nil, err))
+		return
+	}
+
+	w.Write(wrapData("success", nil))
+}
+
+// GetBudgetStatus returns the most recent BudgetStatus of every Budget.
+func (be *BudgetEndpoints) GetBudgetStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	w.Write(wrapData(be.manager.Status(), nil))
+}
+
+func wrapData(data interface{}, err error) []byte {
+	var resp []byte
+
+	if err != nil {
+		log.Infof("Error returned to client: %s", err.Error())
+		resp, _ = json.Marshal(&DataEnvelope{
+			Code:   http.StatusInternalServerError,
+			Status: "error",
+			Data:   err.Error(),
+		})
+	} else {
+		resp, _ = json.Marshal(&DataEnvelope{
+			Code:   http.StatusOK,
+			Status: "success",
+			Data:   data,
+		})
+	}
+
+	return resp
+}
@@ -0,0 +1,58 @@
+package budgets
+
+import (
+	"sync"
+)
+
+// MapDBBudgetStorage is a memory-only BudgetStorage.
+type MapDBBudgetStorage struct {
+	lock  sync.RWMutex
+	store map[string][]byte
+}
+
+func NewMapDBBudgetStorage() BudgetStorage {
+	return &MapDBBudgetStorage{
+		store: make(map[string][]byte),
+	}
+}
+
+// Adds the encoded value to storage if it doesn't exist. Otherwise, update the existing
+// value with the provided.
+func (bs *MapDBBudgetStorage) AddOrUpdate(key string, value []byte) error {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+
+	bs.store[key] = value
+	return nil
+}
+
+// Removes a key from the storage
+func (bs *MapDBBudgetStorage) Remove(key string) error {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+
+	delete(bs.store, key)
+	return nil
+}
+
+// Iterates through all key/values for the storage and calls the handler func. If a handler returns
+// an error, the iteration stops.
+func (bs *MapDBBudgetStorage) Each(handler func(string, []byte) error) error {
+	bs.lock.RLock()
+	defer bs.lock.RUnlock()
+
+	for k, v := range bs.store {
+		value := make([]byte, len(v))
+		copy(value, v)
+
+		if err := handler(k, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Closes the backing storage
+func (bs *MapDBBudgetStorage) Close() error {
+	return nil
+}
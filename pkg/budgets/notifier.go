@@ -0,0 +1,57 @@
+package budgets
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/util/json"
+)
+
+// slackMessage is the payload of a Slack incoming webhook.
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// notifier sends BudgetAlerts to BudgetNotifications.
+type notifier struct {
+	client *http.Client
+}
+
+func newNotifier() *notifier {
+	return &notifier{
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// notify posts the given alert to the given notification's URL: the alert
+// itself for a webhook, or a formatted message for Slack.
+func (n *notifier) notify(notification BudgetNotification, alert *BudgetAlert) error {
+	var payload interface{}
+	switch notification.Type {
+	case NotificationSlack:
+		payload = &slackMessage{Text: fmt.Sprintf(":warning: %s", alert.Message)}
+	default:
+		payload = alert
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.client.Post(notification.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s responded with status %s", notification.Type, resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,579 @@
+package cloud
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/clustercache"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/util"
+	"github.com/kubecost/cost-model/pkg/util/json"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+const AlibabaPriceListPricingSource = "Price List"
+
+// AlibabaSpotLabel is the default label marking spot nodes, which may be
+// overridden by the spotLabel and spotLabelValue of the config.
+const AlibabaSpotLabel = "alibabacloud.com/spot-instance"
+const AlibabaSpotLabelValue = "true"
+
+// AlibabaGPULabel is the label of ACK GPU nodes naming their GPU.
+const AlibabaGPULabel = "aliyun.accelerator/nvidia_name"
+
+// AlibabaDiskCategoryParameter is the storage class parameter of the ACK disk
+// CSI plugin defining the category of disk, e.g. "cloud_essd".
+const AlibabaDiskCategoryParameter = "type"
+
+// AlibabaPriceList is an ECS price list. Instance prices are keyed by
+// "region::instanceType::network::os::ioOptimized", e.g.
+// "cn-hangzhou::ecs.g6.large::vpc::linux::optimized", and disk prices, per
+// GB, are keyed by "region::category", e.g. "cn-hangzhou::cloud_essd".
+type AlibabaPriceList struct {
+	Currency        string                   `json:"currency"`
+	PricingInfo     map[string]*AlibabaPrice `json:"pricingInfo"`
+	DiskPricingInfo map[string]*AlibabaPrice `json:"diskPricingInfo"`
+}
+
+// AlibabaPrice is the price of a resource for each of its billing periods.
+type AlibabaPrice struct {
+	Hours []*AlibabaPricePeriod `json:"hours"`
+}
+
+type AlibabaPricePeriod struct {
+	Price  string `json:"price"`
+	Period string `json:"period"`
+}
+
+// Hourly returns the price of one hour, if any.
+func (ap *AlibabaPrice) Hourly() (string, bool) {
+	if ap == nil {
+		return "", false
+	}
+	for _, h := range ap.Hours {
+		if h.Period == "1" && h.Price != "" {
+			return h.Price, true
+		}
+	}
+	return "", false
+}
+
+type AlibabaPricing struct {
+	Node *Node
+	PV   *PV
+}
+
+type Alibaba struct {
+	Pricing                 map[string]*AlibabaPricing
+	PricingLocation         string // URL or path of the price list, overriding the config
+	PricingStatus           string
+	DownloadPricingDataLock sync.RWMutex
+	Clientset               clustercache.ClusterCache
+	Config                  *ProviderConfig
+	ServiceAccountChecks    map[string]*ServiceAccountCheck
+}
+
+type alibabaKey struct {
+	Labels         map[string]string
+	ProviderID     string
+	SpotLabel      string
+	SpotLabelValue string
+}
+
+func (k *alibabaKey) isSpot() bool {
+	return k.SpotLabel != "" && k.Labels[k.SpotLabel] == k.SpotLabelValue
+}
+
+func (k *alibabaKey) Features() string {
+	region, _ := util.GetRegion(k.Labels)
+	instance, _ := util.GetInstanceType(k.Labels)
+	operatingSystem, ok := util.GetOperatingSystem(k.Labels)
+	if !ok {
+		operatingSystem = "linux"
+	}
+	usageType := "ondemand"
+	if k.isSpot() {
+		usageType = "spot"
+	}
+	return fmt.Sprintf("%s,%s,%s,%s", region, instance, operatingSystem, usageType)
+}
+
+// GPUShare returns the fraction of a GPU that one unit of the given GPU
+// resource represents on the node
+func (k *alibabaKey) GPUShare(resource string) float64 {
+	return GPUShare(resource, k.Labels)
+}
+
+func (k *alibabaKey) GPUType() string {
+	return k.Labels[AlibabaGPULabel]
+}
+
+func (k *alibabaKey) ID() string {
+	return k.ProviderID
+}
+
+type alibabaPVKey struct {
+	Labels                 map[string]string
+	StorageClass           string
+	StorageClassParameters map[string]string
+	Category               string
+	DefaultRegion          string
+	ProviderID             string
+}
+
+func (key *alibabaPVKey) ID() string {
+	return key.ProviderID
+}
+
+func (key *alibabaPVKey) GetStorageClass() string {
+	return key.StorageClass
+}
+
+func (key *alibabaPVKey) Features() string {
+	region, ok := util.GetRegion(key.Labels)
+	if !ok {
+		region = key.DefaultRegion
+	}
+	return region + "," + key.Category
+}
+
+// ParseAlibabaPriceList parses the node and disk pricing of the price list
+// read from the given reader, keyed by features.
+func ParseAlibabaPriceList(r io.Reader) (map[string]*AlibabaPricing, error) {
+	var priceList AlibabaPriceList
+	err := json.NewDecoder(r).Decode(&priceList)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing price list: %s", err)
+	}
+
+	pricing := make(map[string]*AlibabaPricing)
+	for key, price := range priceList.PricingInfo {
+		fields := strings.Split(key, "::")
+		if len(fields) != 5 || fields[2] != "vpc" || fields[4] != "optimized" {
+			continue
+		}
+		cost, ok := price.Hourly()
+		if !ok {
+			continue
+		}
+		region, instanceType, operatingSystem := fields[0], fields[1], fields[3]
+		features := fmt.Sprintf("%s,%s,%s,ondemand", region, instanceType, operatingSystem)
+		pricing[features] = &AlibabaPricing{
+			Node: &Node{
+				Cost:         cost,
+				InstanceType: instanceType,
+				Region:       region,
+				UsageType:    "ondemand",
+			},
+		}
+	}
+
+	for key, price := range priceList.DiskPricingInfo {
+		fields := strings.Split(key, "::")
+		if len(fields) != 2 {
+			continue
+		}
+		cost, ok := price.Hourly()
+		if !ok {
+			continue
+		}
+		region, category := fields[0], fields[1]
+		pricing[region+","+category] = &AlibabaPricing{
+			PV: &PV{
+				Cost:   cost,
+				Class:  category,
+				Region: region,
+			},
+		}
+	}
+
+	return pricing, nil
+}
+
+// DownloadPricingData loads the node and disk pricing of the price list at
+// the config's alibabaPricingURL. No price list is published for download,
+// so none is loaded by default, and nodes and disks are priced by the
+// config's defaults.
+func (alibaba *Alibaba) DownloadPricingData() error {
+	alibaba.DownloadPricingDataLock.Lock()
+	defer alibaba.DownloadPricingDataLock.Unlock()
+
+	c, err := alibaba.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	location := alibaba.PricingLocation
+	if location == "" {
+		location = c.AlibabaPricingURL
+	}
+	if location == "" {
+		alibaba.Pricing = make(map[string]*AlibabaPricing)
+		alibaba.PricingStatus = "No price list configured; set alibabaPricingURL to the URL or path of an ECS price list"
+		return nil
+	}
+
+	r, err := openPriceList(location, "")
+	if err != nil {
+		alibaba.PricingStatus = err.Error()
+		return fmt.Errorf("error loading price list: %s", err)
+	}
+	defer r.Close()
+
+	pricing, err := ParseAlibabaPriceList(r)
+	if err != nil {
+		alibaba.PricingStatus = err.Error()
+		return err
+	}
+	klog.V(2).Infof("Loaded %d prices from Alibaba price list", len(pricing))
+
+	alibaba.Pricing = pricing
+	alibaba.PricingStatus = ""
+	return nil
+}
+
+// AllNodePricing returns the Alibaba pricing objects stored
+func (alibaba *Alibaba) AllNodePricing() (interface{}, error) {
+	alibaba.DownloadPricingDataLock.RLock()
+	defer alibaba.DownloadPricingDataLock.RUnlock()
+	return alibaba.Pricing, nil
+}
+
+// InstanceShapes returns no shapes, as the ECS price list does not list the
+// CPU and RAM of instance types.
+func (*Alibaba) InstanceShapes() ([]*InstanceShape, error) {
+	return nil, nil
+}
+
+// NodePricing returns Alibaba pricing data for a single node. Spot prices
+// are not part of the price list, so spot nodes are priced by the config.
+func (alibaba *Alibaba) NodePricing(key Key) (*Node, error) {
+	alibaba.DownloadPricingDataLock.RLock()
+	defer alibaba.DownloadPricingDataLock.RUnlock()
+
+	c, err := alibaba.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("No default pricing data available")
+	}
+
+	if ak, ok := key.(*alibabaKey); ok && ak.isSpot() {
+		return &Node{
+			VCPUCost:     c.SpotCPU,
+			RAMCost:      c.SpotRAM,
+			GPUCost:      c.SpotGPU,
+			BaseCPUPrice: c.CPU,
+			BaseRAMPrice: c.RAM,
+			BaseGPUPrice: c.GPU,
+			UsageType:    PreemptibleType,
+		}, nil
+	}
+
+	if p, ok := alibaba.Pricing[key.Features()]; ok && p.Node != nil {
+		klog.V(4).Infof("Returning pricing for node %s: %+v from key %s", key, p.Node, key.Features())
+		n := *p.Node
+		n.BaseCPUPrice = c.CPU
+		n.BaseRAMPrice = c.RAM
+		n.BaseGPUPrice = c.GPU
+		return &n, nil
+	}
+	klog.V(1).Infof("[Warning] no pricing data found for %s: %s", key.Features(), key)
+
+	if key.GPUType() != "" {
+		return &Node{
+			VCPUCost: c.CPU,
+			RAMCost:  c.RAM,
+			GPUCost:  c.GPU,
+		}, nil
+	}
+	return &Node{
+		VCPUCost:         c.CPU,
+		RAMCost:          c.RAM,
+		UsesBaseCPUPrice: true,
+	}, nil
+}
+
+// PVPricing returns the price list's price of the disk's category in its
+// region, defaulting to the config's storage price.
+func (alibaba *Alibaba) PVPricing(pvk PVKey) (*PV, error) {
+	alibaba.DownloadPricingDataLock.RLock()
+	defer alibaba.DownloadPricingDataLock.RUnlock()
+
+	if p, ok := alibaba.Pricing[pvk.Features()]; ok && p.PV != nil {
+		return p.PV, nil
+	}
+	klog.V(4).Infof("Persistent Volume pricing not found for %s: %s", pvk.GetStorageClass(), pvk.Features())
+
+	c, err := alibaba.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &PV{
+		Cost: c.Storage,
+	}, nil
+}
+
+// NetworkPricing returns the network egress prices of the config
+func (alibaba *Alibaba) NetworkPricing() (*Network, error) {
+	cpricing, err := alibaba.Config.GetCustomPricingData()
+	if err != nil {
+		return nil, err
+	}
+	znec, err := strconv.ParseFloat(cpricing.ZoneNetworkEgress, 64)
+	if err != nil {
+		return nil, err
+	}
+	rnec, err := strconv.ParseFloat(cpricing.RegionNetworkEgress, 64)
+	if err != nil {
+		return nil, err
+	}
+	inec, err := strconv.ParseFloat(cpricing.InternetNetworkEgress, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Network{
+		ZoneNetworkEgressCost:     znec,
+		RegionNetworkEgressCost:   rnec,
+		InternetNetworkEgressCost: inec,
+	}, nil
+}
+
+// LoadBalancerPricing returns the hourly price of a Server Load Balancer
+// instance with one listener, which is the config's price of a forwarding
+// rule; the ECS price list does not price load balancers.
+func (alibaba *Alibaba) LoadBalancerPricing() (*LoadBalancer, error) {
+	c, err := alibaba.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	cost, err := strconv.ParseFloat(c.FirstFiveForwardingRulesCost, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing load balancer price: %s", err)
+	}
+	return &LoadBalancer{
+		Cost: cost,
+	}, nil
+}
+
+func (alibaba *Alibaba) GetKey(labels map[string]string, n *v1.Node) Key {
+	cfg, err := alibaba.GetConfig()
+	if err != nil {
+		klog.Infof("Error loading alibaba custom pricing information")
+	}
+	spotLabel := AlibabaSpotLabel
+	spotLabelValue := AlibabaSpotLabelValue
+	if cfg != nil && cfg.SpotLabel != "" {
+		spotLabel = cfg.SpotLabel
+		spotLabelValue = cfg.SpotLabelValue
+	}
+	return &alibabaKey{
+		Labels:         labels,
+		ProviderID:     alibaba.ParseID(n.Spec.ProviderID),
+		SpotLabel:      spotLabel,
+		SpotLabelValue: spotLabelValue,
+	}
+}
+
+// GetPVKey returns a key of the disk category of the persistent volume,
+// defined by its storage class or by the attributes of its CSI volume.
+func (alibaba *Alibaba) GetPVKey(pv *v1.PersistentVolume, parameters map[string]string, defaultRegion string) PVKey {
+	category := parameters[AlibabaDiskCategoryParameter]
+	providerID := ""
+	if pv.Spec.CSI != nil {
+		providerID = pv.Spec.CSI.VolumeHandle
+		if category == "" {
+			category = pv.Spec.CSI.VolumeAttributes[AlibabaDiskCategoryParameter]
+		}
+	}
+	// Storage classes may list several categories, in order of preference
+	category = strings.TrimSpace(strings.Split(category, ",")[0])
+	if category == "" {
+		category = "cloud_efficiency"
+	}
+	return &alibabaPVKey{
+		Labels:                 pv.Labels,
+		StorageClass:           pv.Spec.StorageClassName,
+		StorageClassParameters: parameters,
+		Category:               category,
+		DefaultRegion:          defaultRegion,
+		ProviderID:             providerID,
+	}
+}
+
+func (*Alibaba) GetAddresses() ([]byte, error) {
+	return nil, nil
+}
+
+func (*Alibaba) GetDisks() ([]byte, error) {
+	return nil, nil
+}
+
+func (*Alibaba) GetCommitments() ([]*Commitment, error) {
+	return nil, nil
+}
+
+func (*Alibaba) BillingLineItems(start, end time.Time) ([]*BillingLineItem, error) {
+	return nil, nil
+}
+
+func (alibaba *Alibaba) ClusterInfo() (map[string]string, error) {
+	remoteEnabled := env.IsRemoteEnabled()
+
+	m := make(map[string]string)
+	m["name"] = "Alibaba Cluster #1"
+	c, err := alibaba.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if c.ClusterName != "" {
+		m["name"] = c.ClusterName
+	}
+	m["provider"] = "alibaba"
+	m["remoteReadEnabled"] = strconv.FormatBool(remoteEnabled)
+	m["id"] = env.GetClusterID()
+	return m, nil
+}
+
+func (alibaba *Alibaba) GetManagementPlatform() (string, error) {
+	nodes := alibaba.Clientset.GetAllNodes()
+
+	if len(nodes) > 0 {
+		if _, ok := nodes[0].Labels["alibabacloud.com/nodepool-id"]; ok {
+			return "ack", nil
+		}
+	}
+	return "", nil
+}
+
+func (alibaba *Alibaba) UpdateConfigFromConfigMap(a map[string]string) (*CustomPricing, error) {
+	return alibaba.Config.UpdateFromMap(a)
+}
+
+func (alibaba *Alibaba) UpdateConfig(r io.Reader, updateType string) (*CustomPricing, error) {
+	defer alibaba.DownloadPricingData()
+
+	return alibaba.Config.Update(func(c *CustomPricing) error {
+		a := make(map[string]interface{})
+		err := json.NewDecoder(r).Decode(&a)
+		if err != nil {
+			return err
+		}
+		for k, v := range a {
+			kUpper := strings.Title(k) // Just so we consistently supply / receive the same values, uppercase the first letter.
+			vstr, ok := v.(string)
+			if ok {
+				err := SetCustomPricingField(c, kUpper, vstr)
+				if err != nil {
+					return err
+				}
+			} else {
+				sci := v.(map[string]interface{})
+				sc := make(map[string]string)
+				for k, val := range sci {
+					sc[k] = val.(string)
+				}
+				err := SetCustomPricingMapField(c, k, sc)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if env.IsRemoteEnabled() {
+			err := UpdateClusterMeta(env.GetClusterID(), c.ClusterName)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (alibaba *Alibaba) GetConfig() (*CustomPricing, error) {
+	c, err := alibaba.Config.GetCustomPricingData()
+	if err != nil {
+		return nil, err
+	}
+	if c.Discount == "" {
+		c.Discount = "0%"
+	}
+	if c.NegotiatedDiscount == "" {
+		c.NegotiatedDiscount = "0%"
+	}
+	if c.CurrencyCode == "" {
+		c.CurrencyCode = "USD"
+	}
+	return c, nil
+}
+
+func (*Alibaba) GetLocalStorageQuery(window, offset string, rate bool, used bool) string {
+	return ""
+}
+
+func (*Alibaba) ExternalAllocations(start string, end string, aggregator []string, filterType string, filterValue string, crossCluster bool) ([]*OutOfClusterAllocation, error) {
+	return nil, nil
+}
+
+func (*Alibaba) ExternalAssets(start, end time.Time, queryLabels map[string]string) ([]*kubecost.Cloud, error) {
+	return nil, nil
+}
+
+func (*Alibaba) ApplyReservedInstancePricing(nodes map[string]*Node) {
+
+}
+
+func (alibaba *Alibaba) ServiceAccountStatus() *ServiceAccountStatus {
+	checks := []*ServiceAccountCheck{}
+	for _, v := range alibaba.ServiceAccountChecks {
+		checks = append(checks, v)
+	}
+	return &ServiceAccountStatus{
+		Checks: checks,
+	}
+}
+
+func (alibaba *Alibaba) PricingSourceStatus() map[string]*PricingSource {
+	alibaba.DownloadPricingDataLock.RLock()
+	defer alibaba.DownloadPricingDataLock.RUnlock()
+
+	pls := &PricingSource{
+		Name:      AlibabaPriceListPricingSource,
+		Available: alibaba.PricingStatus == "",
+		Error:     alibaba.PricingStatus,
+	}
+	return map[string]*PricingSource{
+		AlibabaPriceListPricingSource: pls,
+	}
+}
+
+func (*Alibaba) ClusterManagementPricing() (string, float64, error) {
+	return "", 0.0, nil
+}
+
+func (alibaba *Alibaba) CombinedDiscountForNode(instanceType string, isPreemptible bool, defaultDiscount, negotiatedDiscount float64) float64 {
+	return 1.0 - ((1.0 - defaultDiscount) * (1.0 - negotiatedDiscount))
+}
+
+// ParseID returns the instance ID of the given provider ID, e.g.
+// "i-bp1abc" of "alicloud://cn-hangzhou.i-bp1abc".
+func (alibaba *Alibaba) ParseID(id string) string {
+	id = id[strings.LastIndex(id, "/")+1:]
+	return id[strings.LastIndex(id, ".")+1:]
+}
+
+// ParsePVID returns the disk ID, e.g. "d-bp1abc", of the given volume ID.
+func (alibaba *Alibaba) ParsePVID(id string) string {
+	return id[strings.LastIndex(id, "/")+1:]
+}
+
+func (alibaba *Alibaba) ParseLBID(id string) string {
+	return id
+}
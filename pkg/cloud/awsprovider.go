@@ -21,6 +21,7 @@ import (
 	"github.com/kubecost/cost-model/pkg/clustercache"
 	"github.com/kubecost/cost-model/pkg/env"
 	"github.com/kubecost/cost-model/pkg/errors"
+	"github.com/kubecost/cost-model/pkg/kubecost"
 	"github.com/kubecost/cost-model/pkg/log"
 	"github.com/kubecost/cost-model/pkg/util"
 	"github.com/kubecost/cost-model/pkg/util/json"
@@ -113,6 +114,7 @@ var awsRegions = []string{
 // AWS represents an Amazon Provider
 type AWS struct {
 	Pricing                     map[string]*AWSProductTerms
+	Shapes                      []*InstanceShape
 	SpotPricingByInstanceID     map[string]*spotInfo
 	SpotPricingUpdatedAt        *time.Time
 	SpotRefreshRunning          bool
@@ -439,7 +441,10 @@ func (aws *AWS) UpdateConfig(r io.Reader, updateType string) (*CustomPricing, er
 					for k, val := range sci {
 						sc[k] = val.(string)
 					}
-					c.SharedCosts = sc //todo: support reflection/multiple map fields
+					err := SetCustomPricingMapField(c, k, sc)
+					if err != nil {
+						return err
+					}
 				}
 			}
 		}
@@ -461,6 +466,12 @@ type awsKey struct {
 	ProviderID     string
 }
 
+// GPUShare returns the fraction of a GPU that one unit of the given GPU
+// resource represents on the node
+func (k *awsKey) GPUShare(resource string) float64 {
+	return GPUShare(resource, k.Labels)
+}
+
 func (k *awsKey) GPUType() string {
 	return ""
 }
@@ -734,6 +745,10 @@ func (aws *AWS) DownloadPricingData() error {
 	aws.ValidPricingKeys = make(map[string]bool)
 	skusToKeys := make(map[string]string)
 
+	// Unlike Pricing, which only holds the instance types of the cluster's
+	// nodes, shapes catalog every on-demand Linux instance type of the region
+	skusToShapes := make(map[string]*InstanceShape)
+
 	resp, pricingURL, err := aws.getRegionPricing(nodeList)
 	if err != nil {
 		return err
@@ -785,6 +800,10 @@ func (aws *AWS) DownloadPricingData() error {
 					}
 					aws.ValidPricingKeys[key] = true
 					aws.ValidPricingKeys[spotKey] = true
+
+					if shape, ok := newAWSInstanceShape(product); ok {
+						skusToShapes[product.Sku] = shape
+					}
 				} else if strings.Contains(product.Attributes.UsageType, "EBS:Volume") {
 					// UsageTypes may be prefixed with a region code - we're removing this when using
 					// volTypes to keep lookups generic
@@ -842,6 +861,14 @@ func (aws *AWS) DownloadPricingData() error {
 						klog.V(1).Infof("Error decoding AWS Offer Term: " + err.Error())
 					}
 
+					if shape, ok := skusToShapes[sku.(string)]; ok {
+						if rc, ok := offerTerm.PriceDimensions[sku.(string)+OnDemandRateCode+HourlyRateCode]; ok {
+							shape.HourlyCost, _ = strconv.ParseFloat(rc.PricePerUnit.USD, 64)
+						} else if rc, ok := offerTerm.PriceDimensions[sku.(string)+OnDemandRateCodeCn+HourlyRateCodeCn]; ok {
+							shape.HourlyCost, _ = strconv.ParseFloat(rc.PricePerUnit.CNY, 64)
+						}
+					}
+
 					key, ok := skusToKeys[sku.(string)]
 					spotKey := key + ",preemptible"
 					if ok {
@@ -882,6 +909,13 @@ func (aws *AWS) DownloadPricingData() error {
 	}
 	klog.V(2).Infof("Finished downloading \"%s\"", pricingURL)
 
+	aws.Shapes = make([]*InstanceShape, 0, len(skusToShapes))
+	for _, shape := range skusToShapes {
+		if shape.HourlyCost > 0 {
+			aws.Shapes = append(aws.Shapes, shape)
+		}
+	}
+
 	// Always run spot pricing refresh when performing download
 	aws.refreshSpotPricing(true)
 
@@ -982,6 +1016,50 @@ func (aws *AWS) AllNodePricing() (interface{}, error) {
 	return aws.Pricing, nil
 }
 
+// InstanceShapes returns every on-demand Linux instance type in the regions
+// of the cluster's nodes, as listed in the pricing data fetched.
+func (aws *AWS) InstanceShapes() ([]*InstanceShape, error) {
+	aws.DownloadPricingDataLock.RLock()
+	defer aws.DownloadPricingDataLock.RUnlock()
+	return aws.Shapes, nil
+}
+
+// newAWSInstanceShape returns the InstanceShape of the given instance
+// product, without its cost, if it is a Linux instance type whose CPU and RAM
+// are listed.
+func newAWSInstanceShape(product *AWSProduct) (*InstanceShape, bool) {
+	attrs := product.Attributes
+	if attrs.OperatingSystem != "Linux" {
+		return nil, false
+	}
+
+	region, ok := locationToRegion[attrs.Location]
+	if !ok {
+		return nil, false
+	}
+
+	cpu, err := strconv.ParseFloat(attrs.VCpu, 64)
+	if err != nil || cpu <= 0 {
+		return nil, false
+	}
+
+	// Memory is listed as, e.g., "8 GiB" or "1,952 GiB"
+	ramGiB, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(strings.Replace(attrs.Memory, ",", "", -1), "GiB")), 64)
+	if err != nil || ramGiB <= 0 {
+		return nil, false
+	}
+
+	gpus, _ := strconv.ParseFloat(attrs.GPU, 64)
+
+	return &InstanceShape{
+		Region:       region,
+		InstanceType: attrs.InstanceType,
+		CPUCores:     cpu,
+		RAMBytes:     ramGiB * 1024 * 1024 * 1024,
+		GPUs:         gpus,
+	}, true
+}
+
 func (aws *AWS) spotPricing(instanceID string) (*spotInfo, bool) {
 	aws.SpotPricingLock.RLock()
 	defer aws.SpotPricingLock.RUnlock()
@@ -1006,6 +1084,61 @@ func (aws *AWS) savingsPlanPricing(instanceID string) (*SavingsPlanData, bool) {
 	return data, ok
 }
 
+// GetCommitments returns the reserved instances and savings plans found in the
+// most recent Athena query, along with the instances each one currently covers
+func (aws *AWS) GetCommitments() ([]*Commitment, error) {
+	var commitments []*Commitment
+
+	aws.RIDataLock.RLock()
+	reservations := map[string]*Commitment{}
+	for _, ri := range aws.RIPricingByInstanceID {
+		c, ok := reservations[ri.ReservationARN]
+		if !ok {
+			c = &Commitment{
+				ID:     ri.ReservationARN,
+				Type:   CommitmentReservedInstance,
+				Region: arnRegion(ri.ReservationARN),
+			}
+			reservations[ri.ReservationARN] = c
+			commitments = append(commitments, c)
+		}
+		c.ResourceIDs = append(c.ResourceIDs, ri.ResourceID)
+		c.HourlyCost += ri.EffectiveCost
+	}
+	aws.RIDataLock.RUnlock()
+
+	aws.SavingsPlanDataLock.RLock()
+	savingsPlans := map[string]*Commitment{}
+	for _, sp := range aws.SavingsPlanDataByInstanceID {
+		c, ok := savingsPlans[sp.SavingsPlanARN]
+		if !ok {
+			c = &Commitment{
+				ID:     sp.SavingsPlanARN,
+				Type:   CommitmentSavingsPlan,
+				Region: arnRegion(sp.SavingsPlanARN),
+			}
+			savingsPlans[sp.SavingsPlanARN] = c
+			commitments = append(commitments, c)
+		}
+		c.ResourceIDs = append(c.ResourceIDs, sp.ResourceID)
+		c.HourlyCost += sp.EffectiveCost
+	}
+	aws.SavingsPlanDataLock.RUnlock()
+
+	return commitments, nil
+}
+
+// arnRegion returns the region field of an ARN, which is empty for global
+// resources, such as savings plans
+func arnRegion(arn string) string {
+	// arn:partition:service:region:account-id:resource
+	fields := strings.Split(arn, ":")
+	if len(fields) < 4 {
+		return ""
+	}
+	return fields[3]
+}
+
 func (aws *AWS) createNode(terms *AWSProductTerms, usageType string, k Key) (*Node, error) {
 	key := k.Features()
 
@@ -2054,6 +2187,256 @@ func (a *AWS) ExternalAllocations(start string, end string, aggregators []string
 	return oocAllocs, nil
 }
 
+// ExternalAssets returns a Cloud asset for the daily cost of each resource
+// in the Cost and Usage Report, over each whole UTC day overlapping the given
+// times, which is tagged with any of the given external query labels, as
+// queried via Athena. Tags which have not been activated as cost allocation
+// tags, and so are not columns of the report, are ignored.
+func (a *AWS) ExternalAssets(start, end time.Time, queryLabels map[string]string) ([]*kubecost.Cloud, error) {
+	customPricing, err := a.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if customPricing.AthenaTable == "" || customPricing.AthenaBucketName == "" {
+		return nil, fmt.Errorf("Athena is not configured")
+	}
+
+	columns, err := a.ShowAthenaColumns()
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{}
+	tagColumns := []string{}
+	for tag := range queryLabels {
+		column := ConvertToGlueColumnFormat("resource_tags_user_" + tag)
+		if !columns[column] {
+			klog.V(3).Infof("Athena missing column: %s", column)
+			continue
+		}
+		tags = append(tags, tag)
+		tagColumns = append(tagColumns, column)
+	}
+	if len(tagColumns) == 0 {
+		return nil, nil
+	}
+
+	start, end = externalAssetDays(start, end)
+
+	lastIdx := len(tagColumns) + 5
+	query := fmt.Sprintf(`SELECT
+		CAST(line_item_usage_start_date AS DATE) as usage_date,
+		line_item_usage_account_id,
+		line_item_product_code,
+		product_product_family,
+		line_item_resource_id,
+		%s,
+		SUM(%s) as cost
+	FROM %s
+	WHERE line_item_usage_start_date >= date '%s' AND line_item_usage_start_date < date '%s'
+		AND (%s <> '')
+	GROUP BY %s`, strings.Join(tagColumns, ",\n\t\t"), awsBillingCostColumn(columns), customPricing.AthenaTable,
+		start.Format("2006-01-02"), end.Format("2006-01-02"), strings.Join(tagColumns, " <> '' OR "), generateAWSGroupBy(lastIdx))
+
+	value := func(d *athena.Datum) string {
+		if d == nil || d.VarCharValue == nil {
+			return ""
+		}
+		return *d.VarCharValue
+	}
+
+	var assets []*kubecost.Cloud
+	page := 0
+	processResults := func(op *athena.GetQueryResultsOutput, lastpage bool) bool {
+		iter := op.ResultSet.Rows
+		if page == 0 && len(iter) > 0 {
+			iter = op.ResultSet.Rows[1:len(op.ResultSet.Rows)]
+		}
+		page++
+		for _, r := range iter {
+			if len(r.Data) <= lastIdx {
+				continue
+			}
+			day, err := time.Parse("2006-01-02", value(r.Data[0]))
+			if err != nil {
+				klog.Infof("Error parsing billing date `%s`", value(r.Data[0]))
+				continue
+			}
+			cost, err := strconv.ParseFloat(value(r.Data[lastIdx]), 64)
+			if err != nil {
+				klog.Infof("Error converting cost `%s` from float ", value(r.Data[lastIdx]))
+				continue
+			}
+
+			rowTags := map[string]string{}
+			for i, tag := range tags {
+				rowTags[tag] = value(r.Data[5+i])
+			}
+			labels, ok := ExternalAssetLabels(rowTags, queryLabels)
+			if !ok {
+				continue
+			}
+
+			asset := newExternalAsset(kubecost.AWSProvider, awsBillingCategory(value(r.Data[3])), awsBillingResourceID(value(r.Data[4])), day)
+			asset.Properties().Account = value(r.Data[1])
+			asset.Properties().Service = value(r.Data[2])
+			asset.SetLabels(labels)
+			asset.Cost = cost
+			assets = append(assets, asset)
+		}
+		return true
+	}
+
+	klog.V(3).Infof("Running Query: %s", query)
+	ip, svc, err := a.QueryAthenaPaginated(query)
+	if err != nil {
+		return nil, err
+	}
+	err = svc.GetQueryResultsPages(ip, processResults)
+	if err != nil {
+		return nil, err
+	}
+
+	return assets, nil
+}
+
+// BillingLineItems returns the daily cost of each resource in the Cost and
+// Usage Report between the given times, as queried via Athena. Usage covered
+// by savings plans and reservations is costed at its effective rate, and, if
+// the report includes net columns, net of negotiated discounts. Taxes are not
+// attributed to resources by the report, and so are not included.
+func (a *AWS) BillingLineItems(start, end time.Time) ([]*BillingLineItem, error) {
+	customPricing, err := a.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if customPricing.AthenaTable == "" || customPricing.AthenaBucketName == "" {
+		return nil, fmt.Errorf("Athena is not configured")
+	}
+
+	columns, err := a.ShowAthenaColumns()
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`SELECT
+		CAST(line_item_usage_start_date AS DATE) as usage_date,
+		line_item_resource_id,
+		product_product_family,
+		SUM(%s) as cost
+	FROM %s
+	WHERE line_item_usage_start_date >= date '%s' AND line_item_usage_start_date < date '%s'
+		AND line_item_resource_id <> ''
+	GROUP BY 1, 2, 3`, awsBillingCostColumn(columns), customPricing.AthenaTable, start.Format("2006-01-02"), end.Format("2006-01-02"))
+
+	var items []*BillingLineItem
+	page := 0
+	processResults := func(op *athena.GetQueryResultsOutput, lastpage bool) bool {
+		iter := op.ResultSet.Rows
+		if page == 0 && len(iter) > 0 {
+			iter = op.ResultSet.Rows[1:len(op.ResultSet.Rows)]
+		}
+		page++
+		for _, r := range iter {
+			if len(r.Data) < 4 || r.Data[0].VarCharValue == nil || r.Data[1].VarCharValue == nil || r.Data[3].VarCharValue == nil {
+				continue
+			}
+			day, err := time.Parse("2006-01-02", *r.Data[0].VarCharValue)
+			if err != nil {
+				klog.Infof("Error parsing billing date `%s`", *r.Data[0].VarCharValue)
+				continue
+			}
+			cost, err := strconv.ParseFloat(*r.Data[3].VarCharValue, 64)
+			if err != nil {
+				klog.Infof("Error converting cost `%s` from float ", *r.Data[3].VarCharValue)
+				continue
+			}
+			family := ""
+			if r.Data[2].VarCharValue != nil {
+				family = *r.Data[2].VarCharValue
+			}
+			items = append(items, &BillingLineItem{
+				Start:      day,
+				End:        day.AddDate(0, 0, 1),
+				Category:   awsBillingCategory(family),
+				ProviderID: awsBillingResourceID(*r.Data[1].VarCharValue),
+				Cost:       cost,
+			})
+		}
+		return true
+	}
+
+	klog.V(3).Infof("Running Query: %s", query)
+	ip, svc, err := a.QueryAthenaPaginated(query)
+	if err != nil {
+		return nil, err
+	}
+	err = svc.GetQueryResultsPages(ip, processResults)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// awsBillingCostColumn returns the expression for the cost of a line item,
+// given the columns of the Cost and Usage Report. Savings plan negations
+// offset the on-demand cost of covered usage, which is replaced by its
+// effective cost, so they are excluded.
+func awsBillingCostColumn(columns map[string]bool) string {
+	prefix := ""
+	if columns["line_item_net_unblended_cost"] {
+		prefix = "net_"
+	}
+
+	cost := fmt.Sprintf("line_item_%sunblended_cost", prefix)
+	savingsPlanCost := fmt.Sprintf("savings_plan_%ssavings_plan_effective_cost", prefix)
+	reservationCost := fmt.Sprintf("reservation_%seffective_cost", prefix)
+
+	cases := ""
+	if columns[savingsPlanCost] {
+		cases += fmt.Sprintf(" WHEN 'SavingsPlanCoveredUsage' THEN %s WHEN 'SavingsPlanNegation' THEN 0", savingsPlanCost)
+	}
+	if columns[reservationCost] {
+		cases += fmt.Sprintf(" WHEN 'DiscountedUsage' THEN %s", reservationCost)
+	}
+	if cases == "" {
+		return cost
+	}
+
+	return fmt.Sprintf("CASE line_item_line_item_type%s ELSE %s END", cases, cost)
+}
+
+// awsBillingCategory returns the Asset category of a Cost and Usage Report
+// product family
+func awsBillingCategory(family string) string {
+	switch {
+	case family == "Compute Instance":
+		return kubecost.ComputeCategory
+	case family == "Storage":
+		return kubecost.StorageCategory
+	case strings.HasPrefix(family, "Load Balancer"):
+		return kubecost.NetworkCategory
+	}
+	return kubecost.OtherCategory
+}
+
+// awsBillingResourceID returns the ID of a billed resource as ParseID,
+// ParsePVID, or ParseLBID would; e.g. load balancers are billed by ARN, but
+// identified by name, which is how they are named in their hostnames.
+func awsBillingResourceID(id string) string {
+	// arn:aws:elasticloadbalancing:us-east-2:123456789012:loadbalancer/net/a9d88195b52a47c89b5055120f28c58/50dc6c495c0c9188
+	if strings.HasPrefix(id, "arn:") && strings.Contains(id, ":loadbalancer/") {
+		name := id[strings.Index(id, ":loadbalancer/")+len(":loadbalancer/"):]
+		name = strings.TrimPrefix(strings.TrimPrefix(name, "app/"), "net/")
+		if i := strings.Index(name, "/"); i >= 0 {
+			name = name[:i]
+		}
+		return name
+	}
+	return id
+}
+
 // QuerySQL can query a properly configured Athena database.
 // Used to fetch billing data.
 // Requires a json config in /var/configs with key region, output, and database.
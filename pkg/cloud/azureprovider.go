@@ -210,6 +210,12 @@ func (k *azureKey) Features() string {
 	return fmt.Sprintf("%s,%s,%s", region, instance, usageType)
 }
 
+// GPUShare returns the fraction of a GPU that one unit of the given GPU
+// resource represents on the node
+func (k *azureKey) GPUShare(resource string) float64 {
+	return GPUShare(resource, k.Labels)
+}
+
 func (k *azureKey) GPUType() string {
 	if t, ok := k.Labels[k.GPULabel]; ok {
 		return t
@@ -730,6 +736,12 @@ func (az *Azure) AllNodePricing() (interface{}, error) {
 	return az.Pricing, nil
 }
 
+// InstanceShapes returns no shapes, as the rate card does not list the CPU
+// and RAM of VM sizes.
+func (*Azure) InstanceShapes() ([]*InstanceShape, error) {
+	return nil, nil
+}
+
 // NodePricing returns Azure pricing data for a single node
 func (az *Azure) NodePricing(key Key) (*Node, error) {
 	az.DownloadPricingDataLock.RLock()
@@ -869,6 +881,10 @@ func (*Azure) GetDisks() ([]byte, error) {
 	return nil, nil
 }
 
+func (*Azure) GetCommitments() ([]*Commitment, error) {
+	return nil, nil
+}
+
 func (az *Azure) ClusterInfo() (map[string]string, error) {
 	remoteEnabled := env.IsRemoteEnabled()
 
@@ -915,7 +931,10 @@ func (az *Azure) UpdateConfig(r io.Reader, updateType string) (*CustomPricing, e
 				for k, val := range sci {
 					sc[k] = val.(string)
 				}
-				c.SharedCosts = sc //todo: support reflection/multiple map fields
+				err := SetCustomPricingMapField(c, k, sc)
+				if err != nil {
+					return err
+				}
 			}
 		}
 
@@ -1058,6 +1077,204 @@ func parseCSV(reader *csv.Reader, start, end time.Time, oocAllocs map[string]*Ou
 	return nil
 }
 
+// ExternalAssets returns a Cloud asset for the daily cost of each resource in
+// the Azure cost exports between the given times which is tagged with any of
+// the given external query labels. Costs are pre-tax.
+func (az *Azure) ExternalAssets(start, end time.Time, queryLabels map[string]string) ([]*kubecost.Cloud, error) {
+	var csvRetriever CSVRetriever = AzureCSVRetriever{}
+	err := az.ConfigureAzureStorage() // load Azure Storage config
+	if err != nil {
+		return nil, err
+	}
+	return getExternalAssets(start, end, queryLabels, csvRetriever)
+}
+
+func getExternalAssets(start, end time.Time, queryLabels map[string]string, csvRetriever CSVRetriever) ([]*kubecost.Cloud, error) {
+	readers, err := csvRetriever.GetCSVReaders(start, end)
+	if err != nil {
+		return nil, err
+	}
+	assets := make(map[string]*kubecost.Cloud)
+	for _, reader := range readers {
+		err = parseExternalAssetsCSV(reader, start, end, assets, queryLabels)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var assetsArr []*kubecost.Cloud
+	for _, asset := range assets {
+		assetsArr = append(assetsArr, asset)
+	}
+	return assetsArr, nil
+}
+
+func parseExternalAssetsCSV(reader *csv.Reader, start, end time.Time, assets map[string]*kubecost.Cloud, queryLabels map[string]string) error {
+	headers, _ := reader.Read()
+	headerMap := createHeaderMap(headers)
+	for _, header := range []string{"MeterCategory", "UsageDateTime", "Tags", "PreTaxCost"} {
+		if _, ok := headerMap[header]; !ok {
+			return fmt.Errorf("billing CSV missing column: %s", header)
+		}
+	}
+
+	// column returns the value of the given optional column
+	column := func(record []string, header string) string {
+		if i, ok := headerMap[header]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	for {
+		var record, err = reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		usageDateTime, err := time.Parse(AzureLayout, record[headerMap["UsageDateTime"]])
+		if err != nil {
+			klog.Errorf("failed to parse usage date: '%s'", record[headerMap["UsageDateTime"]])
+			continue
+		}
+		if !isValidUsageDateTime(start, end, usageDateTime) {
+			continue
+		}
+
+		itemTags := make(map[string]string)
+		itemTagJson := makeValidJSON(record[headerMap["Tags"]])
+		if itemTagJson != "" {
+			err = json.Unmarshal([]byte(itemTagJson), &itemTags)
+			if err != nil {
+				klog.Infof("Could not parse item tags %v", err)
+			}
+		}
+		labels, ok := ExternalAssetLabels(itemTags, queryLabels)
+		if !ok {
+			continue
+		}
+
+		itemCost, err := strconv.ParseFloat(record[headerMap["PreTaxCost"]], 64)
+		if err != nil {
+			klog.Infof("failed to parse cost: '%s'", record[headerMap["PreTaxCost"]])
+			continue
+		}
+
+		category := selectCategory(record[headerMap["MeterCategory"]])
+		day := time.Date(usageDateTime.Year(), usageDateTime.Month(), usageDateTime.Day(), 0, 0, 0, 0, time.UTC)
+		providerID := ""
+		if instanceID := column(record, "InstanceId"); instanceID != "" {
+			providerID = "azure://" + instanceID
+		}
+		subscription := column(record, "SubscriptionGuid")
+		service := column(record, "ConsumedService")
+
+		key := fmt.Sprintf("%s/%s/%s/%s/%s/%s", day.Format(AzureLayout), category, subscription, service, strings.ToLower(providerID), itemTagJson)
+		if asset, ok := assets[key]; ok {
+			asset.Cost += itemCost
+		} else {
+			asset := newExternalAsset(kubecost.AzureProvider, category, providerID, day)
+			asset.Properties().Account = subscription
+			asset.Properties().Service = service
+			asset.SetLabels(labels)
+			asset.Cost = itemCost
+			assets[key] = asset
+		}
+	}
+	return nil
+}
+
+// BillingLineItems returns the daily cost of each resource in the Azure cost
+// exports between the given times. Azure resource IDs are prefixed with
+// "azure://" to match the provider IDs of nodes. Costs are pre-tax.
+func (az *Azure) BillingLineItems(start, end time.Time) ([]*BillingLineItem, error) {
+	var csvRetriever CSVRetriever = AzureCSVRetriever{}
+	err := az.ConfigureAzureStorage() // load Azure Storage config
+	if err != nil {
+		return nil, err
+	}
+	return getBillingLineItems(start, end, csvRetriever)
+}
+
+func getBillingLineItems(start, end time.Time, csvRetriever CSVRetriever) ([]*BillingLineItem, error) {
+	readers, err := csvRetriever.GetCSVReaders(start, end)
+	if err != nil {
+		return nil, err
+	}
+	items := make(map[string]*BillingLineItem)
+	for _, reader := range readers {
+		err = parseBillingCSV(reader, start, end, items)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var itemsArr []*BillingLineItem
+	for _, item := range items {
+		itemsArr = append(itemsArr, item)
+	}
+	return itemsArr, nil
+}
+
+func parseBillingCSV(reader *csv.Reader, start, end time.Time, items map[string]*BillingLineItem) error {
+	headers, _ := reader.Read()
+	headerMap := createHeaderMap(headers)
+	for _, header := range []string{"MeterCategory", "UsageDateTime", "InstanceId", "PreTaxCost"} {
+		if _, ok := headerMap[header]; !ok {
+			return fmt.Errorf("billing CSV missing column: %s", header)
+		}
+	}
+
+	for {
+		var record, err = reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		instanceID := record[headerMap["InstanceId"]]
+		if instanceID == "" {
+			continue
+		}
+
+		usageDateTime, err := time.Parse(AzureLayout, record[headerMap["UsageDateTime"]])
+		if err != nil {
+			klog.Errorf("failed to parse usage date: '%s'", record[headerMap["UsageDateTime"]])
+			continue
+		}
+		if !isValidUsageDateTime(start, end, usageDateTime) {
+			continue
+		}
+
+		itemCost, err := strconv.ParseFloat(record[headerMap["PreTaxCost"]], 64)
+		if err != nil {
+			klog.Infof("failed to parse cost: '%s'", record[headerMap["PreTaxCost"]])
+			continue
+		}
+
+		category := selectCategory(record[headerMap["MeterCategory"]])
+		day := time.Date(usageDateTime.Year(), usageDateTime.Month(), usageDateTime.Day(), 0, 0, 0, 0, time.UTC)
+		providerID := "azure://" + instanceID
+
+		key := fmt.Sprintf("%s/%s/%s", day.Format(AzureLayout), category, strings.ToLower(providerID))
+		if item, ok := items[key]; ok {
+			item.Cost += itemCost
+		} else {
+			items[key] = &BillingLineItem{
+				Start:      day,
+				End:        day.AddDate(0, 0, 1),
+				Category:   category,
+				ProviderID: providerID,
+				Cost:       itemCost,
+			}
+		}
+	}
+	return nil
+}
+
 func createHeaderMap(headers []string) map[string]int {
 	headerMap := make(map[string]int)
 	for i, header := range headers {
@@ -193,6 +193,13 @@ func (k *csvKey) Features() string {
 
 	return region + "," + instanceType + "," + class
 }
+
+// GPUShare returns the fraction of a GPU that one unit of the given GPU
+// resource represents on the node
+func (k *csvKey) GPUShare(resource string) float64 {
+	return GPUShare(resource, k.Labels)
+}
+
 func (k *csvKey) GPUType() string {
 	return ""
 }
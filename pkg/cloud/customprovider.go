@@ -5,9 +5,11 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/kubecost/cost-model/pkg/clustercache"
 	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/kubecost"
 	"github.com/kubecost/cost-model/pkg/util/json"
 
 	v1 "k8s.io/api/core/v1"
@@ -86,7 +88,10 @@ func (cp *CustomProvider) UpdateConfig(r io.Reader, updateType string) (*CustomP
 				for k, val := range sci {
 					sc[k] = val.(string)
 				}
-				c.SharedCosts = sc //todo: support reflection/multiple map fields
+				err := SetCustomPricingMapField(c, k, sc)
+				if err != nil {
+					return err
+				}
 			}
 		}
 
@@ -123,6 +128,14 @@ func (*CustomProvider) GetDisks() ([]byte, error) {
 	return nil, nil
 }
 
+func (*CustomProvider) GetCommitments() ([]*Commitment, error) {
+	return nil, nil
+}
+
+func (*CustomProvider) BillingLineItems(start, end time.Time) ([]*BillingLineItem, error) {
+	return nil, nil
+}
+
 func (cp *CustomProvider) AllNodePricing() (interface{}, error) {
 	cp.DownloadPricingDataLock.RLock()
 	defer cp.DownloadPricingDataLock.RUnlock()
@@ -130,6 +143,12 @@ func (cp *CustomProvider) AllNodePricing() (interface{}, error) {
 	return cp.Pricing, nil
 }
 
+// InstanceShapes returns no shapes, as custom pricing is per resource rather
+// than per instance type.
+func (*CustomProvider) InstanceShapes() ([]*InstanceShape, error) {
+	return nil, nil
+}
+
 func (cp *CustomProvider) NodePricing(key Key) (*Node, error) {
 	cp.DownloadPricingDataLock.RLock()
 	defer cp.DownloadPricingDataLock.RUnlock()
@@ -201,6 +220,10 @@ func (*CustomProvider) ExternalAllocations(start string, end string, aggregator
 	return nil, nil // TODO: transform the QuerySQL lines into the new OutOfClusterAllocation Struct
 }
 
+func (*CustomProvider) ExternalAssets(start, end time.Time, queryLabels map[string]string) ([]*kubecost.Cloud, error) {
+	return nil, nil
+}
+
 func (*CustomProvider) QuerySQL(query string) ([]byte, error) {
 	return nil, nil
 }
@@ -280,6 +303,12 @@ func (*CustomProvider) GetPVKey(pv *v1.PersistentVolume, parameters map[string]s
 	}
 }
 
+// GPUShare returns the fraction of a GPU that one unit of the given GPU
+// resource represents on the node
+func (cpk *customProviderKey) GPUShare(resource string) float64 {
+	return GPUShare(resource, cpk.Labels)
+}
+
 func (cpk *customProviderKey) GPUType() string {
 	if t, ok := cpk.Labels[cpk.GPULabel]; ok {
 		return t
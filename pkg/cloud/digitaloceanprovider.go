@@ -0,0 +1,479 @@
+package cloud
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/clustercache"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/util"
+	"github.com/kubecost/cost-model/pkg/util/json"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+const DigitalOceanSizesURL = "https://api.digitalocean.com/v2/sizes?per_page=200"
+
+// DigitalOceanPricingFile is the list of droplet sizes shipped with the
+// configs, which prices nodes unless the sizes are refreshed from the API.
+const DigitalOceanPricingFile = "digitalocean_pricing.json"
+
+// DigitalOceanSizes is the list of droplet sizes of the DigitalOcean API.
+type DigitalOceanSizes struct {
+	Sizes []*DigitalOceanSize `json:"sizes"`
+}
+
+type DigitalOceanSize struct {
+	Slug         string   `json:"slug"`
+	Memory       int      `json:"memory"`
+	VCPUs        int      `json:"vcpus"`
+	Disk         int      `json:"disk"`
+	PriceMonthly float64  `json:"price_monthly"`
+	PriceHourly  float64  `json:"price_hourly"`
+	Regions      []string `json:"regions"`
+	Available    bool     `json:"available"`
+}
+
+type DigitalOcean struct {
+	Pricing                 map[string]*Node
+	Shapes                  []*InstanceShape
+	PricingLocation         string // URL or path of the sizes, overriding the config
+	PricingStatus           string
+	DownloadPricingDataLock sync.RWMutex
+	Clientset               clustercache.ClusterCache
+	Config                  *ProviderConfig
+	ServiceAccountChecks    map[string]*ServiceAccountCheck
+}
+
+type digitalOceanKey struct {
+	Labels     map[string]string
+	ProviderID string
+}
+
+// Features returns the droplet size of the node, which is priced the same in
+// every region.
+func (k *digitalOceanKey) Features() string {
+	size, _ := util.GetInstanceType(k.Labels)
+	return size
+}
+
+// GPUShare returns the fraction of a GPU that one unit of the given GPU
+// resource represents on the node
+func (k *digitalOceanKey) GPUShare(resource string) float64 {
+	return GPUShare(resource, k.Labels)
+}
+
+func (k *digitalOceanKey) GPUType() string {
+	if size := k.Features(); strings.HasPrefix(size, "gpu-") {
+		return size
+	}
+	return ""
+}
+
+func (k *digitalOceanKey) ID() string {
+	return k.ProviderID
+}
+
+type digitalOceanPVKey struct {
+	Labels                 map[string]string
+	StorageClass           string
+	StorageClassParameters map[string]string
+	ProviderID             string
+}
+
+func (key *digitalOceanPVKey) ID() string {
+	return key.ProviderID
+}
+
+func (key *digitalOceanPVKey) GetStorageClass() string {
+	return key.StorageClass
+}
+
+func (key *digitalOceanPVKey) Features() string {
+	return "volume"
+}
+
+// ParseDigitalOceanSizes parses the hourly prices of the droplet sizes read
+// from the given reader, keyed by their slugs, and the shapes of the sizes
+// available in each region. GPU droplets are not listed as shapes.
+func ParseDigitalOceanSizes(r io.Reader) (map[string]*Node, []*InstanceShape, error) {
+	var sizes DigitalOceanSizes
+	err := json.NewDecoder(r).Decode(&sizes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing sizes: %s", err)
+	}
+
+	pricing := make(map[string]*Node)
+	shapes := []*InstanceShape{}
+	for _, size := range sizes.Sizes {
+		if size.Slug == "" || size.PriceHourly <= 0 {
+			continue
+		}
+		pricing[size.Slug] = &Node{
+			Cost:         strconv.FormatFloat(size.PriceHourly, 'f', -1, 64),
+			VCPU:         strconv.Itoa(size.VCPUs),
+			InstanceType: size.Slug,
+			UsageType:    "ondemand",
+		}
+
+		if !size.Available || strings.HasPrefix(size.Slug, "gpu-") {
+			continue
+		}
+		for _, region := range size.Regions {
+			shapes = append(shapes, &InstanceShape{
+				Region:       region,
+				InstanceType: size.Slug,
+				CPUCores:     float64(size.VCPUs),
+				RAMBytes:     float64(size.Memory) * 1024 * 1024,
+				HourlyCost:   size.PriceHourly,
+			})
+		}
+	}
+
+	return pricing, shapes, nil
+}
+
+// DownloadPricingData loads the prices of the droplet sizes. The sizes are
+// refreshed from the API when a token is configured, and are otherwise read
+// from the list shipped with the configs, which is also used when the API
+// cannot be reached; nodes of sizes missing from them are priced by the
+// config's defaults.
+func (do *DigitalOcean) DownloadPricingData() error {
+	do.DownloadPricingDataLock.Lock()
+	defer do.DownloadPricingDataLock.Unlock()
+
+	c, err := do.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	bundled := configPathFor(DigitalOceanPricingFile)
+	location := do.PricingLocation
+	if location == "" {
+		location = c.DigitalOceanPricingURL
+	}
+	if location == "" && c.DigitalOceanToken != "" {
+		location = DigitalOceanSizesURL
+	}
+	if location == "" {
+		location = bundled
+	}
+
+	pricing, shapes, err := loadDigitalOceanSizes(location, c.DigitalOceanToken)
+	if err != nil && location != bundled {
+		klog.V(1).Infof("[Warning] error loading DigitalOcean sizes from %s, using %s: %s", location, bundled, err)
+		pricing, shapes, err = loadDigitalOceanSizes(bundled, "")
+	}
+	if err != nil {
+		do.PricingStatus = err.Error()
+		return err
+	}
+	klog.V(2).Infof("Loaded prices of %d DigitalOcean droplet sizes", len(pricing))
+
+	do.Pricing = pricing
+	do.Shapes = shapes
+	do.PricingStatus = ""
+	return nil
+}
+
+func loadDigitalOceanSizes(location, token string) (map[string]*Node, []*InstanceShape, error) {
+	r, err := openPriceList(location, token)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error loading sizes: %s", err)
+	}
+	defer r.Close()
+
+	return ParseDigitalOceanSizes(r)
+}
+
+// AllNodePricing returns the DigitalOcean pricing objects stored
+func (do *DigitalOcean) AllNodePricing() (interface{}, error) {
+	do.DownloadPricingDataLock.RLock()
+	defer do.DownloadPricingDataLock.RUnlock()
+	return do.Pricing, nil
+}
+
+// InstanceShapes returns the droplet sizes available in each region
+func (do *DigitalOcean) InstanceShapes() ([]*InstanceShape, error) {
+	do.DownloadPricingDataLock.RLock()
+	defer do.DownloadPricingDataLock.RUnlock()
+	return do.Shapes, nil
+}
+
+// NodePricing returns the hourly price of the node's droplet size
+func (do *DigitalOcean) NodePricing(key Key) (*Node, error) {
+	do.DownloadPricingDataLock.RLock()
+	defer do.DownloadPricingDataLock.RUnlock()
+
+	c, err := do.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("No default pricing data available")
+	}
+
+	if n, ok := do.Pricing[key.Features()]; ok {
+		klog.V(4).Infof("Returning pricing for node %s: %+v from key %s", key, n, key.Features())
+		node := *n
+		node.BaseCPUPrice = c.CPU
+		node.BaseRAMPrice = c.RAM
+		node.BaseGPUPrice = c.GPU
+		return &node, nil
+	}
+	klog.V(1).Infof("[Warning] no pricing data found for %s: %s", key.Features(), key)
+
+	if key.GPUType() != "" {
+		return &Node{
+			VCPUCost: c.CPU,
+			RAMCost:  c.RAM,
+			GPUCost:  c.GPU,
+		}, nil
+	}
+	return &Node{
+		VCPUCost:         c.CPU,
+		RAMCost:          c.RAM,
+		UsesBaseCPUPrice: true,
+	}, nil
+}
+
+// PVPricing returns the config's storage price; block storage volumes are
+// priced the same in every region.
+func (do *DigitalOcean) PVPricing(pvk PVKey) (*PV, error) {
+	c, err := do.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &PV{
+		Cost:  c.Storage,
+		Class: pvk.GetStorageClass(),
+	}, nil
+}
+
+// NetworkPricing returns the network egress prices of the config
+func (do *DigitalOcean) NetworkPricing() (*Network, error) {
+	cpricing, err := do.Config.GetCustomPricingData()
+	if err != nil {
+		return nil, err
+	}
+	znec, err := strconv.ParseFloat(cpricing.ZoneNetworkEgress, 64)
+	if err != nil {
+		return nil, err
+	}
+	rnec, err := strconv.ParseFloat(cpricing.RegionNetworkEgress, 64)
+	if err != nil {
+		return nil, err
+	}
+	inec, err := strconv.ParseFloat(cpricing.InternetNetworkEgress, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Network{
+		ZoneNetworkEgressCost:     znec,
+		RegionNetworkEgressCost:   rnec,
+		InternetNetworkEgressCost: inec,
+	}, nil
+}
+
+// LoadBalancerPricing returns the hourly price of a load balancer node, at
+// $12 per month.
+func (do *DigitalOcean) LoadBalancerPricing() (*LoadBalancer, error) {
+	return &LoadBalancer{
+		Cost: 12.0 / util.HoursPerMonth,
+	}, nil
+}
+
+func (do *DigitalOcean) GetKey(labels map[string]string, n *v1.Node) Key {
+	return &digitalOceanKey{
+		Labels:     labels,
+		ProviderID: do.ParseID(n.Spec.ProviderID),
+	}
+}
+
+func (do *DigitalOcean) GetPVKey(pv *v1.PersistentVolume, parameters map[string]string, defaultRegion string) PVKey {
+	providerID := ""
+	if pv.Spec.CSI != nil {
+		providerID = pv.Spec.CSI.VolumeHandle
+	}
+	return &digitalOceanPVKey{
+		Labels:                 pv.Labels,
+		StorageClass:           pv.Spec.StorageClassName,
+		StorageClassParameters: parameters,
+		ProviderID:             providerID,
+	}
+}
+
+func (*DigitalOcean) GetAddresses() ([]byte, error) {
+	return nil, nil
+}
+
+func (*DigitalOcean) GetDisks() ([]byte, error) {
+	return nil, nil
+}
+
+func (*DigitalOcean) GetCommitments() ([]*Commitment, error) {
+	return nil, nil
+}
+
+func (*DigitalOcean) BillingLineItems(start, end time.Time) ([]*BillingLineItem, error) {
+	return nil, nil
+}
+
+func (do *DigitalOcean) ClusterInfo() (map[string]string, error) {
+	remoteEnabled := env.IsRemoteEnabled()
+
+	m := make(map[string]string)
+	m["name"] = "DigitalOcean Cluster #1"
+	c, err := do.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if c.ClusterName != "" {
+		m["name"] = c.ClusterName
+	}
+	m["provider"] = "digitalocean"
+	m["remoteReadEnabled"] = strconv.FormatBool(remoteEnabled)
+	m["id"] = env.GetClusterID()
+	return m, nil
+}
+
+func (do *DigitalOcean) GetManagementPlatform() (string, error) {
+	nodes := do.Clientset.GetAllNodes()
+
+	if len(nodes) > 0 {
+		if _, ok := nodes[0].Labels["doks.digitalocean.com/node-id"]; ok {
+			return "doks", nil
+		}
+	}
+	return "", nil
+}
+
+func (do *DigitalOcean) UpdateConfigFromConfigMap(a map[string]string) (*CustomPricing, error) {
+	return do.Config.UpdateFromMap(a)
+}
+
+func (do *DigitalOcean) UpdateConfig(r io.Reader, updateType string) (*CustomPricing, error) {
+	defer do.DownloadPricingData()
+
+	return do.Config.Update(func(c *CustomPricing) error {
+		a := make(map[string]interface{})
+		err := json.NewDecoder(r).Decode(&a)
+		if err != nil {
+			return err
+		}
+		for k, v := range a {
+			kUpper := strings.Title(k) // Just so we consistently supply / receive the same values, uppercase the first letter.
+			vstr, ok := v.(string)
+			if ok {
+				err := SetCustomPricingField(c, kUpper, vstr)
+				if err != nil {
+					return err
+				}
+			} else {
+				sci := v.(map[string]interface{})
+				sc := make(map[string]string)
+				for k, val := range sci {
+					sc[k] = val.(string)
+				}
+				err := SetCustomPricingMapField(c, k, sc)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if env.IsRemoteEnabled() {
+			err := UpdateClusterMeta(env.GetClusterID(), c.ClusterName)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (do *DigitalOcean) GetConfig() (*CustomPricing, error) {
+	c, err := do.Config.GetCustomPricingData()
+	if err != nil {
+		return nil, err
+	}
+	if c.Discount == "" {
+		c.Discount = "0%"
+	}
+	if c.NegotiatedDiscount == "" {
+		c.NegotiatedDiscount = "0%"
+	}
+	if c.CurrencyCode == "" {
+		c.CurrencyCode = "USD"
+	}
+	return c, nil
+}
+
+func (*DigitalOcean) GetLocalStorageQuery(window, offset string, rate bool, used bool) string {
+	return ""
+}
+
+func (*DigitalOcean) ExternalAllocations(start string, end string, aggregator []string, filterType string, filterValue string, crossCluster bool) ([]*OutOfClusterAllocation, error) {
+	return nil, nil
+}
+
+func (*DigitalOcean) ExternalAssets(start, end time.Time, queryLabels map[string]string) ([]*kubecost.Cloud, error) {
+	return nil, nil
+}
+
+func (*DigitalOcean) ApplyReservedInstancePricing(nodes map[string]*Node) {
+
+}
+
+func (do *DigitalOcean) ServiceAccountStatus() *ServiceAccountStatus {
+	checks := []*ServiceAccountCheck{}
+	for _, v := range do.ServiceAccountChecks {
+		checks = append(checks, v)
+	}
+	return &ServiceAccountStatus{
+		Checks: checks,
+	}
+}
+
+func (do *DigitalOcean) PricingSourceStatus() map[string]*PricingSource {
+	do.DownloadPricingDataLock.RLock()
+	defer do.DownloadPricingDataLock.RUnlock()
+
+	aps := &PricingSource{
+		Name:      APIPricingSource,
+		Available: do.Pricing != nil && do.PricingStatus == "",
+		Error:     do.PricingStatus,
+	}
+	return map[string]*PricingSource{
+		APIPricingSource: aps,
+	}
+}
+
+// ClusterManagementPricing returns no cost; the DOKS control plane is free
+// unless it is highly available.
+func (*DigitalOcean) ClusterManagementPricing() (string, float64, error) {
+	return "", 0.0, nil
+}
+
+func (do *DigitalOcean) CombinedDiscountForNode(instanceType string, isPreemptible bool, defaultDiscount, negotiatedDiscount float64) float64 {
+	return 1.0 - ((1.0 - defaultDiscount) * (1.0 - negotiatedDiscount))
+}
+
+// ParseID returns the droplet ID of the given provider ID, e.g. "12345678"
+// of "digitalocean://12345678".
+func (do *DigitalOcean) ParseID(id string) string {
+	return strings.TrimPrefix(id, "digitalocean://")
+}
+
+func (do *DigitalOcean) ParsePVID(id string) string {
+	return id
+}
+
+func (do *DigitalOcean) ParseLBID(id string) string {
+	return id
+}
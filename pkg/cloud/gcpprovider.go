@@ -20,6 +20,7 @@ import (
 
 	"github.com/kubecost/cost-model/pkg/clustercache"
 	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/kubecost"
 	"github.com/kubecost/cost-model/pkg/log"
 	"github.com/kubecost/cost-model/pkg/util"
 	"github.com/kubecost/cost-model/pkg/util/json"
@@ -69,6 +70,24 @@ type gcpAllocation struct {
 	Cost        float64
 }
 
+type gcpBillingRow struct {
+	UsageDate    string  `bigquery:"usage_date"`
+	ResourceName string  `bigquery:"resource_name"`
+	Service      string  `bigquery:"service"`
+	SKU          string  `bigquery:"sku"`
+	Cost         float64 `bigquery:"cost"`
+}
+
+type gcpExternalRow struct {
+	UsageDate string              `bigquery:"usage_date"`
+	Project   bigquery.NullString `bigquery:"project"`
+	Service   string              `bigquery:"service"`
+	SKU       string              `bigquery:"sku"`
+	Keys      bigquery.NullString `bigquery:"keys"`
+	Cost      float64             `bigquery:"cost"`
+	Credit    float64             `bigquery:"credit"`
+}
+
 type multiKeyGCPAllocation struct {
 	Keys    bigquery.NullString
 	Service string
@@ -289,7 +308,10 @@ func (gcp *GCP) UpdateConfig(r io.Reader, updateType string) (*CustomPricing, er
 					for k, val := range sci {
 						sc[k] = val.(string)
 					}
-					c.SharedCosts = sc //todo: support reflection/multiple map fields
+					err := SetCustomPricingMapField(c, k, sc)
+					if err != nil {
+						return err
+					}
 				}
 			}
 		}
@@ -440,6 +462,190 @@ func (gcp *GCP) multiLabelQuery(query string, aggregators []string) ([]*OutOfClu
 	return allocations, nil
 }
 
+// ExternalAssets returns a Cloud asset for the daily cost of each SKU in the
+// BigQuery billing export, over each whole UTC day overlapping the given
+// times, which is labeled with any of the given external query labels.
+func (gcp *GCP) ExternalAssets(start, end time.Time, queryLabels map[string]string) ([]*kubecost.Cloud, error) {
+	c, err := gcp.Config.GetCustomPricingData()
+	if err != nil {
+		return nil, err
+	}
+	if c.BillingDataDataset == "" {
+		return nil, fmt.Errorf("BigQuery billing export is not configured")
+	}
+	if len(queryLabels) == 0 {
+		return nil, nil
+	}
+
+	formattedLabels := []string{}
+	for label := range queryLabels {
+		formattedLabels = append(formattedLabels, strconv.Quote(label))
+	}
+
+	start, end = externalAssetDays(start, end)
+
+	queryString := fmt.Sprintf(`SELECT
+			FORMAT_DATE("%%Y-%%m-%%d", DATE(usage_start_time)) as usage_date,
+			project.id as project,
+			service.description as service,
+			sku.description as sku,
+			TO_JSON_STRING(labels) as keys,
+			SUM(cost) as cost,
+			SUM(IFNULL((SELECT SUM(c.amount) FROM UNNEST(credits) AS c), 0)) as credit
+		FROM %s
+		WHERE EXISTS (SELECT * FROM UNNEST(labels) AS l2 WHERE l2.key IN (%s))
+		AND usage_start_time >= "%s" AND usage_start_time < "%s"
+		GROUP BY usage_date, project, service, sku, keys`, c.BillingDataDataset, strings.Join(formattedLabels, ","), start.Format("2006-01-02 15:04:05 MST"), end.Format("2006-01-02 15:04:05 MST"))
+	klog.V(3).Infof("Querying \"%s\" with : %s", c.ProjectID, queryString)
+
+	ctx := context.Background()
+	client, err := bigquery.NewClient(ctx, c.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	it, err := client.Query(queryString).Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var assets []*kubecost.Cloud
+	for {
+		var row gcpExternalRow
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		day, err := time.Parse("2006-01-02", row.UsageDate)
+		if err != nil {
+			klog.Infof("Error parsing billing date `%s`", row.UsageDate)
+			continue
+		}
+
+		var keys []map[string]string
+		if row.Keys.Valid {
+			err := json.Unmarshal([]byte(row.Keys.StringVal), &keys)
+			if err != nil {
+				klog.Infof("Invalid unmarshaling response from BigQuery filtered query: %s", err.Error())
+			}
+		}
+		tags := map[string]string{}
+		for _, label := range keys {
+			tags[label["key"]] = label["value"]
+		}
+		labels, ok := ExternalAssetLabels(tags, queryLabels)
+		if !ok {
+			continue
+		}
+
+		asset := newExternalAsset(kubecost.GCPProvider, gcpBillingCategory(row.Service, row.SKU), "", day)
+		if row.Project.Valid {
+			asset.Properties().Project = row.Project.StringVal
+		}
+		asset.Properties().Service = row.Service
+		asset.SetLabels(labels)
+		asset.Cost = row.Cost
+		asset.Credit = row.Credit
+		assets = append(assets, asset)
+	}
+
+	return assets, nil
+}
+
+// BillingLineItems returns the daily cost of each resource in the BigQuery
+// billing export between the given times, net of credits. Resources are only
+// named by the detailed, resource-level export.
+func (gcp *GCP) BillingLineItems(start, end time.Time) ([]*BillingLineItem, error) {
+	c, err := gcp.Config.GetCustomPricingData()
+	if err != nil {
+		return nil, err
+	}
+	if c.BillingDataDataset == "" {
+		return nil, fmt.Errorf("BigQuery billing export is not configured")
+	}
+
+	queryString := fmt.Sprintf(`SELECT
+			FORMAT_DATE("%%Y-%%m-%%d", DATE(usage_start_time)) as usage_date,
+			resource.name as resource_name,
+			service.description as service,
+			sku.description as sku,
+			SUM(cost) + SUM(IFNULL((SELECT SUM(c.amount) FROM UNNEST(credits) AS c), 0)) as cost
+		FROM %s
+		WHERE usage_start_time >= "%s" AND usage_start_time < "%s" AND resource.name IS NOT NULL
+		GROUP BY usage_date, resource_name, service, sku`, c.BillingDataDataset, start.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05"))
+	klog.V(3).Infof("Querying \"%s\" with : %s", c.ProjectID, queryString)
+
+	ctx := context.Background()
+	client, err := bigquery.NewClient(ctx, c.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	it, err := client.Query(queryString).Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	items := map[string]*BillingLineItem{}
+	var itemsArr []*BillingLineItem
+	for {
+		var row gcpBillingRow
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		day, err := time.Parse("2006-01-02", row.UsageDate)
+		if err != nil {
+			klog.Infof("Error parsing billing date `%s`", row.UsageDate)
+			continue
+		}
+
+		category := gcpBillingCategory(row.Service, row.SKU)
+		key := fmt.Sprintf("%s/%s/%s", row.UsageDate, category, row.ResourceName)
+		if item, ok := items[key]; ok {
+			item.Cost += row.Cost
+			continue
+		}
+		items[key] = &BillingLineItem{
+			Start:      day,
+			End:        day.AddDate(0, 0, 1),
+			Category:   category,
+			ProviderID: row.ResourceName,
+			Cost:       row.Cost,
+		}
+		itemsArr = append(itemsArr, items[key])
+	}
+
+	return itemsArr, nil
+}
+
+// gcpBillingCategory returns the Asset category of a billed SKU of the given
+// service
+func gcpBillingCategory(service, sku string) string {
+	if service != "Compute Engine" {
+		return kubecost.OtherCategory
+	}
+
+	sku = strings.ToLower(sku)
+	switch {
+	case strings.Contains(sku, "pd capacity") || strings.Contains(sku, "pd storage"):
+		return kubecost.StorageCategory
+	case strings.Contains(sku, "load balancing") || strings.Contains(sku, "forwarding rule"):
+		return kubecost.NetworkCategory
+	case strings.Contains(sku, "core") || strings.Contains(sku, "ram") || strings.Contains(sku, "gpu"):
+		return kubecost.ComputeCategory
+	}
+	return kubecost.OtherCategory
+}
+
 // QuerySQL should query BigQuery for billing data for out of cluster costs.
 func (gcp *GCP) QuerySQL(query string) ([]*OutOfClusterAllocation, error) {
 	c, err := gcp.Config.GetCustomPricingData()
@@ -977,6 +1183,23 @@ func (gcp *GCP) DownloadPricingData() error {
 		inputkeys[key.Features()] = key
 	}
 
+	// Price the predefined machine types of the regions of the cluster's
+	// nodes, too, so that they can be recommended as InstanceShapes
+	regions := map[string]bool{}
+	for _, n := range nodeList {
+		if region, ok := util.GetRegion(n.GetObjectMeta().GetLabels()); ok {
+			regions[strings.ToLower(region)] = true
+		}
+	}
+	for region := range regions {
+		for name := range gcpMachineTypes() {
+			key := gcpMachineTypeKey(region, name)
+			if _, ok := inputkeys[key.Features()]; !ok {
+				inputkeys[key.Features()] = key
+			}
+		}
+	}
+
 	pvList := gcp.Clientset.GetAllPersistentVolumes()
 	storageClasses := gcp.Clientset.GetAllStorageClasses()
 	storageClassMap := make(map[string]map[string]string)
@@ -1227,6 +1450,28 @@ func (gcp *GCP) ApplyReservedInstancePricing(nodes map[string]*Node) {
 	}
 }
 
+// GetCommitments returns the active committed use discounts, which reserve
+// amounts of CPU and RAM in a region rather than specific instances
+func (gcp *GCP) GetCommitments() ([]*Commitment, error) {
+	var commitments []*Commitment
+
+	for _, r := range gcp.ReservedInstances {
+		start, end := r.StartDate, r.EndDate
+		commitments = append(commitments, &Commitment{
+			ID:         fmt.Sprintf("%s/%s/%s", r.Region, r.Plan.Name, start.Format(time.RFC3339)),
+			Type:       CommitmentCommittedUseDiscount,
+			Region:     r.Region,
+			CPUCores:   float64(r.ReservedCPU),
+			RAMBytes:   float64(r.ReservedRAM),
+			HourlyCost: float64(r.ReservedCPU)*r.Plan.CPUCost + float64(r.ReservedRAM)/1024.0/1024.0/1024.0*r.Plan.RAMCost,
+			Start:      &start,
+			End:        &end,
+		})
+	}
+
+	return commitments, nil
+}
+
 func (gcp *GCP) getReservedInstances() ([]*GCPReservedInstance, error) {
 	var results []*GCPReservedInstance
 
@@ -1349,6 +1594,12 @@ func (gcp *gcpKey) ID() string {
 	return ""
 }
 
+// GPUShare returns the fraction of a GPU that one unit of the given GPU
+// resource represents on the node
+func (gcp *gcpKey) GPUShare(resource string) float64 {
+	return GPUShare(resource, gcp.Labels)
+}
+
 func (gcp *gcpKey) GPUType() string {
 	if t, ok := gcp.Labels[GKE_GPU_TAG]; ok {
 		var usageType string
@@ -1400,6 +1651,100 @@ func (gcp *GCP) AllNodePricing() (interface{}, error) {
 	return gcp.Pricing, nil
 }
 
+// gcpMachineType is the size of a predefined machine type.
+type gcpMachineType struct {
+	vCPUs     float64
+	memoryGiB float64
+}
+
+// gcpMachineTypes returns the predefined machine types of the general purpose
+// and compute optimized families which GKE commonly runs, by name. Machine
+// types of a series are sized in proportion to their vCPUs.
+func gcpMachineTypes() map[string]gcpMachineType {
+	machineTypes := map[string]gcpMachineType{}
+
+	series := []struct {
+		prefix     string
+		vCPUs      []float64
+		gibPerVCPU float64
+	}{
+		{"e2-standard", []float64{2, 4, 8, 16, 32}, 4},
+		{"e2-highmem", []float64{2, 4, 8, 16}, 8},
+		{"e2-highcpu", []float64{2, 4, 8, 16, 32}, 1},
+		{"n1-standard", []float64{1, 2, 4, 8, 16, 32, 64, 96}, 3.75},
+		{"n1-highmem", []float64{2, 4, 8, 16, 32, 64, 96}, 6.5},
+		{"n1-highcpu", []float64{2, 4, 8, 16, 32, 64, 96}, 0.9},
+		{"n2-standard", []float64{2, 4, 8, 16, 32, 48, 64, 80, 96, 128}, 4},
+		{"n2-highmem", []float64{2, 4, 8, 16, 32, 48, 64, 80, 96, 128}, 8},
+		{"n2-highcpu", []float64{2, 4, 8, 16, 32, 48, 64, 80, 96}, 1},
+		{"n2d-standard", []float64{2, 4, 8, 16, 32, 48, 64, 80, 96, 128, 224}, 4},
+		{"c2-standard", []float64{4, 8, 16, 30, 60}, 4},
+	}
+	for _, s := range series {
+		for _, vCPUs := range s.vCPUs {
+			name := fmt.Sprintf("%s-%d", s.prefix, int(vCPUs))
+			machineTypes[name] = gcpMachineType{vCPUs: vCPUs, memoryGiB: vCPUs * s.gibPerVCPU}
+		}
+	}
+
+	return machineTypes
+}
+
+// gcpMachineTypeKey returns the key of the pricing of the given machine type
+// in the given region, as a node of it would be priced on demand.
+func gcpMachineTypeKey(region, machineType string) *gcpKey {
+	return &gcpKey{
+		Labels: map[string]string{
+			v1.LabelZoneRegion:   region,
+			v1.LabelInstanceType: machineType,
+		},
+	}
+}
+
+// InstanceShapes returns the predefined machine types of gcpMachineTypes in
+// each region of the cluster's nodes, at the prices per vCPU and GiB of RAM
+// of their families. The billing catalog lists the prices of families, not
+// of machine types, so the sizes of the machine types are built in.
+func (gcp *GCP) InstanceShapes() ([]*InstanceShape, error) {
+	gcp.DownloadPricingDataLock.RLock()
+	defer gcp.DownloadPricingDataLock.RUnlock()
+
+	regions := map[string]bool{}
+	for key := range gcp.Pricing {
+		if parts := strings.Split(key, ","); len(parts) == 3 && parts[2] == "ondemand" {
+			regions[parts[0]] = true
+		}
+	}
+
+	shapes := []*InstanceShape{}
+	for region := range regions {
+		for name, mt := range gcpMachineTypes() {
+			pricing, ok := gcp.Pricing[gcpMachineTypeKey(region, name).Features()]
+			if !ok || pricing.Node == nil {
+				continue
+			}
+			cpuCost, err := strconv.ParseFloat(pricing.Node.VCPUCost, 64)
+			if err != nil || cpuCost <= 0 {
+				continue
+			}
+			ramCost, err := strconv.ParseFloat(pricing.Node.RAMCost, 64)
+			if err != nil || ramCost <= 0 {
+				continue
+			}
+
+			shapes = append(shapes, &InstanceShape{
+				Region:       region,
+				InstanceType: name,
+				CPUCores:     mt.vCPUs,
+				RAMBytes:     mt.memoryGiB * 1024 * 1024 * 1024,
+				HourlyCost:   mt.vCPUs*cpuCost + mt.memoryGiB*ramCost,
+			})
+		}
+	}
+
+	return shapes, nil
+}
+
 func (gcp *GCP) getPricing(key Key) (*GCPPricing, bool) {
 	gcp.DownloadPricingDataLock.RLock()
 	defer gcp.DownloadPricingDataLock.RUnlock()
@@ -0,0 +1,88 @@
+package cloud
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Resource names and node labels published by the NVIDIA device plugin and
+// GPU feature discovery, which describe GPUs partitioned by MIG (Multi-
+// Instance GPU) or shared by time-slicing.
+const (
+	GPUResourceName   = "nvidia.com/gpu"
+	MIGResourcePrefix = "nvidia.com/mig-"
+	GPUCountLabel     = "nvidia.com/gpu.count"
+	GPUProductLabel   = "nvidia.com/gpu.product"
+	GPUReplicasLabel  = "nvidia.com/gpu.replicas"
+	MIGStrategyLabel  = "nvidia.com/mig.strategy"
+)
+
+// MIGComputeSlices is the number of compute slices into which MIG partitions
+// a GPU; e.g. a "3g.20gb" profile is 3 of 7 slices.
+const MIGComputeSlices = 7
+
+// migProfileRx matches the compute slices of a MIG profile, as named by a
+// resource, e.g. "nvidia.com/mig-3g.20gb", by a product label, e.g.
+// "A100-SXM4-40GB-MIG-3g.20gb", or by kube-state-metrics, which sanitizes
+// resource names, e.g. "nvidia_com_mig_3g_20gb".
+var migProfileRx = regexp.MustCompile(`(?i)mig[-_](\d+)g[._]`)
+
+var invalidLabelCharRx = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// SanitizeResourceName converts a Kubernetes resource name to the form used
+// by kube-state-metrics in its "resource" label; e.g. "nvidia.com/gpu" is
+// "nvidia_com_gpu".
+func SanitizeResourceName(resource string) string {
+	return invalidLabelCharRx.ReplaceAllString(resource, "_")
+}
+
+// IsGPUResource returns true if the given resource, by its Kubernetes name or
+// as sanitized by kube-state-metrics, is a whole GPU or a MIG profile.
+func IsGPUResource(resource string) bool {
+	r := SanitizeResourceName(resource)
+	return r == SanitizeResourceName(GPUResourceName) || strings.HasPrefix(r, SanitizeResourceName(MIGResourcePrefix))
+}
+
+// GPUShare returns the fraction of a physical GPU that one unit of the given
+// GPU resource represents on a node with the given labels: the fraction of
+// compute slices of a MIG profile, divided among the replicas of a time-sliced
+// GPU. Without MIG or time-slicing, one unit is one GPU.
+func GPUShare(resource string, labels map[string]string) float64 {
+	share := 1.0
+
+	// With the "single" MIG strategy, every GPU on the node is partitioned by
+	// the same profile, which is named by the product, rather than resource
+	profile := resource
+	if SanitizeResourceName(resource) == SanitizeResourceName(GPUResourceName) && labels[MIGStrategyLabel] == "single" {
+		profile = labels[GPUProductLabel]
+	}
+	if match := migProfileRx.FindStringSubmatch(profile); match != nil {
+		slices, err := strconv.Atoi(match[1])
+		if err == nil && slices > 0 && slices <= MIGComputeSlices {
+			share = float64(slices) / MIGComputeSlices
+		}
+	}
+
+	if replicas, err := strconv.Atoi(labels[GPUReplicasLabel]); err == nil && replicas > 1 {
+		share /= float64(replicas)
+	}
+
+	return share
+}
+
+// GPUShares maps each GPU resource in the given capacity to the fraction of a
+// physical GPU that one unit represents, according to the given Key. The map
+// is empty if the capacity includes no GPU resources.
+func GPUShares(key Key, capacity v1.ResourceList) map[string]float64 {
+	shares := map[string]float64{}
+	for name := range capacity {
+		resource := string(name)
+		if IsGPUResource(resource) {
+			shares[resource] = key.GPUShare(resource)
+		}
+	}
+	return shares
+}
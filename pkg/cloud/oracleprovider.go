@@ -0,0 +1,672 @@
+package cloud
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/clustercache"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/util"
+	"github.com/kubecost/cost-model/pkg/util/json"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+const OraclePriceListURL = "https://apexapps.oracle.com/pls/apex/cetools/api/v1/products/?currencyCode=USD"
+
+// OraclePreemptibleLabel is the default label marking preemptible nodes,
+// which may be overridden by the spotLabel and spotLabelValue of the config.
+const OraclePreemptibleLabel = "oci.oraclecloud.com/preemptible"
+const OraclePreemptibleLabelValue = "true"
+
+// OraclePreemptibleDiscount is the discount of preemptible instances from the
+// price of on-demand instances.
+const OraclePreemptibleDiscount = 0.5
+
+// OracleVPUsPerGBParameter is the storage class parameter of the OCI block
+// volume CSI plugin defining the performance of volumes, in VPUs per GB.
+const OracleVPUsPerGBParameter = "vpusPerGB"
+
+// Block volumes are balanced unless configured otherwise
+const oracleDefaultVPUsPerGB = 10
+
+// OraclePriceList is the list of products of the OCI price list API.
+type OraclePriceList struct {
+	Items []*OracleProduct `json:"items"`
+}
+
+type OracleProduct struct {
+	PartNumber                string                  `json:"partNumber"`
+	DisplayName               string                  `json:"displayName"`
+	MetricName                string                  `json:"metricName"`
+	ServiceCategory           string                  `json:"serviceCategory"`
+	CurrencyCodeLocalizations []*OracleCurrencyPrices `json:"currencyCodeLocalizations"`
+}
+
+type OracleCurrencyPrices struct {
+	CurrencyCode string         `json:"currencyCode"`
+	Prices       []*OraclePrice `json:"prices"`
+}
+
+type OraclePrice struct {
+	Model string  `json:"model"`
+	Value float64 `json:"value"`
+}
+
+// Price returns the pay-as-you-go price of the product in the given currency.
+// Products priced in tiers, e.g. after a free allowance, return the highest
+// tier's price.
+func (op *OracleProduct) Price(currency string) (float64, bool) {
+	price, ok := 0.0, false
+	for _, ccl := range op.CurrencyCodeLocalizations {
+		if ccl.CurrencyCode != currency {
+			continue
+		}
+		for _, p := range ccl.Prices {
+			if p.Model == "PAY_AS_YOU_GO" && (!ok || p.Value > price) {
+				price, ok = p.Value, true
+			}
+		}
+	}
+	return price, ok
+}
+
+// OracleShapePrice is the hourly price of an OCPU and of a GB of memory of the
+// shapes of a series, e.g. "E4".
+type OracleShapePrice struct {
+	OCPU   float64
+	Memory float64
+}
+
+// OraclePricing is the pricing parsed from the price list.
+type OraclePricing struct {
+	Shapes                 map[string]*OracleShapePrice
+	BlockVolume            float64 // per GB-month
+	BlockVolumePerformance float64 // per VPU per GB-month
+	LoadBalancer           float64 // per hour
+}
+
+type Oracle struct {
+	Pricing                 *OraclePricing
+	PricingLocation         string // URL or path of the price list, overriding the config
+	PricingStatus           string
+	DownloadPricingDataLock sync.RWMutex
+	Clientset               clustercache.ClusterCache
+	Config                  *ProviderConfig
+	ServiceAccountChecks    map[string]*ServiceAccountCheck
+}
+
+type oracleKey struct {
+	Labels         map[string]string
+	ProviderID     string
+	SpotLabel      string
+	SpotLabelValue string
+}
+
+func (k *oracleKey) isPreemptible() bool {
+	return k.SpotLabel != "" && k.Labels[k.SpotLabel] == k.SpotLabelValue
+}
+
+// Features returns the series of the node's shape, by which shapes are
+// priced in every region.
+func (k *oracleKey) Features() string {
+	usageType := "ondemand"
+	if k.isPreemptible() {
+		usageType = PreemptibleType
+	}
+	return fmt.Sprintf("%s,%s", oracleShapeSeries(k.shape()), usageType)
+}
+
+func (k *oracleKey) shape() string {
+	shape, _ := util.GetInstanceType(k.Labels)
+	return shape
+}
+
+// GPUShare returns the fraction of a GPU that one unit of the given GPU
+// resource represents on the node
+func (k *oracleKey) GPUShare(resource string) float64 {
+	return GPUShare(resource, k.Labels)
+}
+
+func (k *oracleKey) GPUType() string {
+	if strings.Contains(k.shape(), ".GPU") {
+		return k.shape()
+	}
+	return ""
+}
+
+func (k *oracleKey) ID() string {
+	return k.ProviderID
+}
+
+// oracleShapeSeries returns the series of the given shape, e.g. "E4" of
+// "VM.Standard.E4.Flex" and "Standard2" of "VM.Standard2.4".
+func oracleShapeSeries(shape string) string {
+	parts := strings.Split(shape, ".")
+	for len(parts) > 0 {
+		last := parts[len(parts)-1]
+		if _, err := strconv.Atoi(last); err != nil && last != "Flex" {
+			break
+		}
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[len(parts)-1]
+}
+
+// oracleVCPUsPerOCPU returns the number of vCPUs of an OCPU of the given
+// series; an OCPU is one core, which has two hardware threads on x86 shapes.
+func oracleVCPUsPerOCPU(series string) float64 {
+	if strings.HasPrefix(series, "A") {
+		return 1.0
+	}
+	return 2.0
+}
+
+type oraclePVKey struct {
+	Labels                 map[string]string
+	StorageClass           string
+	StorageClassParameters map[string]string
+	VPUsPerGB              int
+	ProviderID             string
+}
+
+func (key *oraclePVKey) ID() string {
+	return key.ProviderID
+}
+
+func (key *oraclePVKey) GetStorageClass() string {
+	return key.StorageClass
+}
+
+func (key *oraclePVKey) Features() string {
+	return fmt.Sprintf("blockvolume,%d", key.VPUsPerGB)
+}
+
+// ParseOraclePriceList parses the compute, block volume and load balancer
+// prices, in the given currency, of the price list read from the given
+// reader.
+func ParseOraclePriceList(r io.Reader, currency string) (*OraclePricing, error) {
+	var priceList OraclePriceList
+	err := json.NewDecoder(r).Decode(&priceList)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing price list: %s", err)
+	}
+
+	pricing := &OraclePricing{
+		Shapes: make(map[string]*OracleShapePrice),
+	}
+	for _, item := range priceList.Items {
+		price, ok := item.Price(currency)
+		if !ok {
+			continue
+		}
+
+		// e.g. "Compute - Standard - E4 - OCPU" or "Compute - Ampere A1 - Memory"
+		parts := strings.Split(item.DisplayName, " - ")
+		switch {
+		case len(parts) >= 3 && parts[0] == "Compute":
+			words := strings.Fields(parts[len(parts)-2])
+			if len(words) == 0 {
+				continue
+			}
+			series := words[len(words)-1]
+			if _, ok := pricing.Shapes[series]; !ok {
+				pricing.Shapes[series] = &OracleShapePrice{}
+			}
+			switch parts[len(parts)-1] {
+			case "OCPU":
+				pricing.Shapes[series].OCPU = price
+			case "Memory":
+				pricing.Shapes[series].Memory = price
+			}
+		case strings.Contains(item.DisplayName, "Block Volume - Performance Units"):
+			pricing.BlockVolumePerformance = price
+		case strings.Contains(item.DisplayName, "Block Volume - Storage"):
+			pricing.BlockVolume = price
+		case strings.Contains(item.DisplayName, "Load Balancer Base"):
+			pricing.LoadBalancer = price
+		}
+	}
+
+	return pricing, nil
+}
+
+// DownloadPricingData loads the compute, block volume and load balancer
+// pricing of the OCI price list; nodes of shapes missing from it are priced
+// by the config's defaults.
+func (oracle *Oracle) DownloadPricingData() error {
+	oracle.DownloadPricingDataLock.Lock()
+	defer oracle.DownloadPricingDataLock.Unlock()
+
+	c, err := oracle.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	location := oracle.PricingLocation
+	if location == "" {
+		location = c.OraclePricingURL
+	}
+	if location == "" {
+		location = OraclePriceListURL
+	}
+
+	r, err := openPriceList(location, "")
+	if err != nil {
+		oracle.PricingStatus = err.Error()
+		return fmt.Errorf("error loading price list: %s", err)
+	}
+	defer r.Close()
+
+	pricing, err := ParseOraclePriceList(r, c.CurrencyCode)
+	if err != nil {
+		oracle.PricingStatus = err.Error()
+		return err
+	}
+	klog.V(2).Infof("Loaded prices of %d shape series from Oracle price list", len(pricing.Shapes))
+
+	oracle.Pricing = pricing
+	oracle.PricingStatus = ""
+	return nil
+}
+
+// AllNodePricing returns the Oracle pricing objects stored
+func (oracle *Oracle) AllNodePricing() (interface{}, error) {
+	oracle.DownloadPricingDataLock.RLock()
+	defer oracle.DownloadPricingDataLock.RUnlock()
+	return oracle.Pricing, nil
+}
+
+// Sizes of the flexible shapes returned by InstanceShapes, in vCPUs and in GB
+// of memory per vCPU. Flexible shapes may be sized freely, so these are the
+// sizes of the general purpose, compute and memory optimized shapes of other
+// providers.
+var (
+	oracleFlexVCPUs     = []float64{2, 4, 8, 16, 32, 64}
+	oracleFlexGBPerVCPU = []float64{2, 4, 8}
+)
+
+// oracleFlexShape returns the name of the flexible shape of the given series,
+// e.g. "VM.Standard.E4.Flex" of "E4" and "VM.Standard3.Flex" of "Standard3".
+func oracleFlexShape(series string) string {
+	if strings.HasPrefix(series, "Standard") || strings.HasPrefix(series, "Optimized") {
+		return fmt.Sprintf("VM.%s.Flex", series)
+	}
+	return fmt.Sprintf("VM.Standard.%s.Flex", series)
+}
+
+// InstanceShapes returns sizes of the flexible shape of each series of the
+// price list, which are priced the same in every region. Sizes of the same
+// shape are distinguished by their OCPUs and memory, e.g.
+// "VM.Standard.E4.Flex (2 OCPU, 16 GB)".
+func (oracle *Oracle) InstanceShapes() ([]*InstanceShape, error) {
+	oracle.DownloadPricingDataLock.RLock()
+	defer oracle.DownloadPricingDataLock.RUnlock()
+
+	if oracle.Pricing == nil {
+		return nil, nil
+	}
+
+	shapes := []*InstanceShape{}
+	for series, price := range oracle.Pricing.Shapes {
+		if price.OCPU <= 0 || price.Memory <= 0 {
+			continue
+		}
+		vcpusPerOCPU := oracleVCPUsPerOCPU(series)
+		for _, vcpus := range oracleFlexVCPUs {
+			for _, gbPerVCPU := range oracleFlexGBPerVCPU {
+				ocpus := vcpus / vcpusPerOCPU
+				memory := vcpus * gbPerVCPU
+				shapes = append(shapes, &InstanceShape{
+					InstanceType: fmt.Sprintf("%s (%g OCPU, %g GB)", oracleFlexShape(series), ocpus, memory),
+					CPUCores:     vcpus,
+					RAMBytes:     memory * 1024 * 1024 * 1024,
+					HourlyCost:   ocpus*price.OCPU + memory*price.Memory,
+				})
+			}
+		}
+	}
+
+	return shapes, nil
+}
+
+// NodePricing returns the prices of a vCPU and of a GB of RAM of the node's
+// shape. Preemptible instances are discounted from those prices.
+func (oracle *Oracle) NodePricing(key Key) (*Node, error) {
+	oracle.DownloadPricingDataLock.RLock()
+	defer oracle.DownloadPricingDataLock.RUnlock()
+
+	c, err := oracle.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("No default pricing data available")
+	}
+
+	k, isOracleKey := key.(*oracleKey)
+	if isOracleKey && oracle.Pricing != nil {
+		series := oracleShapeSeries(k.shape())
+		if sp, found := oracle.Pricing.Shapes[series]; found && sp.OCPU > 0 {
+			vcpuCost := sp.OCPU / oracleVCPUsPerOCPU(series)
+			ramCost := sp.Memory
+			usageType := "ondemand"
+			if k.isPreemptible() {
+				vcpuCost *= 1.0 - OraclePreemptibleDiscount
+				ramCost *= 1.0 - OraclePreemptibleDiscount
+				usageType = PreemptibleType
+			}
+			return &Node{
+				VCPUCost:     fmt.Sprintf("%f", vcpuCost),
+				RAMCost:      fmt.Sprintf("%f", ramCost),
+				BaseCPUPrice: c.CPU,
+				BaseRAMPrice: c.RAM,
+				BaseGPUPrice: c.GPU,
+				InstanceType: k.shape(),
+				UsageType:    usageType,
+			}, nil
+		}
+	}
+	klog.V(1).Infof("[Warning] no pricing data found for %s: %s", key.Features(), key)
+
+	if isOracleKey && k.isPreemptible() {
+		return &Node{
+			VCPUCost:  c.SpotCPU,
+			RAMCost:   c.SpotRAM,
+			GPUCost:   c.SpotGPU,
+			UsageType: PreemptibleType,
+		}, nil
+	}
+	if key.GPUType() != "" {
+		return &Node{
+			VCPUCost: c.CPU,
+			RAMCost:  c.RAM,
+			GPUCost:  c.GPU,
+		}, nil
+	}
+	return &Node{
+		VCPUCost:         c.CPU,
+		RAMCost:          c.RAM,
+		UsesBaseCPUPrice: true,
+	}, nil
+}
+
+// PVPricing returns the hourly price of a GB of block volume storage at the
+// volume's performance, defaulting to the config's storage price.
+func (oracle *Oracle) PVPricing(pvk PVKey) (*PV, error) {
+	oracle.DownloadPricingDataLock.RLock()
+	defer oracle.DownloadPricingDataLock.RUnlock()
+
+	if opvk, ok := pvk.(*oraclePVKey); ok && oracle.Pricing != nil && oracle.Pricing.BlockVolume > 0 {
+		monthly := oracle.Pricing.BlockVolume + float64(opvk.VPUsPerGB)*oracle.Pricing.BlockVolumePerformance
+		return &PV{
+			Cost:  fmt.Sprintf("%.10f", monthly/util.HoursPerMonth),
+			Class: opvk.StorageClass,
+		}, nil
+	}
+	klog.V(4).Infof("Persistent Volume pricing not found for %s: %s", pvk.GetStorageClass(), pvk.Features())
+
+	c, err := oracle.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &PV{
+		Cost: c.Storage,
+	}, nil
+}
+
+// NetworkPricing returns the network egress prices of the config
+func (oracle *Oracle) NetworkPricing() (*Network, error) {
+	cpricing, err := oracle.Config.GetCustomPricingData()
+	if err != nil {
+		return nil, err
+	}
+	znec, err := strconv.ParseFloat(cpricing.ZoneNetworkEgress, 64)
+	if err != nil {
+		return nil, err
+	}
+	rnec, err := strconv.ParseFloat(cpricing.RegionNetworkEgress, 64)
+	if err != nil {
+		return nil, err
+	}
+	inec, err := strconv.ParseFloat(cpricing.InternetNetworkEgress, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Network{
+		ZoneNetworkEgressCost:     znec,
+		RegionNetworkEgressCost:   rnec,
+		InternetNetworkEgressCost: inec,
+	}, nil
+}
+
+// LoadBalancerPricing returns the hourly base price of a flexible load
+// balancer, excluding its bandwidth.
+func (oracle *Oracle) LoadBalancerPricing() (*LoadBalancer, error) {
+	oracle.DownloadPricingDataLock.RLock()
+	defer oracle.DownloadPricingDataLock.RUnlock()
+
+	cost := 0.0113
+	if oracle.Pricing != nil && oracle.Pricing.LoadBalancer > 0 {
+		cost = oracle.Pricing.LoadBalancer
+	}
+	return &LoadBalancer{
+		Cost: cost,
+	}, nil
+}
+
+func (oracle *Oracle) GetKey(labels map[string]string, n *v1.Node) Key {
+	cfg, err := oracle.GetConfig()
+	if err != nil {
+		klog.Infof("Error loading oracle custom pricing information")
+	}
+	spotLabel := OraclePreemptibleLabel
+	spotLabelValue := OraclePreemptibleLabelValue
+	if cfg != nil && cfg.SpotLabel != "" {
+		spotLabel = cfg.SpotLabel
+		spotLabelValue = cfg.SpotLabelValue
+	}
+	return &oracleKey{
+		Labels:         labels,
+		ProviderID:     oracle.ParseID(n.Spec.ProviderID),
+		SpotLabel:      spotLabel,
+		SpotLabelValue: spotLabelValue,
+	}
+}
+
+// GetPVKey returns a key of the performance of the block volume, defined by
+// its storage class.
+func (oracle *Oracle) GetPVKey(pv *v1.PersistentVolume, parameters map[string]string, defaultRegion string) PVKey {
+	vpus, err := strconv.Atoi(parameters[OracleVPUsPerGBParameter])
+	if err != nil {
+		vpus = oracleDefaultVPUsPerGB
+	}
+	providerID := ""
+	if pv.Spec.CSI != nil {
+		providerID = pv.Spec.CSI.VolumeHandle
+	}
+	return &oraclePVKey{
+		Labels:                 pv.Labels,
+		StorageClass:           pv.Spec.StorageClassName,
+		StorageClassParameters: parameters,
+		VPUsPerGB:              vpus,
+		ProviderID:             providerID,
+	}
+}
+
+func (*Oracle) GetAddresses() ([]byte, error) {
+	return nil, nil
+}
+
+func (*Oracle) GetDisks() ([]byte, error) {
+	return nil, nil
+}
+
+func (*Oracle) GetCommitments() ([]*Commitment, error) {
+	return nil, nil
+}
+
+func (*Oracle) BillingLineItems(start, end time.Time) ([]*BillingLineItem, error) {
+	return nil, nil
+}
+
+func (oracle *Oracle) ClusterInfo() (map[string]string, error) {
+	remoteEnabled := env.IsRemoteEnabled()
+
+	m := make(map[string]string)
+	m["name"] = "Oracle Cluster #1"
+	c, err := oracle.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if c.ClusterName != "" {
+		m["name"] = c.ClusterName
+	}
+	m["provider"] = "oracle"
+	m["remoteReadEnabled"] = strconv.FormatBool(remoteEnabled)
+	m["id"] = env.GetClusterID()
+	return m, nil
+}
+
+func (oracle *Oracle) GetManagementPlatform() (string, error) {
+	nodes := oracle.Clientset.GetAllNodes()
+
+	if len(nodes) > 0 {
+		for label := range nodes[0].Labels {
+			if strings.HasPrefix(label, "oke.oraclecloud.com/") {
+				return "oke", nil
+			}
+		}
+	}
+	return "", nil
+}
+
+func (oracle *Oracle) UpdateConfigFromConfigMap(a map[string]string) (*CustomPricing, error) {
+	return oracle.Config.UpdateFromMap(a)
+}
+
+func (oracle *Oracle) UpdateConfig(r io.Reader, updateType string) (*CustomPricing, error) {
+	defer oracle.DownloadPricingData()
+
+	return oracle.Config.Update(func(c *CustomPricing) error {
+		a := make(map[string]interface{})
+		err := json.NewDecoder(r).Decode(&a)
+		if err != nil {
+			return err
+		}
+		for k, v := range a {
+			kUpper := strings.Title(k) // Just so we consistently supply / receive the same values, uppercase the first letter.
+			vstr, ok := v.(string)
+			if ok {
+				err := SetCustomPricingField(c, kUpper, vstr)
+				if err != nil {
+					return err
+				}
+			} else {
+				sci := v.(map[string]interface{})
+				sc := make(map[string]string)
+				for k, val := range sci {
+					sc[k] = val.(string)
+				}
+				err := SetCustomPricingMapField(c, k, sc)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if env.IsRemoteEnabled() {
+			err := UpdateClusterMeta(env.GetClusterID(), c.ClusterName)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (oracle *Oracle) GetConfig() (*CustomPricing, error) {
+	c, err := oracle.Config.GetCustomPricingData()
+	if err != nil {
+		return nil, err
+	}
+	if c.Discount == "" {
+		c.Discount = "0%"
+	}
+	if c.NegotiatedDiscount == "" {
+		c.NegotiatedDiscount = "0%"
+	}
+	if c.CurrencyCode == "" {
+		c.CurrencyCode = "USD"
+	}
+	return c, nil
+}
+
+func (*Oracle) GetLocalStorageQuery(window, offset string, rate bool, used bool) string {
+	return ""
+}
+
+func (*Oracle) ExternalAllocations(start string, end string, aggregator []string, filterType string, filterValue string, crossCluster bool) ([]*OutOfClusterAllocation, error) {
+	return nil, nil
+}
+
+func (*Oracle) ExternalAssets(start, end time.Time, queryLabels map[string]string) ([]*kubecost.Cloud, error) {
+	return nil, nil
+}
+
+func (*Oracle) ApplyReservedInstancePricing(nodes map[string]*Node) {
+
+}
+
+func (oracle *Oracle) ServiceAccountStatus() *ServiceAccountStatus {
+	checks := []*ServiceAccountCheck{}
+	for _, v := range oracle.ServiceAccountChecks {
+		checks = append(checks, v)
+	}
+	return &ServiceAccountStatus{
+		Checks: checks,
+	}
+}
+
+func (oracle *Oracle) PricingSourceStatus() map[string]*PricingSource {
+	oracle.DownloadPricingDataLock.RLock()
+	defer oracle.DownloadPricingDataLock.RUnlock()
+
+	pls := &PricingSource{
+		Name:      APIPricingSource,
+		Available: oracle.Pricing != nil && oracle.PricingStatus == "",
+		Error:     oracle.PricingStatus,
+	}
+	return map[string]*PricingSource{
+		APIPricingSource: pls,
+	}
+}
+
+func (*Oracle) ClusterManagementPricing() (string, float64, error) {
+	return "", 0.0, nil
+}
+
+func (oracle *Oracle) CombinedDiscountForNode(instanceType string, isPreemptible bool, defaultDiscount, negotiatedDiscount float64) float64 {
+	return 1.0 - ((1.0 - defaultDiscount) * (1.0 - negotiatedDiscount))
+}
+
+// ParseID returns the OCID of the instance of the given provider ID.
+func (oracle *Oracle) ParseID(id string) string {
+	return strings.TrimPrefix(id, "oci://")
+}
+
+func (oracle *Oracle) ParsePVID(id string) string {
+	return id
+}
+
+func (oracle *Oracle) ParseLBID(id string) string {
+	return id
+}
@@ -5,7 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"os"
 	"strings"
+	"time"
 
 	"k8s.io/klog"
 
@@ -13,6 +16,7 @@ import (
 
 	"github.com/kubecost/cost-model/pkg/clustercache"
 	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/kubecost"
 
 	v1 "k8s.io/api/core/v1"
 )
@@ -37,6 +41,56 @@ type ReservedInstanceData struct {
 	RAMCost     float64 `json:"RAMHourlyCost"`
 }
 
+// CommitmentType describes how a Commitment discounts usage
+type CommitmentType string
+
+const (
+	CommitmentReservedInstance     CommitmentType = "reservedInstance"
+	CommitmentSavingsPlan          CommitmentType = "savingsPlan"
+	CommitmentCommittedUseDiscount CommitmentType = "committedUseDiscount"
+)
+
+// Commitment is a purchased reservation, savings plan, or committed use
+// discount. Commitments applying to specific instances list them in
+// ResourceIDs; commitments to amounts of resources in a region, such as GCP
+// committed use discounts, set CPUCores and RAMBytes instead.
+type Commitment struct {
+	ID          string         `json:"id"`
+	Type        CommitmentType `json:"type"`
+	Region      string         `json:"region"`
+	ResourceIDs []string       `json:"resourceIDs,omitempty"`
+	CPUCores    float64        `json:"cpuCores,omitempty"`
+	RAMBytes    float64        `json:"ramBytes,omitempty"`
+	HourlyCost  float64        `json:"hourlyCost,omitempty"`
+	Start       *time.Time     `json:"start,omitempty"`
+	End         *time.Time     `json:"end,omitempty"`
+}
+
+// BillingLineItem is the cost billed by a cloud provider for one resource
+// over one day, net of any credits and discounts the bill applies to it.
+// ProviderID identifies the resource in the same form as ParseID, ParsePVID,
+// or ParseLBID, so that it can be matched to an Asset; Category is an Asset
+// category, e.g. kubecost.ComputeCategory.
+type BillingLineItem struct {
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Category   string    `json:"category"`
+	ProviderID string    `json:"providerID"`
+	Cost       float64   `json:"cost"`
+}
+
+// InstanceShape is an instance type which a provider offers on demand in a
+// region, at the hourly cost of its price list. Shapes without a region are
+// offered, at the same cost, in every region.
+type InstanceShape struct {
+	Region       string  `json:"region"`
+	InstanceType string  `json:"instanceType"`
+	CPUCores     float64 `json:"cpuCores"`
+	RAMBytes     float64 `json:"ramBytes"`
+	GPUs         float64 `json:"gpus"`
+	HourlyCost   float64 `json:"hourlyCost"`
+}
+
 // Node is the interface by which the provider and cost model communicate Node prices.
 // The provider will best-effort try to fill out this struct.
 type Node struct {
@@ -56,6 +110,7 @@ type Node struct {
 	GPU              string                `json:"gpu"` // GPU represents the number of GPU on the instance
 	GPUName          string                `json:"gpuName"`
 	GPUCost          string                `json:"gpuCost"`
+	GPUShares        map[string]float64    `json:"gpuShares,omitempty"` // GPUShares maps GPU resources, e.g. MIG profiles, to the fraction of a GPU each unit represents
 	InstanceType     string                `json:"instanceType,omitempty"`
 	Region           string                `json:"region,omitempty"`
 	Reserved         *ReservedInstanceData `json:"reserved,omitempty"`
@@ -106,9 +161,10 @@ type PV struct {
 
 // Key represents a way for nodes to match between the k8s API and a pricing API
 type Key interface {
-	ID() string       // ID represents an exact match
-	Features() string // Features are a comma separated string of node metadata that could match pricing
-	GPUType() string  // GPUType returns "" if no GPU exists, but the name of the GPU otherwise
+	ID() string                       // ID represents an exact match
+	Features() string                 // Features are a comma separated string of node metadata that could match pricing
+	GPUType() string                  // GPUType returns "" if no GPU exists, but the name of the GPU otherwise
+	GPUShare(resource string) float64 // GPUShare returns the fraction of a physical GPU represented by one unit of the given GPU resource, e.g. a MIG profile or time-sliced GPU
 }
 
 type PVKey interface {
@@ -126,6 +182,73 @@ type OutOfClusterAllocation struct {
 	Cluster     string  `json:"cluster"`
 }
 
+// openPriceList opens the price list at the given URL or file path. Requests
+// for URLs are authorized by the given bearer token, if any.
+func openPriceList(location, token string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return os.Open(location)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status fetching %s: %s", location, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// newExternalAsset returns a Cloud asset for the cost billed for an
+// out-of-cluster resource over the day starting at the given time.
+func newExternalAsset(provider, category, providerID string, day time.Time) *kubecost.Cloud {
+	end := day.AddDate(0, 0, 1)
+	asset := kubecost.NewCloud(category, providerID, day, end, kubecost.NewWindow(&day, &end))
+	asset.Properties().Provider = provider
+	return asset
+}
+
+// externalAssetDays returns the start of the UTC day containing the given
+// start, and the end of the UTC day containing the given end. Out-of-cluster
+// costs are billed by UTC day, so whole days are queried, and the costs of
+// days partially within a window are prorated by the caller.
+func externalAssetDays(start, end time.Time) (time.Time, time.Time) {
+	return kubecost.RoundBack(start.UTC(), 24*time.Hour), kubecost.RoundForward(end.UTC(), 24*time.Hour)
+}
+
+// ExternalAssetLabels returns the labels of an out-of-cluster asset with the
+// given tags, given the external query labels of a kubecost.LabelConfig. Tags
+// which are configured as external labels are also set under the name of the
+// property they represent, e.g. the "kubernetes_namespace" tag also sets
+// "namespace", so that AssetToExternalAllocation can match them. It returns
+// false if no tag is configured as an external label.
+func ExternalAssetLabels(tags map[string]string, queryLabels map[string]string) (kubecost.AssetLabels, bool) {
+	labels := kubecost.AssetLabels{}
+	match := false
+
+	for tag, value := range tags {
+		if value == "" {
+			continue
+		}
+		labels[tag] = value
+
+		if label, ok := queryLabels[tag]; ok {
+			labels[strings.TrimSuffix(label, "_external_label")] = value
+			match = true
+		}
+	}
+
+	return labels, match
+}
+
 type CustomPricing struct {
 	Provider                     string            `json:"provider"`
 	Description                  string            `json:"description"`
@@ -166,10 +289,15 @@ type CustomPricing struct {
 	AzureClientSecret            string            `json:"azureClientSecret"`
 	AzureTenantID                string            `json:"azureTenantID"`
 	AzureBillingRegion           string            `json:"azureBillingRegion"`
+	AlibabaPricingURL            string            `json:"alibabaPricingURL,omitempty"`
+	OraclePricingURL             string            `json:"oraclePricingURL,omitempty"`
+	DigitalOceanPricingURL       string            `json:"digitalOceanPricingURL,omitempty"`
+	DigitalOceanToken            string            `json:"digitalOceanToken,omitempty"`
 	CurrencyCode                 string            `json:"currencyCode"`
 	Discount                     string            `json:"discount"`
 	NegotiatedDiscount           string            `json:"negotiatedDiscount"`
 	SharedCosts                  map[string]string `json:"sharedCost"`
+	ExtendedResources            map[string]string `json:"extendedResources"`
 	ClusterName                  string            `json:"clusterName"`
 	SharedNamespaces             string            `json:"sharedNamespaces"`
 	SharedLabelNames             string            `json:"sharedLabelNames"`
@@ -219,11 +347,14 @@ type Provider interface {
 	ClusterInfo() (map[string]string, error)
 	GetAddresses() ([]byte, error)
 	GetDisks() ([]byte, error)
+	GetCommitments() ([]*Commitment, error)
+	BillingLineItems(start, end time.Time) ([]*BillingLineItem, error)
 	NodePricing(Key) (*Node, error)
 	PVPricing(PVKey) (*PV, error)
 	NetworkPricing() (*Network, error)           // TODO: add key interface arg for dynamic price fetching
 	LoadBalancerPricing() (*LoadBalancer, error) // TODO: add key interface arg for dynamic price fetching
 	AllNodePricing() (interface{}, error)
+	InstanceShapes() ([]*InstanceShape, error)
 	DownloadPricingData() error
 	GetKey(map[string]string, *v1.Node) Key
 	GetPVKey(*v1.PersistentVolume, map[string]string, string) PVKey
@@ -233,6 +364,7 @@ type Provider interface {
 	GetManagementPlatform() (string, error)
 	GetLocalStorageQuery(string, string, bool, bool) string
 	ExternalAllocations(string, string, []string, string, string, bool) ([]*OutOfClusterAllocation, error)
+	ExternalAssets(start, end time.Time, queryLabels map[string]string) ([]*kubecost.Cloud, error)
 	ApplyReservedInstancePricing(map[string]*Node)
 	ServiceAccountStatus() *ServiceAccountStatus
 	PricingSourceStatus() map[string]*PricingSource
@@ -371,6 +503,12 @@ func NewProvider(cache clustercache.ClusterCache, apiKey string) (Provider, erro
 		} else if strings.HasPrefix(provider, "azure") {
 			configFileName = "azure.json"
 
+		} else if strings.HasPrefix(provider, "alicloud") {
+			configFileName = "alibaba.json"
+		} else if strings.HasPrefix(provider, "oci") {
+			configFileName = "oracle.json"
+		} else if strings.HasPrefix(provider, "digitalocean") {
+			configFileName = "digitalocean.json"
 		} else {
 			configFileName = "default.json"
 		}
@@ -406,6 +544,24 @@ func NewProvider(cache clustercache.ClusterCache, apiKey string) (Provider, erro
 			Clientset: cache,
 			Config:    NewProviderConfig("azure.json"),
 		}, nil
+	} else if strings.HasPrefix(provider, "alicloud") {
+		klog.V(2).Info("Found ProviderID starting with \"alicloud\", using Alibaba Provider")
+		return &Alibaba{
+			Clientset: cache,
+			Config:    NewProviderConfig("alibaba.json"),
+		}, nil
+	} else if strings.HasPrefix(provider, "oci") {
+		klog.V(2).Info("Found ProviderID starting with \"oci\", using Oracle Provider")
+		return &Oracle{
+			Clientset: cache,
+			Config:    NewProviderConfig("oracle.json"),
+		}, nil
+	} else if strings.HasPrefix(provider, "digitalocean") {
+		klog.V(2).Info("Found ProviderID starting with \"digitalocean\", using DigitalOcean Provider")
+		return &DigitalOcean{
+			Clientset: cache,
+			Config:    NewProviderConfig("digitalocean.json"),
+		}, nil
 	} else {
 		klog.V(2).Info("Unsupported provider, falling back to default")
 		return &CustomProvider{
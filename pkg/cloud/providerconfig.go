@@ -203,6 +203,35 @@ func SetCustomPricingField(obj *CustomPricing, name string, value string) error
 	return nil
 }
 
+// SetCustomPricingMapField sets the map field of the given CustomPricing
+// identified by its JSON name, e.g. "sharedCost" or "extendedResources", to
+// the given value.
+func SetCustomPricingMapField(obj *CustomPricing, name string, value map[string]string) error {
+	structValue := reflect.ValueOf(obj).Elem()
+	structType := structValue.Type()
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if strings.Split(field.Tag.Get("json"), ",")[0] != name {
+			continue
+		}
+
+		val := reflect.ValueOf(value)
+		if field.Type != val.Type() {
+			return fmt.Errorf("Provided value type didn't match custom pricing field type")
+		}
+
+		for k, v := range value {
+			value[k] = sanitizePolicy.Sanitize(v)
+		}
+
+		structValue.Field(i).Set(val)
+		return nil
+	}
+
+	return fmt.Errorf("No such field: %s in obj", name)
+}
+
 // File exists has three different return cases that should be handled:
 //   1. File exists and is not a directory (true, nil)
 //   2. File does not exist (false, nil)
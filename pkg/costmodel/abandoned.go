@@ -0,0 +1,591 @@
+package costmodel
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/prom"
+	"github.com/kubecost/cost-model/pkg/util"
+	"github.com/kubecost/cost-model/pkg/util/json"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	queryFmtPodNetEgressBytes = `sum(increase(kubecost_pod_network_egress_bytes_total[%s]%s)) by (pod_name, namespace, cluster_id)`
+)
+
+// Defaults for abandoned workload detection, which considers a controller
+// abandoned if its pods average less than 10 millicores of CPU usage and
+// send less than 1MB per day.
+const (
+	DefaultAbandonedMaxCPUCores          = 0.01
+	DefaultAbandonedMaxEgressBytesPerDay = 1000000.0
+)
+
+// Hourly costs of static IP addresses which are not associated with any
+// resource, by provider
+var unassociatedAddressHourlyCost = map[string]float64{
+	kubecost.AWSProvider: 0.005,
+	kubecost.GCPProvider: 0.010,
+}
+
+// AbandonedConfig configures the detection of abandoned workloads.
+type AbandonedConfig struct {
+	// MaxCPUCores is the average CPU usage per pod below which a controller
+	// may be abandoned
+	MaxCPUCores float64
+
+	// MaxEgressBytesPerDay is the network egress of all of a controller's
+	// pods below which a controller may be abandoned
+	MaxEgressBytesPerDay float64
+
+	// Cloud determines whether to query the cloud provider for unattached
+	// disks and unassociated addresses
+	Cloud bool
+}
+
+// AbandonedWorkload is a Deployment or StatefulSet whose pods have barely
+// used CPU or sent traffic over the window.
+type AbandonedWorkload struct {
+	Cluster             string  `json:"cluster"`
+	Namespace           string  `json:"namespace"`
+	ControllerKind      string  `json:"controllerKind"`
+	Controller          string  `json:"controller"`
+	CPUCoreUsageAverage float64 `json:"cpuCoreUsageAverage"`
+	EgressBytesPerDay   float64 `json:"egressBytesPerDay"`
+	MonthlyCost         float64 `json:"monthlyCost"`
+}
+
+// OrphanedVolume is a PersistentVolume which no PersistentVolumeClaim claimed
+// over the window.
+type OrphanedVolume struct {
+	Cluster     string  `json:"cluster"`
+	Name        string  `json:"name"`
+	Bytes       float64 `json:"bytes"`
+	MonthlyCost float64 `json:"monthlyCost"`
+}
+
+// OrphanedDisk is a cloud provider disk which is not attached to any
+// instance.
+type OrphanedDisk struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Region      string  `json:"region"`
+	Zone        string  `json:"zone"`
+	Type        string  `json:"type"`
+	SizeGiB     float64 `json:"sizeGiB"`
+	MonthlyCost float64 `json:"monthlyCost"`
+}
+
+// OrphanedAddress is a static IP address reserved with the cloud provider
+// which is not associated with any resource.
+type OrphanedAddress struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Address     string  `json:"address"`
+	Region      string  `json:"region"`
+	MonthlyCost float64 `json:"monthlyCost"`
+}
+
+// AbandonedReport lists the abandoned workloads and orphaned resources
+// found, the total monthly cost of which is the potential savings of
+// removing them. Warnings describe any part of the report which could not
+// be computed.
+type AbandonedReport struct {
+	Workloads           []*AbandonedWorkload `json:"workloads"`
+	Volumes             []*OrphanedVolume    `json:"volumes"`
+	Disks               []*OrphanedDisk      `json:"disks"`
+	Addresses           []*OrphanedAddress   `json:"addresses"`
+	TotalMonthlySavings float64              `json:"totalMonthlySavings"`
+	Warnings            []string             `json:"warnings"`
+}
+
+// ComputeAbandoned finds the abandoned workloads and orphaned volumes of the
+// given window, along with, if configured, the cloud provider's unattached
+// disks and unassociated addresses.
+func (a *Accesses) ComputeAbandoned(window kubecost.Window, config AbandonedConfig) (*AbandonedReport, error) {
+	if window.IsOpen() || window.IsNegative() {
+		return nil, fmt.Errorf("illegal window: %s", window)
+	}
+	start, end := *window.Start(), *window.End()
+
+	report := &AbandonedReport{
+		Workloads: []*AbandonedWorkload{},
+		Volumes:   []*OrphanedVolume{},
+		Disks:     []*OrphanedDisk{},
+		Addresses: []*OrphanedAddress{},
+		Warnings:  []string{},
+	}
+
+	as, err := a.computeAllocation(start, end, env.GetETLResolution())
+	if err != nil {
+		return nil, fmt.Errorf("error computing allocation: %s", err)
+	}
+
+	durStr, offStr, err := window.DurationOffsetForPrometheus()
+	if err != nil {
+		return nil, fmt.Errorf("illegal window: %s", err)
+	}
+	resStr := util.DurationString(env.GetETLResolution())
+
+	ctx := prom.NewContext(a.PrometheusClient)
+	resChEgress := ctx.Query(fmt.Sprintf(queryFmtPodNetEgressBytes, durStr, offStr))
+	resChPVCostPerGiBHour := ctx.Query(fmt.Sprintf(queryFmtPVCostPerGiBHour, durStr, offStr))
+	resChPVBytes := ctx.Query(fmt.Sprintf(queryFmtPVBytes, durStr, offStr))
+	resChPVCInfo := ctx.Query(fmt.Sprintf(queryFmtPVCInfo, durStr, resStr, offStr))
+
+	resEgress, _ := resChEgress.Await()
+	resPVCostPerGiBHour, _ := resChPVCostPerGiBHour.Await()
+	resPVBytes, _ := resChPVBytes.Await()
+	resPVCInfo, _ := resChPVCInfo.Await()
+	if ctx.HasErrors() {
+		return nil, ctx.ErrorCollection()
+	}
+
+	// Without network data, every idle workload would appear abandoned, so
+	// workloads are only reported if network costs are being recorded
+	if len(resEgress) == 0 {
+		report.Warnings = append(report.Warnings, "network egress data is unavailable, so abandoned workloads cannot be detected; is network cost monitoring enabled?")
+	} else {
+		egress := map[podKey]float64{}
+		for _, res := range resEgress {
+			key, err := resultPodKey(res, "cluster_id", "namespace", "pod_name")
+			if err != nil || len(res.Values) == 0 {
+				continue
+			}
+			egress[key] += res.Values[0].Value
+		}
+		report.Workloads = findAbandonedWorkloads(as, egress, config)
+	}
+
+	pvMap := map[pvKey]*PV{}
+	buildPVMap(pvMap, resPVCostPerGiBHour)
+	applyPVBytes(pvMap, resPVBytes)
+
+	pvcMap := map[pvcKey]*PVC{}
+	buildPVCMap(window, pvcMap, pvMap, resPVCInfo)
+
+	for _, pv := range pvMap {
+		if isPVMounted(pv, pvcMap) {
+			continue
+		}
+		report.Volumes = append(report.Volumes, &OrphanedVolume{
+			Cluster:     pv.Cluster,
+			Name:        pv.Name,
+			Bytes:       pv.Bytes,
+			MonthlyCost: pv.CostPerGiBHour * (pv.Bytes / 1024 / 1024 / 1024) * util.HoursPerMonth,
+		})
+	}
+	sort.Slice(report.Volumes, func(i, j int) bool {
+		return report.Volumes[i].MonthlyCost > report.Volumes[j].MonthlyCost
+	})
+
+	if config.Cloud {
+		provider := kubecost.NilProvider
+		if info, err := a.CloudProvider.ClusterInfo(); err == nil {
+			provider = kubecost.ParseProvider(info["provider"])
+		}
+
+		if data, err := a.CloudProvider.GetDisks(); err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("unable to get disks: %s", err))
+		} else if disks, err := parseOrphanedDisks(provider, data); err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("unable to parse disks: %s", err))
+		} else {
+			for _, disk := range disks {
+				disk.MonthlyCost = a.diskCostPerGiBHour(disk) * disk.SizeGiB * util.HoursPerMonth
+			}
+			sort.Slice(disks, func(i, j int) bool {
+				return disks[i].MonthlyCost > disks[j].MonthlyCost
+			})
+			report.Disks = disks
+		}
+
+		if data, err := a.CloudProvider.GetAddresses(); err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("unable to get addresses: %s", err))
+		} else if addresses, err := parseOrphanedAddresses(provider, data); err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("unable to parse addresses: %s", err))
+		} else {
+			for _, address := range addresses {
+				address.MonthlyCost = unassociatedAddressHourlyCost[provider] * util.HoursPerMonth
+			}
+			report.Addresses = addresses
+		}
+	}
+
+	for _, w := range report.Workloads {
+		report.TotalMonthlySavings += w.MonthlyCost
+	}
+	for _, v := range report.Volumes {
+		report.TotalMonthlySavings += v.MonthlyCost
+	}
+	for _, d := range report.Disks {
+		report.TotalMonthlySavings += d.MonthlyCost
+	}
+	for _, addr := range report.Addresses {
+		report.TotalMonthlySavings += addr.MonthlyCost
+	}
+
+	return report, nil
+}
+
+// findAbandonedWorkloads returns the Deployments and StatefulSets of the
+// given AllocationSet whose pods averaged less than the configured CPU usage
+// and, together, sent less than the configured egress per day, according to
+// the given egress bytes of each pod. Results are sorted by descending cost.
+func findAbandonedWorkloads(as *kubecost.AllocationSet, egress map[podKey]float64, config AbandonedConfig) []*AbandonedWorkload {
+	days := as.End().Sub(as.Start()).Hours() / 24.0
+	if days <= 0 {
+		return []*AbandonedWorkload{}
+	}
+
+	type controllerKey struct {
+		cluster, namespace, kind, name string
+	}
+
+	type controllerTotals struct {
+		cpuCoreMinutes float64
+		minutes        float64
+		cost           float64
+		pods           map[podKey]bool
+	}
+
+	totals := map[controllerKey]*controllerTotals{}
+
+	as.Each(func(name string, alloc *kubecost.Allocation) {
+		if alloc.Properties == nil {
+			return
+		}
+		props := alloc.Properties
+
+		kind := strings.ToLower(props.ControllerKind)
+		if kind != "deployment" && kind != "statefulset" {
+			return
+		}
+
+		key := controllerKey{props.Cluster, props.Namespace, kind, props.Controller}
+		if _, ok := totals[key]; !ok {
+			totals[key] = &controllerTotals{pods: map[podKey]bool{}}
+		}
+		t := totals[key]
+
+		t.cpuCoreMinutes += alloc.CPUCoreUsageAverage * alloc.Minutes()
+		t.minutes += alloc.Minutes()
+		t.cost += alloc.TotalCost()
+		t.pods[newPodKey(props.Cluster, props.Namespace, props.Pod)] = true
+	})
+
+	workloads := []*AbandonedWorkload{}
+
+	for key, t := range totals {
+		if t.minutes <= 0 {
+			continue
+		}
+
+		egressBytes := 0.0
+		for pod := range t.pods {
+			egressBytes += egress[pod]
+		}
+
+		cpu := t.cpuCoreMinutes / t.minutes
+		egressPerDay := egressBytes / days
+		if cpu >= config.MaxCPUCores || egressPerDay >= config.MaxEgressBytesPerDay {
+			continue
+		}
+
+		workloads = append(workloads, &AbandonedWorkload{
+			Cluster:             key.cluster,
+			Namespace:           key.namespace,
+			ControllerKind:      key.kind,
+			Controller:          key.name,
+			CPUCoreUsageAverage: cpu,
+			EgressBytesPerDay:   egressPerDay,
+			MonthlyCost:         t.cost / (days * 24.0) * util.HoursPerMonth,
+		})
+	}
+
+	sort.Slice(workloads, func(i, j int) bool {
+		if workloads[i].MonthlyCost != workloads[j].MonthlyCost {
+			return workloads[i].MonthlyCost > workloads[j].MonthlyCost
+		}
+		return workloads[i].Controller < workloads[j].Controller
+	})
+
+	return workloads
+}
+
+// awsDisks is the subset of the AWS DescribeVolumes response returned by
+// AWS.GetDisks needed to find unattached disks
+type awsDisks struct {
+	Volumes []struct {
+		VolumeId         string
+		VolumeType       string
+		State            string
+		Size             float64
+		AvailabilityZone string
+		Tags             []struct {
+			Key   string
+			Value string
+		}
+	}
+}
+
+// gcpDisks is the subset of the GCP disks aggregated list returned by
+// GCP.GetDisks needed to find unattached disks
+type gcpDisks struct {
+	Items map[string]struct {
+		Disks []struct {
+			Id     string   `json:"id"`
+			Name   string   `json:"name"`
+			SizeGb string   `json:"sizeGb"`
+			Type   string   `json:"type"`
+			Zone   string   `json:"zone"`
+			Users  []string `json:"users"`
+		} `json:"disks"`
+	} `json:"items"`
+}
+
+// parseOrphanedDisks parses the unattached disks from the response of the
+// given provider's GetDisks. Providers which do not list disks return none.
+func parseOrphanedDisks(provider string, data []byte) ([]*OrphanedDisk, error) {
+	disks := []*OrphanedDisk{}
+	if len(data) == 0 {
+		return disks, nil
+	}
+
+	switch provider {
+	case kubecost.AWSProvider:
+		resp := &awsDisks{}
+		if err := json.Unmarshal(data, resp); err != nil {
+			return nil, err
+		}
+
+		for _, v := range resp.Volumes {
+			if v.State != "available" {
+				continue
+			}
+
+			name := ""
+			for _, tag := range v.Tags {
+				if tag.Key == "Name" {
+					name = tag.Value
+				}
+			}
+
+			disks = append(disks, &OrphanedDisk{
+				ID:      v.VolumeId,
+				Name:    name,
+				Region:  zoneRegion(provider, v.AvailabilityZone),
+				Zone:    v.AvailabilityZone,
+				Type:    v.VolumeType,
+				SizeGiB: v.Size,
+			})
+		}
+	case kubecost.GCPProvider:
+		resp := &gcpDisks{}
+		if err := json.Unmarshal(data, resp); err != nil {
+			return nil, err
+		}
+
+		for _, item := range resp.Items {
+			for _, d := range item.Disks {
+				if len(d.Users) > 0 {
+					continue
+				}
+
+				size, _ := strconv.ParseFloat(d.SizeGb, 64)
+				zone := path.Base(d.Zone)
+
+				disks = append(disks, &OrphanedDisk{
+					ID:      d.Id,
+					Name:    d.Name,
+					Region:  zoneRegion(provider, zone),
+					Zone:    zone,
+					Type:    path.Base(d.Type),
+					SizeGiB: size,
+				})
+			}
+		}
+	}
+
+	return disks, nil
+}
+
+// zoneRegion returns the region of the given zone of the given provider;
+// e.g. "us-east-1" of AWS zone "us-east-1a" and "us-central1" of GCP zone
+// "us-central1-a".
+func zoneRegion(provider, zone string) string {
+	switch provider {
+	case kubecost.AWSProvider:
+		return strings.TrimRight(zone, "abcdefghijklmnopqrstuvwxyz")
+	case kubecost.GCPProvider:
+		if i := strings.LastIndex(zone, "-"); i > 0 {
+			return zone[:i]
+		}
+	}
+	return zone
+}
+
+// awsAddresses is the subset of the AWS DescribeAddresses response returned
+// by AWS.GetAddresses needed to find unassociated addresses
+type awsAddresses struct {
+	Addresses []struct {
+		AllocationId       string
+		AssociationId      string
+		PublicIp           string
+		NetworkBorderGroup string
+		Tags               []struct {
+			Key   string
+			Value string
+		}
+	}
+}
+
+// gcpAddresses is the subset of the GCP addresses aggregated list returned by
+// GCP.GetAddresses needed to find unassociated addresses
+type gcpAddresses struct {
+	Items map[string]struct {
+		Addresses []struct {
+			Id          string `json:"id"`
+			Name        string `json:"name"`
+			Address     string `json:"address"`
+			AddressType string `json:"addressType"`
+			Status      string `json:"status"`
+			Region      string `json:"region"`
+		} `json:"addresses"`
+	} `json:"items"`
+}
+
+// parseOrphanedAddresses parses the unassociated, external, static
+// addresses from the response of the given provider's GetAddresses.
+// Providers which do not list addresses return none.
+func parseOrphanedAddresses(provider string, data []byte) ([]*OrphanedAddress, error) {
+	addresses := []*OrphanedAddress{}
+	if len(data) == 0 {
+		return addresses, nil
+	}
+
+	switch provider {
+	case kubecost.AWSProvider:
+		resp := &awsAddresses{}
+		if err := json.Unmarshal(data, resp); err != nil {
+			return nil, err
+		}
+
+		for _, addr := range resp.Addresses {
+			if addr.AssociationId != "" {
+				continue
+			}
+
+			name := ""
+			for _, tag := range addr.Tags {
+				if tag.Key == "Name" {
+					name = tag.Value
+				}
+			}
+
+			addresses = append(addresses, &OrphanedAddress{
+				ID:      addr.AllocationId,
+				Name:    name,
+				Address: addr.PublicIp,
+				Region:  addr.NetworkBorderGroup,
+			})
+		}
+	case kubecost.GCPProvider:
+		resp := &gcpAddresses{}
+		if err := json.Unmarshal(data, resp); err != nil {
+			return nil, err
+		}
+
+		for _, item := range resp.Items {
+			for _, addr := range item.Addresses {
+				if addr.Status != "RESERVED" || addr.AddressType == "INTERNAL" {
+					continue
+				}
+
+				addresses = append(addresses, &OrphanedAddress{
+					ID:      addr.Id,
+					Name:    addr.Name,
+					Address: addr.Address,
+					Region:  path.Base(addr.Region),
+				})
+			}
+		}
+	}
+
+	return addresses, nil
+}
+
+// diskCostPerGiBHour returns the cost per GiB-hour of the given disk,
+// according to the provider's PV pricing for its type and region, falling
+// back to the configured storage cost.
+func (a *Accesses) diskCostPerGiBHour(disk *OrphanedDisk) float64 {
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{v1.LabelZoneRegion: disk.Region},
+		},
+	}
+	key := a.CloudProvider.GetPVKey(pv, map[string]string{"type": disk.Type}, disk.Region)
+
+	if pricing, err := a.CloudProvider.PVPricing(key); err == nil && pricing != nil {
+		if cost, err := strconv.ParseFloat(pricing.Cost, 64); err == nil && cost > 0 {
+			return cost
+		}
+	}
+
+	if c, err := a.CloudProvider.GetConfig(); err == nil {
+		if cost, err := strconv.ParseFloat(c.Storage, 64); err == nil {
+			return cost
+		}
+	}
+
+	log.DedupedWarningf(5, "ComputeAbandoned: no pricing for disk of type %s in %s", disk.Type, disk.Region)
+	return 0.0
+}
+
+// AbandonedHandler reports abandoned workloads and orphaned resources, and
+// the monthly savings of removing them.
+func (a *Accesses) AbandonedHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	qp := util.NewQueryParams(r.URL.Query())
+
+	// Window is an optional parameter, defaulting to the past week, over
+	// which workload usage and volume claims are observed.
+	window, err := kubecost.ParseWindowWithOffset(qp.Get("window", "7d"), env.GetParsedUTCOffset())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid 'window' parameter: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// MaxCPUCores and MaxEgressBytesPerDay are optional parameters defining
+	// the usage below which a workload is considered abandoned.
+	// Example: "maxCPUCores=0.05&maxEgressBytesPerDay=10000000"
+	maxCPUCores := qp.GetFloat64("maxCPUCores", DefaultAbandonedMaxCPUCores)
+	maxEgress := qp.GetFloat64("maxEgressBytesPerDay", DefaultAbandonedMaxEgressBytesPerDay)
+
+	// Cloud is an optional parameter, defaulting to true, which if false skips
+	// querying the cloud provider for disks and addresses.
+	includeCloud := qp.GetBool("cloud", true)
+
+	report, err := a.ComputeAbandoned(window, AbandonedConfig{
+		MaxCPUCores:          maxCPUCores,
+		MaxEgressBytesPerDay: maxEgress,
+		Cloud:                includeCloud,
+	})
+	if err != nil {
+		WriteError(w, InternalServerError(err.Error()))
+		return
+	}
+
+	w.Write(WrapData(report, nil))
+}
@@ -0,0 +1,138 @@
+package costmodel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+func TestFindAbandonedWorkloads(t *testing.T) {
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(48 * time.Hour)
+
+	newAlloc := func(kind, controller, pod string, cpuUsage, cost float64) *kubecost.Allocation {
+		return &kubecost.Allocation{
+			Name: "cluster1/node1/web/" + pod + "/main",
+			Properties: &kubecost.AllocationProperties{
+				Cluster:        "cluster1",
+				Namespace:      "web",
+				ControllerKind: kind,
+				Controller:     controller,
+				Pod:            pod,
+				Container:      "main",
+			},
+			Start:               start,
+			End:                 end,
+			CPUCoreUsageAverage: cpuUsage,
+			CPUCost:             cost,
+		}
+	}
+
+	as := kubecost.NewAllocationSet(start, end,
+		// Busy
+		newAlloc("deployment", "api", "api-1", 0.5, 10.0),
+		// Idle, and silent
+		newAlloc("deployment", "legacy", "legacy-1", 0.001, 4.0),
+		newAlloc("deployment", "legacy", "legacy-2", 0.002, 4.0),
+		// Idle, but serving traffic
+		newAlloc("statefulset", "cache", "cache-0", 0.001, 2.0),
+		// Idle, but not a Deployment or StatefulSet
+		newAlloc("daemonset", "agent", "agent-1", 0.001, 1.0),
+		newAlloc("", "", "debug", 0.001, 1.0),
+	)
+
+	egress := map[podKey]float64{
+		newPodKey("cluster1", "web", "api-1"):    1e9,
+		newPodKey("cluster1", "web", "legacy-1"): 1000.0,
+		newPodKey("cluster1", "web", "cache-0"):  1e8,
+	}
+
+	workloads := findAbandonedWorkloads(as, egress, AbandonedConfig{
+		MaxCPUCores:          DefaultAbandonedMaxCPUCores,
+		MaxEgressBytesPerDay: DefaultAbandonedMaxEgressBytesPerDay,
+	})
+	if len(workloads) != 1 {
+		t.Fatalf("expected 1 abandoned workload; got %d", len(workloads))
+	}
+
+	w := workloads[0]
+	if w.Controller != "legacy" || w.ControllerKind != "deployment" || w.EgressBytesPerDay != 500.0 {
+		t.Fatalf("unexpected workload: %+v", w)
+	}
+	if !util.IsApproximately(w.CPUCoreUsageAverage, 0.0015) || !util.IsApproximately(w.MonthlyCost, 8.0/48.0*730.0) {
+		t.Fatalf("unexpected workload: %+v", w)
+	}
+}
+
+func TestParseOrphanedDisks(t *testing.T) {
+	aws := []byte(`{"Volumes": [
+		{"VolumeId": "vol-1", "VolumeType": "gp2", "State": "available", "Size": 100, "AvailabilityZone": "us-east-1a", "Tags": [{"Key": "Name", "Value": "old-data"}]},
+		{"VolumeId": "vol-2", "VolumeType": "gp2", "State": "in-use", "Size": 50, "AvailabilityZone": "us-east-1b"}
+	]}`)
+
+	disks, err := parseOrphanedDisks(kubecost.AWSProvider, aws)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(disks) != 1 {
+		t.Fatalf("expected 1 disk; got %d", len(disks))
+	}
+	if d := disks[0]; d.ID != "vol-1" || d.Name != "old-data" || d.Region != "us-east-1" || d.Type != "gp2" || d.SizeGiB != 100.0 {
+		t.Fatalf("unexpected disk: %+v", d)
+	}
+
+	gcp := []byte(`{"items": {
+		"zones/us-central1-a": {"disks": [
+			{"id": "123", "name": "old-data", "sizeGb": "200", "type": "https://www.googleapis.com/compute/v1/projects/p/zones/us-central1-a/diskTypes/pd-ssd", "zone": "https://www.googleapis.com/compute/v1/projects/p/zones/us-central1-a"},
+			{"id": "456", "name": "boot", "sizeGb": "10", "type": "pd-standard", "zone": "us-central1-a", "users": ["instances/node1"]}
+		]},
+		"zones/us-east1-b": {"warning": {"code": "NO_RESULTS_ON_PAGE"}}
+	}}`)
+
+	disks, err = parseOrphanedDisks(kubecost.GCPProvider, gcp)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(disks) != 1 {
+		t.Fatalf("expected 1 disk; got %d", len(disks))
+	}
+	if d := disks[0]; d.ID != "123" || d.Region != "us-central1" || d.Zone != "us-central1-a" || d.Type != "pd-ssd" || d.SizeGiB != 200.0 {
+		t.Fatalf("unexpected disk: %+v", d)
+	}
+
+	disks, err = parseOrphanedDisks(kubecost.AzureProvider, nil)
+	if err != nil || len(disks) != 0 {
+		t.Fatalf("expected no disks; got %v, %s", disks, err)
+	}
+}
+
+func TestParseOrphanedAddresses(t *testing.T) {
+	aws := []byte(`{"Addresses": [
+		{"AllocationId": "eipalloc-1", "PublicIp": "1.2.3.4", "NetworkBorderGroup": "us-east-1"},
+		{"AllocationId": "eipalloc-2", "AssociationId": "eipassoc-2", "PublicIp": "5.6.7.8", "NetworkBorderGroup": "us-east-1"}
+	]}`)
+
+	addresses, err := parseOrphanedAddresses(kubecost.AWSProvider, aws)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(addresses) != 1 || addresses[0].ID != "eipalloc-1" || addresses[0].Address != "1.2.3.4" {
+		t.Fatalf("unexpected addresses: %+v", addresses)
+	}
+
+	gcp := []byte(`{"items": {"regions/us-central1": {"addresses": [
+		{"id": "1", "name": "unused", "address": "1.2.3.4", "status": "RESERVED", "addressType": "EXTERNAL", "region": "https://www.googleapis.com/compute/v1/projects/p/regions/us-central1"},
+		{"id": "2", "name": "ingress", "address": "5.6.7.8", "status": "IN_USE", "addressType": "EXTERNAL"},
+		{"id": "3", "name": "internal", "address": "10.0.0.1", "status": "RESERVED", "addressType": "INTERNAL"}
+	]}}}`)
+
+	addresses, err = parseOrphanedAddresses(kubecost.GCPProvider, gcp)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(addresses) != 1 || addresses[0].Name != "unused" || addresses[0].Region != "us-central1" {
+		t.Fatalf("unexpected addresses: %+v", addresses)
+	}
+}
@@ -2010,6 +2010,14 @@ func (a *Accesses) AggregateCostModelHandler(w http.ResponseWriter, r *http.Requ
 	// etl triggers ETL adapter
 	opts.UseETLAdapter = r.URL.Query().Get("etl") == "true"
 
+	// format determines whether the result is returned as JSON, or streamed
+	// as CSV or Parquet with one row per aggregation
+	format, err := ParseExportFormat(util.NewQueryParams(r.URL.Query()))
+	if err != nil {
+		WriteError(w, BadRequest(err.Error()))
+		return
+	}
+
 	// aggregation field is required
 	if field == "" {
 		WriteError(w, BadRequest("Missing aggregation field parameter"))
@@ -2107,6 +2115,11 @@ func (a *Accesses) AggregateCostModelHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if format != ExportFormatJSON {
+		writeExport(w, format, "aggregation", newAggregationExportTable(data, window, pricingCurrency(a.CloudProvider)))
+		return
+	}
+
 	if warning == "" {
 		w.Write(WrapDataWithMessage(data, nil, message))
 	} else {
@@ -2134,17 +2147,88 @@ func ParseAggregationProperties(qp util.QueryParams, key string) ([]string, erro
 	return aggregateBy, nil
 }
 
+// writeAllocationQueryError writes the error of parsing an allocation query,
+// which is a bad request unless it was caused by the config.
+func writeAllocationQueryError(w http.ResponseWriter, err error) {
+	if _, ok := err.(*SharedCostConfigError); ok {
+		WriteError(w, InternalServerError(err.Error()))
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
 // ComputeAllocationHandler computes an AllocationSetRange from the CostModel.
 func (a *Accesses) ComputeAllocationHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	w.Header().Set("Content-Type", "application/json")
 
 	qp := util.NewQueryParams(r.URL.Query())
 
+	query, err := a.parseAllocationQuery(qp)
+	if err != nil {
+		writeAllocationQueryError(w, err)
+		return
+	}
+
+	// Format is an optional parameter, defaulting to json, which determines
+	// whether the result is returned as JSON, or streamed as CSV or Parquet
+	// with one row per allocation per step.
+	format, err := ParseExportFormat(qp)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid 'format' parameter: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// Currency is an optional parameter, defaulting to the currency of
+	// prices, to which costs are converted at configured exchange rates.
+	// Example: "currency=EUR"
+	currency, rate, err := a.parseCurrency(qp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	asr, err := a.queryAllocation(query)
+	if err != nil {
+		WriteError(w, InternalServerError(err.Error()))
+		return
+	}
+
+	if rate != 1.0 {
+		asr.ScaleCosts(rate)
+	}
+
+	if format != ExportFormatJSON {
+		writeExport(w, format, "allocation", newAllocationExportTable(asr, currency))
+		return
+	}
+
+	w.Write(WrapDataWithCurrency(asr, nil, currency))
+}
+
+// allocationQuery holds the parsed parameters of a query for an
+// AllocationSetRange. See parseAllocationQuery.
+type allocationQuery struct {
+	window      kubecost.Window
+	step        time.Duration
+	resolution  time.Duration
+	aggregateBy []string
+	accumulate  bool
+	idle        bool
+	reconcile   bool
+	external    bool
+	filterFuncs []kubecost.AllocationMatchFunc
+	opts        *kubecost.AllocationAggregationOptions
+}
+
+// parseAllocationQuery parses the parameters of a query for an
+// AllocationSetRange, as accepted by ComputeAllocationHandler, using the
+// configured shared namespaces, labels, and costs as defaults.
+func (a *Accesses) parseAllocationQuery(qp util.QueryParams) (*allocationQuery, error) {
 	// Window is a required field describing the window of time over which to
 	// compute allocation data.
 	window, err := kubecost.ParseWindowWithOffset(qp.Get("window", ""), env.GetParsedUTCOffset())
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid 'window' parameter: %s", err), http.StatusBadRequest)
+		return nil, fmt.Errorf("Invalid 'window' parameter: %s", err)
 	}
 
 	// Step is an optional parameter that defines the duration per-set, i.e.
@@ -2162,26 +2246,335 @@ func (a *Accesses) ComputeAllocationHandler(w http.ResponseWriter, r *http.Reque
 	// Examples: "namespace", "namespace,label:app"
 	aggregateBy, err := ParseAggregationProperties(qp, "aggregate")
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid 'aggregate' parameter: %s", err), http.StatusBadRequest)
+		return nil, fmt.Errorf("Invalid 'aggregate' parameter: %s", err)
 	}
 
 	// Accumulate is an optional parameter, defaulting to false, which if true
 	// sums each Set in the Range, producing one Set.
 	accumulate := qp.GetBool("accumulate", false)
 
+	// ShareIdle is an optional parameter, defaulting to none, which determines
+	// how idle costs are shared among the aggregated allocations; i.e.
+	// "weighted" shares idle in proportion to each allocation's cost and
+	// "even" shares idle evenly. Sharing idle requires computing idle, so it
+	// implies idle=true.
+	shareIdle, err := ParseShareType(qp.Get("shareIdle", ""))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid 'shareIdle' parameter: %s", err)
+	}
+
+	// Idle is an optional parameter, defaulting to false, which if true
+	// computes idle allocations from the cost of the Node assets in each
+	// cluster that is not allocated to any container.
+	idle := qp.GetBool("idle", false) || shareIdle != kubecost.ShareNone
+
+	// SplitIdle is an optional parameter, defaulting to false, which if true
+	// returns one idle allocation per-cluster, rather than a single combined
+	// idle allocation.
+	splitIdle := qp.GetBool("splitIdle", false)
+
+	// Reconcile is an optional parameter, defaulting to false, which if true
+	// scales the costs of allocations by the ratio of each node's billed cost
+	// to its list cost. It requires billing reconciliation to be enabled, and
+	// only applies to steps for which billing data has been retrieved.
+	reconcile := qp.GetBool("reconcile", false)
+
+	// External is an optional parameter, defaulting to false, which if true
+	// includes the out-of-cluster costs billed by the cloud provider, which
+	// are tagged with the configured external labels, as external
+	// allocations. Only costs tagged with one of the aggregation properties
+	// are included, so external allocations require aggregation.
+	external := qp.GetBool("external", false)
+
+	// Filters are optional parameters, each of which restricts the results
+	// to allocations matching the given values. See ParseAllocationFilters.
+	// Examples: "filterNamespaces=kubecost", "filterLabels=app:web,!env:dev"
+	filterFuncs, err := ParseAllocationFilters(qp)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid filter parameter: %s", err)
+	}
+
+	// ShareNamespaces and ShareLabels are optional parameters, defaulting to
+	// the configured shared namespaces and labels, which determine the
+	// allocations whose costs are shared among the remaining allocations.
+	// Examples: "shareNamespaces=kube-system", "shareLabels=app:kubecost"
+	sharedLabelNames, sharedLabelValues := cloud.SharedLabels(a.CloudProvider)
+	shareFuncs, err := ParseAllocationShareFuncs(qp, cloud.SharedNamespaces(a.CloudProvider), sharedLabelNames, sharedLabelValues)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid share parameter: %s", err)
+	}
+
+	// ShareCost is an optional parameter, defaulting to the configured shared
+	// costs, which defines a monthly cost to be shared among the allocations.
+	var sharedCosts map[string]string
+	if c, err := a.CloudProvider.GetConfig(); err == nil {
+		sharedCosts = c.SharedCosts
+	}
+	sharedHourlyCosts, err := ParseSharedHourlyCosts(qp, sharedCosts)
+	if _, ok := err.(*SharedCostConfigError); ok {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("Invalid 'shareCost' parameter: %s", err)
+	}
+
+	// ShareSplit is an optional parameter, defaulting to weighted, which
+	// determines how shared costs are split among the allocations.
+	shareSplit, err := ParseShareType(qp.Get("shareSplit", SplitTypeWeighted))
+	if err != nil || shareSplit == kubecost.ShareNone {
+		return nil, fmt.Errorf("Invalid 'shareSplit' parameter: %s", qp.Get("shareSplit", ""))
+	}
+
+	return &allocationQuery{
+		window:      window,
+		step:        step,
+		resolution:  resolution,
+		aggregateBy: aggregateBy,
+		accumulate:  accumulate,
+		idle:        idle,
+		reconcile:   reconcile,
+		external:    external,
+		filterFuncs: filterFuncs,
+		opts: &kubecost.AllocationAggregationOptions{
+			FilterFuncs:       filterFuncs,
+			ShareFuncs:        shareFuncs,
+			ShareIdle:         shareIdle,
+			ShareSplit:        shareSplit,
+			SharedHourlyCosts: sharedHourlyCosts,
+			SplitIdle:         splitIdle,
+		},
+	}, nil
+}
+
+// queryAllocation computes the AllocationSetRange of the given query.
+func (a *Accesses) queryAllocation(q *allocationQuery) (*kubecost.AllocationSetRange, error) {
+	if q.window.Start() == nil || q.window.End() == nil {
+		return nil, fmt.Errorf("illegal window: %s", q.window)
+	}
+	if q.step <= 0 {
+		return nil, fmt.Errorf("illegal step: %s", q.step)
+	}
+
+	// Retrieve the tagged out-of-cluster costs of every step at once, if
+	// requested, to be converted to external allocations step by step
+	var externals []*kubecost.Cloud
+	if q.external && len(q.aggregateBy) > 0 {
+		var err error
+		externals, err = a.queryExternalAssets(*q.window.Start(), stepsEnd(q.window, q.step))
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Query for AllocationSets in increments of the given step duration,
 	// appending each to the AllocationSetRange.
 	asr := kubecost.NewAllocationSetRange()
+	stepStart := *q.window.Start()
+	for q.window.End().After(stepStart) {
+		stepEnd := stepStart.Add(q.step)
+		stepWindow := kubecost.NewWindow(&stepStart, &stepEnd)
+
+		as, err := a.computeAllocation(*stepWindow.Start(), *stepWindow.End(), q.resolution)
+		if err != nil {
+			return nil, err
+		}
+
+		// Compute the assets of the same window, if required to reconcile
+		// allocations with the bill, or to compute idle allocations
+		reconcile := q.reconcile && a.Model.Reconciler.Covers(as.Start(), as.End())
+		if reconcile || q.idle {
+			assetSet, err := a.computeAssets(as.Start(), as.End())
+			if err != nil {
+				return nil, fmt.Errorf("error computing assets: %s", err)
+			}
+
+			if reconcile {
+				reconcileAllocations(as, assetSet)
+			}
+
+			if q.idle {
+				err = insertIdleAllocations(as, assetSet)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		// Convert the tagged out-of-cluster costs of the same window to
+		// external allocations, if requested, and insert them into the set
+		if q.external && len(q.aggregateBy) > 0 {
+			externalSet := newExternalAssetSet(externals, as.Start(), as.End())
+
+			err = insertExternalAllocations(as, externalSet, q.aggregateBy, a.LabelConfig)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		asr.Append(as)
+
+		stepStart = stepEnd
+	}
+
+	// Aggregate, if requested
+	if len(q.aggregateBy) > 0 {
+		err := asr.AggregateBy(q.aggregateBy, q.opts)
+		if err != nil {
+			return nil, err
+		}
+	} else if len(q.filterFuncs) > 0 {
+		asr.Each(func(i int, as *kubecost.AllocationSet) {
+			filterAllocationSet(as, q.filterFuncs)
+		})
+	}
+
+	// Accumulate, if requested
+	if q.accumulate {
+		as, err := asr.Accumulate()
+		if err != nil {
+			return nil, err
+		}
+		asr = kubecost.NewAllocationSetRange(as)
+	}
+
+	return asr, nil
+}
+
+// ParseShareType attempts to parse the given string as a method of sharing
+// costs; i.e. "weighted" or "even". An empty string, "none", and "false" all
+// indicate that costs should not be shared.
+func ParseShareType(shareType string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(shareType)) {
+	case SplitTypeWeighted:
+		return kubecost.ShareWeighted, nil
+	case "even":
+		return kubecost.ShareEven, nil
+	case "", "none", "false":
+		return kubecost.ShareNone, nil
+	}
+	return kubecost.ShareNone, fmt.Errorf("unsupported share type: %s", shareType)
+}
+
+// insertIdleAllocations computes, from the given AssetSet of the same window,
+// and inserts one idle allocation per-cluster into the given AllocationSet.
+func insertIdleAllocations(as *kubecost.AllocationSet, assetSet *kubecost.AssetSet) error {
+	idleAllocs, err := as.ComputeIdleAllocations(assetSet)
+	if err != nil {
+		return fmt.Errorf("error computing idle allocations: %s", err)
+	}
+
+	for _, idleAlloc := range idleAllocs {
+		err = as.Insert(idleAlloc)
+		if err != nil {
+			return fmt.Errorf("error inserting idle allocation: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// ParseAssetAggregationProperties attempts to parse and return asset
+// aggregation properties encoded under the given key. Properties may be any
+// valid AssetProperty or a label, distinguished by the "label:" prefix.
+func ParseAssetAggregationProperties(qp util.QueryParams, key string) ([]string, error) {
+	aggregateBy := []string{}
+	for _, agg := range qp.GetList(key, ",") {
+		aggregate := strings.TrimSpace(agg)
+		if aggregate != "" {
+			if prop, err := kubecost.ParseAssetProperty(aggregate); err == nil {
+				aggregateBy = append(aggregateBy, string(prop))
+			} else if strings.HasPrefix(aggregate, "label:") {
+				aggregateBy = append(aggregateBy, aggregate)
+			} else {
+				return nil, err
+			}
+		}
+	}
+	return aggregateBy, nil
+}
+
+// ComputeAssetsHandler computes an AssetSetRange from the CostModel.
+func (a *Accesses) ComputeAssetsHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	qp := util.NewQueryParams(r.URL.Query())
+
+	// Window is a required field describing the window of time over which to
+	// compute asset data.
+	window, err := kubecost.ParseWindowWithOffset(qp.Get("window", ""), env.GetParsedUTCOffset())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid 'window' parameter: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// Step is an optional parameter that defines the duration per-set, i.e.
+	// the window for an AssetSet, of the AssetSetRange to be computed.
+	// Defaults to the window size, making one set.
+	step := qp.GetDuration("step", window.Duration())
+	if step <= 0 {
+		http.Error(w, fmt.Sprintf("Invalid 'step' parameter: %s", step), http.StatusBadRequest)
+		return
+	}
+
+	// Aggregation is an optional comma-separated list of fields by which to
+	// aggregate results. Labels are distinguished with a colon; e.g.
+	// "label:app".
+	// Examples: "cluster", "provider,type", "cluster,label:app"
+	aggregateBy, err := ParseAssetAggregationProperties(qp, "aggregate")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid 'aggregate' parameter: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// Accumulate is an optional parameter, defaulting to false, which if true
+	// sums each Set in the Range, producing one Set.
+	accumulate := qp.GetBool("accumulate", false)
+
+	// External is an optional parameter, defaulting to false, which if true
+	// includes the out-of-cluster costs billed by the cloud provider, which
+	// are tagged with the configured external labels, as Cloud assets.
+	external := qp.GetBool("external", false)
+
+	// Currency is an optional parameter, defaulting to the currency of
+	// prices, to which costs are converted at configured exchange rates.
+	// Example: "currency=EUR"
+	currency, rate, err := a.parseCurrency(qp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Retrieve the tagged out-of-cluster costs of every step at once, if
+	// requested, to be inserted step by step
+	var externals []*kubecost.Cloud
+	if external {
+		externals, err = a.queryExternalAssets(*window.Start(), stepsEnd(window, step))
+		if err != nil {
+			WriteError(w, InternalServerError(err.Error()))
+			return
+		}
+	}
+
+	// Query for AssetSets in increments of the given step duration,
+	// appending each to the AssetSetRange.
+	asr := kubecost.NewAssetSetRange()
 	stepStart := *window.Start()
 	for window.End().After(stepStart) {
 		stepEnd := stepStart.Add(step)
 		stepWindow := kubecost.NewWindow(&stepStart, &stepEnd)
 
-		as, err := a.Model.ComputeAllocation(*stepWindow.Start(), *stepWindow.End(), resolution)
+		as, err := a.computeAssets(*stepWindow.Start(), *stepWindow.End())
 		if err != nil {
 			WriteError(w, InternalServerError(err.Error()))
 			return
 		}
+
+		if external {
+			externalSet := newExternalAssetSet(externals, *stepWindow.Start(), *stepWindow.End())
+			externalSet.Each(func(key string, asset kubecost.Asset) {
+				as.Insert(asset)
+			})
+		}
+
 		asr.Append(as)
 
 		stepStart = stepEnd
@@ -2203,10 +2596,14 @@ func (a *Accesses) ComputeAllocationHandler(w http.ResponseWriter, r *http.Reque
 			WriteError(w, InternalServerError(err.Error()))
 			return
 		}
-		asr = kubecost.NewAllocationSetRange(as)
+		asr = kubecost.NewAssetSetRange(as)
+	}
+
+	if rate != 1.0 {
+		asr.ScaleCosts(rate)
 	}
 
-	w.Write(WrapData(asr, nil))
+	w.Write(WrapDataWithCurrency(asr, nil, currency))
 }
 
 // The below was transferred from a different package in order to maintain
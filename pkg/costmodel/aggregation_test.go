@@ -3,6 +3,7 @@ package costmodel
 import (
 	"testing"
 
+	"github.com/kubecost/cost-model/pkg/kubecost"
 	"github.com/kubecost/cost-model/pkg/util"
 )
 
@@ -193,3 +194,31 @@ func TestScaleHourlyCostData(t *testing.T) {
 		}
 	}
 }
+
+func TestParseShareType(t *testing.T) {
+	cases := map[string]struct {
+		input    string
+		expected string
+		err      bool
+	}{
+		"empty":    {input: "", expected: kubecost.ShareNone},
+		"none":     {input: "none", expected: kubecost.ShareNone},
+		"false":    {input: "false", expected: kubecost.ShareNone},
+		"weighted": {input: "weighted", expected: kubecost.ShareWeighted},
+		"even":     {input: " Even ", expected: kubecost.ShareEven},
+		"invalid":  {input: "proportional", expected: kubecost.ShareNone, err: true},
+	}
+
+	for name, c := range cases {
+		actual, err := ParseShareType(c.input)
+		if c.err && err == nil {
+			t.Errorf("%s: expected error; got nil", name)
+		}
+		if !c.err && err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+		}
+		if actual != c.expected {
+			t.Errorf("%s: expected %s; got %s", name, c.expected, actual)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package costmodel
 import (
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -35,10 +36,16 @@ const (
 	// See PromQL subquery documentation for a rate example:
 	// https://prometheus.io/blog/2019/01/28/subquery-support/#examples
 	queryFmtCPUUsageMax           = `max(max_over_time(kubecost_savings_container_cpu_usage_seconds[%s]%s)) by (container_name, pod_name, namespace, instance, cluster_id)`
-	queryFmtGPUsRequested         = `avg(avg_over_time(kube_pod_container_resource_requests{resource="nvidia_com_gpu", container!="",container!="POD", node!=""}[%s]%s)) by (container, pod, namespace, node, cluster_id)`
+	queryFmtGPUsRequested         = `avg(avg_over_time(kube_pod_container_resource_requests{resource=~"nvidia_com_gpu|nvidia_com_mig_.*", container!="",container!="POD", node!=""}[%s]%s)) by (container, pod, namespace, node, resource, cluster_id)`
+	queryFmtGPUUsageAvg           = `sum(label_replace(label_replace(label_replace(avg_over_time(DCGM_FI_DEV_GPU_UTIL{exported_pod!=""}[%[1]s]%[2]s), "pod", "$1", "exported_pod", "(.+)"), "namespace", "$1", "exported_namespace", "(.+)"), "container", "$1", "exported_container", "(.+)") or avg_over_time(DCGM_FI_DEV_GPU_UTIL{container!="", pod!="", exported_pod=""}[%[1]s]%[2]s)) by (container, pod, namespace, cluster_id) / 100`
+	queryFmtGPUUsageMax           = `sum(label_replace(label_replace(label_replace(max_over_time(DCGM_FI_DEV_GPU_UTIL{exported_pod!=""}[%[1]s]%[2]s), "pod", "$1", "exported_pod", "(.+)"), "namespace", "$1", "exported_namespace", "(.+)"), "container", "$1", "exported_container", "(.+)") or max_over_time(DCGM_FI_DEV_GPU_UTIL{container!="", pod!="", exported_pod=""}[%[1]s]%[2]s)) by (container, pod, namespace, cluster_id) / 100`
+	queryFmtGPUMemoryUsageAvg     = `sum(label_replace(label_replace(label_replace(avg_over_time(DCGM_FI_DEV_FB_USED{exported_pod!=""}[%[1]s]%[2]s), "pod", "$1", "exported_pod", "(.+)"), "namespace", "$1", "exported_namespace", "(.+)"), "container", "$1", "exported_container", "(.+)") or avg_over_time(DCGM_FI_DEV_FB_USED{container!="", pod!="", exported_pod=""}[%[1]s]%[2]s)) by (container, pod, namespace, cluster_id) * 1024 * 1024`
+	queryFmtGPUMemoryUsageMax     = `sum(label_replace(label_replace(label_replace(max_over_time(DCGM_FI_DEV_FB_USED{exported_pod!=""}[%[1]s]%[2]s), "pod", "$1", "exported_pod", "(.+)"), "namespace", "$1", "exported_namespace", "(.+)"), "container", "$1", "exported_container", "(.+)") or max_over_time(DCGM_FI_DEV_FB_USED{container!="", pod!="", exported_pod=""}[%[1]s]%[2]s)) by (container, pod, namespace, cluster_id) * 1024 * 1024`
+	queryFmtExtendedResources     = `avg(avg_over_time(kube_pod_container_resource_requests{resource=~"%s", container!="",container!="POD", node!=""}[%s]%s)) by (container, pod, namespace, node, resource, unit, cluster_id)`
 	queryFmtNodeCostPerCPUHr      = `avg(avg_over_time(node_cpu_hourly_cost[%s]%s)) by (node, cluster_id, instance_type)`
 	queryFmtNodeCostPerRAMGiBHr   = `avg(avg_over_time(node_ram_hourly_cost[%s]%s)) by (node, cluster_id, instance_type)`
 	queryFmtNodeCostPerGPUHr      = `avg(avg_over_time(node_gpu_hourly_cost[%s]%s)) by (node, cluster_id, instance_type)`
+	queryFmtNodeGPUShares         = `avg(avg_over_time(kubecost_node_gpu_share[%s]%s)) by (node, resource, cluster_id)`
 	queryFmtNodeIsSpot            = `avg_over_time(kubecost_node_is_spot[%s]%s)`
 	queryFmtPVCInfo               = `avg(kube_persistentvolumeclaim_info{volumename != ""}) by (persistentvolumeclaim, storageclass, volumename, namespace, cluster_id)[%s:%s]%s`
 	queryFmtPVBytes               = `avg(avg_over_time(kube_persistentvolume_capacity_bytes[%s]%s)) by (persistentvolume, cluster_id)`
@@ -139,6 +146,26 @@ func (cm *CostModel) ComputeAllocation(start, end time.Time, resolution time.Dur
 	queryGPUsRequested := fmt.Sprintf(queryFmtGPUsRequested, durStr, offStr)
 	resChGPUsRequested := ctx.Query(queryGPUsRequested)
 
+	queryGPUUsageAvg := fmt.Sprintf(queryFmtGPUUsageAvg, durStr, offStr)
+	resChGPUUsageAvg := ctx.Query(queryGPUUsageAvg)
+
+	queryGPUUsageMax := fmt.Sprintf(queryFmtGPUUsageMax, durStr, offStr)
+	resChGPUUsageMax := ctx.Query(queryGPUUsageMax)
+
+	queryGPUMemoryUsageAvg := fmt.Sprintf(queryFmtGPUMemoryUsageAvg, durStr, offStr)
+	resChGPUMemoryUsageAvg := ctx.Query(queryGPUMemoryUsageAvg)
+
+	queryGPUMemoryUsageMax := fmt.Sprintf(queryFmtGPUMemoryUsageMax, durStr, offStr)
+	resChGPUMemoryUsageMax := ctx.Query(queryGPUMemoryUsageMax)
+
+	// Extended resources are only queried if any are priced
+	extendedResourcePrices := getExtendedResourcePrices(cm)
+	var resChExtendedResources prom.QueryResultsChan
+	if len(extendedResourcePrices) > 0 {
+		queryExtendedResources := fmt.Sprintf(queryFmtExtendedResources, extendedResourcesRegex(extendedResourcePrices), durStr, offStr)
+		resChExtendedResources = ctx.Query(queryExtendedResources)
+	}
+
 	queryNodeCostPerCPUHr := fmt.Sprintf(queryFmtNodeCostPerCPUHr, durStr, offStr)
 	resChNodeCostPerCPUHr := ctx.Query(queryNodeCostPerCPUHr)
 
@@ -148,6 +175,9 @@ func (cm *CostModel) ComputeAllocation(start, end time.Time, resolution time.Dur
 	queryNodeCostPerGPUHr := fmt.Sprintf(queryFmtNodeCostPerGPUHr, durStr, offStr)
 	resChNodeCostPerGPUHr := ctx.Query(queryNodeCostPerGPUHr)
 
+	queryNodeGPUShares := fmt.Sprintf(queryFmtNodeGPUShares, durStr, offStr)
+	resChNodeGPUShares := ctx.Query(queryNodeGPUShares)
+
 	queryNodeIsSpot := fmt.Sprintf(queryFmtNodeIsSpot, durStr, offStr)
 	resChNodeIsSpot := ctx.Query(queryNodeIsSpot)
 
@@ -226,10 +256,19 @@ func (cm *CostModel) ComputeAllocation(start, end time.Time, resolution time.Dur
 	resRAMUsageAvg, _ := resChRAMUsageAvg.Await()
 	resRAMUsageMax, _ := resChRAMUsageMax.Await()
 	resGPUsRequested, _ := resChGPUsRequested.Await()
+	resGPUUsageAvg, _ := resChGPUUsageAvg.Await()
+	resGPUUsageMax, _ := resChGPUUsageMax.Await()
+	resGPUMemoryUsageAvg, _ := resChGPUMemoryUsageAvg.Await()
+	resGPUMemoryUsageMax, _ := resChGPUMemoryUsageMax.Await()
+	var resExtendedResources []*prom.QueryResult
+	if resChExtendedResources != nil {
+		resExtendedResources, _ = resChExtendedResources.Await()
+	}
 
 	resNodeCostPerCPUHr, _ := resChNodeCostPerCPUHr.Await()
 	resNodeCostPerRAMGiBHr, _ := resChNodeCostPerRAMGiBHr.Await()
 	resNodeCostPerGPUHr, _ := resChNodeCostPerGPUHr.Await()
+	resNodeGPUShares, _ := resChNodeGPUShares.Await()
 	resNodeIsSpot, _ := resChNodeIsSpot.Await()
 
 	resPVBytes, _ := resChPVBytes.Await()
@@ -277,7 +316,13 @@ func (cm *CostModel) ComputeAllocation(start, end time.Time, resolution time.Dur
 	applyRAMBytesRequested(podMap, resRAMRequests)
 	applyRAMBytesUsedAvg(podMap, resRAMUsageAvg)
 	applyRAMBytesUsedMax(podMap, resRAMUsageMax)
-	applyGPUsRequested(podMap, resGPUsRequested)
+	nodeGPUShares := resToNodeGPUShares(resNodeGPUShares)
+	applyGPUsRequested(podMap, resGPUsRequested, nodeGPUShares)
+	applyGPUsUsedAvg(podMap, resGPUUsageAvg)
+	applyGPUsUsedMax(podMap, resGPUUsageMax)
+	applyGPUMemoryBytesUsedAvg(podMap, resGPUMemoryUsageAvg)
+	applyGPUMemoryBytesUsedMax(podMap, resGPUMemoryUsageMax)
+	applyExtendedResourcesRequested(podMap, resExtendedResources, extendedResourcePrices)
 	applyNetworkAllocation(podMap, resNetZoneGiB, resNetZoneCostPerGiB)
 	applyNetworkAllocation(podMap, resNetRegionGiB, resNetRegionCostPerGiB)
 	applyNetworkAllocation(podMap, resNetInternetGiB, resNetInternetCostPerGiB)
@@ -854,7 +899,10 @@ func applyRAMBytesUsedMax(podMap map[podKey]*Pod, resRAMBytesUsedMax []*prom.Que
 	}
 }
 
-func applyGPUsRequested(podMap map[podKey]*Pod, resGPUsRequested []*prom.QueryResult) {
+// applyGPUsRequested applies GPU hours requested, counting each unit of
+// a MIG profile or time-sliced GPU as the fraction of a GPU it represents on
+// its node, so that it is priced proportionally to the GPU.
+func applyGPUsRequested(podMap map[podKey]*Pod, resGPUsRequested []*prom.QueryResult, nodeGPUShares map[nodeKey]map[string]float64) {
 	for _, res := range resGPUsRequested {
 		key, err := resultPodKey(res, "cluster_id", "namespace", "pod")
 		if err != nil {
@@ -877,8 +925,202 @@ func applyGPUsRequested(podMap map[podKey]*Pod, resGPUsRequested []*prom.QueryRe
 			pod.AppendContainer(container)
 		}
 
+		resource, err := res.GetString("resource")
+		if err != nil {
+			resource = cloud.SanitizeResourceName(cloud.GPUResourceName)
+		}
+
+		// Without a recorded share, e.g. from before shares were recorded,
+		// MIG profiles are still shares of a GPU by name
+		share := cloud.GPUShare(resource, nil)
+		if node, err := res.GetString("node"); err == nil {
+			if recorded, ok := nodeGPUShares[newNodeKey(key.Cluster, node)][resource]; ok {
+				share = recorded
+			}
+		}
+
 		hrs := pod.Allocations[container].Minutes() / 60.0
-		pod.Allocations[container].GPUHours = res.Values[0].Value * hrs
+		pod.Allocations[container].GPUHours += res.Values[0].Value * share * hrs
+	}
+}
+
+// applyExtendedResourcesRequested applies the cost of each priced extended
+// resource requested, e.g. hugepages or vendor devices, at its configured
+// hourly price. Resources measured in bytes are priced per GiB.
+func applyExtendedResourcesRequested(podMap map[podKey]*Pod, resExtendedResources []*prom.QueryResult, prices map[string]*extendedResourcePrice) {
+	for _, res := range resExtendedResources {
+		key, err := resultPodKey(res, "cluster_id", "namespace", "pod")
+		if err != nil {
+			log.DedupedWarningf(10, "CostModel.ComputeAllocation: extended resource request result missing field: %s", err)
+			continue
+		}
+
+		pod, ok := podMap[key]
+		if !ok {
+			continue
+		}
+
+		container, err := res.GetString("container")
+		if err != nil {
+			log.DedupedWarningf(10, "CostModel.ComputeAllocation: extended resource request query result missing 'container': %s", key)
+			continue
+		}
+
+		resource, err := res.GetString("resource")
+		if err != nil {
+			log.DedupedWarningf(10, "CostModel.ComputeAllocation: extended resource request query result missing 'resource': %s", key)
+			continue
+		}
+
+		price, ok := prices[resource]
+		if !ok {
+			continue
+		}
+
+		if _, ok := pod.Allocations[container]; !ok {
+			pod.AppendContainer(container)
+		}
+
+		units := res.Values[0].Value
+		if unit, _ := res.GetString("unit"); unit == "byte" {
+			units = units / 1024 / 1024 / 1024
+		}
+
+		alloc := pod.Allocations[container]
+		if alloc.ExtendedResourceCosts == nil {
+			alloc.ExtendedResourceCosts = map[string]float64{}
+		}
+		hrs := alloc.Minutes() / 60.0
+		alloc.ExtendedResourceCosts[price.Name] += units * hrs * price.CostPerUnitHr
+	}
+}
+
+// applyGPUsUsedAvg applies average GPU utilization, as reported per GPU by
+// DCGM-exporter, in units of GPUs; e.g. two GPUs, each 50% utilized, are one
+// GPU's worth of usage. GPU usage requires DCGM-exporter to attribute GPUs to
+// pods, without which GPU usage is zero. A ServiceMonitor scrape without
+// honorLabels renames DCGM-exporter's pod, namespace, and container labels
+// to exported_pod, exported_namespace, and exported_container, so the usage
+// queries relabel those series to the pod using the GPU.
+func applyGPUsUsedAvg(podMap map[podKey]*Pod, resGPUsUsedAvg []*prom.QueryResult) {
+	for _, res := range resGPUsUsedAvg {
+		key, err := resultPodKey(res, "cluster_id", "namespace", "pod")
+		if err != nil {
+			log.DedupedWarningf(10, "CostModel.ComputeAllocation: GPU usage avg result missing field: %s", err)
+			continue
+		}
+
+		pod, ok := podMap[key]
+		if !ok {
+			continue
+		}
+
+		container, err := res.GetString("container")
+		if err != nil {
+			log.DedupedWarningf(10, "CostModel.ComputeAllocation: GPU usage avg query result missing 'container': %s", key)
+			continue
+		}
+
+		if _, ok := pod.Allocations[container]; !ok {
+			pod.AppendContainer(container)
+		}
+
+		pod.Allocations[container].GPUUsageAverage = res.Values[0].Value
+	}
+}
+
+// applyGPUsUsedMax applies the sum of the maximum utilization of each GPU,
+// which bounds the maximum GPUs' worth of usage.
+func applyGPUsUsedMax(podMap map[podKey]*Pod, resGPUsUsedMax []*prom.QueryResult) {
+	for _, res := range resGPUsUsedMax {
+		key, err := resultPodKey(res, "cluster_id", "namespace", "pod")
+		if err != nil {
+			log.DedupedWarningf(10, "CostModel.ComputeAllocation: GPU usage max result missing field: %s", err)
+			continue
+		}
+
+		pod, ok := podMap[key]
+		if !ok {
+			continue
+		}
+
+		container, err := res.GetString("container")
+		if err != nil {
+			log.DedupedWarningf(10, "CostModel.ComputeAllocation: GPU usage max query result missing 'container': %s", key)
+			continue
+		}
+
+		if _, ok := pod.Allocations[container]; !ok {
+			pod.AppendContainer(container)
+		}
+
+		if pod.Allocations[container].RawAllocationOnly == nil {
+			pod.Allocations[container].RawAllocationOnly = &kubecost.RawAllocationOnlyData{
+				GPUUsageMax: res.Values[0].Value,
+			}
+		} else {
+			pod.Allocations[container].RawAllocationOnly.GPUUsageMax = res.Values[0].Value
+		}
+	}
+}
+
+func applyGPUMemoryBytesUsedAvg(podMap map[podKey]*Pod, resGPUMemoryBytesUsedAvg []*prom.QueryResult) {
+	for _, res := range resGPUMemoryBytesUsedAvg {
+		key, err := resultPodKey(res, "cluster_id", "namespace", "pod")
+		if err != nil {
+			log.DedupedWarningf(10, "CostModel.ComputeAllocation: GPU memory usage avg result missing field: %s", err)
+			continue
+		}
+
+		pod, ok := podMap[key]
+		if !ok {
+			continue
+		}
+
+		container, err := res.GetString("container")
+		if err != nil {
+			log.DedupedWarningf(10, "CostModel.ComputeAllocation: GPU memory usage avg query result missing 'container': %s", key)
+			continue
+		}
+
+		if _, ok := pod.Allocations[container]; !ok {
+			pod.AppendContainer(container)
+		}
+
+		pod.Allocations[container].GPUMemoryBytesUsageAverage = res.Values[0].Value
+	}
+}
+
+func applyGPUMemoryBytesUsedMax(podMap map[podKey]*Pod, resGPUMemoryBytesUsedMax []*prom.QueryResult) {
+	for _, res := range resGPUMemoryBytesUsedMax {
+		key, err := resultPodKey(res, "cluster_id", "namespace", "pod")
+		if err != nil {
+			log.DedupedWarningf(10, "CostModel.ComputeAllocation: GPU memory usage max result missing field: %s", err)
+			continue
+		}
+
+		pod, ok := podMap[key]
+		if !ok {
+			continue
+		}
+
+		container, err := res.GetString("container")
+		if err != nil {
+			log.DedupedWarningf(10, "CostModel.ComputeAllocation: GPU memory usage max query result missing 'container': %s", key)
+			continue
+		}
+
+		if _, ok := pod.Allocations[container]; !ok {
+			pod.AppendContainer(container)
+		}
+
+		if pod.Allocations[container].RawAllocationOnly == nil {
+			pod.Allocations[container].RawAllocationOnly = &kubecost.RawAllocationOnlyData{
+				GPUMemoryBytesUsageMax: res.Values[0].Value,
+			}
+		} else {
+			pod.Allocations[container].RawAllocationOnly.GPUMemoryBytesUsageMax = res.Values[0].Value
+		}
 	}
 }
 
@@ -1375,6 +1617,33 @@ func applyNodeCostPerGPUHr(nodeMap map[nodeKey]*NodePricing, resNodeCostPerGPUHr
 	}
 }
 
+// resToNodeGPUShares maps each node to the fraction of a GPU that one unit of
+// each of its GPU resources represents.
+func resToNodeGPUShares(resNodeGPUShares []*prom.QueryResult) map[nodeKey]map[string]float64 {
+	nodeGPUShares := map[nodeKey]map[string]float64{}
+
+	for _, res := range resNodeGPUShares {
+		key, err := resultNodeKey(res, "cluster_id", "node")
+		if err != nil {
+			log.DedupedWarningf(10, "CostModel.ComputeAllocation: Node GPU share query result missing field: %s", err)
+			continue
+		}
+
+		resource, err := res.GetString("resource")
+		if err != nil {
+			log.DedupedWarningf(10, "CostModel.ComputeAllocation: Node GPU share query result missing field: %s", err)
+			continue
+		}
+
+		if _, ok := nodeGPUShares[key]; !ok {
+			nodeGPUShares[key] = map[string]float64{}
+		}
+		nodeGPUShares[key][resource] = res.Values[0].Value
+	}
+
+	return nodeGPUShares
+}
+
 func applyNodeSpot(nodeMap map[nodeKey]*NodePricing, resNodeIsSpot []*prom.QueryResult) {
 	for _, res := range resNodeIsSpot {
 		cluster, err := res.GetString("cluster_id")
@@ -1429,6 +1698,56 @@ func applyNodeDiscount(nodeMap map[nodeKey]*NodePricing, cm *CostModel) {
 	}
 }
 
+// getExtendedResourcePrices returns the hourly prices of extended resources
+// configured in custom pricing, keyed by resource name as sanitized by
+// kube-state-metrics. CPU, RAM, and GPUs, which are priced by node, cannot
+// be priced as extended resources.
+func getExtendedResourcePrices(cm *CostModel) map[string]*extendedResourcePrice {
+	prices := map[string]*extendedResourcePrice{}
+
+	if cm == nil || cm.Provider == nil {
+		return prices
+	}
+
+	c, err := cm.Provider.GetConfig()
+	if err != nil {
+		log.Errorf("CostModel.ComputeAllocation: getExtendedResourcePrices: %s", err)
+		return prices
+	}
+
+	for name, priceStr := range c.ExtendedResources {
+		if name == "cpu" || name == "memory" || cloud.IsGPUResource(name) {
+			log.DedupedWarningf(5, "CostModel.ComputeAllocation: cannot price %s as an extended resource", name)
+			continue
+		}
+
+		price, err := strconv.ParseFloat(priceStr, 64)
+		if err != nil {
+			log.DedupedWarningf(5, "CostModel.ComputeAllocation: illegal price for extended resource %s: %s", name, priceStr)
+			continue
+		}
+
+		prices[cloud.SanitizeResourceName(name)] = &extendedResourcePrice{
+			Name:          name,
+			CostPerUnitHr: price,
+		}
+	}
+
+	return prices
+}
+
+// extendedResourcesRegex returns a regex matching the sanitized names of the
+// given extended resources, for the "resource" label of kube-state-metrics.
+// Sanitized names need no escaping.
+func extendedResourcesRegex(prices map[string]*extendedResourcePrice) string {
+	resources := make([]string, 0, len(prices))
+	for resource := range prices {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	return strings.Join(resources, "|")
+}
+
 func buildPVMap(pvMap map[pvKey]*PV, resPVCostPerGiBHour []*prom.QueryResult) {
 	for _, res := range resPVCostPerGiBHour {
 		cluster, err := res.GetString("cluster_id")
@@ -1599,18 +1918,7 @@ func applyUnmountedPVs(window kubecost.Window, podMap map[podKey]*Pod, pvMap map
 	unmountedPVCost := map[string]float64{}
 
 	for _, pv := range pvMap {
-		mounted := false
-		for _, pvc := range pvcMap {
-			if pvc.Volume == nil {
-				continue
-			}
-			if pvc.Volume == pv {
-				mounted = true
-				break
-			}
-		}
-
-		if !mounted {
+		if !isPVMounted(pv, pvcMap) {
 			gib := pv.Bytes / 1024 / 1024 / 1024
 			hrs := window.Minutes() / 60.0 // TODO improve with PV hours, not window hours
 			cost := pv.CostPerGiBHour * gib * hrs
@@ -1645,6 +1953,17 @@ func applyUnmountedPVs(window kubecost.Window, podMap map[podKey]*Pod, pvMap map
 	}
 }
 
+// isPVMounted returns true if the given PV is claimed by any of the given
+// PVCs.
+func isPVMounted(pv *PV, pvcMap map[pvcKey]*PVC) bool {
+	for _, pvc := range pvcMap {
+		if pvc.Volume != nil && pvc.Volume == pv {
+			return true
+		}
+	}
+	return false
+}
+
 func applyUnmountedPVCs(window kubecost.Window, podMap map[podKey]*Pod, pvcMap map[pvcKey]*PVC) {
 	unmountedPVCBytes := map[namespaceKey]float64{}
 	unmountedPVCCost := map[namespaceKey]float64{}
@@ -1893,6 +2212,13 @@ type NodePricing struct {
 	Source          string
 }
 
+// extendedResourcePrice describes the configured hourly price of one unit, or
+// GiB, of an extended resource, under its configured name.
+type extendedResourcePrice struct {
+	Name          string
+	CostPerUnitHr float64
+}
+
 // Pod describes a running pod's start and end time within a Window and
 // all the Allocations (i.e. containers) contained within it.
 type Pod struct {
@@ -0,0 +1,245 @@
+package costmodel
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/prom"
+	"github.com/kubecost/cost-model/pkg/util"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestApplyGPUsRequested(t *testing.T) {
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(10 * time.Hour)
+	window := kubecost.NewWindow(&start, &end)
+
+	key := newPodKey("cluster1", "ml", "train")
+	podMap := map[podKey]*Pod{
+		key: &Pod{
+			Window:      window.Clone(),
+			Start:       start,
+			End:         end,
+			Key:         key,
+			Allocations: map[string]*kubecost.Allocation{},
+		},
+	}
+
+	request := func(container, node, resource string, value float64) *prom.QueryResult {
+		return &prom.QueryResult{
+			Metric: map[string]interface{}{
+				"cluster_id": "cluster1",
+				"namespace":  "ml",
+				"pod":        "train",
+				"container":  container,
+				"node":       node,
+				"resource":   resource,
+			},
+			Values: []*util.Vector{{Value: value}},
+		}
+	}
+
+	// A whole GPU, one replica of a GPU time-sliced four ways, and two MIG
+	// slices, one recorded and one priced by name
+	nodeGPUShares := map[nodeKey]map[string]float64{
+		newNodeKey("cluster1", "node1"): {"nvidia_com_gpu": 0.25},
+	}
+	applyGPUsRequested(podMap, []*prom.QueryResult{
+		request("whole", "node0", "nvidia_com_gpu", 1.0),
+		request("sliced", "node1", "nvidia_com_gpu", 1.0),
+		request("mig", "node2", "nvidia_com_mig_3g_20gb", 2.0),
+	}, nodeGPUShares)
+
+	allocs := podMap[key].Allocations
+	if !util.IsApproximately(allocs["whole"].GPUHours, 10.0) {
+		t.Fatalf("expected 10 GPU hours; got %f", allocs["whole"].GPUHours)
+	}
+	if !util.IsApproximately(allocs["sliced"].GPUHours, 2.5) {
+		t.Fatalf("expected 2.5 GPU hours; got %f", allocs["sliced"].GPUHours)
+	}
+	if !util.IsApproximately(allocs["mig"].GPUHours, 2.0*10.0*3.0/7.0) {
+		t.Fatalf("expected %f GPU hours; got %f", 2.0*10.0*3.0/7.0, allocs["mig"].GPUHours)
+	}
+}
+
+func TestApplyGPUsUsed(t *testing.T) {
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(10 * time.Hour)
+	window := kubecost.NewWindow(&start, &end)
+
+	key := newPodKey("cluster1", "ml", "train")
+	podMap := map[podKey]*Pod{
+		key: &Pod{
+			Window:      window.Clone(),
+			Start:       start,
+			End:         end,
+			Key:         key,
+			Allocations: map[string]*kubecost.Allocation{},
+		},
+	}
+	podMap[key].AppendContainer("trainer")
+
+	usage := func(pod, container string, value float64) *prom.QueryResult {
+		return &prom.QueryResult{
+			Metric: map[string]interface{}{
+				"cluster_id": "cluster1",
+				"namespace":  "ml",
+				"pod":        pod,
+				"container":  container,
+			},
+			Values: []*util.Vector{{Value: value}},
+		}
+	}
+
+	// Usage of a known container, a container not yet allocated, and a pod
+	// that is not running in the window
+	applyGPUsUsedAvg(podMap, []*prom.QueryResult{
+		usage("train", "trainer", 1.5),
+		usage("train", "sidecar", 0.25),
+		usage("other", "trainer", 1.0),
+	})
+	applyGPUsUsedMax(podMap, []*prom.QueryResult{
+		usage("train", "trainer", 2.0),
+		usage("train", "sidecar", 0.5),
+	})
+	applyGPUMemoryBytesUsedAvg(podMap, []*prom.QueryResult{
+		usage("train", "trainer", 8.0*1024*1024*1024),
+	})
+	applyGPUMemoryBytesUsedMax(podMap, []*prom.QueryResult{
+		usage("train", "trainer", 12.0*1024*1024*1024),
+	})
+
+	if len(podMap) != 1 {
+		t.Fatalf("expected 1 pod; got %d", len(podMap))
+	}
+
+	allocs := podMap[key].Allocations
+	if len(allocs) != 2 {
+		t.Fatalf("expected 2 containers; got %d", len(allocs))
+	}
+
+	trainer := allocs["trainer"]
+	if !util.IsApproximately(trainer.GPUUsageAverage, 1.5) {
+		t.Fatalf("expected average GPU usage 1.5; got %f", trainer.GPUUsageAverage)
+	}
+	if trainer.RawAllocationOnly == nil || !util.IsApproximately(trainer.RawAllocationOnly.GPUUsageMax, 2.0) {
+		t.Fatalf("expected max GPU usage 2.0; got %v", trainer.RawAllocationOnly)
+	}
+	if !util.IsApproximately(trainer.GPUMemoryBytesUsageAverage, 8.0*1024*1024*1024) {
+		t.Fatalf("expected average GPU memory usage 8GiB; got %f", trainer.GPUMemoryBytesUsageAverage)
+	}
+	if !util.IsApproximately(trainer.RawAllocationOnly.GPUMemoryBytesUsageMax, 12.0*1024*1024*1024) {
+		t.Fatalf("expected max GPU memory usage 12GiB; got %f", trainer.RawAllocationOnly.GPUMemoryBytesUsageMax)
+	}
+
+	sidecar, ok := allocs["sidecar"]
+	if !ok {
+		t.Fatalf("expected GPU usage to add container 'sidecar'")
+	}
+	if !util.IsApproximately(sidecar.GPUUsageAverage, 0.25) {
+		t.Fatalf("expected average GPU usage 0.25; got %f", sidecar.GPUUsageAverage)
+	}
+	if sidecar.RawAllocationOnly == nil || !util.IsApproximately(sidecar.RawAllocationOnly.GPUUsageMax, 0.5) {
+		t.Fatalf("expected max GPU usage 0.5; got %v", sidecar.RawAllocationOnly)
+	}
+	if sidecar.GPUMemoryBytesUsageAverage != 0.0 || sidecar.RawAllocationOnly.GPUMemoryBytesUsageMax != 0.0 {
+		t.Fatalf("expected no GPU memory usage; got %f avg, %f max", sidecar.GPUMemoryBytesUsageAverage, sidecar.RawAllocationOnly.GPUMemoryBytesUsageMax)
+	}
+}
+
+func TestGPUUsageQueries(t *testing.T) {
+	for _, queryFmt := range []string{queryFmtGPUUsageAvg, queryFmtGPUUsageMax, queryFmtGPUMemoryUsageAvg, queryFmtGPUMemoryUsageMax} {
+		query := fmt.Sprintf(queryFmt, "1h", " offset 1h")
+		if strings.Contains(query, "%!") {
+			t.Fatalf("malformed query: %s", query)
+		}
+		// Series scraped through a ServiceMonitor are relabeled, and series
+		// scraped with honorLabels are used as they are
+		if !strings.Contains(query, `"pod", "$1", "exported_pod", "(.+)"`) || !strings.Contains(query, `exported_pod=""}[1h] offset 1h`) {
+			t.Fatalf("expected query to read pod from exported_pod or pod: %s", query)
+		}
+	}
+}
+
+func TestNodeGPUCount(t *testing.T) {
+	n := &v1.Node{}
+	n.Status.Capacity = v1.ResourceList{
+		"nvidia.com/mig-3g.20gb": resource.MustParse("2"),
+		"nvidia.com/mig-1g.5gb":  resource.MustParse("1"),
+	}
+	shares := map[string]float64{"nvidia.com/mig-3g.20gb": 3.0 / 7.0, "nvidia.com/mig-1g.5gb": 1.0 / 7.0}
+
+	// One GPU, fully partitioned
+	if count := nodeGPUCount(n, shares); count != 1 {
+		t.Fatalf("expected 1 GPU; got %d", count)
+	}
+
+	// Eight GPUs, time-sliced four ways
+	n.Status.Capacity = v1.ResourceList{"nvidia.com/gpu": resource.MustParse("32")}
+	if count := nodeGPUCount(n, map[string]float64{"nvidia.com/gpu": 0.25}); count != 8 {
+		t.Fatalf("expected 8 GPUs; got %d", count)
+	}
+
+	n.Labels = map[string]string{"nvidia.com/gpu.count": "4"}
+	if count := nodeGPUCount(n, map[string]float64{"nvidia.com/gpu": 0.25}); count != 4 {
+		t.Fatalf("expected labeled 4 GPUs; got %d", count)
+	}
+}
+
+func TestApplyExtendedResourcesRequested(t *testing.T) {
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(10 * time.Hour)
+	window := kubecost.NewWindow(&start, &end)
+
+	key := newPodKey("cluster1", "net", "router")
+	podMap := map[podKey]*Pod{
+		key: &Pod{
+			Window:      window.Clone(),
+			Start:       start,
+			End:         end,
+			Key:         key,
+			Allocations: map[string]*kubecost.Allocation{},
+		},
+	}
+
+	request := func(resource, unit string, value float64) *prom.QueryResult {
+		return &prom.QueryResult{
+			Metric: map[string]interface{}{
+				"cluster_id": "cluster1",
+				"namespace":  "net",
+				"pod":        "router",
+				"container":  "dpdk",
+				"node":       "node1",
+				"resource":   resource,
+				"unit":       unit,
+			},
+			Values: []*util.Vector{{Value: value}},
+		}
+	}
+
+	prices := map[string]*extendedResourcePrice{
+		"hugepages_2Mi":      {Name: "hugepages-2Mi", CostPerUnitHr: 0.01},
+		"intel_com_sriov_vf": {Name: "intel.com/sriov_vf", CostPerUnitHr: 0.05},
+	}
+	applyExtendedResourcesRequested(podMap, []*prom.QueryResult{
+		request("hugepages_2Mi", "byte", 2.0*1024*1024*1024),
+		request("intel_com_sriov_vf", "integer", 2.0),
+		request("example_com_unpriced", "integer", 1.0),
+	}, prices)
+
+	costs := podMap[key].Allocations["dpdk"].ExtendedResourceCosts
+	if len(costs) != 2 {
+		t.Fatalf("expected 2 extended resource costs; got %v", costs)
+	}
+	if !util.IsApproximately(costs["hugepages-2Mi"], 2.0*10.0*0.01) {
+		t.Fatalf("expected hugepages cost %f; got %f", 2.0*10.0*0.01, costs["hugepages-2Mi"])
+	}
+	if !util.IsApproximately(costs["intel.com/sriov_vf"], 2.0*10.0*0.05) {
+		t.Fatalf("expected SR-IOV cost %f; got %f", 2.0*10.0*0.05, costs["intel.com/sriov_vf"])
+	}
+}
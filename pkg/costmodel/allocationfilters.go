@@ -0,0 +1,273 @@
+package costmodel
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/prom"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+// allocationFilterValues returns the values of an Allocation against which
+// the values of a filter query parameter are matched.
+type allocationFilterValues func(*kubecost.Allocation) []string
+
+// allocationFilter describes a single filter query parameter.
+type allocationFilter struct {
+	// param is the name of the query parameter
+	param string
+
+	// values returns the values of the Allocation to match against
+	values allocationFilterValues
+
+	// caseInsensitive determines whether or not matching ignores case
+	caseInsensitive bool
+
+	// keyValue determines whether or not filter values must be of the form
+	// "key:value", in which case the key is sanitized as a Prometheus label
+	keyValue bool
+}
+
+// allocationFilters is the list of supported filter query parameters, each of
+// which accepts a comma-separated list of values; e.g.
+//   filterNamespaces=kubecost,kube-*
+//   filterLabels=app:web,!env:dev
+//   filterControllers=deployment:cost-analyzer
+var allocationFilters = []allocationFilter{
+	{
+		param: "filterClusters",
+		values: func(a *kubecost.Allocation) []string {
+			return []string{a.Properties.Cluster}
+		},
+	},
+	{
+		param: "filterNodes",
+		values: func(a *kubecost.Allocation) []string {
+			return []string{a.Properties.Node}
+		},
+	},
+	{
+		param: "filterNamespaces",
+		values: func(a *kubecost.Allocation) []string {
+			return []string{a.Properties.Namespace}
+		},
+	},
+	{
+		param: "filterControllerKinds",
+		values: func(a *kubecost.Allocation) []string {
+			return []string{a.Properties.ControllerKind}
+		},
+		caseInsensitive: true,
+	},
+	{
+		// Controllers may be given either by name or by "kind:name"
+		param: "filterControllers",
+		values: func(a *kubecost.Allocation) []string {
+			if a.Properties.Controller == "" {
+				return []string{}
+			}
+			return []string{
+				a.Properties.Controller,
+				fmt.Sprintf("%s:%s", a.Properties.ControllerKind, a.Properties.Controller),
+			}
+		},
+	},
+	{
+		param: "filterPods",
+		values: func(a *kubecost.Allocation) []string {
+			return []string{a.Properties.Pod}
+		},
+	},
+	{
+		param: "filterContainers",
+		values: func(a *kubecost.Allocation) []string {
+			return []string{a.Properties.Container}
+		},
+	},
+	{
+		param: "filterServices",
+		values: func(a *kubecost.Allocation) []string {
+			return a.Properties.Services
+		},
+	},
+	{
+		param: "filterLabels",
+		values: func(a *kubecost.Allocation) []string {
+			vals := []string{}
+			for k, v := range a.Properties.Labels {
+				vals = append(vals, fmt.Sprintf("%s:%s", k, v))
+			}
+			return vals
+		},
+		keyValue: true,
+	},
+	{
+		param: "filterAnnotations",
+		values: func(a *kubecost.Allocation) []string {
+			vals := []string{}
+			for k, v := range a.Properties.Annotations {
+				vals = append(vals, fmt.Sprintf("%s:%s", k, v))
+			}
+			return vals
+		},
+		keyValue: true,
+	},
+}
+
+// ParseAllocationFilters parses the filter query parameters of the given
+// QueryParams into a list of AllocationMatchFuncs, one per parameter. As with
+// AllocationAggregationOptions.FilterFuncs, an Allocation must pass every
+// function in order to pass the filter.
+//
+// Each parameter accepts a comma-separated list of values. An Allocation
+// passes a parameter if it matches any of the values, unless that parameter
+// has only negated values, in which case it passes if it matches none of them.
+// Values are negated with a "!" prefix and may contain "*" wildcards, which
+// match any sequence of characters. Labels and annotations are given in the
+// form "key:value"; e.g.
+//   filterNamespaces=kube-*,!kube-public
+//   filterLabels=app:web,!env:dev*
+func ParseAllocationFilters(qp util.QueryParams) ([]kubecost.AllocationMatchFunc, error) {
+	filterFuncs := []kubecost.AllocationMatchFunc{}
+
+	for _, filter := range allocationFilters {
+		includes := []string{}
+		excludes := []string{}
+
+		for _, rawValue := range qp.GetList(filter.param, ",") {
+			value := strings.TrimSpace(rawValue)
+
+			negated := strings.HasPrefix(value, "!")
+			if negated {
+				value = strings.TrimSpace(strings.TrimPrefix(value, "!"))
+			}
+
+			if value == "" {
+				continue
+			}
+
+			if filter.keyValue {
+				kv := strings.SplitN(value, ":", 2)
+				if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+					return nil, fmt.Errorf("invalid '%s' value '%s': expected the form key:value", filter.param, rawValue)
+				}
+				value = fmt.Sprintf("%s:%s", prom.SanitizeLabelName(strings.TrimSpace(kv[0])), strings.TrimSpace(kv[1]))
+			}
+
+			if filter.caseInsensitive {
+				value = strings.ToLower(value)
+			}
+
+			if negated {
+				excludes = append(excludes, value)
+			} else {
+				includes = append(includes, value)
+			}
+		}
+
+		if len(includes) == 0 && len(excludes) == 0 {
+			continue
+		}
+
+		filterFuncs = append(filterFuncs, newAllocationMatchFunc(filter, includes, excludes))
+	}
+
+	return filterFuncs, nil
+}
+
+// newAllocationMatchFunc returns an AllocationMatchFunc which passes any
+// Allocation with a value matching one of the includes, if there are any, and
+// none of the excludes.
+func newAllocationMatchFunc(filter allocationFilter, includes, excludes []string) kubecost.AllocationMatchFunc {
+	return func(a *kubecost.Allocation) bool {
+		if a == nil || a.Properties == nil {
+			return false
+		}
+
+		included := len(includes) == 0
+		for _, value := range filter.values(a) {
+			if filter.caseInsensitive {
+				value = strings.ToLower(value)
+			}
+
+			for _, pattern := range excludes {
+				if wildcardMatch(pattern, value) {
+					return false
+				}
+			}
+
+			if !included {
+				for _, pattern := range includes {
+					if wildcardMatch(pattern, value) {
+						included = true
+						break
+					}
+				}
+			}
+		}
+
+		return included
+	}
+}
+
+// filterAllocationSet deletes from the given AllocationSet every non-idle,
+// non-external Allocation that fails any of the given filter functions. This
+// mirrors the filtering done by AllocationSet.AggregateBy, for use when the
+// set is not being aggregated.
+func filterAllocationSet(as *kubecost.AllocationSet, filterFuncs []kubecost.AllocationMatchFunc) {
+	if len(filterFuncs) == 0 {
+		return
+	}
+
+	filtered := []string{}
+	as.Each(func(name string, alloc *kubecost.Allocation) {
+		if alloc.IsIdle() || alloc.IsExternal() {
+			return
+		}
+
+		for _, ff := range filterFuncs {
+			if !ff(alloc) {
+				filtered = append(filtered, name)
+				return
+			}
+		}
+	})
+
+	for _, name := range filtered {
+		as.Delete(name)
+	}
+}
+
+// wildcardMatch returns true if the given string matches the given pattern,
+// in which "*" matches any sequence of characters, including none.
+func wildcardMatch(pattern, str string) bool {
+	if !strings.Contains(pattern, "*") {
+		return pattern == str
+	}
+
+	parts := strings.Split(pattern, "*")
+
+	// The first part must be a prefix and the last part must be a suffix
+	if !strings.HasPrefix(str, parts[0]) {
+		return false
+	}
+	str = str[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	if len(str) < len(last) || !strings.HasSuffix(str, last) {
+		return false
+	}
+	str = str[:len(str)-len(last)]
+
+	// Each intermediate part must appear, in order, in the remainder
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(str, part)
+		if i < 0 {
+			return false
+		}
+		str = str[i+len(part):]
+	}
+
+	return true
+}
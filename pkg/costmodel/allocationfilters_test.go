@@ -0,0 +1,162 @@
+package costmodel
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+func TestWildcardMatch(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		str      string
+		expected bool
+	}{
+		{"kubecost", "kubecost", true},
+		{"kubecost", "kubecost2", false},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"kube-*", "kube-system", true},
+		{"kube-*", "kubecost", false},
+		{"*-system", "kube-system", true},
+		{"*-system", "kube-public", false},
+		{"kube*tem", "kube-system", true},
+		{"a*b*c", "aXbYc", true},
+		{"a*b*c", "aXcYb", false},
+		{"ab*ba", "aba", false},
+	}
+
+	for _, c := range cases {
+		if actual := wildcardMatch(c.pattern, c.str); actual != c.expected {
+			t.Errorf("wildcardMatch(%q, %q): expected %t; got %t", c.pattern, c.str, c.expected, actual)
+		}
+	}
+}
+
+func TestParseAllocationFilters(t *testing.T) {
+	newAlloc := func(cluster, namespace, controllerKind, controller string, labels map[string]string) *kubecost.Allocation {
+		return &kubecost.Allocation{
+			Name: cluster + "/" + namespace,
+			Properties: &kubecost.AllocationProperties{
+				Cluster:        cluster,
+				Namespace:      namespace,
+				ControllerKind: controllerKind,
+				Controller:     controller,
+				Labels:         labels,
+			},
+		}
+	}
+
+	kubecostAlloc := newAlloc("cluster-one", "kubecost", "deployment", "cost-analyzer", map[string]string{"app": "cost-analyzer", "env": "prod"})
+	kubeSystemAlloc := newAlloc("cluster-one", "kube-system", "daemonset", "kube-proxy", map[string]string{"k8s_app": "kube-proxy"})
+	webAlloc := newAlloc("cluster-two", "web", "deployment", "frontend", map[string]string{"app": "web", "env": "dev"})
+	allocs := []*kubecost.Allocation{kubecostAlloc, kubeSystemAlloc, webAlloc}
+
+	cases := map[string]struct {
+		query    string
+		expected []*kubecost.Allocation
+		err      bool
+	}{
+		"no filters": {
+			query:    "",
+			expected: allocs,
+		},
+		"namespace": {
+			query:    "filterNamespaces=kubecost,web",
+			expected: []*kubecost.Allocation{kubecostAlloc, webAlloc},
+		},
+		"namespace wildcard": {
+			query:    "filterNamespaces=kube*",
+			expected: []*kubecost.Allocation{kubecostAlloc, kubeSystemAlloc},
+		},
+		"namespace negation": {
+			query:    "filterNamespaces=!kube-system",
+			expected: []*kubecost.Allocation{kubecostAlloc, webAlloc},
+		},
+		"namespace wildcard and negation": {
+			query:    "filterNamespaces=kube*,!kube-system",
+			expected: []*kubecost.Allocation{kubecostAlloc},
+		},
+		"cluster": {
+			query:    "filterClusters=cluster-two",
+			expected: []*kubecost.Allocation{webAlloc},
+		},
+		"controller kind is case insensitive": {
+			query:    "filterControllerKinds=DaemonSet",
+			expected: []*kubecost.Allocation{kubeSystemAlloc},
+		},
+		"controller with kind": {
+			query:    "filterControllers=deployment:frontend,kube-proxy",
+			expected: []*kubecost.Allocation{kubeSystemAlloc, webAlloc},
+		},
+		"label": {
+			query:    "filterLabels=app:web",
+			expected: []*kubecost.Allocation{webAlloc},
+		},
+		"label wildcard": {
+			query:    "filterLabels=app:*",
+			expected: []*kubecost.Allocation{kubecostAlloc, webAlloc},
+		},
+		"label key is sanitized": {
+			query:    "filterLabels=k8s-app:kube-proxy",
+			expected: []*kubecost.Allocation{kubeSystemAlloc},
+		},
+		"label negation": {
+			query:    "filterLabels=!env:dev",
+			expected: []*kubecost.Allocation{kubecostAlloc, kubeSystemAlloc},
+		},
+		"multiple parameters": {
+			query:    "filterClusters=cluster-one&filterLabels=env:prod",
+			expected: []*kubecost.Allocation{kubecostAlloc},
+		},
+		"invalid label": {
+			query: "filterLabels=app",
+			err:   true,
+		},
+	}
+
+	for name, c := range cases {
+		values, err := url.ParseQuery(c.query)
+		if err != nil {
+			t.Fatalf("%s: failed to parse query: %s", name, err)
+		}
+
+		filterFuncs, err := ParseAllocationFilters(util.NewQueryParams(values))
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: expected error; got nil", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+			continue
+		}
+
+		actual := []*kubecost.Allocation{}
+		for _, alloc := range allocs {
+			passes := true
+			for _, ff := range filterFuncs {
+				if !ff(alloc) {
+					passes = false
+					break
+				}
+			}
+			if passes {
+				actual = append(actual, alloc)
+			}
+		}
+
+		if len(actual) != len(c.expected) {
+			t.Errorf("%s: expected %d allocations; got %d", name, len(c.expected), len(actual))
+			continue
+		}
+		for i := range actual {
+			if actual[i] != c.expected[i] {
+				t.Errorf("%s: expected %s; got %s", name, c.expected[i].Name, actual[i].Name)
+			}
+		}
+	}
+}
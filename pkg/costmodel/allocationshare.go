@@ -0,0 +1,145 @@
+package costmodel
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/prom"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+// shareNone is the query parameter value which explicitly disables sharing,
+// overriding any configured default.
+const shareNone = "none"
+
+// sharedCostName is the name given to the shared cost provided by the
+// shareCost query parameter.
+const sharedCostName = "shareCost"
+
+// ParseAllocationShareFuncs parses the shareNamespaces and shareLabels query
+// parameters of the given QueryParams into a list of AllocationMatchFuncs, any
+// of which marks an Allocation as a shared resource. Each parameter defaults to
+// the given configured values if it is not provided, and may be set to "none"
+// to share nothing. Labels are given in the form "name:value"; e.g.
+//   shareNamespaces=kube-system,kubecost
+//   shareLabels=app:kubecost,type:staging
+func ParseAllocationShareFuncs(qp util.QueryParams, defaultNamespaces, defaultLabelNames, defaultLabelValues []string) ([]kubecost.AllocationMatchFunc, error) {
+	shareFuncs := []kubecost.AllocationMatchFunc{}
+
+	namespaces := defaultNamespaces
+	if qp.Get("shareNamespaces", "") != "" {
+		namespaces = qp.GetList("shareNamespaces", ",")
+	}
+	for _, ns := range namespaces {
+		ns = strings.TrimSpace(ns)
+		if ns == "" || ns == shareNone {
+			continue
+		}
+		shareFuncs = append(shareFuncs, newShareNamespaceFunc(ns))
+	}
+
+	labelNames := defaultLabelNames
+	labelValues := defaultLabelValues
+	if qp.Get("shareLabels", "") != "" {
+		labelNames = []string{}
+		labelValues = []string{}
+		for _, rawLabel := range qp.GetList("shareLabels", ",") {
+			label := strings.TrimSpace(rawLabel)
+			if label == "" || label == shareNone {
+				continue
+			}
+			kv := strings.SplitN(label, ":", 2)
+			if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+				return nil, fmt.Errorf("invalid 'shareLabels' value '%s': expected the form name:value", rawLabel)
+			}
+			labelNames = append(labelNames, kv[0])
+			labelValues = append(labelValues, kv[1])
+		}
+	}
+	if len(labelNames) != len(labelValues) {
+		return nil, fmt.Errorf("shared labels have mis-matched lengths: %d names, %d values", len(labelNames), len(labelValues))
+	}
+	for i := range labelNames {
+		name := prom.SanitizeLabelName(strings.TrimSpace(labelNames[i]))
+		value := strings.TrimSpace(labelValues[i])
+		if name == "" || value == "" {
+			continue
+		}
+		shareFuncs = append(shareFuncs, newShareLabelFunc(name, value))
+	}
+
+	return shareFuncs, nil
+}
+
+// SharedCostConfigError describes an error caused by an invalid shared cost
+// in the config, rather than by the shareCost query parameter
+type SharedCostConfigError struct {
+	name  string
+	value string
+	err   error
+}
+
+// Error implements the error interface
+func (scce *SharedCostConfigError) Error() string {
+	return fmt.Sprintf("invalid shared cost %s=%s in the 'sharedCost' setting of the config: %s", scce.name, scce.value, scce.err)
+}
+
+// ParseSharedHourlyCosts parses the shareCost query parameter of the given
+// QueryParams, a monthly cost to be shared among the aggregated allocations,
+// into a map of hourly costs, as expected by SharedHourlyCosts. If shareCost is
+// not provided, the given configured monthly costs are used instead, which
+// return a SharedCostConfigError if invalid. Setting shareCost to "0" or
+// "none" shares no cost.
+func ParseSharedHourlyCosts(qp util.QueryParams, defaultMonthlyCosts map[string]string) (map[string]float64, error) {
+	sharedHourlyCosts := map[string]float64{}
+
+	shareCost := strings.TrimSpace(qp.Get("shareCost", ""))
+	if shareCost == shareNone {
+		return sharedHourlyCosts, nil
+	}
+
+	if shareCost != "" {
+		cost, err := strconv.ParseFloat(shareCost, 64)
+		if err != nil || cost < 0.0 {
+			return nil, fmt.Errorf("invalid 'shareCost' value '%s': expected a non-negative number", shareCost)
+		}
+		if cost > 0.0 {
+			sharedHourlyCosts[sharedCostName] = cost / util.HoursPerMonth
+		}
+		return sharedHourlyCosts, nil
+	}
+
+	for name, val := range defaultMonthlyCosts {
+		cost, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return nil, &SharedCostConfigError{name: name, value: val, err: err}
+		}
+		if cost > 0.0 {
+			sharedHourlyCosts[name] = cost / util.HoursPerMonth
+		}
+	}
+
+	return sharedHourlyCosts, nil
+}
+
+// newShareNamespaceFunc returns an AllocationMatchFunc which passes any
+// Allocation in the given namespace.
+func newShareNamespaceFunc(namespace string) kubecost.AllocationMatchFunc {
+	return func(a *kubecost.Allocation) bool {
+		return a != nil && a.Properties != nil && a.Properties.Namespace == namespace
+	}
+}
+
+// newShareLabelFunc returns an AllocationMatchFunc which passes any
+// Allocation with the given label name and value.
+func newShareLabelFunc(name, value string) kubecost.AllocationMatchFunc {
+	return func(a *kubecost.Allocation) bool {
+		if a == nil || a.Properties == nil || a.Properties.Labels == nil {
+			return false
+		}
+		v, ok := a.Properties.Labels[name]
+		return ok && v == value
+	}
+}
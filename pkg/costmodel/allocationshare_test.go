@@ -0,0 +1,170 @@
+package costmodel
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+func TestParseAllocationShareFuncs(t *testing.T) {
+	newAlloc := func(namespace string, labels map[string]string) *kubecost.Allocation {
+		return &kubecost.Allocation{
+			Name: namespace,
+			Properties: &kubecost.AllocationProperties{
+				Namespace: namespace,
+				Labels:    labels,
+			},
+		}
+	}
+
+	kubecostAlloc := newAlloc("kubecost", map[string]string{"app": "cost-analyzer"})
+	kubeSystemAlloc := newAlloc("kube-system", map[string]string{"k8s_app": "kube-proxy"})
+	webAlloc := newAlloc("web", map[string]string{"app": "web", "env": "staging"})
+	allocs := []*kubecost.Allocation{kubecostAlloc, kubeSystemAlloc, webAlloc}
+
+	cases := map[string]struct {
+		query    string
+		expected []*kubecost.Allocation
+		err      bool
+	}{
+		"defaults": {
+			query:    "",
+			expected: []*kubecost.Allocation{kubeSystemAlloc, webAlloc},
+		},
+		"namespaces override default": {
+			query:    "shareNamespaces=kubecost",
+			expected: []*kubecost.Allocation{kubecostAlloc, webAlloc},
+		},
+		"labels override default": {
+			query:    "shareLabels=app:cost-analyzer",
+			expected: []*kubecost.Allocation{kubeSystemAlloc, kubecostAlloc},
+		},
+		"label name is sanitized": {
+			query:    "shareNamespaces=none&shareLabels=k8s-app:kube-proxy",
+			expected: []*kubecost.Allocation{kubeSystemAlloc},
+		},
+		"none": {
+			query:    "shareNamespaces=none&shareLabels=none",
+			expected: []*kubecost.Allocation{},
+		},
+		"invalid label": {
+			query: "shareLabels=app",
+			err:   true,
+		},
+	}
+
+	for name, c := range cases {
+		values, err := url.ParseQuery(c.query)
+		if err != nil {
+			t.Fatalf("%s: failed to parse query: %s", name, err)
+		}
+
+		shareFuncs, err := ParseAllocationShareFuncs(util.NewQueryParams(values), []string{"kube-system"}, []string{"env"}, []string{"staging"})
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: expected error; got nil", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+			continue
+		}
+
+		shared := map[*kubecost.Allocation]bool{}
+		for _, alloc := range allocs {
+			for _, sf := range shareFuncs {
+				if sf(alloc) {
+					shared[alloc] = true
+					break
+				}
+			}
+		}
+
+		if len(shared) != len(c.expected) {
+			t.Errorf("%s: expected %d shared allocations; got %d", name, len(c.expected), len(shared))
+			continue
+		}
+		for _, alloc := range c.expected {
+			if !shared[alloc] {
+				t.Errorf("%s: expected %s to be shared", name, alloc.Name)
+			}
+		}
+	}
+}
+
+func TestParseSharedHourlyCosts(t *testing.T) {
+	defaults := map[string]string{"overhead": "730", "support": "0"}
+
+	cases := map[string]struct {
+		query    string
+		expected map[string]float64
+		err      bool
+	}{
+		"defaults": {
+			query:    "",
+			expected: map[string]float64{"overhead": 1.0},
+		},
+		"override": {
+			query:    "shareCost=1460",
+			expected: map[string]float64{sharedCostName: 2.0},
+		},
+		"zero": {
+			query:    "shareCost=0",
+			expected: map[string]float64{},
+		},
+		"none": {
+			query:    "shareCost=none",
+			expected: map[string]float64{},
+		},
+		"invalid": {
+			query: "shareCost=abc",
+			err:   true,
+		},
+		"negative": {
+			query: "shareCost=-1",
+			err:   true,
+		},
+	}
+
+	for name, c := range cases {
+		values, err := url.ParseQuery(c.query)
+		if err != nil {
+			t.Fatalf("%s: failed to parse query: %s", name, err)
+		}
+
+		actual, err := ParseSharedHourlyCosts(util.NewQueryParams(values), defaults)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: expected error; got nil", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+			continue
+		}
+
+		if len(actual) != len(c.expected) {
+			t.Errorf("%s: expected %v; got %v", name, c.expected, actual)
+			continue
+		}
+		for k, v := range c.expected {
+			if actual[k] != v {
+				t.Errorf("%s: expected %s=%f; got %f", name, k, v, actual[k])
+			}
+		}
+	}
+
+	// Invalid configured costs are errors of the config, not of the query
+	_, err := ParseSharedHourlyCosts(util.NewQueryParams(url.Values{}), map[string]string{"overhead": "abc"})
+	if _, ok := err.(*SharedCostConfigError); !ok {
+		t.Errorf("invalid config: expected SharedCostConfigError; got %v", err)
+	}
+	_, err = ParseSharedHourlyCosts(util.NewQueryParams(url.Values{"shareCost": []string{"abc"}}), defaults)
+	if _, ok := err.(*SharedCostConfigError); ok || err == nil {
+		t.Errorf("invalid query: expected query error; got %v", err)
+	}
+}
@@ -0,0 +1,453 @@
+package costmodel
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/errors"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Methods by which a baseline of daily spend is summarized
+const (
+	AnomalyMethodMAD    = "mad"
+	AnomalyMethodStdDev = "stddev"
+)
+
+// Properties by which daily spend is summed for anomaly detection
+const (
+	AnomalyAggregationNamespace  = "namespace"
+	AnomalyAggregationController = "controller"
+)
+
+// madScale scales the median absolute deviation to be a consistent estimator
+// of the standard deviation of normally distributed data, so that thresholds
+// have the same meaning for both methods.
+const madScale = 1.4826
+
+// minDispersionRatio is the minimum dispersion of a baseline, as a ratio of
+// its center, which keeps perfectly flat baselines from flagging trivial
+// changes as anomalous.
+const minDispersionRatio = 0.05
+
+// Anomaly is a day on which the spend of a namespace or controller deviated
+// significantly above its baseline; i.e. the spend of the preceding days.
+type Anomaly struct {
+	Aggregation   string    `json:"aggregation"`
+	Name          string    `json:"name"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	Cost          float64   `json:"cost"`
+	Baseline      float64   `json:"baseline"`
+	Deviation     float64   `json:"deviation"`
+	Score         float64   `json:"score"`
+	PercentChange float64   `json:"percentChange"`
+}
+
+// AnomalyDetectorConfig configures an AnomalyDetector.
+type AnomalyDetectorConfig struct {
+	// BaselineDays is the number of days preceding each day against which
+	// that day's spend is compared
+	BaselineDays int
+
+	// LookbackDays is the number of most recent complete days in which
+	// anomalies are detected
+	LookbackDays int
+
+	// Method is AnomalyMethodMAD or AnomalyMethodStdDev
+	Method string
+
+	// Threshold is the score above which a day's spend is anomalous
+	Threshold float64
+
+	// MinCost is the minimum increase of a day's spend over its baseline
+	// for the day to be anomalous
+	MinCost float64
+
+	// RefreshRate is the interval at which anomalies are detected
+	RefreshRate time.Duration
+
+	// UTCOffset defines the time zone in which days begin
+	UTCOffset time.Duration
+}
+
+// anomalyKey identifies a namespace or controller whose spend is tracked.
+type anomalyKey struct {
+	aggregation string
+	name        string
+}
+
+// AnomalyDetector periodically sums the daily spend of each namespace and
+// controller, and compares each recent day's spend against a trailing
+// baseline, flagging statistically significant spikes.
+type AnomalyDetector struct {
+	lock      sync.RWMutex
+	compute   func(start, end time.Time) (*kubecost.AllocationSet, error)
+	config    AnomalyDetectorConfig
+	loc       *time.Location
+	days      map[int64]map[anomalyKey]float64
+	anomalies []*Anomaly
+	lastRun   time.Time
+	gauge     *prometheus.GaugeVec
+	stop      chan struct{}
+}
+
+// NewAnomalyDetector creates an AnomalyDetector, which computes daily
+// allocations with the given function and, if a gauge is given, sets it to
+// the score of each anomaly of the most recent complete day, labeled by
+// aggregation and name.
+func NewAnomalyDetector(compute func(start, end time.Time) (*kubecost.AllocationSet, error), config AnomalyDetectorConfig, gauge *prometheus.GaugeVec) (*AnomalyDetector, error) {
+	if compute == nil {
+		return nil, fmt.Errorf("AnomalyDetector: compute is nil")
+	}
+	if config.BaselineDays < 2 {
+		return nil, fmt.Errorf("AnomalyDetector: baseline must be at least 2 days; got %d", config.BaselineDays)
+	}
+	if config.LookbackDays < 1 {
+		return nil, fmt.Errorf("AnomalyDetector: lookback must be at least 1 day; got %d", config.LookbackDays)
+	}
+	if config.Method != AnomalyMethodMAD && config.Method != AnomalyMethodStdDev {
+		return nil, fmt.Errorf("AnomalyDetector: unsupported method: %s", config.Method)
+	}
+	if config.Threshold <= 0 {
+		return nil, fmt.Errorf("AnomalyDetector: illegal threshold: %f", config.Threshold)
+	}
+
+	return &AnomalyDetector{
+		compute:   compute,
+		config:    config,
+		loc:       time.FixedZone("", int(config.UTCOffset.Seconds())),
+		days:      map[int64]map[anomalyKey]float64{},
+		anomalies: []*Anomaly{},
+		gauge:     gauge,
+	}, nil
+}
+
+// Start detects anomalies at the configured refresh rate, in the
+// background, until Stop is called.
+func (ad *AnomalyDetector) Start() {
+	ad.stop = make(chan struct{})
+
+	go func(stop chan struct{}) {
+		defer errors.HandlePanic()
+
+		for {
+			ad.Run(time.Now())
+
+			select {
+			case <-stop:
+				return
+			case <-time.After(ad.config.RefreshRate):
+			}
+		}
+	}(ad.stop)
+}
+
+// Stop stops the background detection started by Start.
+func (ad *AnomalyDetector) Stop() {
+	if ad.stop != nil {
+		close(ad.stop)
+		ad.stop = nil
+	}
+}
+
+// Run detects anomalies in each of the configured number of complete days
+// preceding the given time. The daily spend of every day but the most
+// recent is cached, as it is no longer expected to change.
+func (ad *AnomalyDetector) Run(now time.Time) {
+	now = now.In(ad.loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, ad.loc)
+	first := today.AddDate(0, 0, -(ad.config.LookbackDays + ad.config.BaselineDays))
+	latest := today.AddDate(0, 0, -1)
+
+	ad.lock.RLock()
+	cached := map[int64]map[anomalyKey]float64{}
+	for key, costs := range ad.days {
+		cached[key] = costs
+	}
+	ad.lock.RUnlock()
+
+	days := map[int64]map[anomalyKey]float64{}
+	for day := first; day.Before(today); day = day.AddDate(0, 0, 1) {
+		if costs, ok := cached[day.Unix()]; ok && day.Before(latest) {
+			days[day.Unix()] = costs
+			continue
+		}
+
+		costs, err := ad.dailyCosts(day, day.AddDate(0, 0, 1))
+		if err != nil {
+			log.Warningf("AnomalyDetector: error computing allocation for %s: %s", day.Format("2006-01-02"), err)
+			continue
+		}
+		days[day.Unix()] = costs
+	}
+
+	anomalies := []*Anomaly{}
+	for day := latest.AddDate(0, 0, -(ad.config.LookbackDays - 1)); !day.After(latest); day = day.AddDate(0, 0, 1) {
+		anomalies = append(anomalies, ad.detect(day, days)...)
+	}
+
+	sort.Slice(anomalies, func(i, j int) bool {
+		if !anomalies[i].Start.Equal(anomalies[j].Start) {
+			return anomalies[i].Start.After(anomalies[j].Start)
+		}
+		return anomalies[i].Score > anomalies[j].Score
+	})
+
+	if ad.gauge != nil {
+		ad.gauge.Reset()
+		for _, anomaly := range anomalies {
+			if anomaly.Start.Equal(latest) {
+				ad.gauge.WithLabelValues(anomaly.Aggregation, anomaly.Name).Set(anomaly.Score)
+			}
+		}
+	}
+
+	ad.lock.Lock()
+	ad.days = days
+	ad.anomalies = anomalies
+	ad.lastRun = now
+	ad.lock.Unlock()
+}
+
+// dailyCosts returns the total cost of each namespace and controller over
+// the given day. Idle and unallocated costs are excluded.
+func (ad *AnomalyDetector) dailyCosts(start, end time.Time) (map[anomalyKey]float64, error) {
+	as, err := ad.compute(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	costs := map[anomalyKey]float64{}
+	as.Each(func(name string, alloc *kubecost.Allocation) {
+		if alloc.IsIdle() || alloc.IsUnallocated() || alloc.Properties == nil {
+			return
+		}
+		props := alloc.Properties
+
+		if props.Namespace != "" {
+			costs[anomalyKey{AnomalyAggregationNamespace, props.Namespace}] += alloc.TotalCost()
+		}
+
+		if props.Namespace != "" && props.Controller != "" {
+			controller := props.Controller
+			if props.ControllerKind != "" {
+				controller = fmt.Sprintf("%s:%s", props.ControllerKind, props.Controller)
+			}
+			costs[anomalyKey{AnomalyAggregationController, fmt.Sprintf("%s/%s", props.Namespace, controller)}] += alloc.TotalCost()
+		}
+	})
+
+	return costs, nil
+}
+
+// detect returns the anomalies of the given day, given the daily costs of
+// the day and its baseline. Namespaces and controllers which did not incur
+// cost on at least half of the baseline days are considered too new to have
+// a baseline, and are skipped, as is any day missing half of its baseline.
+func (ad *AnomalyDetector) detect(day time.Time, days map[int64]map[anomalyKey]float64) []*Anomaly {
+	anomalies := []*Anomaly{}
+
+	costs, ok := days[day.Unix()]
+	if !ok {
+		return anomalies
+	}
+
+	baselineDays := []map[anomalyKey]float64{}
+	for i := 1; i <= ad.config.BaselineDays; i++ {
+		if c, ok := days[day.AddDate(0, 0, -i).Unix()]; ok {
+			baselineDays = append(baselineDays, c)
+		}
+	}
+	minDays := (ad.config.BaselineDays + 1) / 2
+	if len(baselineDays) < minDays {
+		return anomalies
+	}
+
+	for key, cost := range costs {
+		baseline := make([]float64, 0, len(baselineDays))
+		present := 0
+		for _, c := range baselineDays {
+			if c[key] > 0 {
+				present++
+			}
+			baseline = append(baseline, c[key])
+		}
+		if present < minDays {
+			continue
+		}
+
+		score, center, dispersion := anomalyScore(cost, baseline, ad.config.Method)
+		if score < ad.config.Threshold || cost-center < ad.config.MinCost {
+			continue
+		}
+
+		percentChange := 0.0
+		if center > 0 {
+			percentChange = 100.0 * (cost - center) / center
+		}
+
+		anomalies = append(anomalies, &Anomaly{
+			Aggregation:   key.aggregation,
+			Name:          key.name,
+			Start:         day,
+			End:           day.AddDate(0, 0, 1),
+			Cost:          cost,
+			Baseline:      center,
+			Deviation:     dispersion,
+			Score:         score,
+			PercentChange: percentChange,
+		})
+	}
+
+	return anomalies
+}
+
+// Anomalies returns the anomalies found by the most recent run, ordered from
+// most to least recent, then by descending score, and the time of that run.
+// If aggregation is not empty, only anomalies of that aggregation are
+// returned.
+func (ad *AnomalyDetector) Anomalies(aggregation string) ([]*Anomaly, time.Time) {
+	ad.lock.RLock()
+	defer ad.lock.RUnlock()
+
+	anomalies := []*Anomaly{}
+	for _, anomaly := range ad.anomalies {
+		if aggregation == "" || anomaly.Aggregation == aggregation {
+			anomalies = append(anomalies, anomaly)
+		}
+	}
+
+	return anomalies, ad.lastRun
+}
+
+// anomalyScore returns the number of deviations by which the given value
+// exceeds the center of the given baseline, along with the center and
+// deviation, summarized by the given method: the median and scaled median
+// absolute deviation, or the mean and standard deviation. The deviation is
+// at least minDispersionRatio of the center.
+func anomalyScore(value float64, baseline []float64, method string) (float64, float64, float64) {
+	if len(baseline) == 0 {
+		return 0.0, 0.0, 0.0
+	}
+
+	var center, dispersion float64
+	switch method {
+	case AnomalyMethodStdDev:
+		for _, v := range baseline {
+			center += v
+		}
+		center /= float64(len(baseline))
+
+		for _, v := range baseline {
+			dispersion += (v - center) * (v - center)
+		}
+		dispersion = math.Sqrt(dispersion / float64(len(baseline)))
+	default:
+		center = median(baseline)
+
+		deviations := make([]float64, len(baseline))
+		for i, v := range baseline {
+			deviations[i] = math.Abs(v - center)
+		}
+		dispersion = madScale * median(deviations)
+	}
+
+	dispersion = math.Max(dispersion, minDispersionRatio*math.Abs(center))
+	if dispersion == 0 {
+		return 0.0, center, dispersion
+	}
+
+	return (value - center) / dispersion, center, dispersion
+}
+
+// median returns the median of the given values, without modifying them.
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0.0
+	}
+
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2.0
+	}
+	return sorted[mid]
+}
+
+// newAnomalyDetector creates and starts an AnomalyDetector, configured by
+// the environment, which computes daily allocations the same way as
+// /allocation/compute, and registers its gauge. If the detector cannot be
+// created, it returns nil.
+func newAnomalyDetector(a *Accesses) *AnomalyDetector {
+	compute := func(start, end time.Time) (*kubecost.AllocationSet, error) {
+		return a.computeAllocation(start, end, env.GetETLResolution())
+	}
+
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kubecost_allocation_anomaly_score",
+		Help: "kubecost_allocation_anomaly_score Deviations above baseline of the most recent day's spend of each anomalous namespace or controller",
+	}, []string{"aggregation", "name"})
+
+	detector, err := NewAnomalyDetector(compute, AnomalyDetectorConfig{
+		BaselineDays: env.GetAnomalyBaselineDays(),
+		LookbackDays: env.GetAnomalyLookbackDays(),
+		Method:       strings.ToLower(env.GetAnomalyMethod()),
+		Threshold:    env.GetAnomalyThreshold(),
+		MinCost:      env.GetAnomalyMinCost(),
+		RefreshRate:  env.GetAnomalyRefreshRate(),
+		UTCOffset:    env.GetParsedUTCOffset(),
+	}, gauge)
+	if err != nil {
+		log.Errorf("Init: failed to create anomaly detector: %s", err)
+		return nil
+	}
+
+	err = prometheus.Register(gauge)
+	if err != nil {
+		log.Warningf("Init: failed to register anomaly gauge: %s", err)
+	}
+
+	detector.Start()
+
+	return detector
+}
+
+// AnomaliesHandler returns the spend anomalies found by the most recent run
+// of the AnomalyDetector, optionally restricted to an aggregation of
+// "namespace" or "controller".
+func (a *Accesses) AnomaliesHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if a.AnomalyDetector == nil {
+		w.Write(WrapData(nil, fmt.Errorf("anomaly detection is not enabled")))
+		return
+	}
+
+	qp := util.NewQueryParams(r.URL.Query())
+
+	aggregation := qp.Get("aggregate", "")
+	if aggregation != "" && aggregation != AnomalyAggregationNamespace && aggregation != AnomalyAggregationController {
+		http.Error(w, fmt.Sprintf("Invalid 'aggregate' parameter: %s", aggregation), http.StatusBadRequest)
+		return
+	}
+
+	anomalies, lastRun := a.AnomalyDetector.Anomalies(aggregation)
+
+	w.Write(WrapData(map[string]interface{}{
+		"anomalies": anomalies,
+		"lastRun":   lastRun,
+	}, nil))
+}
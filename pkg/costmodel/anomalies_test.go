@@ -0,0 +1,187 @@
+package costmodel
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/kubecost"
+)
+
+func TestAnomalyScore(t *testing.T) {
+	baseline := []float64{10.0, 12.0, 11.0, 9.0, 10.0, 30.0, 10.0}
+
+	// median 10, MAD 1; the outlier in the baseline does not inflate it
+	score, center, dispersion := anomalyScore(20.0, baseline, AnomalyMethodMAD)
+	if center != 10.0 || math.Abs(dispersion-madScale) > 1e-9 {
+		t.Fatalf("mad: expected center 10 and dispersion %f; got %f and %f", madScale, center, dispersion)
+	}
+	if math.Abs(score-10.0/madScale) > 1e-9 {
+		t.Fatalf("mad: expected score %f; got %f", 10.0/madScale, score)
+	}
+
+	score, center, dispersion = anomalyScore(20.0, []float64{8.0, 12.0}, AnomalyMethodStdDev)
+	if center != 10.0 || dispersion != 2.0 || score != 5.0 {
+		t.Fatalf("stddev: expected score 5, center 10 and dispersion 2; got %f, %f and %f", score, center, dispersion)
+	}
+
+	// A flat baseline uses the minimum dispersion
+	score, _, dispersion = anomalyScore(11.0, []float64{10.0, 10.0, 10.0}, AnomalyMethodMAD)
+	if dispersion != 0.5 || score != 2.0 {
+		t.Fatalf("flat: expected score 2 and dispersion 0.5; got %f and %f", score, dispersion)
+	}
+
+	score, _, _ = anomalyScore(11.0, []float64{0.0, 0.0}, AnomalyMethodMAD)
+	if score != 0.0 {
+		t.Fatalf("zero: expected score 0; got %f", score)
+	}
+}
+
+// mockDailyCosts returns a compute function which returns, for each day, an
+// allocation for each of the given "namespace/controller" pairs costing the
+// amount returned by the given function, and records the days computed.
+func mockDailyCosts(cost func(controller string, day time.Time) float64, computed *[]time.Time, controllers ...string) func(start, end time.Time) (*kubecost.AllocationSet, error) {
+	return func(start, end time.Time) (*kubecost.AllocationSet, error) {
+		*computed = append(*computed, start)
+
+		as := kubecost.NewAllocationSet(start, end)
+		for _, pair := range controllers {
+			namespace, controller := path.Split(pair)
+			namespace = strings.TrimSuffix(namespace, "/")
+
+			c := cost(controller, start)
+			if c <= 0 {
+				continue
+			}
+			as.Set(&kubecost.Allocation{
+				Name:  fmt.Sprintf("cluster1/node1/%s/%s/%s", namespace, controller, controller),
+				Start: start,
+				End:   end,
+				Properties: &kubecost.AllocationProperties{
+					Cluster:        "cluster1",
+					Namespace:      namespace,
+					ControllerKind: "deployment",
+					Controller:     controller,
+				},
+				CPUCost: c,
+			})
+		}
+		as.Set(&kubecost.Allocation{
+			Name:       kubecost.IdleSuffix,
+			Start:      start,
+			End:        end,
+			Properties: &kubecost.AllocationProperties{Cluster: "cluster1"},
+			CPUCost:    1000.0 * float64(start.Day()%2),
+		})
+
+		return as, nil
+	}
+}
+
+func TestAnomalyDetector_Run(t *testing.T) {
+	now := time.Date(2021, time.March, 20, 6, 0, 0, 0, time.UTC)
+	spike := time.Date(2021, time.March, 19, 0, 0, 0, 0, time.UTC)
+	launch := time.Date(2021, time.March, 18, 0, 0, 0, 0, time.UTC)
+
+	cost := func(controller string, day time.Time) float64 {
+		switch controller {
+		case "api":
+			// Varies day-to-day, then spikes on the most recent day
+			if day.Equal(spike) {
+				return 100.0
+			}
+			return 20.0 + float64(day.Day()%3)
+		case "worker":
+			// Steady, with a small increase on the most recent day
+			if day.Equal(spike) {
+				return 52.0
+			}
+			return 50.0
+		case "batch":
+			// Launched recently, so has no baseline
+			if day.Before(launch) {
+				return 0.0
+			}
+			return 500.0
+		}
+		return 0.0
+	}
+
+	computed := []time.Time{}
+	ad, err := NewAnomalyDetector(mockDailyCosts(cost, &computed, "web/api", "web/worker", "batch/batch"), AnomalyDetectorConfig{
+		BaselineDays: 7,
+		LookbackDays: 3,
+		Method:       AnomalyMethodMAD,
+		Threshold:    3.5,
+		MinCost:      1.0,
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ad.Run(now)
+	if len(computed) != 10 {
+		t.Fatalf("expected 10 days to be computed; got %d", len(computed))
+	}
+
+	anomalies, lastRun := ad.Anomalies("")
+	if !lastRun.Equal(now) {
+		t.Fatalf("expected last run %s; got %s", now, lastRun)
+	}
+	if len(anomalies) != 2 {
+		t.Fatalf("expected 2 anomalies; got %d", len(anomalies))
+	}
+
+	// The namespace and controller spike by the same amount, but the
+	// namespace's baseline also includes "worker", so its score is lower
+	controller, namespace := anomalies[0], anomalies[1]
+	if controller.Aggregation != AnomalyAggregationController || controller.Name != "web/deployment:api" {
+		t.Fatalf("unexpected anomaly: %+v", controller)
+	}
+	if !controller.Start.Equal(spike) || controller.Cost != 100.0 || controller.Baseline != 21.0 {
+		t.Fatalf("unexpected anomaly: %+v", controller)
+	}
+	if namespace.Aggregation != AnomalyAggregationNamespace || namespace.Name != "web" || namespace.Score >= controller.Score {
+		t.Fatalf("unexpected anomaly: %+v", namespace)
+	}
+
+	anomalies, _ = ad.Anomalies(AnomalyAggregationNamespace)
+	if len(anomalies) != 1 || anomalies[0].Name != "web" {
+		t.Fatalf("expected only the namespace anomaly; got %+v", anomalies)
+	}
+
+	// Running again recomputes only the most recent day
+	computed = computed[:0]
+	ad.Run(now.Add(time.Hour))
+	if len(computed) != 1 || !computed[0].Equal(spike) {
+		t.Fatalf("expected only %s to be recomputed; got %v", spike, computed)
+	}
+}
+
+func TestNewAnomalyDetector(t *testing.T) {
+	compute := func(start, end time.Time) (*kubecost.AllocationSet, error) {
+		return kubecost.NewAllocationSet(start, end), nil
+	}
+	valid := AnomalyDetectorConfig{BaselineDays: 14, LookbackDays: 7, Method: AnomalyMethodMAD, Threshold: 3.5}
+
+	if _, err := NewAnomalyDetector(compute, valid, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := map[string]func(c *AnomalyDetectorConfig){
+		"baseline":  func(c *AnomalyDetectorConfig) { c.BaselineDays = 1 },
+		"lookback":  func(c *AnomalyDetectorConfig) { c.LookbackDays = 0 },
+		"method":    func(c *AnomalyDetectorConfig) { c.Method = "zscore" },
+		"threshold": func(c *AnomalyDetectorConfig) { c.Threshold = 0 },
+	}
+	for name, modify := range cases {
+		config := valid
+		modify(&config)
+		if _, err := NewAnomalyDetector(compute, config, nil); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package costmodel
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/log"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// ComputeAssets uses the CostModel instance to compute an AssetSet for the
+// window defined by the given start and end times. The AssetSet is built from
+// the Nodes, Disks, and LoadBalancers returned by ClusterNodes, ClusterDisks,
+// and ClusterLoadBalancers, respectively, and is not aggregated.
+func (cm *CostModel) ComputeAssets(start, end time.Time) (*kubecost.AssetSet, error) {
+	window := kubecost.NewWindow(&start, &end)
+
+	// Create an empty AssetSet. For safety, in the case of an error, we
+	// should prefer to return this empty set with the error. (In the case of
+	// no error, of course we populate the set and return it.)
+	assetSet := kubecost.NewAssetSet(start, end)
+
+	duration, offset, err := window.DurationOffset()
+	if err != nil {
+		// Negative or open window, so return empty set
+		return assetSet, nil
+	}
+
+	// Negative offset means that the end time is in the future. Prometheus
+	// fails for non-positive offset values, so shrink the duration and
+	// remove the offset altogether.
+	if offset < 0 {
+		duration = duration + offset
+		offset = 0
+	}
+	if duration <= 0 {
+		return assetSet, nil
+	}
+
+	nodeMap, err := ClusterNodes(cm.Provider, cm.PrometheusClient, duration, offset)
+	if err != nil {
+		return assetSet, fmt.Errorf("error computing nodes: %s", err)
+	}
+
+	diskMap, err := ClusterDisks(cm.PrometheusClient, cm.Provider, duration, offset)
+	if err != nil {
+		return assetSet, fmt.Errorf("error computing disks: %s", err)
+	}
+
+	lbMap, err := ClusterLoadBalancers(cm.Provider, cm.PrometheusClient, duration, offset)
+	if err != nil {
+		return assetSet, fmt.Errorf("error computing load balancers: %s", err)
+	}
+
+	for _, node := range nodeMap {
+		err = assetSet.Insert(nodeToAsset(node, cm.providerFor(node.Cluster), window))
+		if err != nil {
+			log.Warningf("ComputeAssets: failed to insert node %s: %s", node.Name, err)
+		}
+	}
+
+	for _, disk := range diskMap {
+		err = assetSet.Insert(diskToAsset(disk, cm.providerFor(disk.Cluster), window))
+		if err != nil {
+			log.Warningf("ComputeAssets: failed to insert disk %s: %s", disk.Name, err)
+		}
+	}
+
+	for _, lb := range lbMap {
+		err = assetSet.Insert(loadBalancerToAsset(lb, cm.providerFor(lb.Cluster), window))
+		if err != nil {
+			log.Warningf("ComputeAssets: failed to insert load balancer %s: %s", lb.Name, err)
+		}
+	}
+
+	// Adjust the costs of assets to those billed by the cloud provider, if
+	// billing reconciliation is enabled
+	if cm.Reconciler != nil {
+		cm.Reconciler.ReconcileAssets(assetSet)
+	}
+
+	return assetSet, nil
+}
+
+// computeAssets returns the AssetSet of the given window computed by the
+// CostModel, caching it so that queries of the same window, e.g. to compute
+// idle or reconciled allocations, do not query Prometheus again. The returned
+// set is a copy, which may be modified.
+func (a *Accesses) computeAssets(start, end time.Time) (*kubecost.AssetSet, error) {
+	key := fmt.Sprintf("%d:%d", start.Unix(), end.Unix())
+	if a.AssetsCache != nil {
+		if value, found := a.AssetsCache.Get(key); found {
+			if as, ok := value.(*kubecost.AssetSet); ok {
+				return as.Clone(), nil
+			}
+			log.Errorf("caching error: failed to type cast data: %s", key)
+		}
+	}
+
+	as, err := a.Model.ComputeAssets(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.AssetsCache != nil {
+		a.AssetsCache.Set(key, as.Clone(), cache.DefaultExpiration)
+	}
+
+	return as, nil
+}
+
+// providerFor returns the kubecost provider (e.g. "AWS", "GCP") of the given
+// cluster, falling back to the provider of the local cluster if the cluster
+// is not found in the ClusterMap.
+func (cm *CostModel) providerFor(cluster string) string {
+	if cm.ClusterMap != nil {
+		if info := cm.ClusterMap.InfoFor(cluster); info != nil && info.Provider != "" {
+			return kubecost.ParseProvider(info.Provider)
+		}
+	}
+
+	if cm.Provider != nil {
+		if info, err := cm.Provider.ClusterInfo(); err == nil {
+			return kubecost.ParseProvider(info["provider"])
+		}
+	}
+
+	return kubecost.NilProvider
+}
+
+// nodeToAsset converts a Node, as computed by ClusterNodes, into a
+// kubecost.Node Asset for the given window.
+func nodeToAsset(n *Node, provider string, window kubecost.Window) *kubecost.Node {
+	hours := n.Minutes / 60.0
+
+	node := kubecost.NewNode(n.Name, n.Cluster, n.ProviderID, n.Start, n.End, window)
+	node.Properties().Provider = provider
+	node.NodeType = n.NodeType
+	node.CPUCoreHours = n.CPUCores * hours
+	node.RAMByteHours = n.RAMBytes * hours
+	node.GPUCount = n.GPUCount
+	node.CPUCost = n.CPUCost
+	node.GPUCost = n.GPUCost
+	node.RAMCost = n.RAMCost
+	node.Discount = n.Discount
+	if n.Preemptible {
+		node.Preemptible = 1.0
+	}
+	if n.CPUBreakdown != nil {
+		node.CPUBreakdown = clusterCostsBreakdownToBreakdown(n.CPUBreakdown)
+	}
+	if n.RAMBreakdown != nil {
+		node.RAMBreakdown = clusterCostsBreakdownToBreakdown(n.RAMBreakdown)
+	}
+	if n.Labels != nil {
+		node.SetLabels(kubecost.AssetLabels(n.Labels).Clone())
+	}
+
+	return node
+}
+
+// diskToAsset converts a Disk, as computed by ClusterDisks, into a
+// kubecost.Disk Asset for the given window.
+func diskToAsset(d *Disk, provider string, window kubecost.Window) *kubecost.Disk {
+	disk := kubecost.NewDisk(d.Name, d.Cluster, d.ProviderID, d.Start, d.End, window)
+	disk.Properties().Provider = provider
+	disk.Cost = d.Cost
+	disk.ByteHours = d.Bytes * (d.Minutes / 60.0)
+	if d.Local {
+		disk.Local = 1.0
+	}
+	if d.Breakdown != nil {
+		disk.Breakdown = clusterCostsBreakdownToBreakdown(d.Breakdown)
+	}
+
+	return disk
+}
+
+// loadBalancerToAsset converts a LoadBalancer, as computed by
+// ClusterLoadBalancers, into a kubecost.LoadBalancer Asset for the given
+// window.
+func loadBalancerToAsset(lb *LoadBalancer, provider string, window kubecost.Window) *kubecost.LoadBalancer {
+	// If active minutes could not be determined, assume the load balancer
+	// ran for the entire window.
+	start, end := *window.Start(), *window.End()
+	if !lb.Start.IsZero() {
+		start = lb.Start
+		end = lb.Start.Add(time.Duration(lb.Minutes) * time.Minute)
+	}
+
+	loadBalancer := kubecost.NewLoadBalancer(lb.Name, lb.Cluster, lb.ProviderID, start, end, window)
+	loadBalancer.Properties().Provider = provider
+	loadBalancer.Cost = lb.Cost
+
+	return loadBalancer
+}
+
+func clusterCostsBreakdownToBreakdown(ccb *ClusterCostsBreakdown) *kubecost.Breakdown {
+	return &kubecost.Breakdown{
+		Idle:   ccb.Idle,
+		Other:  ccb.Other,
+		System: ccb.System,
+		User:   ccb.User,
+	}
+}
@@ -0,0 +1,130 @@
+package costmodel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/kubecost"
+)
+
+func TestNodeToAsset(t *testing.T) {
+	start := time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	window := kubecost.NewWindow(&start, &end)
+
+	n := &Node{
+		Cluster:      "cluster1",
+		Name:         "node1",
+		ProviderID:   "i-123",
+		NodeType:     "m5.large",
+		CPUCost:      10.0,
+		CPUCores:     2.0,
+		GPUCost:      0.0,
+		RAMCost:      5.0,
+		RAMBytes:     8.0 * 1024 * 1024 * 1024,
+		Discount:     0.1,
+		Preemptible:  true,
+		CPUBreakdown: &ClusterCostsBreakdown{Idle: 0.5, User: 0.5},
+		RAMBreakdown: &ClusterCostsBreakdown{Idle: 0.25, System: 0.75},
+		Start:        start,
+		End:          start.Add(12 * time.Hour),
+		Minutes:      12 * 60,
+		Labels:       map[string]string{"label_app": "web"},
+	}
+
+	node := nodeToAsset(n, kubecost.AWSProvider, window)
+
+	if node.Properties().Provider != kubecost.AWSProvider {
+		t.Errorf("expected provider %s; got %s", kubecost.AWSProvider, node.Properties().Provider)
+	}
+	if node.Properties().Cluster != "cluster1" || node.Properties().Name != "node1" || node.Properties().ProviderID != "i-123" {
+		t.Errorf("unexpected properties: %s", node.Properties())
+	}
+	if node.CPUCoreHours != 24.0 {
+		t.Errorf("expected CPUCoreHours 24.0; got %f", node.CPUCoreHours)
+	}
+	if node.RAMByteHours != 12.0*8.0*1024*1024*1024 {
+		t.Errorf("expected RAMByteHours %f; got %f", 12.0*8.0*1024*1024*1024, node.RAMByteHours)
+	}
+	if !node.IsPreemptible() {
+		t.Errorf("expected node to be preemptible")
+	}
+	if node.CPUBreakdown.Idle != 0.5 || node.RAMBreakdown.System != 0.75 {
+		t.Errorf("unexpected breakdowns: %v, %v", node.CPUBreakdown, node.RAMBreakdown)
+	}
+	if node.Labels()["label_app"] != "web" {
+		t.Errorf("expected label label_app=web; got %v", node.Labels())
+	}
+	if node.TotalCost() != 13.5 {
+		t.Errorf("expected TotalCost 13.5; got %f", node.TotalCost())
+	}
+	if node.Minutes() != 12*60 {
+		t.Errorf("expected Minutes %d; got %f", 12*60, node.Minutes())
+	}
+}
+
+func TestDiskToAsset(t *testing.T) {
+	start := time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	window := kubecost.NewWindow(&start, &end)
+
+	d := &Disk{
+		Cluster:   "cluster1",
+		Name:      "pvc-abc",
+		Cost:      2.0,
+		Bytes:     100.0,
+		Local:     true,
+		Start:     start,
+		End:       end,
+		Minutes:   24 * 60,
+		Breakdown: &ClusterCostsBreakdown{Idle: 1.0},
+	}
+
+	disk := diskToAsset(d, kubecost.GCPProvider, window)
+
+	if disk.Properties().Provider != kubecost.GCPProvider {
+		t.Errorf("expected provider %s; got %s", kubecost.GCPProvider, disk.Properties().Provider)
+	}
+	if disk.ByteHours != 2400.0 {
+		t.Errorf("expected ByteHours 2400.0; got %f", disk.ByteHours)
+	}
+	if disk.Local != 1.0 {
+		t.Errorf("expected Local 1.0; got %f", disk.Local)
+	}
+	if disk.TotalCost() != 2.0 {
+		t.Errorf("expected TotalCost 2.0; got %f", disk.TotalCost())
+	}
+}
+
+func TestLoadBalancerToAsset(t *testing.T) {
+	start := time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	window := kubecost.NewWindow(&start, &end)
+
+	// Active minutes known
+	lb := loadBalancerToAsset(&LoadBalancer{
+		Cluster: "cluster1",
+		Name:    "namespace1/service1",
+		Cost:    3.0,
+		Start:   start.Add(time.Hour),
+		Minutes: 60,
+	}, kubecost.AzureProvider, window)
+
+	if !lb.Start().Equal(start.Add(time.Hour)) || !lb.End().Equal(start.Add(2*time.Hour)) {
+		t.Errorf("unexpected (start, end): (%s, %s)", lb.Start(), lb.End())
+	}
+	if lb.TotalCost() != 3.0 {
+		t.Errorf("expected TotalCost 3.0; got %f", lb.TotalCost())
+	}
+
+	// Active minutes unknown, so default to the window
+	lb = loadBalancerToAsset(&LoadBalancer{
+		Cluster: "cluster1",
+		Name:    "namespace1/service2",
+		Cost:    1.0,
+	}, kubecost.AzureProvider, window)
+
+	if !lb.Start().Equal(start) || !lb.End().Equal(end) {
+		t.Errorf("unexpected (start, end): (%s, %s)", lb.Start(), lb.End())
+	}
+}
@@ -0,0 +1,66 @@
+package costmodel
+
+import (
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/budgets"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/log"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// budgetAllocationComputer computes allocations for budgets the same way as
+// /allocation/compute; i.e. from the ETL when the window is aligned to its
+// steps, and from Prometheus otherwise. The BudgetManager requests completed
+// days separately from the current day so that only the latter goes to
+// Prometheus.
+type budgetAllocationComputer struct {
+	a *Accesses
+}
+
+func (bac *budgetAllocationComputer) ComputeAllocation(start, end time.Time, resolution time.Duration) (*kubecost.AllocationSet, error) {
+	return bac.a.computeAllocation(start, end, resolution)
+}
+
+// newBudgetManager creates and starts a BudgetManager, storing budgets in a
+// boltdb at the configured path. If that fails, then we fall back to a
+// memory-only storage.
+func newBudgetManager(a *Accesses) *budgets.BudgetManager {
+	storage, statusStorage := newBudgetStorages()
+
+	manager := budgets.NewBudgetManager(storage, statusStorage, &budgetAllocationComputer{a: a}, budgets.BudgetManagerConfig{
+		Resolution: env.GetETLResolution(),
+		Interval:   env.GetBudgetsEvaluationInterval(),
+		UTCOffset:  env.GetParsedUTCOffset(),
+	})
+	manager.Start()
+
+	return manager
+}
+
+// newBudgetStorages returns the storages of budgets and their statuses.
+func newBudgetStorages() (budgets.BudgetStorage, budgets.BudgetStorage) {
+	db, err := bolt.Open(env.GetBudgetsDBPath(), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		log.Errorf("Init: failed to open budgets db, budgets will not be persisted: %s", err)
+		return budgets.NewMapDBBudgetStorage(), budgets.NewMapDBBudgetStorage()
+	}
+
+	storage, err := budgets.NewBoltDBBudgetStorage("budgets", db)
+	if err != nil {
+		log.Errorf("Init: failed to create budget storage, budgets will not be persisted: %s", err)
+		db.Close()
+		return budgets.NewMapDBBudgetStorage(), budgets.NewMapDBBudgetStorage()
+	}
+
+	statusStorage, err := budgets.NewBoltDBBudgetStorage("budget-status", db)
+	if err != nil {
+		log.Errorf("Init: failed to create budget status storage, budgets will not be persisted: %s", err)
+		db.Close()
+		return budgets.NewMapDBBudgetStorage(), budgets.NewMapDBBudgetStorage()
+	}
+
+	return storage, statusStorage
+}
@@ -0,0 +1,482 @@
+package costmodel
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/prom"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+const (
+	queryNodeHourlyCostByInstance = `avg(node_total_hourly_cost) by (node, instance_type, region, provider_id, cluster_id)`
+	queryNodeIsSpot               = `avg(kubecost_node_is_spot) by (node, cluster_id)`
+	queryNodeCPUCores             = `avg(kube_node_status_capacity_cpu_cores) by (node, cluster_id)`
+)
+
+// Commitment terms
+const (
+	CommitmentTermOneYear   = "1yr"
+	CommitmentTermThreeYear = "3yr"
+)
+
+// DefaultCommitmentPercentile is the percentile of hourly on-demand spend
+// considered steady-state. A low percentile keeps the recommended commitment
+// fully used through all but the quietest hours.
+const DefaultCommitmentPercentile = 0.1
+
+// Expected discounts off of on-demand prices of commitments without upfront
+// payment, by provider and term, used unless a discount is given explicitly
+var defaultCommitmentDiscounts = map[string]map[string]float64{
+	kubecost.AWSProvider: {
+		CommitmentTermOneYear:   0.28,
+		CommitmentTermThreeYear: 0.46,
+	},
+	kubecost.GCPProvider: {
+		CommitmentTermOneYear:   0.37,
+		CommitmentTermThreeYear: 0.55,
+	},
+	kubecost.AzureProvider: {
+		CommitmentTermOneYear:   0.40,
+		CommitmentTermThreeYear: 0.60,
+	},
+	kubecost.NilProvider: {
+		CommitmentTermOneYear:   0.30,
+		CommitmentTermThreeYear: 0.50,
+	},
+}
+
+// Commitments recommended for each provider; AWS instance savings plans and
+// GCP committed use discounts both apply to an instance family in a region
+var commitmentTypes = map[string]cloud.CommitmentType{
+	kubecost.AWSProvider: cloud.CommitmentSavingsPlan,
+	kubecost.GCPProvider: cloud.CommitmentCommittedUseDiscount,
+}
+
+// CommitmentConfig configures commitment recommendations.
+type CommitmentConfig struct {
+	// Term is the length of the recommended commitments; either "1yr" or
+	// "3yr"
+	Term string
+
+	// Discount is the expected discount off of on-demand prices of the
+	// recommended commitments
+	Discount float64
+
+	// Percentile of hourly on-demand spend, over the window, to commit to
+	Percentile float64
+
+	// Type of commitment to recommend
+	Type cloud.CommitmentType
+}
+
+// CommitmentRecommendation is a recommended purchase of a commitment covering
+// the steady-state on-demand usage of an instance family in a region. Hourly
+// costs are on-demand prices, unless otherwise stated.
+type CommitmentRecommendation struct {
+	Region string               `json:"region"`
+	Family string               `json:"family"`
+	Type   cloud.CommitmentType `json:"type"`
+	Term   string               `json:"term"`
+
+	// Discount is the expected discount off of on-demand prices
+	Discount float64 `json:"discount"`
+
+	// OnDemandHourlyCost is the average hourly cost of nodes not covered by
+	// existing commitments, and CoveredHourlyCost is the average hourly cost
+	// of those that are; Coverage is the latter's share of the total
+	OnDemandHourlyCost float64 `json:"onDemandHourlyCost"`
+	CoveredHourlyCost  float64 `json:"coveredHourlyCost"`
+	Coverage           float64 `json:"coverage"`
+
+	// HourlyCommitment is the on-demand spend per hour to commit to, which
+	// costs CommittedHourlyCost per hour over the term
+	HourlyCommitment    float64 `json:"hourlyCommitment"`
+	CommittedHourlyCost float64 `json:"committedHourlyCost"`
+
+	// Utilization is the expected fraction of the commitment used, based on
+	// the window; a commitment saves money so long as its utilization exceeds
+	// BreakEvenUtilization
+	Utilization          float64 `json:"utilization"`
+	BreakEvenUtilization float64 `json:"breakEvenUtilization"`
+
+	// BreakEvenMonths is the number of months after which the commitment, if
+	// paid upfront, costs less than the on-demand usage it covers
+	BreakEvenMonths float64 `json:"breakEvenMonths"`
+
+	MonthlySavings float64 `json:"monthlySavings"`
+}
+
+// CommitmentReport lists the current commitments and recommended purchases.
+type CommitmentReport struct {
+	Commitments         []*cloud.Commitment         `json:"commitments"`
+	Recommendations     []*CommitmentRecommendation `json:"recommendations"`
+	TotalMonthlySavings float64                     `json:"totalMonthlySavings"`
+}
+
+// commitmentNode records the hourly cost of a node, by the hour of the window
+// in which it was observed.
+type commitmentNode struct {
+	Region       string
+	InstanceType string
+	ResourceID   string
+	Spot         bool
+	CPUCores     float64
+	HourlyCosts  []float64
+}
+
+// ComputeCommitments compares the hourly on-demand node spend over the given
+// window against the cloud provider's current commitments, recommending the
+// purchase of commitments covering steady-state usage.
+func (a *Accesses) ComputeCommitments(window kubecost.Window, config CommitmentConfig) (*CommitmentReport, error) {
+	if window.IsOpen() || window.IsNegative() {
+		return nil, fmt.Errorf("illegal window: %s", window)
+	}
+	start, end := *window.Start(), *window.End()
+	if now := time.Now().UTC().Truncate(time.Hour); end.After(now) {
+		end = now
+	}
+	hours := int(end.Sub(start) / time.Hour)
+	if hours < 1 {
+		return nil, fmt.Errorf("illegal window: %s is shorter than an hour", window)
+	}
+
+	commitments, err := a.CloudProvider.GetCommitments()
+	if err != nil {
+		return nil, fmt.Errorf("error getting commitments: %s", err)
+	}
+	if commitments == nil {
+		commitments = []*cloud.Commitment{}
+	}
+
+	// Query each hour of the window, ending an hour before its end
+	last := start.Add(time.Duration(hours-1) * time.Hour)
+
+	ctx := prom.NewContext(a.PrometheusClient)
+	resChCost := ctx.QueryRange(queryNodeHourlyCostByInstance, start, last, time.Hour)
+	resChSpot := ctx.QueryRange(queryNodeIsSpot, start, last, time.Hour)
+	resChCPUCores := ctx.QueryRange(queryNodeCPUCores, start, last, time.Hour)
+
+	resCost, _ := resChCost.Await()
+	resSpot, _ := resChSpot.Await()
+	resCPUCores, _ := resChCPUCores.Await()
+	if ctx.HasErrors() {
+		return nil, ctx.ErrorCollection()
+	}
+
+	spot := map[nodeIdentifierNoProviderID]bool{}
+	for _, res := range resSpot {
+		key, err := commitmentNodeKey(res)
+		if err != nil {
+			continue
+		}
+		for _, v := range res.Values {
+			if v.Value > 0 {
+				spot[key] = true
+			}
+		}
+	}
+
+	cpuCores := map[nodeIdentifierNoProviderID]float64{}
+	for _, res := range resCPUCores {
+		key, err := commitmentNodeKey(res)
+		if err != nil {
+			continue
+		}
+		for _, v := range res.Values {
+			cpuCores[key] = math.Max(cpuCores[key], v.Value)
+		}
+	}
+
+	var nodes []*commitmentNode
+	for _, res := range resCost {
+		key, err := commitmentNodeKey(res)
+		if err != nil {
+			log.Warningf("ComputeCommitments: %s", err)
+			continue
+		}
+		instanceType, _ := res.GetString("instance_type")
+		region, _ := res.GetString("region")
+		providerID, _ := res.GetString("provider_id")
+
+		node := &commitmentNode{
+			Region:       region,
+			InstanceType: instanceType,
+			ResourceID:   a.CloudProvider.ParseID(providerID),
+			Spot:         spot[key],
+			CPUCores:     cpuCores[key],
+			HourlyCosts:  make([]float64, hours),
+		}
+		for _, v := range res.Values {
+			h := int(math.Round((v.Timestamp - float64(start.Unix())) / 3600.0))
+			if h >= 0 && h < hours {
+				node.HourlyCosts[h] = v.Value
+			}
+		}
+		nodes = append(nodes, node)
+	}
+
+	recs := buildCommitmentRecommendations(nodes, commitments, hours, config)
+
+	report := &CommitmentReport{
+		Commitments:     commitments,
+		Recommendations: recs,
+	}
+	for _, rec := range recs {
+		report.TotalMonthlySavings += rec.MonthlySavings
+	}
+
+	return report, nil
+}
+
+// commitmentNodeKey identifies the node of a query result
+func commitmentNodeKey(res *prom.QueryResult) (nodeIdentifierNoProviderID, error) {
+	cluster, err := res.GetString("cluster_id")
+	if err != nil {
+		cluster = env.GetClusterID()
+	}
+	node, err := res.GetString("node")
+	if err != nil {
+		return nodeIdentifierNoProviderID{}, err
+	}
+	return nodeIdentifierNoProviderID{Cluster: cluster, Name: node}, nil
+}
+
+// buildCommitmentRecommendations totals the hourly cost of on-demand nodes by
+// region and instance family, splitting it between the cost already covered
+// by the given commitments and that which is not, and recommends committing
+// to the configured percentile of the latter. Spot nodes are excluded.
+//
+// Commitments listing resource IDs cover those nodes entirely. Commitments to
+// amounts of CPU in a region, instead, cover a share of the cost of every
+// uncovered node in that region, in proportion to the reserved cores.
+func buildCommitmentRecommendations(nodes []*commitmentNode, commitments []*cloud.Commitment, hours int, config CommitmentConfig) []*CommitmentRecommendation {
+	covered := map[string]bool{}
+	reservedCPUCores := map[string]float64{}
+	for _, c := range commitments {
+		for _, id := range c.ResourceIDs {
+			covered[id] = true
+		}
+		if len(c.ResourceIDs) == 0 {
+			reservedCPUCores[c.Region] += c.CPUCores
+		}
+	}
+
+	// Total the on-demand cores running in each region, each hour, to share
+	// out regional commitments
+	regionCPUCores := map[string][]float64{}
+	for _, node := range nodes {
+		if node.Spot || covered[node.ResourceID] {
+			continue
+		}
+		if _, ok := regionCPUCores[node.Region]; !ok {
+			regionCPUCores[node.Region] = make([]float64, hours)
+		}
+		for h, cost := range node.HourlyCosts {
+			if cost > 0 {
+				regionCPUCores[node.Region][h] += node.CPUCores
+			}
+		}
+	}
+
+	type familyKey struct {
+		region string
+		family string
+	}
+	onDemand := map[familyKey][]float64{}
+	coveredCosts := map[familyKey]float64{}
+
+	for _, node := range nodes {
+		if node.Spot {
+			continue
+		}
+		key := familyKey{region: node.Region, family: instanceFamily(node.InstanceType)}
+		if _, ok := onDemand[key]; !ok {
+			onDemand[key] = make([]float64, hours)
+		}
+
+		for h, cost := range node.HourlyCosts {
+			if covered[node.ResourceID] {
+				coveredCosts[key] += cost
+				continue
+			}
+
+			share := 0.0
+			if cores := regionCPUCores[node.Region][h]; cores > 0 {
+				share = math.Min(1.0, reservedCPUCores[node.Region]/cores)
+			}
+			coveredCosts[key] += cost * share
+			onDemand[key][h] += cost * (1.0 - share)
+		}
+	}
+
+	recs := []*CommitmentRecommendation{}
+
+	for key, costs := range onDemand {
+		rec := &CommitmentRecommendation{
+			Region:               key.region,
+			Family:               key.family,
+			Type:                 config.Type,
+			Term:                 config.Term,
+			Discount:             config.Discount,
+			CoveredHourlyCost:    coveredCosts[key] / float64(hours),
+			BreakEvenUtilization: 1.0 - config.Discount,
+		}
+
+		for _, cost := range costs {
+			rec.OnDemandHourlyCost += cost
+		}
+		rec.OnDemandHourlyCost /= float64(hours)
+		if total := rec.OnDemandHourlyCost + rec.CoveredHourlyCost; total > 0 {
+			rec.Coverage = rec.CoveredHourlyCost / total
+		}
+
+		commitment := percentile(costs, config.Percentile)
+		if commitment <= 0 {
+			continue
+		}
+
+		used := 0.0
+		for _, cost := range costs {
+			used += math.Min(cost, commitment)
+		}
+		used /= float64(hours)
+
+		rec.HourlyCommitment = commitment
+		rec.CommittedHourlyCost = commitment * (1.0 - config.Discount)
+		rec.Utilization = used / commitment
+		rec.MonthlySavings = (used - rec.CommittedHourlyCost) * util.HoursPerMonth
+		if rec.MonthlySavings <= 0 {
+			continue
+		}
+		rec.BreakEvenMonths = rec.BreakEvenUtilization * commitmentTermMonths(config.Term) / rec.Utilization
+
+		recs = append(recs, rec)
+	}
+
+	sort.Slice(recs, func(i, j int) bool {
+		if recs[i].MonthlySavings != recs[j].MonthlySavings {
+			return recs[i].MonthlySavings > recs[j].MonthlySavings
+		}
+		if recs[i].Region != recs[j].Region {
+			return recs[i].Region < recs[j].Region
+		}
+		return recs[i].Family < recs[j].Family
+	})
+
+	return recs
+}
+
+// instanceFamily returns the family of an instance type; e.g. "m5" for AWS
+// "m5.xlarge" and "n1" for GCP "n1-standard-4". Instance types in neither form
+// are their own family.
+func instanceFamily(instanceType string) string {
+	if i := strings.Index(instanceType, "."); i > 0 {
+		return instanceType[:i]
+	}
+	if i := strings.Index(instanceType, "-"); i > 0 {
+		return instanceType[:i]
+	}
+	return instanceType
+}
+
+// commitmentTermMonths returns the length of the given term in months
+func commitmentTermMonths(term string) float64 {
+	if term == CommitmentTermThreeYear {
+		return 36.0
+	}
+	return 12.0
+}
+
+// percentile returns the nearest-rank p-th percentile, for p in [0, 1], of
+// the given values; the 0th percentile being the minimum.
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0.0
+	}
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// CommitmentsHandler reports current commitments and recommends commitment
+// purchases covering steady-state on-demand node usage.
+func (a *Accesses) CommitmentsHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	qp := util.NewQueryParams(r.URL.Query())
+
+	// Window is an optional parameter, defaulting to the past week, over
+	// which node usage is observed.
+	window, err := kubecost.ParseWindowWithOffset(qp.Get("window", "7d"), env.GetParsedUTCOffset())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid 'window' parameter: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// Term is an optional parameter, either "1yr" (default) or "3yr".
+	term := qp.Get("term", CommitmentTermOneYear)
+	if term != CommitmentTermOneYear && term != CommitmentTermThreeYear {
+		http.Error(w, fmt.Sprintf("Invalid 'term' parameter: %s", term), http.StatusBadRequest)
+		return
+	}
+
+	provider := kubecost.NilProvider
+	if info, err := a.CloudProvider.ClusterInfo(); err == nil {
+		provider = kubecost.ParseProvider(info["provider"])
+	}
+	discounts, ok := defaultCommitmentDiscounts[provider]
+	if !ok {
+		discounts = defaultCommitmentDiscounts[kubecost.NilProvider]
+	}
+	commitmentType, ok := commitmentTypes[provider]
+	if !ok {
+		commitmentType = cloud.CommitmentReservedInstance
+	}
+
+	// Discount and percentile are optional parameters, given as percentages,
+	// overriding the expected discount of the commitment and the percentile
+	// of hourly usage to commit to.
+	// Example: "discount=35&percentile=5"
+	discount := qp.GetFloat64("discount", discounts[term]*100.0) / 100.0
+	if discount <= 0.0 || discount >= 1.0 {
+		http.Error(w, fmt.Sprintf("Invalid 'discount' parameter: %s", qp.Get("discount", "")), http.StatusBadRequest)
+		return
+	}
+	pct := qp.GetFloat64("percentile", DefaultCommitmentPercentile*100.0) / 100.0
+	if pct < 0.0 || pct > 1.0 {
+		http.Error(w, fmt.Sprintf("Invalid 'percentile' parameter: %s", qp.Get("percentile", "")), http.StatusBadRequest)
+		return
+	}
+
+	report, err := a.ComputeCommitments(window, CommitmentConfig{
+		Term:       term,
+		Discount:   discount,
+		Percentile: pct,
+		Type:       commitmentType,
+	})
+	if err != nil {
+		WriteError(w, InternalServerError(err.Error()))
+		return
+	}
+
+	w.Write(WrapData(report, nil))
+}
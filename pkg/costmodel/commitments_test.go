@@ -0,0 +1,97 @@
+package costmodel
+
+import (
+	"testing"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+func TestBuildCommitmentRecommendations(t *testing.T) {
+	nodes := []*commitmentNode{
+		// Reserved
+		{Region: "us-east-1", InstanceType: "m5.large", ResourceID: "i-a", CPUCores: 2.0, HourlyCosts: []float64{0.1, 0.1, 0.1, 0.1}},
+		// On-demand, with a second node for the first two hours
+		{Region: "us-east-1", InstanceType: "m5.xlarge", ResourceID: "i-b", CPUCores: 4.0, HourlyCosts: []float64{0.2, 0.2, 0.2, 0.2}},
+		{Region: "us-east-1", InstanceType: "m5.xlarge", ResourceID: "i-c", CPUCores: 4.0, HourlyCosts: []float64{0.2, 0.2, 0.0, 0.0}},
+		// Spot
+		{Region: "us-east-1", InstanceType: "m5.xlarge", ResourceID: "i-d", Spot: true, CPUCores: 4.0, HourlyCosts: []float64{0.05, 0.05, 0.05, 0.05}},
+		// Not steady
+		{Region: "us-east-1", InstanceType: "c5.large", ResourceID: "i-e", CPUCores: 2.0, HourlyCosts: []float64{0.1, 0.0, 0.0, 0.0}},
+		// Half covered by a regional commitment
+		{Region: "us-central1", InstanceType: "n1-standard-4", ResourceID: "node-f", CPUCores: 4.0, HourlyCosts: []float64{0.2, 0.2, 0.2, 0.2}},
+	}
+
+	commitments := []*cloud.Commitment{
+		{ID: "ri", Type: cloud.CommitmentReservedInstance, Region: "us-east-1", ResourceIDs: []string{"i-a"}},
+		{ID: "cud", Type: cloud.CommitmentCommittedUseDiscount, Region: "us-central1", CPUCores: 2.0},
+	}
+
+	recs := buildCommitmentRecommendations(nodes, commitments, 4, CommitmentConfig{
+		Term:       CommitmentTermOneYear,
+		Discount:   0.25,
+		Percentile: 0.0,
+		Type:       cloud.CommitmentSavingsPlan,
+	})
+	if len(recs) != 2 {
+		t.Fatalf("expected 2 recommendations; got %d", len(recs))
+	}
+
+	// Committing to the minimum of $0.2 per hour, at 25% off, is always used
+	rec := recs[0]
+	if rec.Region != "us-east-1" || rec.Family != "m5" || rec.Type != cloud.CommitmentSavingsPlan || rec.Term != CommitmentTermOneYear {
+		t.Fatalf("unexpected recommendation: %+v", rec)
+	}
+	if !util.IsApproximately(rec.OnDemandHourlyCost, 0.3) || !util.IsApproximately(rec.CoveredHourlyCost, 0.1) || !util.IsApproximately(rec.Coverage, 0.25) {
+		t.Fatalf("unexpected coverage: %+v", rec)
+	}
+	if !util.IsApproximately(rec.HourlyCommitment, 0.2) || !util.IsApproximately(rec.CommittedHourlyCost, 0.15) || rec.Utilization != 1.0 {
+		t.Fatalf("unexpected commitment: %+v", rec)
+	}
+	if !util.IsApproximately(rec.MonthlySavings, 0.05*730.0) || !util.IsApproximately(rec.BreakEvenMonths, 9.0) || rec.BreakEvenUtilization != 0.75 {
+		t.Fatalf("unexpected savings: %+v", rec)
+	}
+
+	rec = recs[1]
+	if rec.Region != "us-central1" || rec.Family != "n1" {
+		t.Fatalf("unexpected recommendation: %+v", rec)
+	}
+	if !util.IsApproximately(rec.CoveredHourlyCost, 0.1) || !util.IsApproximately(rec.HourlyCommitment, 0.1) || !util.IsApproximately(rec.MonthlySavings, 0.025*730.0) {
+		t.Fatalf("unexpected commitment: %+v", rec)
+	}
+
+	// Committing to the peak leaves the commitment half used, at a loss
+	recs = buildCommitmentRecommendations(nodes[1:3], nil, 4, CommitmentConfig{Discount: 0.25, Percentile: 1.0})
+	if len(recs) != 0 {
+		t.Fatalf("expected no recommendations; got %+v", recs[0])
+	}
+}
+
+func TestInstanceFamily(t *testing.T) {
+	for instanceType, family := range map[string]string{
+		"m5.xlarge":       "m5",
+		"n1-standard-4":   "n1",
+		"Standard_D4s_v3": "Standard_D4s_v3",
+		"":                "",
+	} {
+		if f := instanceFamily(instanceType); f != family {
+			t.Fatalf("expected family %s of %s; got %s", family, instanceType, f)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	values := []float64{5.0, 1.0, 4.0, 2.0, 3.0}
+	if p := percentile(values, 0.0); p != 1.0 {
+		t.Fatalf("expected minimum 1.0; got %f", p)
+	}
+	if p := percentile(values, 0.5); p != 3.0 {
+		t.Fatalf("expected median 3.0; got %f", p)
+	}
+	if p := percentile(values, 1.0); p != 5.0 {
+		t.Fatalf("expected maximum 5.0; got %f", p)
+	}
+	if values[0] != 5.0 {
+		t.Fatalf("expected values to be unsorted")
+	}
+}
@@ -53,6 +53,7 @@ type CostModel struct {
 	ScrapeInterval   time.Duration
 	PrometheusClient prometheus.Client
 	Provider         costAnalyzerCloud.Provider
+	Reconciler       *Reconciler
 	pricingMetadata  *costAnalyzerCloud.PricingMatchMetadata
 }
 
@@ -1002,12 +1003,14 @@ func (cm *CostModel) GetNodeCost(cp costAnalyzerCloud.Provider) (map[string]*cos
 		// Azure does not seem to provide a GPU count in its pricing API. GKE supports attaching multiple GPUs
 		// So the k8s api will often report more accurate results for GPU count under status > capacity > nvidia.com/gpu than the cloud providers billing data
 		// not all providers are guaranteed to use this, so don't overwrite a Provider assignment if we can't find something under that capacity exists
+		// MIG profiles and time-sliced GPUs are counted as the physical GPUs they share.
 		gpuc := 0.0
-		q, ok := n.Status.Capacity["nvidia.com/gpu"]
-		if ok {
-			gpuCount := q.Value()
+		gpuShares := costAnalyzerCloud.GPUShares(cp.GetKey(nodeLabels, n), n.Status.Capacity)
+		if len(gpuShares) > 0 {
+			newCnode.GPUShares = gpuShares
+			gpuCount := nodeGPUCount(n, gpuShares)
 			if gpuCount != 0 {
-				newCnode.GPU = fmt.Sprintf("%d", q.Value())
+				newCnode.GPU = fmt.Sprintf("%d", gpuCount)
 				gpuc = float64(gpuCount)
 			}
 		} else {
@@ -1203,6 +1206,25 @@ func (cm *CostModel) GetNodeCost(cp costAnalyzerCloud.Provider) (map[string]*cos
 	return nodes, nil
 }
 
+// nodeGPUCount returns the number of physical GPUs on the given node, given
+// the fraction of a GPU that one unit of each of its GPU resources represents.
+// GPU feature discovery labels the count, without which it is the number of
+// whole GPUs covered by the node's capacity.
+func nodeGPUCount(n *v1.Node, gpuShares map[string]float64) int64 {
+	if count, err := strconv.ParseInt(n.Labels[costAnalyzerCloud.GPUCountLabel], 10, 64); err == nil && count > 0 {
+		return count
+	}
+
+	gpus := 0.0
+	for resource, share := range gpuShares {
+		q := n.Status.Capacity[v1.ResourceName(resource)]
+		gpus += float64(q.Value()) * share
+	}
+
+	// Round up, as MIG profiles may leave slices of a GPU unused
+	return int64(math.Ceil(gpus - 1e-9))
+}
+
 // TODO: drop some logs
 func (cm *CostModel) GetLBCost(cp costAnalyzerCloud.Provider) (map[string]*costAnalyzerCloud.LoadBalancer, error) {
 	// for fetching prices from cloud provider
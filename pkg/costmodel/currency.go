@@ -0,0 +1,104 @@
+package costmodel
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/currency"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+// DefaultCurrency is the currency of prices when none is configured
+const DefaultCurrency = "USD"
+
+// newCurrencyConverter returns a Converter using exchange rates from the
+// configured URL, if any, or else from the configured file.
+func newCurrencyConverter() *currency.Converter {
+	var source currency.RateSource
+	if url := env.GetCurrencyRatesURL(); url != "" {
+		source = currency.NewURLRateSource(url)
+	} else {
+		source = currency.NewFileRateSource(env.GetCurrencyRatesPath())
+	}
+	log.Infof("Init: exchange rates from %s", source.Name())
+
+	return currency.NewConverter(source, env.GetCurrencyRatesRefreshInterval())
+}
+
+// pricingCurrency returns the configured currency of the provider's prices.
+func pricingCurrency(cp cloud.Provider) string {
+	if c, err := cp.GetConfig(); err == nil && c.CurrencyCode != "" {
+		return currency.Normalize(c.CurrencyCode)
+	}
+	return DefaultCurrency
+}
+
+// parseCurrency returns the currency requested by the optional 'currency'
+// parameter, defaulting to the currency of prices, and the rate by which to
+// multiply costs to convert them to it.
+// Example: "currency=EUR"
+func (a *Accesses) parseCurrency(qp util.QueryParams) (string, float64, error) {
+	from := pricingCurrency(a.CloudProvider)
+	to := currency.Normalize(qp.Get("currency", from))
+	if to == from {
+		return to, 1.0, nil
+	}
+
+	if a.CurrencyConverter == nil {
+		return "", 0.0, fmt.Errorf("Invalid 'currency' parameter: currency conversion is not configured")
+	}
+	rate, err := a.CurrencyConverter.Rate(from, to)
+	if err != nil {
+		return "", 0.0, fmt.Errorf("Invalid 'currency' parameter: %s", err)
+	}
+
+	return to, rate, nil
+}
+
+// scaleClusterCosts returns copies of the given ClusterCosts with costs
+// multiplied by the given rate. Breakdowns, being proportions, are shared.
+func scaleClusterCosts(costs map[string]*ClusterCosts, rate float64) map[string]*ClusterCosts {
+	scaled := make(map[string]*ClusterCosts, len(costs))
+	for key, cc := range costs {
+		if cc == nil {
+			scaled[key] = nil
+			continue
+		}
+		c := *cc
+		c.CPUCumulative *= rate
+		c.CPUMonthly *= rate
+		c.GPUCumulative *= rate
+		c.GPUMonthly *= rate
+		c.RAMCumulative *= rate
+		c.RAMMonthly *= rate
+		c.StorageCumulative *= rate
+		c.StorageMonthly *= rate
+		c.TotalCumulative *= rate
+		c.TotalMonthly *= rate
+		scaled[key] = &c
+	}
+	return scaled
+}
+
+// scaleTotals multiplies the costs of each time series of the given Totals,
+// which are pairs of timestamp and cost, by the given rate.
+func scaleTotals(totals *Totals, rate float64) {
+	if totals == nil {
+		return
+	}
+	for _, series := range [][][]string{totals.TotalCost, totals.CPUCost, totals.MemCost, totals.StorageCost} {
+		for _, point := range series {
+			if len(point) < 2 {
+				continue
+			}
+			cost, err := strconv.ParseFloat(point[1], 64)
+			if err != nil {
+				continue
+			}
+			point[1] = fmt.Sprintf("%f", cost*rate)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package costmodel
+
+import (
+	"testing"
+)
+
+func TestScaleClusterCosts(t *testing.T) {
+	costs := map[string]*ClusterCosts{
+		"cluster1": {CPUCumulative: 2.0, TotalCumulative: 4.0, TotalMonthly: 100.0},
+	}
+
+	scaled := scaleClusterCosts(costs, 0.5)
+	if cc := scaled["cluster1"]; cc.CPUCumulative != 1.0 || cc.TotalCumulative != 2.0 || cc.TotalMonthly != 50.0 {
+		t.Fatalf("unexpected scaled costs: %+v", cc)
+	}
+	if costs["cluster1"].TotalCumulative != 4.0 {
+		t.Fatalf("expected original costs unchanged")
+	}
+}
+
+func TestScaleTotals(t *testing.T) {
+	totals := &Totals{
+		TotalCost: [][]string{{"1614556800", "10.0"}, {"1614643200", "NaN"}},
+		CPUCost:   [][]string{{"1614556800", "4"}},
+	}
+
+	scaleTotals(totals, 2.0)
+	if totals.TotalCost[0][1] != "20.000000" || totals.CPUCost[0][1] != "8.000000" {
+		t.Fatalf("unexpected scaled totals: %v, %v", totals.TotalCost, totals.CPUCost)
+	}
+	if totals.TotalCost[0][0] != "1614556800" {
+		t.Fatalf("expected timestamps unchanged")
+	}
+}
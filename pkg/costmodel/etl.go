@@ -0,0 +1,104 @@
+package costmodel
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/etl"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/storage"
+)
+
+// newAllocationETL creates and starts an AllocationETL for the given
+// CostModel, configured by the environment. If the ETL cannot be created,
+// it returns nil, in which case allocations are always computed from
+// Prometheus.
+func newAllocationETL(model *CostModel) *etl.AllocationETL {
+	backup, err := newETLBackupStorage()
+	if err != nil {
+		log.Errorf("Init: failed to create ETL backup storage: %s", err)
+		return nil
+	}
+
+	allocETL, err := etl.NewAllocationETL(model, etl.AllocationETLConfig{
+		Path:           env.GetETLPath(),
+		Backup:         backup,
+		BackupDuration: env.GetETLBackupRetention(),
+		DailyDuration:  env.GetETLDailyStoreDuration(),
+		HourlyDuration: env.GetETLHourlyStoreDuration(),
+		Resolution:     env.GetETLResolution(),
+		MaxBatch:       env.GetETLMaxBatchDuration(),
+		RefreshRate:    env.GetETLRefreshRate(),
+		UTCOffset:      env.GetParsedUTCOffset(),
+	})
+	if err != nil {
+		log.Errorf("Init: failed to create allocation ETL: %s", err)
+		return nil
+	}
+
+	allocETL.Start()
+
+	return allocETL
+}
+
+// newETLBackupStorage creates the Storage to which ETL files are backed up,
+// as configured by the environment, or nil if backup is not configured.
+func newETLBackupStorage() (storage.Storage, error) {
+	switch strings.ToLower(env.GetETLBackupStorage()) {
+	case "":
+		return nil, nil
+	case "file":
+		if env.GetETLBackupPath() == "" {
+			return nil, fmt.Errorf("%s is required for file backup", env.ETLBackupPathEnvVar)
+		}
+		return storage.NewFileStorage(env.GetETLBackupPath()), nil
+	case "s3":
+		return storage.NewS3Storage(storage.S3Config{
+			Bucket:          env.GetETLBackupS3Bucket(),
+			Prefix:          env.GetETLBackupPath(),
+			Region:          env.GetETLBackupS3Region(),
+			Endpoint:        env.GetETLBackupS3Endpoint(),
+			Insecure:        env.IsETLBackupS3Insecure(),
+			AccessKeyID:     env.GetETLBackupS3AccessKeyID(),
+			SecretAccessKey: env.GetETLBackupS3SecretAccessKey(),
+		})
+	}
+
+	return nil, fmt.Errorf("unsupported %s: %s", env.ETLBackupStorageEnvVar, env.GetETLBackupStorage())
+}
+
+// computeAllocation returns the AllocationSet for the window defined by the
+// given start and end times. If the AllocationETL is running, the requested
+// resolution matches the ETL resolution, and the stored sets cover the
+// window, then the set is served from the ETL. Otherwise, it is computed from
+// Prometheus.
+func (a *Accesses) computeAllocation(start, end time.Time, resolution time.Duration) (*kubecost.AllocationSet, error) {
+	if a.AllocationETL != nil && resolution == env.GetETLResolution() {
+		if as, ok := a.AllocationETL.ComputeAllocation(start, end); ok {
+			return as, nil
+		}
+	}
+
+	return a.Model.ComputeAllocation(start, end, resolution)
+}
+
+// ETLStatusHandler returns the ETLStatus of each store of each ETL.
+func (a *Accesses) ETLStatusHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if a.AllocationETL == nil {
+		w.Write(WrapData(nil, fmt.Errorf("ETL is not enabled")))
+		return
+	}
+
+	status := map[string]map[string]*kubecost.ETLStatus{
+		"allocation": a.AllocationETL.Status(),
+	}
+
+	w.Write(WrapData(status, nil))
+}
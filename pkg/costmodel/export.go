@@ -0,0 +1,403 @@
+package costmodel
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/util"
+	"github.com/kubecost/cost-model/pkg/util/parquet"
+)
+
+// Supported values of the format query parameter
+const (
+	ExportFormatJSON    = "json"
+	ExportFormatCSV     = "csv"
+	ExportFormatParquet = "parquet"
+)
+
+// ParseExportFormat parses the format query parameter, which defaults to
+// JSON, and may also be CSV or Parquet.
+func ParseExportFormat(qp util.QueryParams) (string, error) {
+	format := strings.ToLower(strings.TrimSpace(qp.Get("format", ExportFormatJSON)))
+
+	switch format {
+	case ExportFormatJSON, ExportFormatCSV, ExportFormatParquet:
+		return format, nil
+	}
+
+	return "", fmt.Errorf("unsupported format: %s", format)
+}
+
+// exportTable is a flat, tabular view of a result, which can be streamed row
+// by row in any tabular format. Values in each row must be of type string,
+// float64, or time.Time, matching the type of the column, or nil for null
+// values of optional columns.
+type exportTable struct {
+	columns []parquet.Column
+	rows    func(write func(row []interface{}) error) error
+}
+
+// writeExport streams the given table to the response in the given format,
+// as an attachment with the given base file name. Once streaming begins, the
+// status can no longer be changed, so errors are only logged.
+func writeExport(w http.ResponseWriter, format, name string, table *exportTable) {
+	switch format {
+	case ExportFormatCSV:
+		w.Header().Set("Content-Type", "text/csv")
+	case ExportFormatParquet:
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.%s\"", name, format))
+
+	var err error
+	switch format {
+	case ExportFormatCSV:
+		err = writeExportCSV(w, table)
+	case ExportFormatParquet:
+		err = writeExportParquet(w, table)
+	default:
+		err = fmt.Errorf("unsupported format: %s", format)
+	}
+
+	if err != nil {
+		log.Errorf("error writing %s export: %s", format, err)
+	}
+}
+
+// writeExportCSV streams the given table as CSV, with a header row of column
+// names. Null values are written as empty strings.
+func writeExportCSV(w io.Writer, table *exportTable) error {
+	cw := csv.NewWriter(w)
+
+	header := make([]string, len(table.columns))
+	for i, col := range table.columns {
+		header[i] = col.Name
+	}
+	err := cw.Write(header)
+	if err != nil {
+		return err
+	}
+
+	record := make([]string, len(table.columns))
+	err = table.rows(func(row []interface{}) error {
+		for i, value := range row {
+			record[i] = formatExportValue(value)
+		}
+		return cw.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeExportParquet streams the given table as Parquet, one row group at a
+// time.
+func writeExportParquet(w io.Writer, table *exportTable) error {
+	pw, err := parquet.NewWriter(w, table.columns, parquet.DefaultRowGroupSize)
+	if err != nil {
+		return err
+	}
+
+	err = table.rows(pw.Write)
+	if err != nil {
+		return err
+	}
+
+	return pw.Close()
+}
+
+// formatExportValue formats a table value as a string.
+func formatExportValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// allocationExportColumns are the fixed columns of an allocation export,
+// named after the corresponding JSON fields, which are followed by one
+// column per label and annotation. The currency column holds the currency
+// of every cost column.
+var allocationExportColumns = []parquet.Column{
+	{Name: "windowStart", Type: parquet.Timestamp},
+	{Name: "windowEnd", Type: parquet.Timestamp},
+	{Name: "name", Type: parquet.String},
+	{Name: "cluster", Type: parquet.String},
+	{Name: "node", Type: parquet.String},
+	{Name: "namespace", Type: parquet.String},
+	{Name: "controllerKind", Type: parquet.String},
+	{Name: "controller", Type: parquet.String},
+	{Name: "pod", Type: parquet.String},
+	{Name: "container", Type: parquet.String},
+	{Name: "services", Type: parquet.String},
+	{Name: "providerID", Type: parquet.String},
+	{Name: "start", Type: parquet.Timestamp},
+	{Name: "end", Type: parquet.Timestamp},
+	{Name: "minutes", Type: parquet.Double},
+	{Name: "cpuCores", Type: parquet.Double},
+	{Name: "cpuCoreRequestAverage", Type: parquet.Double},
+	{Name: "cpuCoreUsageAverage", Type: parquet.Double},
+	{Name: "cpuCoreHours", Type: parquet.Double},
+	{Name: "cpuCost", Type: parquet.Double},
+	{Name: "cpuEfficiency", Type: parquet.Double},
+	{Name: "gpuHours", Type: parquet.Double},
+	{Name: "gpuCost", Type: parquet.Double},
+	{Name: "gpuUsageAverage", Type: parquet.Double},
+	{Name: "gpuMemoryByteUsageAverage", Type: parquet.Double},
+	{Name: "gpuEfficiency", Type: parquet.Double},
+	{Name: "networkCost", Type: parquet.Double},
+	{Name: "loadBalancerCost", Type: parquet.Double},
+	{Name: "pvBytes", Type: parquet.Double},
+	{Name: "pvByteHours", Type: parquet.Double},
+	{Name: "pvCost", Type: parquet.Double},
+	{Name: "ramBytes", Type: parquet.Double},
+	{Name: "ramByteRequestAverage", Type: parquet.Double},
+	{Name: "ramByteUsageAverage", Type: parquet.Double},
+	{Name: "ramByteHours", Type: parquet.Double},
+	{Name: "ramCost", Type: parquet.Double},
+	{Name: "ramEfficiency", Type: parquet.Double},
+	{Name: "sharedCost", Type: parquet.Double},
+	{Name: "externalCost", Type: parquet.Double},
+	{Name: "extendedResourceCost", Type: parquet.Double},
+	{Name: "totalCost", Type: parquet.Double},
+	{Name: "totalEfficiency", Type: parquet.Double},
+	{Name: "currency", Type: parquet.String},
+}
+
+// newAllocationExportTable returns a table of one row per Allocation per
+// AllocationSet in the given range, flattening the window of the set, and
+// the properties and fields of the Allocation. Each label and annotation
+// found in the range becomes an optional column; e.g. "label:app". Costs are
+// labeled with the given currency.
+func newAllocationExportTable(asr *kubecost.AllocationSetRange, currency string) *exportTable {
+	labelSet := map[string]bool{}
+	annotationSet := map[string]bool{}
+	asr.Each(func(i int, as *kubecost.AllocationSet) {
+		as.Each(func(name string, alloc *kubecost.Allocation) {
+			if alloc.Properties == nil {
+				return
+			}
+			for k := range alloc.Properties.Labels {
+				labelSet[k] = true
+			}
+			for k := range alloc.Properties.Annotations {
+				annotationSet[k] = true
+			}
+		})
+	})
+	labels := sortedKeys(labelSet)
+	annotations := sortedKeys(annotationSet)
+
+	columns := append([]parquet.Column{}, allocationExportColumns...)
+	for _, k := range labels {
+		columns = append(columns, parquet.Column{Name: "label:" + k, Type: parquet.String, Optional: true})
+	}
+	for _, k := range annotations {
+		columns = append(columns, parquet.Column{Name: "annotation:" + k, Type: parquet.String, Optional: true})
+	}
+
+	return &exportTable{
+		columns: columns,
+		rows: func(write func(row []interface{}) error) error {
+			for _, as := range asr.Slice() {
+				allocs := as.Map()
+
+				names := make([]string, 0, len(allocs))
+				for name := range allocs {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+
+				for _, name := range names {
+					err := write(allocationExportRow(as, allocs[name], currency, labels, annotations))
+					if err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// allocationExportRow flattens the given Allocation into a row matching the
+// columns of newAllocationExportTable.
+func allocationExportRow(as *kubecost.AllocationSet, alloc *kubecost.Allocation, currency string, labels, annotations []string) []interface{} {
+	props := alloc.Properties
+	if props == nil {
+		props = &kubecost.AllocationProperties{}
+	}
+
+	row := []interface{}{
+		as.Start(),
+		as.End(),
+		alloc.Name,
+		props.Cluster,
+		props.Node,
+		props.Namespace,
+		props.ControllerKind,
+		props.Controller,
+		props.Pod,
+		props.Container,
+		strings.Join(props.Services, ","),
+		props.ProviderID,
+		alloc.Start,
+		alloc.End,
+		alloc.Minutes(),
+		alloc.CPUCores(),
+		alloc.CPUCoreRequestAverage,
+		alloc.CPUCoreUsageAverage,
+		alloc.CPUCoreHours,
+		alloc.CPUCost,
+		alloc.CPUEfficiency(),
+		alloc.GPUHours,
+		alloc.GPUCost,
+		alloc.GPUUsageAverage,
+		alloc.GPUMemoryBytesUsageAverage,
+		alloc.GPUEfficiency(),
+		alloc.NetworkCost,
+		alloc.LoadBalancerCost,
+		alloc.PVBytes(),
+		alloc.PVByteHours,
+		alloc.PVCost,
+		alloc.RAMBytes(),
+		alloc.RAMBytesRequestAverage,
+		alloc.RAMBytesUsageAverage,
+		alloc.RAMByteHours,
+		alloc.RAMCost,
+		alloc.RAMEfficiency(),
+		alloc.SharedCost,
+		alloc.ExternalCost,
+		alloc.ExtendedResourceCost(),
+		alloc.TotalCost(),
+		alloc.TotalEfficiency(),
+		currency,
+	}
+
+	for _, k := range labels {
+		if v, ok := props.Labels[k]; ok {
+			row = append(row, v)
+		} else {
+			row = append(row, nil)
+		}
+	}
+	for _, k := range annotations {
+		if v, ok := props.Annotations[k]; ok {
+			row = append(row, v)
+		} else {
+			row = append(row, nil)
+		}
+	}
+
+	return row
+}
+
+// aggregationExportColumns are the columns of an aggregation export, named
+// after the corresponding JSON fields, and the currency of the costs.
+var aggregationExportColumns = []parquet.Column{
+	{Name: "windowStart", Type: parquet.Timestamp},
+	{Name: "windowEnd", Type: parquet.Timestamp},
+	{Name: "name", Type: parquet.String},
+	{Name: "aggregation", Type: parquet.String},
+	{Name: "subfields", Type: parquet.String},
+	{Name: "environment", Type: parquet.String},
+	{Name: "cluster", Type: parquet.String},
+	{Name: "cpuAllocationAverage", Type: parquet.Double},
+	{Name: "cpuCost", Type: parquet.Double},
+	{Name: "cpuEfficiency", Type: parquet.Double},
+	{Name: "gpuAllocationAverage", Type: parquet.Double},
+	{Name: "gpuCost", Type: parquet.Double},
+	{Name: "ramAllocationAverage", Type: parquet.Double},
+	{Name: "ramCost", Type: parquet.Double},
+	{Name: "ramEfficiency", Type: parquet.Double},
+	{Name: "pvAllocationAverage", Type: parquet.Double},
+	{Name: "pvCost", Type: parquet.Double},
+	{Name: "networkCost", Type: parquet.Double},
+	{Name: "sharedCost", Type: parquet.Double},
+	{Name: "totalCost", Type: parquet.Double},
+	{Name: "efficiency", Type: parquet.Double},
+	{Name: "currency", Type: parquet.String},
+}
+
+// newAggregationExportTable returns a table of one row per Aggregation,
+// sorted by name, over the given window, with costs in the given currency.
+func newAggregationExportTable(data map[string]*Aggregation, window kubecost.Window, currency string) *exportTable {
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	start, end := time.Time{}, time.Time{}
+	if window.Start() != nil {
+		start = *window.Start()
+	}
+	if window.End() != nil {
+		end = *window.End()
+	}
+
+	return &exportTable{
+		columns: aggregationExportColumns,
+		rows: func(write func(row []interface{}) error) error {
+			for _, name := range names {
+				agg := data[name]
+				err := write([]interface{}{
+					start,
+					end,
+					name,
+					agg.Aggregator,
+					strings.Join(agg.Subfields, ","),
+					agg.Environment,
+					agg.Cluster,
+					agg.CPUAllocationHourlyAverage,
+					agg.CPUCost,
+					agg.CPUEfficiency,
+					agg.GPUAllocationHourlyAverage,
+					agg.GPUCost,
+					agg.RAMAllocationHourlyAverage,
+					agg.RAMCost,
+					agg.RAMEfficiency,
+					agg.PVAllocationHourlyAverage,
+					agg.PVCost,
+					agg.NetworkCost,
+					agg.SharedCost,
+					agg.TotalCost,
+					agg.Efficiency,
+					currency,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// sortedKeys returns the keys of the given set in sorted order.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
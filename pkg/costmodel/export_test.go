@@ -0,0 +1,160 @@
+package costmodel
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+func TestParseExportFormat(t *testing.T) {
+	cases := map[string]struct {
+		query    string
+		expected string
+		err      bool
+	}{
+		"default":     {query: "", expected: ExportFormatJSON},
+		"json":        {query: "format=json", expected: ExportFormatJSON},
+		"csv":         {query: "format=CSV", expected: ExportFormatCSV},
+		"parquet":     {query: "format=parquet", expected: ExportFormatParquet},
+		"unsupported": {query: "format=xml", err: true},
+	}
+
+	for name, c := range cases {
+		values, err := url.ParseQuery(c.query)
+		if err != nil {
+			t.Fatalf("%s: unexpected error parsing query: %s", name, err)
+		}
+
+		format, err := ParseExportFormat(util.NewQueryParams(values))
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: expected error; got %s", name, format)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+			continue
+		}
+		if format != c.expected {
+			t.Errorf("%s: expected %s; got %s", name, c.expected, format)
+		}
+	}
+}
+
+func TestAllocationExportTable_CSV(t *testing.T) {
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+
+	web := &kubecost.Allocation{
+		Name:  "web",
+		Start: start,
+		End:   end,
+		Properties: &kubecost.AllocationProperties{
+			Namespace: "web",
+			Services:  []string{"frontend", "backend"},
+			Labels:    map[string]string{"app": "web"},
+		},
+		CPUCoreHours: 24.0,
+		CPUCost:      1.5,
+	}
+	kubecostAlloc := &kubecost.Allocation{
+		Name:  "kubecost",
+		Start: start,
+		End:   end,
+		Properties: &kubecost.AllocationProperties{
+			Namespace:   "kubecost",
+			Annotations: map[string]string{"owner": "ops"},
+		},
+		RAMCost: 0.25,
+	}
+	asr := kubecost.NewAllocationSetRange(kubecost.NewAllocationSet(start, end, web, kubecostAlloc))
+
+	table := newAllocationExportTable(asr, "EUR")
+
+	buf := &bytes.Buffer{}
+	err := writeExportCSV(buf, table)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	records, err := csv.NewReader(buf).ReadAll()
+	if err != nil {
+		t.Fatalf("unexpected error reading CSV: %s", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records; got %d", len(records))
+	}
+
+	header := records[0]
+	if len(header) != len(allocationExportColumns)+2 {
+		t.Fatalf("expected %d columns; got %d", len(allocationExportColumns)+2, len(header))
+	}
+	if header[len(header)-2] != "label:app" || header[len(header)-1] != "annotation:owner" {
+		t.Fatalf("expected label and annotation columns; got %v", header[len(header)-2:])
+	}
+
+	column := func(name string) int {
+		for i, h := range header {
+			if h == name {
+				return i
+			}
+		}
+		t.Fatalf("missing column %s", name)
+		return -1
+	}
+
+	// Rows are sorted by name
+	kc, wb := records[1], records[2]
+
+	if kc[column("name")] != "kubecost" || wb[column("name")] != "web" {
+		t.Fatalf("expected rows kubecost, web; got %s, %s", kc[column("name")], wb[column("name")])
+	}
+	if wb[column("windowStart")] != "2021-03-01T00:00:00Z" || wb[column("windowEnd")] != "2021-03-02T00:00:00Z" {
+		t.Errorf("unexpected window: %s, %s", wb[column("windowStart")], wb[column("windowEnd")])
+	}
+	if wb[column("services")] != "frontend,backend" {
+		t.Errorf("expected services frontend,backend; got %s", wb[column("services")])
+	}
+	if wb[column("cpuCores")] != "1" {
+		t.Errorf("expected cpuCores 1; got %s", wb[column("cpuCores")])
+	}
+	if wb[column("totalCost")] != "1.5" {
+		t.Errorf("expected totalCost 1.5; got %s", wb[column("totalCost")])
+	}
+	if wb[column("currency")] != "EUR" || kc[column("currency")] != "EUR" {
+		t.Errorf("expected currency EUR; got %s, %s", wb[column("currency")], kc[column("currency")])
+	}
+	if wb[column("label:app")] != "web" || kc[column("label:app")] != "" {
+		t.Errorf("unexpected label:app values: %q, %q", wb[column("label:app")], kc[column("label:app")])
+	}
+	if kc[column("annotation:owner")] != "ops" || wb[column("annotation:owner")] != "" {
+		t.Errorf("unexpected annotation:owner values: %q, %q", kc[column("annotation:owner")], wb[column("annotation:owner")])
+	}
+}
+
+func TestAggregationExportTable_Parquet(t *testing.T) {
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+
+	data := map[string]*Aggregation{
+		"web":      {Aggregator: "namespace", TotalCost: 2.0},
+		"kubecost": {Aggregator: "namespace", TotalCost: 1.0},
+	}
+
+	buf := &bytes.Buffer{}
+	err := writeExportParquet(buf, newAggregationExportTable(data, kubecost.NewWindow(&start, &end), "USD"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	b := buf.Bytes()
+	if len(b) < 8 || string(b[:4]) != "PAR1" || string(b[len(b)-4:]) != "PAR1" {
+		t.Fatalf("expected Parquet magic bytes")
+	}
+}
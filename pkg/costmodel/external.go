@@ -0,0 +1,234 @@
+package costmodel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/billing"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/util"
+	"github.com/kubecost/cost-model/pkg/util/json"
+	"github.com/patrickmn/go-cache"
+)
+
+// LoadLabelConfig loads the LabelConfig from the JSON file at the given path.
+// If no file exists, it returns an empty LabelConfig, which uses the default
+// labels; e.g. out-of-cluster costs tagged "kubernetes_namespace" are
+// attributed to namespaces.
+func LoadLabelConfig(configPath string) (*kubecost.LabelConfig, error) {
+	lc := &kubecost.LabelConfig{}
+
+	exists, err := util.FileExists(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return lc, nil
+	}
+
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, lc)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", configPath, err)
+	}
+
+	return lc, nil
+}
+
+// newBillingIngester creates a billing.Ingester of the exports configured by
+// the billing config file, or nil if there is no config.
+func newBillingIngester() *billing.Ingester {
+	config, err := billing.LoadConfig(env.GetBillingConfigPath())
+	if err != nil {
+		log.Errorf("Init: failed to load billing config: %s", err)
+		return nil
+	}
+	if config == nil {
+		return nil
+	}
+
+	store, err := config.NewStorage()
+	if err != nil {
+		log.Errorf("Init: failed to create billing storage: %s", err)
+		return nil
+	}
+
+	ingester, err := billing.NewIngester(store, config)
+	if err != nil {
+		log.Errorf("Init: failed to create billing ingester: %s", err)
+		return nil
+	}
+	log.Infof("Init: ingesting billing exports from %s", store.FullPath(""))
+
+	return ingester
+}
+
+// computeExternalAssets computes an AssetSet of the out-of-cluster costs
+// billed between the given times; see queryExternalAssets and
+// newExternalAssetSet.
+func (a *Accesses) computeExternalAssets(start, end time.Time) (*kubecost.AssetSet, error) {
+	clouds, err := a.queryExternalAssets(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return newExternalAssetSet(clouds, start, end), nil
+}
+
+// queryExternalAssets returns the out-of-cluster costs billed by the cloud
+// provider, and contained by the ingested billing exports, over the whole UTC
+// days containing the given times, which are tagged with any of the
+// configured external labels. Billing data is refreshed at the rate it is for
+// reconciliation, so results are cached for that long. The returned assets
+// are shared by the cache, so must not be modified.
+func (a *Accesses) queryExternalAssets(start, end time.Time) ([]*kubecost.Cloud, error) {
+	start = kubecost.RoundBack(start.UTC(), 24*time.Hour)
+	end = kubecost.RoundForward(end.UTC(), 24*time.Hour)
+
+	key := fmt.Sprintf("%d:%d", start.Unix(), end.Unix())
+	if a.ExternalAssetsCache != nil {
+		if value, found := a.ExternalAssetsCache.Get(key); found {
+			if clouds, ok := value.([]*kubecost.Cloud); ok {
+				return clouds, nil
+			}
+			log.Errorf("caching error: failed to type cast data: %s", key)
+		}
+	}
+
+	queryLabels := a.LabelConfig.ExternalQueryLabels()
+
+	clouds, err := a.CloudProvider.ExternalAssets(start, end, queryLabels)
+	if err != nil {
+		// Clusters which are billed by exports may not have configured their
+		// provider's billing data, so it is only required without exports
+		if a.BillingIngester == nil {
+			return nil, fmt.Errorf("error querying external assets: %s", err)
+		}
+		log.DedupedWarningf(5, "queryExternalAssets: error querying provider: %s", err)
+	}
+
+	if a.BillingIngester != nil {
+		ingested, err := a.BillingIngester.ExternalAssets(start, end, queryLabels)
+		if err != nil {
+			return nil, fmt.Errorf("error ingesting billing exports: %s", err)
+		}
+		clouds = append(clouds, ingested...)
+	}
+
+	if a.ExternalAssetsCache != nil {
+		a.ExternalAssetsCache.Set(key, clouds, cache.DefaultExpiration)
+	}
+
+	return clouds, nil
+}
+
+// stepsEnd returns the end of the last of the steps of the given duration
+// by which the given closed window is queried, which may be after the end of
+// the window itself.
+func stepsEnd(window kubecost.Window, step time.Duration) time.Time {
+	end := *window.Start()
+	for window.End().After(end) {
+		end = end.Add(step)
+	}
+	return end
+}
+
+// newExternalAssetSet returns an AssetSet of copies of the given assets,
+// restricted to the given times. Costs are billed by period, e.g. daily, so
+// the costs of periods partially within the window are prorated.
+func newExternalAssetSet(clouds []*kubecost.Cloud, start, end time.Time) *kubecost.AssetSet {
+	assetSet := kubecost.NewAssetSet(start, end)
+	for _, c := range clouds {
+		s, e := c.Start(), c.End()
+		if s.Before(start) {
+			s = start
+		}
+		if e.After(end) {
+			e = end
+		}
+		if !e.After(s) || c.Minutes() <= 0 {
+			continue
+		}
+
+		cloud := c.Clone().(*kubecost.Cloud)
+		cloud.ScaleCosts(e.Sub(s).Minutes() / c.Minutes())
+		cloud.SetStartEnd(s, e)
+
+		// Assets are keyed by their properties, so costs which are not
+		// billed to a specific resource are named by their labels, lest the
+		// costs of differently labeled resources be combined.
+		if cloud.Properties().Name == "" {
+			cloud.Properties().Name = cloud.Properties().ProviderID
+		}
+		if cloud.Properties().Name == "" {
+			cloud.Properties().Name = externalAssetName(cloud.Labels())
+		}
+
+		err := assetSet.Insert(cloud)
+		if err != nil {
+			log.Warningf("newExternalAssetSet: failed to insert asset: %s", err)
+		}
+	}
+
+	return assetSet
+}
+
+// externalAssetName returns a name identifying an asset by its labels.
+func externalAssetName(labels kubecost.AssetLabels) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+// externalAllocationLabels returns the mapping from the names of labels by
+// which allocations may be aggregated to the names of the external asset
+// labels which represent them; e.g. given the default config, aggregating
+// allocations by "label:env" matches assets tagged "kubernetes_label_env",
+// which are labeled "environment".
+func externalAllocationLabels(lc *kubecost.LabelConfig) map[string]string {
+	m := lc.Map()
+
+	labels := map[string]string{}
+	for _, name := range []string{"department", "environment", "owner", "product", "team"} {
+		if label := m[name+"_label"]; label != "" {
+			labels[label] = name
+		}
+	}
+
+	return labels
+}
+
+// insertExternalAllocations converts each asset of the given AssetSet, which
+// is labeled with any of the given aggregation properties, to an external
+// allocation and inserts it into the given AllocationSet.
+func insertExternalAllocations(as *kubecost.AllocationSet, assetSet *kubecost.AssetSet, aggregateBy []string, lc *kubecost.LabelConfig) error {
+	externalLabels := externalAllocationLabels(lc)
+
+	var err error
+	assetSet.Each(func(key string, asset kubecost.Asset) {
+		alloc, e := kubecost.AssetToExternalAllocation(asset, aggregateBy, externalLabels)
+		if e != nil {
+			// The asset is not labeled with any of the properties
+			return
+		}
+
+		if e := as.Insert(alloc); e != nil && err == nil {
+			err = fmt.Errorf("error inserting external allocation: %s", e)
+		}
+	})
+
+	return err
+}
@@ -0,0 +1,203 @@
+package costmodel
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/patrickmn/go-cache"
+)
+
+// mockExternalProvider is a provider which bills the given out-of-cluster
+// costs, ignoring the queried labels, and records the windows queried.
+type mockExternalProvider struct {
+	*cloud.CustomProvider
+	newAssets func() []*kubecost.Cloud
+	queries   []kubecost.Window
+}
+
+func (p *mockExternalProvider) ExternalAssets(start, end time.Time, queryLabels map[string]string) ([]*kubecost.Cloud, error) {
+	p.queries = append(p.queries, kubecost.NewWindow(&start, &end))
+	return p.newAssets(), nil
+}
+
+func newMockExternalAsset(providerID string, day time.Time, cost float64, labels map[string]string) *kubecost.Cloud {
+	end := day.AddDate(0, 0, 1)
+	asset := kubecost.NewCloud(kubecost.OtherCategory, providerID, day, end, kubecost.NewWindow(&day, &end))
+	asset.Properties().Provider = kubecost.GCPProvider
+	asset.Properties().Service = "Cloud SQL"
+	asset.SetLabels(labels)
+	asset.Cost = cost
+	return asset
+}
+
+func TestComputeExternalAssets(t *testing.T) {
+	day1 := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+
+	a := &Accesses{
+		LabelConfig: &kubecost.LabelConfig{},
+		CloudProvider: &mockExternalProvider{
+			newAssets: func() []*kubecost.Cloud {
+				return []*kubecost.Cloud{
+					newMockExternalAsset("", day1, 24.0, map[string]string{"kubernetes_namespace": "web", "namespace": "web"}),
+					newMockExternalAsset("", day2, 48.0, map[string]string{"kubernetes_namespace": "web", "namespace": "web"}),
+					newMockExternalAsset("", day1, 10.0, map[string]string{"kubernetes_namespace": "db", "namespace": "db", "kubernetes_label_env": "prod", "environment": "prod"}),
+				}
+			},
+		},
+	}
+
+	// Differently labeled costs are not combined, and the costs of the same
+	// resource over both days are
+	assetSet, err := a.computeExternalAssets(day1, day2.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if assetSet.Length() != 2 {
+		t.Fatalf("expected 2 assets; got %d", assetSet.Length())
+	}
+	if math.Abs(assetSet.TotalCost()-82.0) > 1e-9 {
+		t.Fatalf("expected total cost 82; got %f", assetSet.TotalCost())
+	}
+
+	// Days partially within the window are prorated
+	start := day1.Add(12 * time.Hour)
+	end := day2.Add(6 * time.Hour)
+	assetSet, err = a.computeExternalAssets(start, end)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if math.Abs(assetSet.TotalCost()-29.0) > 1e-9 {
+		t.Fatalf("prorated: expected total cost 29; got %f", assetSet.TotalCost())
+	}
+
+	// Costs are converted to external allocations by the aggregation
+	// properties they are labeled with
+	as := kubecost.NewAllocationSet(start, end)
+	err = insertExternalAllocations(as, assetSet, []string{"namespace"}, a.LabelConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]float64{"web/__external__": 24.0, "db/__external__": 5.0}
+	externals := as.ExternalAllocations()
+	if len(externals) != len(expected) {
+		t.Fatalf("expected %d external allocations; got %d", len(expected), len(externals))
+	}
+	for name, cost := range expected {
+		alloc, ok := externals[name]
+		if !ok {
+			t.Fatalf("missing external allocation %s", name)
+		}
+		if math.Abs(alloc.TotalCost()-cost) > 1e-9 {
+			t.Fatalf("%s: expected total cost %f; got %f", name, cost, alloc.TotalCost())
+		}
+	}
+
+	// Labels configured as Kubernetes concepts match their external labels
+	as = kubecost.NewAllocationSet(start, end)
+	err = insertExternalAllocations(as, assetSet, []string{"label:env"}, a.LabelConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	externals = as.ExternalAllocations()
+	if alloc, ok := externals["env=prod/__external__"]; !ok || len(externals) != 1 || alloc.TotalCost() != 5.0 {
+		t.Fatalf("expected one external allocation env=prod/__external__ costing 5; got %v", externals)
+	}
+}
+
+func TestComputeExternalAssets_SubDay(t *testing.T) {
+	day1 := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+
+	provider := &mockExternalProvider{
+		newAssets: func() []*kubecost.Cloud {
+			return []*kubecost.Cloud{
+				newMockExternalAsset("", day1, 24.0, map[string]string{"kubernetes_namespace": "web", "namespace": "web"}),
+				newMockExternalAsset("", day2, 48.0, map[string]string{"kubernetes_namespace": "web", "namespace": "web"}),
+			}
+		},
+	}
+	a := &Accesses{
+		LabelConfig:         &kubecost.LabelConfig{},
+		CloudProvider:       provider,
+		ExternalAssetsCache: cache.New(time.Hour, time.Hour),
+	}
+
+	// Six hours of the first day, in a non-UTC zone, are queried as the whole
+	// UTC day, and prorated only once
+	loc := time.FixedZone("", -7*60*60)
+	start := time.Date(2021, time.February, 28, 23, 0, 0, 0, loc)
+	end := start.Add(6 * time.Hour)
+	assetSet, err := a.computeExternalAssets(start, end)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(provider.queries) != 1 || !provider.queries[0].Start().Equal(day1) || !provider.queries[0].End().Equal(day2) {
+		t.Fatalf("expected query of %s to %s; got %v", day1, day2, provider.queries)
+	}
+	if math.Abs(assetSet.TotalCost()-6.0) > 1e-9 {
+		t.Fatalf("expected total cost 6; got %f", assetSet.TotalCost())
+	}
+
+	// Retrieved assets are cached, and not modified by proration, so steps of
+	// the same days are assigned their share of the same costs
+	for h := 0; h < 48; h += 12 {
+		stepStart := day1.Add(time.Duration(h) * time.Hour)
+		stepEnd := stepStart.Add(12 * time.Hour)
+
+		assetSet, err = a.computeExternalAssets(stepStart, stepEnd)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		expected := 12.0
+		if h >= 24 {
+			expected = 24.0
+		}
+		if math.Abs(assetSet.TotalCost()-expected) > 1e-9 {
+			t.Fatalf("step %s: expected total cost %f; got %f", stepStart, expected, assetSet.TotalCost())
+		}
+	}
+	if len(provider.queries) != 2 {
+		t.Fatalf("expected one query per day; got %d queries", len(provider.queries))
+	}
+}
+
+func TestLoadLabelConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "labels")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "labels.json")
+
+	lc, err := LoadLabelConfig(configPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if lc.ExternalQueryLabels()["kubernetes_namespace"] != "namespace_external_label" {
+		t.Fatalf("expected default external labels; got %v", lc.ExternalQueryLabels())
+	}
+
+	err = ioutil.WriteFile(configPath, []byte(`{"namespace_external_label": "ns", "environment_label": "stage"}`), 0644)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lc, err = LoadLabelConfig(configPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if lc.ExternalQueryLabels()["ns"] != "namespace_external_label" {
+		t.Fatalf("expected configured external labels; got %v", lc.ExternalQueryLabels())
+	}
+	if externalAllocationLabels(lc)["stage"] != "environment" {
+		t.Fatalf("expected \"stage\" to map to \"environment\"; got %v", externalAllocationLabels(lc))
+	}
+}
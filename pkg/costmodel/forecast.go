@@ -0,0 +1,363 @@
+package costmodel
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+// Defaults for forecasting, which projects the next 30 days of spend from
+// the past 28 days, within a 90% confidence interval.
+const (
+	DefaultForecastWindow     = "28d"
+	DefaultForecastDays       = 30
+	DefaultForecastConfidence = 0.9
+)
+
+// forecastSeasonalDays is the number of days of history required to fit a
+// day-of-week pattern; i.e. two observations of each day of the week.
+const forecastSeasonalDays = 14
+
+// ForecastPoint is the actual or forecast cost of a day. Forecasts give the
+// range, Lower to Upper, within which the cost is expected to fall.
+type ForecastPoint struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Cost  float64   `json:"cost"`
+	Lower float64   `json:"lower"`
+	Upper float64   `json:"upper"`
+}
+
+// Forecast projects the daily cost of an aggregated allocation, from a linear
+// trend and, given enough history, the day of the week.
+type Forecast struct {
+	Name     string           `json:"name"`
+	Actuals  []*ForecastPoint `json:"actuals"`
+	Forecast []*ForecastPoint `json:"forecast"`
+
+	// TotalCost is the forecast cost over all forecast days, expected to fall
+	// between TotalLower and TotalUpper
+	TotalCost  float64 `json:"totalCost"`
+	TotalLower float64 `json:"totalLower"`
+	TotalUpper float64 `json:"totalUpper"`
+
+	// Trend is the fitted change in daily cost per day
+	Trend    float64 `json:"trend"`
+	Seasonal bool    `json:"seasonal"`
+}
+
+// ForecastReport lists the forecast of each aggregated allocation, and of
+// their total.
+type ForecastReport struct {
+	Days       int         `json:"days"`
+	Confidence float64     `json:"confidence"`
+	Total      *Forecast   `json:"total"`
+	Forecasts  []*Forecast `json:"forecasts"`
+}
+
+// ComputeForecast queries daily allocations for the given query, and forecasts
+// the cost of each aggregated allocation, and of their total, for the given
+// number of days following the query's window, within the given confidence.
+// The window is rounded to whole days, excluding the current, partial day.
+func (a *Accesses) ComputeForecast(q *allocationQuery, days int, confidence float64) (*ForecastReport, error) {
+	if q.window.IsOpen() || q.window.IsNegative() {
+		return nil, fmt.Errorf("illegal window: %s", q.window)
+	}
+
+	start, end := *q.window.Start(), *q.window.End()
+	if now := time.Now().In(end.Location()); end.After(now) {
+		end = now
+	}
+	start = kubecost.RoundBack(start, 24*time.Hour)
+	end = kubecost.RoundBack(end, 24*time.Hour)
+	if !end.After(start) {
+		return nil, fmt.Errorf("illegal window: %s does not contain a whole day", q.window)
+	}
+
+	q.window = kubecost.NewWindow(&start, &end)
+	q.step = 24 * time.Hour
+	q.accumulate = false
+
+	asr, err := a.queryAllocation(q)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildForecastReport(asr, days, confidence), nil
+}
+
+// buildForecastReport forecasts the daily cost of each allocation name in the
+// given range of daily sets, missing days costing nothing.
+func buildForecastReport(asr *kubecost.AllocationSetRange, days int, confidence float64) *ForecastReport {
+	report := &ForecastReport{
+		Days:       days,
+		Confidence: confidence,
+		Forecasts:  []*Forecast{},
+	}
+
+	n := asr.Length()
+	if n == 0 {
+		return report
+	}
+
+	var starts []time.Time
+	costs := map[string][]float64{}
+	totals := make([]float64, n)
+
+	asr.Each(func(i int, as *kubecost.AllocationSet) {
+		starts = append(starts, as.Start())
+		as.Each(func(name string, alloc *kubecost.Allocation) {
+			if _, ok := costs[name]; !ok {
+				costs[name] = make([]float64, n)
+			}
+			costs[name][i] += alloc.TotalCost()
+			totals[i] += alloc.TotalCost()
+		})
+	})
+
+	z := math.Sqrt2 * math.Erfinv(confidence)
+
+	report.Total = forecastCosts("total", starts, totals, days, z)
+	for name, cs := range costs {
+		report.Forecasts = append(report.Forecasts, forecastCosts(name, starts, cs, days, z))
+	}
+
+	sort.Slice(report.Forecasts, func(i, j int) bool {
+		if report.Forecasts[i].TotalCost != report.Forecasts[j].TotalCost {
+			return report.Forecasts[i].TotalCost > report.Forecasts[j].TotalCost
+		}
+		return report.Forecasts[i].Name < report.Forecasts[j].Name
+	})
+
+	return report
+}
+
+// forecastCosts fits the given daily costs, of consecutive days beginning at
+// the given starts, by least squares to an intercept, a linear trend, and,
+// given two weeks of history, an offset for each day of the week. It projects
+// the given number of following days, with prediction intervals of z standard
+// errors, both for each day and for their total. Negative costs are clamped
+// to zero.
+func forecastCosts(name string, starts []time.Time, costs []float64, days int, z float64) *Forecast {
+	n := len(costs)
+	f := &Forecast{
+		Name:     name,
+		Actuals:  make([]*ForecastPoint, n),
+		Forecast: make([]*ForecastPoint, days),
+		Seasonal: n >= forecastSeasonalDays,
+	}
+	for i, cost := range costs {
+		f.Actuals[i] = &ForecastPoint{Start: starts[i], End: starts[i].Add(24 * time.Hour), Cost: cost, Lower: cost, Upper: cost}
+	}
+
+	// The features of day t, counting from the first day of history: an
+	// intercept, t, and, if seasonal, indicators of the day of the week,
+	// excluding that of the first day
+	features := func(t int) []float64 {
+		x := []float64{1.0}
+		if n > 1 {
+			x = append(x, float64(t))
+		}
+		if f.Seasonal {
+			for d := 1; d < 7; d++ {
+				if t%7 == d {
+					x = append(x, 1.0)
+				} else {
+					x = append(x, 0.0)
+				}
+			}
+		}
+		return x
+	}
+	p := len(features(0))
+
+	// Solve the normal equations, (X'X)b = X'y
+	xtx := make([][]float64, p)
+	for i := range xtx {
+		xtx[i] = make([]float64, p)
+	}
+	xty := make([]float64, p)
+	for t, y := range costs {
+		x := features(t)
+		for i := 0; i < p; i++ {
+			xty[i] += x[i] * y
+			for j := 0; j < p; j++ {
+				xtx[i][j] += x[i] * x[j]
+			}
+		}
+	}
+
+	beta, ok := solveLinearSystem(xtx, xty)
+	if !ok {
+		// Fall back to the mean, without a trend or seasonality
+		beta = make([]float64, p)
+		for _, y := range costs {
+			beta[0] += y / float64(n)
+		}
+		f.Seasonal = false
+	}
+	if p > 1 {
+		f.Trend = beta[1]
+	}
+
+	predict := func(x []float64) float64 {
+		y := 0.0
+		for i := range x {
+			y += x[i] * beta[i]
+		}
+		return y
+	}
+
+	// Estimate the standard deviation of daily costs about the fit
+	sigma := 0.0
+	if ok && n > p {
+		sse := 0.0
+		for t, y := range costs {
+			e := y - predict(features(t))
+			sse += e * e
+		}
+		sigma = math.Sqrt(sse / float64(n-p))
+	}
+
+	// variance returns the variance of the fitted value at x, relative to
+	// that of a single day; i.e. x'(X'X)^-1 x
+	variance := func(x []float64) float64 {
+		if !ok {
+			return 0.0
+		}
+		v, solved := solveLinearSystem(xtx, x)
+		if !solved {
+			return 0.0
+		}
+		s := 0.0
+		for i := range x {
+			s += x[i] * v[i]
+		}
+		return s
+	}
+
+	end := starts[n-1].Add(24 * time.Hour)
+	sum := make([]float64, p)
+	for h := 0; h < days; h++ {
+		x := features(n + h)
+		for i := range x {
+			sum[i] += x[i]
+		}
+
+		cost := predict(x)
+		se := sigma * math.Sqrt(1.0+variance(x))
+		start := end.Add(time.Duration(h) * 24 * time.Hour)
+		f.Forecast[h] = &ForecastPoint{
+			Start: start,
+			End:   start.Add(24 * time.Hour),
+			Cost:  math.Max(0.0, cost),
+			Lower: math.Max(0.0, cost-z*se),
+			Upper: math.Max(0.0, cost+z*se),
+		}
+		f.TotalCost += cost
+	}
+
+	// The total's errors are those of each day, plus that of the fit, which
+	// is common to every day
+	se := sigma * math.Sqrt(float64(days)+variance(sum))
+	f.TotalLower = math.Max(0.0, f.TotalCost-z*se)
+	f.TotalUpper = math.Max(0.0, f.TotalCost+z*se)
+	f.TotalCost = math.Max(0.0, f.TotalCost)
+
+	return f
+}
+
+// solveLinearSystem solves Ax = b by Gaussian elimination with partial
+// pivoting, returning false if A is singular. A and b are not modified.
+func solveLinearSystem(a [][]float64, b []float64) ([]float64, bool) {
+	n := len(b)
+	m := make([][]float64, n)
+	for i := range a {
+		m[i] = make([]float64, n+1)
+		copy(m[i], a[i])
+		m[i][n] = b[i]
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return nil, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+
+		for row := col + 1; row < n; row++ {
+			factor := m[row][col] / m[col][col]
+			for k := col; k <= n; k++ {
+				m[row][k] -= factor * m[col][k]
+			}
+		}
+	}
+
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		s := m[row][n]
+		for k := row + 1; k < n; k++ {
+			s -= m[row][k] * x[k]
+		}
+		x[row] = s / m[row][row]
+	}
+
+	return x, true
+}
+
+// ForecastHandler forecasts daily costs, by aggregation, from the daily costs
+// of the given window. It accepts the parameters of /allocation, except step
+// and accumulate; e.g. "aggregate=cluster&idle=true" forecasts the full cost
+// of each cluster.
+func (a *Accesses) ForecastHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Window is an optional parameter, defaulting to the past 28 days, of
+	// history from which costs are forecast.
+	values := r.URL.Query()
+	if values.Get("window") == "" {
+		values.Set("window", DefaultForecastWindow)
+	}
+	qp := util.NewQueryParams(values)
+
+	query, err := a.parseAllocationQuery(qp)
+	if err != nil {
+		writeAllocationQueryError(w, err)
+		return
+	}
+
+	// Days is an optional parameter, defaulting to 30, of the number of days
+	// to forecast.
+	days := qp.GetInt("days", DefaultForecastDays)
+	if days < 1 || days > 366 {
+		http.Error(w, fmt.Sprintf("Invalid 'days' parameter: %s", qp.Get("days", "")), http.StatusBadRequest)
+		return
+	}
+
+	// Confidence is an optional parameter, defaulting to 90, of the
+	// percentage of costs expected to fall within each forecast's range.
+	confidence := qp.GetFloat64("confidence", DefaultForecastConfidence*100.0) / 100.0
+	if confidence <= 0.0 || confidence >= 1.0 {
+		http.Error(w, fmt.Sprintf("Invalid 'confidence' parameter: %s", qp.Get("confidence", "")), http.StatusBadRequest)
+		return
+	}
+
+	report, err := a.ComputeForecast(query, days, confidence)
+	if err != nil {
+		WriteError(w, InternalServerError(err.Error()))
+		return
+	}
+
+	w.Write(WrapData(report, nil))
+}
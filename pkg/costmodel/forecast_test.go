@@ -0,0 +1,116 @@
+package costmodel
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+func TestForecastCosts(t *testing.T) {
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	startsOf := func(n int) []time.Time {
+		starts := make([]time.Time, n)
+		for i := range starts {
+			starts[i] = start.AddDate(0, 0, i)
+		}
+		return starts
+	}
+
+	// Four weeks growing by $2 per day, $30 cheaper on the sixth and seventh
+	// days of each week, are fit exactly
+	costs := make([]float64, 28)
+	for i := range costs {
+		costs[i] = 100.0 + 2.0*float64(i)
+		if i%7 == 5 || i%7 == 6 {
+			costs[i] -= 30.0
+		}
+	}
+
+	f := forecastCosts("web", startsOf(28), costs, 7, 1.645)
+	if !f.Seasonal || !util.IsApproximately(f.Trend, 2.0) {
+		t.Fatalf("expected seasonal fit with trend 2.0; got %+v", f)
+	}
+	if len(f.Actuals) != 28 || len(f.Forecast) != 7 {
+		t.Fatalf("expected 28 actuals and 7 forecasts; got %d and %d", len(f.Actuals), len(f.Forecast))
+	}
+	if p := f.Forecast[0]; !p.Start.Equal(start.AddDate(0, 0, 28)) || !util.IsApproximately(p.Cost, 156.0) {
+		t.Fatalf("unexpected forecast: %+v", p)
+	}
+	if p := f.Forecast[5]; !util.IsApproximately(p.Cost, 136.0) || !util.IsApproximately(p.Lower, p.Upper) {
+		t.Fatalf("unexpected forecast: %+v", p)
+	}
+	if !util.IsApproximately(f.TotalCost, 1074.0) || !util.IsApproximately(f.TotalLower, f.TotalUpper) {
+		t.Fatalf("unexpected total: %f (%f, %f)", f.TotalCost, f.TotalLower, f.TotalUpper)
+	}
+
+	// Ten noisy days are too few to fit the day of the week
+	costs = make([]float64, 10)
+	for i := range costs {
+		costs[i] = 10.0 + math.Pow(-1.0, float64(i))
+	}
+
+	f = forecastCosts("web", startsOf(10), costs, 7, 1.645)
+	if f.Seasonal {
+		t.Fatalf("expected no seasonality")
+	}
+	for _, p := range f.Forecast {
+		if !(p.Lower < p.Cost && p.Cost < p.Upper) {
+			t.Fatalf("expected cost within interval; got %+v", p)
+		}
+	}
+	if f.TotalUpper-f.TotalLower <= f.Forecast[0].Upper-f.Forecast[0].Lower {
+		t.Fatalf("expected total interval wider than a day's")
+	}
+
+	// A single day forecasts itself
+	f = forecastCosts("web", startsOf(1), []float64{5.0}, 2, 1.645)
+	if f.Forecast[1].Cost != 5.0 || f.TotalCost != 10.0 || f.Trend != 0.0 {
+		t.Fatalf("unexpected forecast: %+v", f)
+	}
+}
+
+func TestBuildForecastReport(t *testing.T) {
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	asr := kubecost.NewAllocationSetRange()
+	for i := 0; i < 3; i++ {
+		s := start.AddDate(0, 0, i)
+		e := s.AddDate(0, 0, 1)
+		as := kubecost.NewAllocationSet(s, e,
+			&kubecost.Allocation{Name: "web", Start: s, End: e, CPUCost: 10.0},
+		)
+		// Batch runs on the first day only
+		if i == 0 {
+			as.Set(&kubecost.Allocation{Name: "batch", Start: s, End: e, CPUCost: 3.0})
+		}
+		asr.Append(as)
+	}
+
+	report := buildForecastReport(asr, 2, 0.9)
+	if report.Days != 2 || report.Confidence != 0.9 || len(report.Forecasts) != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if web := report.Forecasts[0]; web.Name != "web" || !util.IsApproximately(web.TotalCost, 20.0) {
+		t.Fatalf("unexpected forecast: %+v", web)
+	}
+	if batch := report.Forecasts[1]; batch.Name != "batch" || batch.Actuals[1].Cost != 0.0 || batch.Trend >= 0.0 {
+		t.Fatalf("unexpected forecast: %+v", batch)
+	}
+	if report.Total.Actuals[0].Cost != 13.0 || report.Total.Actuals[2].Cost != 10.0 {
+		t.Fatalf("unexpected total: %+v", report.Total)
+	}
+}
+
+func TestSolveLinearSystem(t *testing.T) {
+	x, ok := solveLinearSystem([][]float64{{0.0, 2.0}, {1.0, 1.0}}, []float64{4.0, 3.0})
+	if !ok || !util.IsApproximately(x[0], 1.0) || !util.IsApproximately(x[1], 2.0) {
+		t.Fatalf("expected (1, 2); got %v", x)
+	}
+
+	if _, ok := solveLinearSystem([][]float64{{1.0, 2.0}, {2.0, 4.0}}, []float64{1.0, 2.0}); ok {
+		t.Fatalf("expected singular system")
+	}
+}
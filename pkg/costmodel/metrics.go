@@ -546,6 +546,7 @@ var (
 	ramGv                      *prometheus.GaugeVec
 	gpuGv                      *prometheus.GaugeVec
 	gpuCountGv                 *prometheus.GaugeVec
+	gpuShareGv                 *prometheus.GaugeVec
 	pvGv                       *prometheus.GaugeVec
 	spotGv                     *prometheus.GaugeVec
 	totalGv                    *prometheus.GaugeVec
@@ -583,6 +584,11 @@ func initCostModelMetrics(clusterCache clustercache.ClusterCache, provider cloud
 			Help: "node_gpu_count count of gpu on this node",
 		}, []string{"instance", "node", "instance_type", "region", "provider_id"})
 
+		gpuShareGv = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kubecost_node_gpu_share",
+			Help: "kubecost_node_gpu_share fraction of a gpu represented by one unit of a gpu resource, e.g. a MIG profile or time-sliced gpu, on this node",
+		}, []string{"instance", "node", "resource"})
+
 		pvGv = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Name: "pv_hourly_cost",
 			Help: "pv_hourly_cost Cost per GB per hour on a persistent disk",
@@ -644,7 +650,7 @@ func initCostModelMetrics(clusterCache clustercache.ClusterCache, provider cloud
 		}, []string{"ingress_ip", "namespace", "service_name"}) // assumes one ingress IP per load balancer
 
 		// Register cost-model metrics for emission
-		prometheus.MustRegister(cpuGv, ramGv, gpuGv, gpuCountGv, totalGv, pvGv, spotGv)
+		prometheus.MustRegister(cpuGv, ramGv, gpuGv, gpuCountGv, gpuShareGv, totalGv, pvGv, spotGv)
 		prometheus.MustRegister(ramAllocGv, cpuAllocGv, gpuAllocGv, pvAllocGv)
 		prometheus.MustRegister(networkZoneEgressCostG, networkRegionEgressCostG, networkInternetEgressCostG)
 		prometheus.MustRegister(clusterManagementCostGv, lbCostGv)
@@ -696,6 +702,7 @@ type CostModelMetricsEmitter struct {
 	PersistentVolumePriceRecorder *prometheus.GaugeVec
 	GPUPriceRecorder              *prometheus.GaugeVec
 	GPUCountRecorder              *prometheus.GaugeVec
+	GPUShareRecorder              *prometheus.GaugeVec
 	PVAllocationRecorder          *prometheus.GaugeVec
 	NodeSpotRecorder              *prometheus.GaugeVec
 	NodeTotalPriceRecorder        *prometheus.GaugeVec
@@ -728,6 +735,7 @@ func NewCostModelMetricsEmitter(promClient promclient.Client, clusterCache clust
 		RAMPriceRecorder:              ramGv,
 		GPUPriceRecorder:              gpuGv,
 		GPUCountRecorder:              gpuCountGv,
+		GPUShareRecorder:              gpuShareGv,
 		PersistentVolumePriceRecorder: pvGv,
 		NodeSpotRecorder:              spotGv,
 		NodeTotalPriceRecorder:        totalGv,
@@ -785,6 +793,7 @@ func (cmme *CostModelMetricsEmitter) Start() bool {
 
 		containerSeen := make(map[string]bool)
 		nodeSeen := make(map[string]bool)
+		gpuShareSeen := make(map[string]bool)
 		loadBalancerSeen := make(map[string]bool)
 		pvSeen := make(map[string]bool)
 		pvcSeen := make(map[string]bool)
@@ -903,6 +912,14 @@ func (cmme *CostModelMetricsEmitter) Start() bool {
 				}
 				labelKey := getKeyFromLabelStrings(nodeName, nodeName, nodeType, nodeRegion, node.ProviderID)
 				nodeSeen[labelKey] = true
+
+				// Resources are labeled as by kube-state-metrics, for matching
+				// to resource requests
+				for resource, share := range node.GPUShares {
+					resource = cloud.SanitizeResourceName(resource)
+					cmme.GPUShareRecorder.WithLabelValues(nodeName, nodeName, resource).Set(share)
+					gpuShareSeen[getKeyFromLabelStrings(nodeName, nodeName, resource)] = true
+				}
 			}
 
 			// TODO: Pass CloudProvider into CostModel on instantiation so this isn't so awkward
@@ -1043,6 +1060,15 @@ func (cmme *CostModelMetricsEmitter) Start() bool {
 					nodeSeen[labelString] = false
 				}
 			}
+			for labelString, seen := range gpuShareSeen {
+				if !seen {
+					labels := getLabelStringsFromKey(labelString)
+					cmme.GPUShareRecorder.DeleteLabelValues(labels...)
+					delete(gpuShareSeen, labelString)
+				} else {
+					gpuShareSeen[labelString] = false
+				}
+			}
 			for labelString, seen := range loadBalancerSeen {
 				if !seen {
 					labels := getLabelStringsFromKey(labelString)
@@ -0,0 +1,503 @@
+package costmodel
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+// Defaults for node sizing, which fills nodes to no more than 90% of their
+// capacity, and recommends a pool of at least one node.
+const (
+	DefaultNodeSizingHeadroom = 0.1
+	DefaultNodeSizingMinNodes = 1
+	nodeSizingAlternatives    = 5
+)
+
+// Node labels, as exported to Prometheus, which identify a node's region
+var nodeRegionLabels = []string{
+	"label_topology_kubernetes_io_region",
+	"label_failure_domain_beta_kubernetes_io_region",
+}
+
+// NodeSizingConfig configures the computation of node sizing
+// recommendations.
+type NodeSizingConfig struct {
+	// Headroom is the fraction of each node's capacity left unrequested
+	Headroom float64
+
+	// MinNodes is the minimum number of nodes recommended for a pool
+	MinNodes int
+}
+
+// NodeShape is an instance type of which a node pool may be composed.
+type NodeShape struct {
+	InstanceType string  `json:"instanceType"`
+	CPUCores     float64 `json:"cpuCores"`
+	RAMBytes     float64 `json:"ramBytes"`
+	HourlyCost   float64 `json:"hourlyCost"`
+}
+
+// NodePool is a number of nodes of a single NodeShape, which fits the pod
+// requests of a cluster at the given utilization of its resources.
+type NodePool struct {
+	Shape          NodeShape `json:"shape"`
+	Count          int       `json:"count"`
+	MonthlyCost    float64   `json:"monthlyCost"`
+	CPUUtilization float64   `json:"cpuUtilization"`
+	RAMUtilization float64   `json:"ramUtilization"`
+}
+
+// NodeSizingRecommendation compares the current nodes of a cluster to the
+// cheapest NodePool able to fit the cluster's pod requests, and lists the
+// next-cheapest alternatives. Node counts of the current nodes are averages
+// over the window. ProviderCatalog is false if only the current instance
+// types were compared, as the provider's catalog offered none in the
+// cluster's region.
+type NodeSizingRecommendation struct {
+	Cluster            string             `json:"cluster"`
+	CurrentNodeCount   float64            `json:"currentNodeCount"`
+	CurrentNodeTypes   map[string]float64 `json:"currentNodeTypes"`
+	CurrentMonthlyCost float64            `json:"currentMonthlyCost"`
+	CPUCoresRequested  float64            `json:"cpuCoresRequested"`
+	RAMBytesRequested  float64            `json:"ramBytesRequested"`
+	ProviderCatalog    bool               `json:"providerCatalog"`
+	Recommended        *NodePool          `json:"recommended"`
+	Alternatives       []*NodePool        `json:"alternatives"`
+	MonthlySavings     float64            `json:"monthlySavings"`
+}
+
+// podRequests are the CPU and RAM requested by a pod, or by the pods of a
+// DaemonSet on each node.
+type podRequests struct {
+	CPUCores float64
+	RAMBytes float64
+}
+
+// clusterRequests are the pod requests of a cluster to be fit onto nodes.
+// DaemonSet requests are counted once per node.
+type clusterRequests struct {
+	pods    []podRequests
+	perNode podRequests
+}
+
+// ComputeNodeSizing recommends, for each cluster, the cheapest pool of a
+// single instance type which fits the pod requests observed over the given
+// window. Candidate instance types include those of the cluster's current
+// nodes and every instance type of the provider's catalog offered in the
+// cluster's region: AWS instance types, GCP predefined machine types, OCI
+// flexible shapes and DigitalOcean droplets. Azure, Alibaba Cloud and custom
+// pricing have no catalog, so only the current instance types are compared.
+// Nodes and pods using GPUs are excluded.
+func (a *Accesses) ComputeNodeSizing(window kubecost.Window, config NodeSizingConfig) ([]*NodeSizingRecommendation, error) {
+	if window.IsOpen() || window.IsNegative() {
+		return nil, fmt.Errorf("illegal window: %s", window)
+	}
+	start, end := *window.Start(), *window.End()
+
+	duration, offset, err := window.DurationOffset()
+	if err != nil {
+		return nil, fmt.Errorf("illegal window: %s", err)
+	}
+	if offset < 0 {
+		duration = duration + offset
+		offset = 0
+	}
+
+	nodes, err := ClusterNodes(a.CloudProvider, a.PrometheusClient, duration, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error computing nodes: %s", err)
+	}
+
+	as, err := a.computeAllocation(start, end, env.GetETLResolution())
+	if err != nil {
+		return nil, fmt.Errorf("error computing allocation: %s", err)
+	}
+
+	var catalog map[string][]NodeShape
+	if shapes, err := a.CloudProvider.InstanceShapes(); err == nil {
+		catalog = nodeShapesFromCatalog(shapes)
+	}
+
+	return buildNodeSizingRecommendations(nodes, as, catalog, config), nil
+}
+
+// nodeShapesFromCatalog returns the given instance shapes by region, as
+// NodeShapes. Shapes offered in every region are keyed by the empty region.
+// Instance types with GPUs are excluded.
+func nodeShapesFromCatalog(catalog []*cloud.InstanceShape) map[string][]NodeShape {
+	shapes := map[string][]NodeShape{}
+
+	for _, shape := range catalog {
+		if shape.GPUs > 0 || shape.CPUCores <= 0 || shape.RAMBytes <= 0 || shape.HourlyCost <= 0 {
+			continue
+		}
+		shapes[shape.Region] = append(shapes[shape.Region], NodeShape{
+			InstanceType: shape.InstanceType,
+			CPUCores:     shape.CPUCores,
+			RAMBytes:     shape.RAMBytes,
+			HourlyCost:   shape.HourlyCost,
+		})
+	}
+
+	return shapes
+}
+
+// buildNodeSizingRecommendations recommends a NodePool for each cluster of
+// the given nodes, fitting the pod requests of the given AllocationSet.
+// Candidate shapes are the instance types of the cluster's nodes, at their
+// observed cost, and those of the given catalog in the cluster's region or
+// in every region.
+// Recommended costs are discounted at the average discount of the cluster's
+// nodes, so that they are comparable to the current cost.
+func buildNodeSizingRecommendations(nodes map[NodeIdentifier]*Node, as *kubecost.AllocationSet, catalog map[string][]NodeShape, config NodeSizingConfig) []*NodeSizingRecommendation {
+	windowHours := as.End().Sub(as.Start()).Hours()
+	if windowHours <= 0 {
+		return []*NodeSizingRecommendation{}
+	}
+
+	requests := buildClusterRequests(as)
+
+	recs := []*NodeSizingRecommendation{}
+
+	clusters := map[string][]*Node{}
+	for _, node := range nodes {
+		if node.GPUCount > 0 || node.Minutes <= 0 {
+			continue
+		}
+		clusters[node.Cluster] = append(clusters[node.Cluster], node)
+	}
+
+	for cluster, clusterNodes := range clusters {
+		rec := &NodeSizingRecommendation{
+			Cluster:          cluster,
+			CurrentNodeTypes: map[string]float64{},
+			Alternatives:     []*NodePool{},
+		}
+
+		// Observed shapes, by instance type, at their average hourly cost,
+		// and the cost-weighted discount of the cluster's nodes
+		shapes := map[string]NodeShape{}
+		shapeHours := map[string]float64{}
+		listCost, discountedCost := 0.0, 0.0
+		region := ""
+
+		for _, node := range clusterNodes {
+			count := node.Minutes / 60.0 / windowHours
+			cost := node.CPUCost + node.RAMCost
+
+			rec.CurrentNodeCount += count
+			rec.CurrentNodeTypes[node.NodeType] += count
+			listCost += cost
+			discountedCost += cost * (1.0 - node.Discount)
+
+			if region == "" {
+				region = nodeRegion(node.Labels)
+			}
+
+			if node.NodeType != "" && node.CPUCores > 0 && node.RAMBytes > 0 {
+				shape := shapes[node.NodeType]
+				shape.InstanceType = node.NodeType
+				shape.CPUCores = math.Max(shape.CPUCores, node.CPUCores)
+				shape.RAMBytes = math.Max(shape.RAMBytes, node.RAMBytes)
+				shape.HourlyCost += cost
+				shapes[node.NodeType] = shape
+				shapeHours[node.NodeType] += node.Minutes / 60.0
+			}
+		}
+		for instanceType, shape := range shapes {
+			shape.HourlyCost /= shapeHours[instanceType]
+			shapes[instanceType] = shape
+		}
+		rec.CurrentMonthlyCost = discountedCost / windowHours * util.HoursPerMonth
+
+		discount := 0.0
+		if listCost > 0 {
+			discount = 1.0 - discountedCost/listCost
+		}
+
+		// Catalog shapes replace observed shapes of the same instance type,
+		// as they are not subject to partial-hour billing artifacts
+		for _, r := range []string{region, ""} {
+			for _, shape := range catalog[r] {
+				shapes[shape.InstanceType] = shape
+				rec.ProviderCatalog = true
+			}
+		}
+
+		reqs := requests[cluster]
+		if reqs == nil {
+			reqs = &clusterRequests{}
+		}
+		for _, pod := range reqs.pods {
+			rec.CPUCoresRequested += pod.CPUCores
+			rec.RAMBytesRequested += pod.RAMBytes
+		}
+
+		pools := []*NodePool{}
+		for _, shape := range shapes {
+			pool := fitNodePool(shape, reqs, config)
+			if pool == nil {
+				continue
+			}
+			pool.MonthlyCost *= 1.0 - discount
+			pools = append(pools, pool)
+		}
+
+		sort.Slice(pools, func(i, j int) bool {
+			if pools[i].MonthlyCost != pools[j].MonthlyCost {
+				return pools[i].MonthlyCost < pools[j].MonthlyCost
+			}
+			return pools[i].Shape.InstanceType < pools[j].Shape.InstanceType
+		})
+
+		if len(pools) > 0 {
+			rec.Recommended = pools[0]
+			rec.MonthlySavings = rec.CurrentMonthlyCost - pools[0].MonthlyCost
+
+			alternatives := pools[1:]
+			if len(alternatives) > nodeSizingAlternatives {
+				alternatives = alternatives[:nodeSizingAlternatives]
+			}
+			rec.Alternatives = alternatives
+		}
+
+		recs = append(recs, rec)
+	}
+
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].Cluster < recs[j].Cluster
+	})
+
+	return recs
+}
+
+// buildClusterRequests returns the pod requests of each cluster of the given
+// AllocationSet. Each controller contributes as many pods as it ran on
+// average, rounded up, each requesting the most of any of its pods. Each
+// DaemonSet contributes the most any of its pods requested to every node.
+// Pods requesting GPUs are excluded.
+func buildClusterRequests(as *kubecost.AllocationSet) map[string]*clusterRequests {
+	windowMinutes := as.End().Sub(as.Start()).Minutes()
+
+	type pod struct {
+		cluster  string
+		kind     string
+		owner    string
+		minutes  float64
+		requests podRequests
+		gpu      bool
+	}
+
+	pods := map[podKey]*pod{}
+
+	as.Each(func(name string, alloc *kubecost.Allocation) {
+		if alloc.IsIdle() || alloc.IsUnallocated() || strings.Contains(name, kubecost.UnmountedSuffix) || alloc.Properties == nil {
+			return
+		}
+		props := alloc.Properties
+		if props.Pod == "" {
+			return
+		}
+
+		key := newPodKey(props.Cluster, props.Namespace, props.Pod)
+		if _, ok := pods[key]; !ok {
+			owner := props.Namespace + "/" + props.Pod
+			if props.Controller != "" {
+				owner = props.Namespace + "/" + props.ControllerKind + ":" + props.Controller
+			}
+			pods[key] = &pod{
+				cluster: props.Cluster,
+				kind:    strings.ToLower(props.ControllerKind),
+				owner:   owner,
+			}
+		}
+		p := pods[key]
+
+		if alloc.Minutes() > p.minutes {
+			p.minutes = alloc.Minutes()
+		}
+		p.requests.CPUCores += alloc.CPUCoreRequestAverage
+		p.requests.RAMBytes += alloc.RAMBytesRequestAverage
+		if alloc.GPUHours > 0 {
+			p.gpu = true
+		}
+	})
+
+	// Group pods by owner, then expand each owner into its replicas
+	type owner struct {
+		cluster  string
+		kind     string
+		minutes  float64
+		requests podRequests
+		gpu      bool
+	}
+
+	owners := map[string]*owner{}
+	for _, p := range pods {
+		key := p.cluster + "/" + p.owner
+		if _, ok := owners[key]; !ok {
+			owners[key] = &owner{cluster: p.cluster, kind: p.kind}
+		}
+		o := owners[key]
+
+		o.minutes += p.minutes
+		o.requests.CPUCores = math.Max(o.requests.CPUCores, p.requests.CPUCores)
+		o.requests.RAMBytes = math.Max(o.requests.RAMBytes, p.requests.RAMBytes)
+		o.gpu = o.gpu || p.gpu
+	}
+
+	requests := map[string]*clusterRequests{}
+	for _, o := range owners {
+		if _, ok := requests[o.cluster]; !ok {
+			requests[o.cluster] = &clusterRequests{}
+		}
+		r := requests[o.cluster]
+
+		if o.gpu {
+			continue
+		}
+
+		if o.kind == "daemonset" {
+			r.perNode.CPUCores += o.requests.CPUCores
+			r.perNode.RAMBytes += o.requests.RAMBytes
+			continue
+		}
+
+		replicas := 1
+		if windowMinutes > 0 {
+			replicas = int(math.Ceil(o.minutes/windowMinutes - 1e-9))
+		}
+		for i := 0; i < replicas; i++ {
+			r.pods = append(r.pods, o.requests)
+		}
+	}
+
+	return requests
+}
+
+// fitNodePool returns the NodePool of the given shape which fits the given
+// requests, packing pods onto nodes first-fit in order of decreasing size,
+// or nil if some pod does not fit on a single node.
+func fitNodePool(shape NodeShape, reqs *clusterRequests, config NodeSizingConfig) *NodePool {
+	capCPU := shape.CPUCores*(1.0-config.Headroom) - reqs.perNode.CPUCores
+	capRAM := shape.RAMBytes*(1.0-config.Headroom) - reqs.perNode.RAMBytes
+	if capCPU <= 0 || capRAM <= 0 {
+		return nil
+	}
+
+	size := func(p podRequests) float64 {
+		return math.Max(p.CPUCores/capCPU, p.RAMBytes/capRAM)
+	}
+
+	pods := make([]podRequests, len(reqs.pods))
+	copy(pods, reqs.pods)
+	sort.SliceStable(pods, func(i, j int) bool {
+		return size(pods[i]) > size(pods[j])
+	})
+
+	bins := []podRequests{}
+	for _, p := range pods {
+		if p.CPUCores > capCPU || p.RAMBytes > capRAM {
+			return nil
+		}
+
+		fit := false
+		for i := range bins {
+			if bins[i].CPUCores+p.CPUCores <= capCPU && bins[i].RAMBytes+p.RAMBytes <= capRAM {
+				bins[i].CPUCores += p.CPUCores
+				bins[i].RAMBytes += p.RAMBytes
+				fit = true
+				break
+			}
+		}
+		if !fit {
+			bins = append(bins, p)
+		}
+	}
+
+	count := len(bins)
+	if count < config.MinNodes {
+		count = config.MinNodes
+	}
+	if count == 0 {
+		return nil
+	}
+
+	requestedCPU := float64(count) * reqs.perNode.CPUCores
+	requestedRAM := float64(count) * reqs.perNode.RAMBytes
+	for _, p := range pods {
+		requestedCPU += p.CPUCores
+		requestedRAM += p.RAMBytes
+	}
+
+	return &NodePool{
+		Shape:          shape,
+		Count:          count,
+		MonthlyCost:    float64(count) * shape.HourlyCost * util.HoursPerMonth,
+		CPUUtilization: requestedCPU / (float64(count) * shape.CPUCores),
+		RAMUtilization: requestedRAM / (float64(count) * shape.RAMBytes),
+	}
+}
+
+// nodeRegion returns the region of a node from its Prometheus labels.
+func nodeRegion(labels map[string]string) string {
+	for _, label := range nodeRegionLabels {
+		if region, ok := labels[label]; ok && region != "" {
+			return region
+		}
+	}
+	return ""
+}
+
+// NodeSizingHandler recommends, for each cluster, the cheapest pool of a
+// single instance type which fits the cluster's pod requests, and estimates
+// the monthly savings of adopting it.
+func (a *Accesses) NodeSizingHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	qp := util.NewQueryParams(r.URL.Query())
+
+	// Window is an optional parameter, defaulting to the past week, over
+	// which nodes and pod requests are observed.
+	window, err := kubecost.ParseWindowWithOffset(qp.Get("window", "7d"), env.GetParsedUTCOffset())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid 'window' parameter: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// Headroom is an optional parameter, expressed in percent, of each node's
+	// capacity to leave unrequested.
+	headroom := qp.GetFloat64("headroom", DefaultNodeSizingHeadroom*100.0) / 100.0
+	if headroom < 0.0 || headroom >= 1.0 {
+		http.Error(w, fmt.Sprintf("Invalid 'headroom' parameter: %s", qp.Get("headroom", "")), http.StatusBadRequest)
+		return
+	}
+
+	// MinNodes is an optional parameter defining the minimum size of a pool,
+	// e.g. for availability.
+	minNodes := qp.GetInt("minNodes", DefaultNodeSizingMinNodes)
+	if minNodes < 1 {
+		http.Error(w, fmt.Sprintf("Invalid 'minNodes' parameter: %s", qp.Get("minNodes", "")), http.StatusBadRequest)
+		return
+	}
+
+	recs, err := a.ComputeNodeSizing(window, NodeSizingConfig{
+		Headroom: headroom,
+		MinNodes: minNodes,
+	})
+	if err != nil {
+		WriteError(w, InternalServerError(err.Error()))
+		return
+	}
+
+	w.Write(WrapData(recs, nil))
+}
@@ -0,0 +1,168 @@
+package costmodel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+func TestBuildNodeSizingRecommendations(t *testing.T) {
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	gib := 1024.0 * 1024.0 * 1024.0
+
+	regions := map[string]string{"cluster1": "us-east-1", "cluster2": "us-central1"}
+
+	newNode := func(cluster, name, nodeType string, cores, ramGiB, hourlyCost, discount float64) *Node {
+		return &Node{
+			Cluster:  cluster,
+			Name:     name,
+			NodeType: nodeType,
+			CPUCores: cores,
+			RAMBytes: ramGiB * gib,
+			CPUCost:  hourlyCost * 24.0,
+			Discount: discount,
+			Minutes:  24.0 * 60.0,
+			Labels:   map[string]string{"label_topology_kubernetes_io_region": regions[cluster]},
+		}
+	}
+
+	nodes := map[NodeIdentifier]*Node{}
+	for _, node := range []*Node{
+		newNode("cluster1", "node1", "m5.xlarge", 4.0, 16.0, 0.192, 0.0),
+		newNode("cluster1", "node2", "m5.xlarge", 4.0, 16.0, 0.192, 0.0),
+		newNode("cluster1", "node3", "m5.xlarge", 4.0, 16.0, 0.192, 0.0),
+		newNode("cluster1", "node4", "m5.xlarge", 4.0, 16.0, 0.192, 0.0),
+		newNode("cluster2", "node1", "n1-standard-2", 2.0, 7.5, 0.1, 0.5),
+		newNode("cluster2", "node2", "n1-standard-2", 2.0, 7.5, 0.1, 0.5),
+	} {
+		nodes[NodeIdentifier{Cluster: node.Cluster, Name: node.Name}] = node
+	}
+
+	// GPU nodes are excluded
+	gpu := newNode("cluster1", "gpu1", "p3.2xlarge", 8.0, 61.0, 3.06, 0.0)
+	gpu.GPUCount = 1
+	nodes[NodeIdentifier{Cluster: "cluster1", Name: "gpu1"}] = gpu
+
+	newAlloc := func(kind, controller, pod string, cores, ramGiB, hours float64) *kubecost.Allocation {
+		return &kubecost.Allocation{
+			Name: "cluster1/node1/web/" + pod + "/main",
+			Properties: &kubecost.AllocationProperties{
+				Cluster:        "cluster1",
+				Namespace:      "web",
+				ControllerKind: kind,
+				Controller:     controller,
+				Pod:            pod,
+				Container:      "main",
+			},
+			Start:                  start,
+			End:                    start.Add(time.Duration(hours * float64(time.Hour))),
+			CPUCoreRequestAverage:  cores,
+			RAMBytesRequestAverage: ramGiB * gib,
+		}
+	}
+
+	as := kubecost.NewAllocationSet(start, end,
+		newAlloc("deployment", "api", "api-1", 1.0, 2.0, 24.0),
+		newAlloc("deployment", "api", "api-2", 1.0, 2.0, 24.0),
+		newAlloc("", "", "debug", 0.5, 1.0, 12.0),
+		newAlloc("daemonset", "agent", "agent-1", 0.1, 0.25, 24.0),
+		newAlloc("daemonset", "agent", "agent-2", 0.1, 0.25, 24.0),
+		newAlloc("daemonset", "agent", "agent-3", 0.1, 0.25, 24.0),
+		newAlloc("daemonset", "agent", "agent-4", 0.1, 0.25, 24.0),
+	)
+	train := newAlloc("job", "train", "train-1", 8.0, 32.0, 24.0)
+	train.GPUHours = 24.0
+	as.Set(train)
+
+	catalog := map[string][]NodeShape{
+		"us-east-1": {
+			{InstanceType: "m5.large", CPUCores: 2.0, RAMBytes: 8.0 * gib, HourlyCost: 0.096},
+			{InstanceType: "m5.xlarge", CPUCores: 4.0, RAMBytes: 16.0 * gib, HourlyCost: 0.192},
+			{InstanceType: "c5.large", CPUCores: 2.0, RAMBytes: 4.0 * gib, HourlyCost: 0.085},
+			{InstanceType: "t3.small", CPUCores: 2.0, RAMBytes: 2.0 * gib, HourlyCost: 0.0208},
+		},
+	}
+
+	recs := buildNodeSizingRecommendations(nodes, as, catalog, NodeSizingConfig{Headroom: 0.1, MinNodes: 1})
+	if len(recs) != 2 {
+		t.Fatalf("expected 2 recommendations; got %d", len(recs))
+	}
+
+	// Two api replicas, plus the debug pod, fit on two c5.large nodes
+	// alongside the agent; t3.small cannot fit an api replica
+	rec := recs[0]
+	if rec.Cluster != "cluster1" || rec.CurrentNodeCount != 4.0 || rec.CurrentNodeTypes["m5.xlarge"] != 4.0 {
+		t.Fatalf("unexpected current nodes: %+v", rec)
+	}
+	if !util.IsApproximately(rec.CurrentMonthlyCost, 4.0*0.192*730.0) {
+		t.Fatalf("expected current monthly cost %f; got %f", 4.0*0.192*730.0, rec.CurrentMonthlyCost)
+	}
+	if rec.CPUCoresRequested != 2.5 || rec.RAMBytesRequested != 5.0*gib {
+		t.Fatalf("unexpected requests: %+v", rec)
+	}
+	if !rec.ProviderCatalog {
+		t.Fatalf("expected the catalog of us-east-1 to be used")
+	}
+	if rec.Recommended == nil || rec.Recommended.Shape.InstanceType != "c5.large" || rec.Recommended.Count != 2 {
+		t.Fatalf("expected 2 c5.large nodes; got %+v", rec.Recommended)
+	}
+	if !util.IsApproximately(rec.MonthlySavings, (4.0*0.192-2.0*0.085)*730.0) {
+		t.Fatalf("expected monthly savings %f; got %f", (4.0*0.192-2.0*0.085)*730.0, rec.MonthlySavings)
+	}
+	if !util.IsApproximately(rec.Recommended.CPUUtilization, 2.7/4.0) {
+		t.Fatalf("expected CPU utilization %f; got %f", 2.7/4.0, rec.Recommended.CPUUtilization)
+	}
+	if len(rec.Alternatives) != 2 || rec.Alternatives[0].Shape.InstanceType != "m5.large" || rec.Alternatives[1].Shape.InstanceType != "m5.xlarge" {
+		t.Fatalf("unexpected alternatives: %+v", rec.Alternatives)
+	}
+
+	// Without pods, the cluster needs only the minimum number of nodes of
+	// its own, observed, instance type, at its own discount
+	rec = recs[1]
+	if rec.Cluster != "cluster2" || rec.Recommended == nil || rec.Recommended.Count != 1 || rec.Recommended.Shape.InstanceType != "n1-standard-2" {
+		t.Fatalf("unexpected recommendation: %+v", rec)
+	}
+	if !util.IsApproximately(rec.CurrentMonthlyCost, 73.0) || !util.IsApproximately(rec.MonthlySavings, 36.5) {
+		t.Fatalf("expected current cost 73 and savings 36.5; got %f and %f", rec.CurrentMonthlyCost, rec.MonthlySavings)
+	}
+	if rec.ProviderCatalog {
+		t.Fatalf("expected no catalog outside of us-east-1")
+	}
+
+	// Shapes offered in every region are candidates in every cluster
+	catalog[""] = []NodeShape{
+		{InstanceType: "VM.Standard.E4.Flex (1 OCPU, 4 GB)", CPUCores: 2.0, RAMBytes: 4.0 * gib, HourlyCost: 0.03},
+	}
+	recs = buildNodeSizingRecommendations(nodes, as, catalog, NodeSizingConfig{Headroom: 0.1, MinNodes: 1})
+	for _, rec := range recs {
+		if !rec.ProviderCatalog || rec.Recommended == nil || rec.Recommended.Shape.InstanceType != "VM.Standard.E4.Flex (1 OCPU, 4 GB)" {
+			t.Fatalf("%s: expected shape offered in every region; got %+v", rec.Cluster, rec.Recommended)
+		}
+	}
+}
+
+func TestNodeShapesFromCatalog(t *testing.T) {
+	catalog := []*cloud.InstanceShape{
+		{Region: "us-east-1", InstanceType: "m5.large", CPUCores: 2, RAMBytes: 8.0 * 1024 * 1024 * 1024, HourlyCost: 0.096},
+		{Region: "us-east-1", InstanceType: "p3.2xlarge", CPUCores: 8, RAMBytes: 61.0 * 1024 * 1024 * 1024, GPUs: 1, HourlyCost: 3.06},
+		{Region: "us-east-1", InstanceType: "m5.unpriced", CPUCores: 2, RAMBytes: 8.0 * 1024 * 1024 * 1024},
+		{Region: "us-west-2", InstanceType: "x1.32xlarge", CPUCores: 128, RAMBytes: 1952.0 * 1024 * 1024 * 1024, HourlyCost: 13.338},
+		{InstanceType: "VM.Standard.E4.Flex (1 OCPU, 4 GB)", CPUCores: 2, RAMBytes: 4.0 * 1024 * 1024 * 1024, HourlyCost: 0.031},
+	}
+
+	shapes := nodeShapesFromCatalog(catalog)
+	if len(shapes["us-east-1"]) != 1 || len(shapes["us-west-2"]) != 1 || len(shapes[""]) != 1 {
+		t.Fatalf("expected one shape per region, and one in every region; got %+v", shapes)
+	}
+	if s := shapes["us-east-1"][0]; s.InstanceType != "m5.large" || s.CPUCores != 2.0 || s.RAMBytes != 8.0*1024*1024*1024 || s.HourlyCost != 0.096 {
+		t.Fatalf("unexpected shape: %+v", s)
+	}
+
+	if len(nodeShapesFromCatalog(nil)) != 0 {
+		t.Fatalf("expected no shapes from an empty catalog")
+	}
+}
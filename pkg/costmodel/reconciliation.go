@@ -0,0 +1,298 @@
+package costmodel
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/errors"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/log"
+)
+
+// ReconcilerConfig configures a Reconciler.
+type ReconcilerConfig struct {
+	// Days is the number of most recent complete days of billing data which
+	// are retained, and retrieved again at every refresh, as providers revise
+	// bills for days after the usage
+	Days int
+
+	// RefreshRate is the interval at which billing data is retrieved
+	RefreshRate time.Duration
+}
+
+// billingKey identifies the billed cost of a resource. Provider IDs are
+// lower-cased, as some providers, e.g. Azure, do not preserve their case.
+type billingKey struct {
+	category   string
+	providerID string
+}
+
+// Reconciler periodically retrieves the line items of the cloud provider's
+// bill, and adjusts the cost of each Node, Disk, and LoadBalancer asset to
+// the cost billed for it, so that costs reflect negotiated rates, credits,
+// and other charges that are not reflected by list prices.
+type Reconciler struct {
+	lock     sync.RWMutex
+	retrieve func(start, end time.Time) ([]*cloud.BillingLineItem, error)
+	config   ReconcilerConfig
+	days     map[int64]map[billingKey]float64
+	lastRun  time.Time
+	stop     chan struct{}
+}
+
+// NewReconciler creates a Reconciler, which retrieves billing line items with
+// the given function; e.g. cloud.Provider.BillingLineItems.
+func NewReconciler(retrieve func(start, end time.Time) ([]*cloud.BillingLineItem, error), config ReconcilerConfig) (*Reconciler, error) {
+	if retrieve == nil {
+		return nil, fmt.Errorf("Reconciler: retrieve is nil")
+	}
+	if config.Days < 1 {
+		return nil, fmt.Errorf("Reconciler: must retain at least 1 day; got %d", config.Days)
+	}
+
+	return &Reconciler{
+		retrieve: retrieve,
+		config:   config,
+		days:     map[int64]map[billingKey]float64{},
+	}, nil
+}
+
+// Start retrieves billing data at the configured refresh rate, in the
+// background, until Stop is called.
+func (r *Reconciler) Start() {
+	r.stop = make(chan struct{})
+
+	go func(stop chan struct{}) {
+		defer errors.HandlePanic()
+
+		for {
+			r.Run(time.Now())
+
+			select {
+			case <-stop:
+				return
+			case <-time.After(r.config.RefreshRate):
+			}
+		}
+	}(r.stop)
+}
+
+// Stop stops the background retrieval started by Start.
+func (r *Reconciler) Stop() {
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+// Run retrieves the billing line items of the configured number of complete
+// UTC days preceding the given time, replacing those previously retrieved.
+// Bills lag usage, so only days with line items are retained, excluding the
+// most recent of them, which may still be incomplete. If retrieval fails, the
+// previously retrieved days are kept.
+func (r *Reconciler) Run(now time.Time) {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	first := today.AddDate(0, 0, -r.config.Days)
+
+	items, err := r.retrieve(first, today)
+	if err != nil {
+		log.Warningf("Reconciler: error retrieving billing data: %s", err)
+		return
+	}
+
+	days := map[int64]map[billingKey]float64{}
+	var latest int64
+	for _, item := range items {
+		if item == nil || item.ProviderID == "" {
+			continue
+		}
+
+		start := item.Start.UTC()
+		day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+		if day.Before(first) || !day.Before(today) {
+			continue
+		}
+
+		if _, ok := days[day.Unix()]; !ok {
+			days[day.Unix()] = map[billingKey]float64{}
+		}
+		days[day.Unix()][billingKey{item.Category, strings.ToLower(item.ProviderID)}] += item.Cost
+
+		if day.Unix() > latest {
+			latest = day.Unix()
+		}
+	}
+	delete(days, latest)
+
+	r.lock.Lock()
+	r.days = days
+	r.lastRun = now
+	r.lock.Unlock()
+
+	log.Infof("Reconciler: retrieved %d billing line items covering %d days", len(items), len(days))
+}
+
+// ReconcileAssets sets the adjustment of each Node, Disk, and LoadBalancer in
+// the given AssetSet which is matched to billed costs by category and
+// provider ID, such that its total cost is the cost billed for it over the
+// set's window. Billed costs of partial days are prorated. If billing data is
+// missing for any day of the window, no assets are adjusted. It returns the
+// number of assets adjusted.
+func (r *Reconciler) ReconcileAssets(as *kubecost.AssetSet) int {
+	if r == nil || as == nil || as.Window.IsOpen() {
+		return 0
+	}
+
+	start, end := *as.Window.Start(), *as.Window.End()
+	billed, ok := r.billedCosts(start, end)
+	if !ok {
+		return 0
+	}
+
+	// Index the assets by provider ID first, so that only billed resources
+	// with a potential match need to be matched.
+	providerIDs := map[string]string{}
+	as.Each(func(key string, a kubecost.Asset) {
+		if id := a.Properties().ProviderID; id != "" {
+			providerIDs[strings.ToLower(id)] = id
+		}
+	})
+
+	adjusted := 0
+	for key, cost := range billed {
+		providerID, ok := providerIDs[key.providerID]
+		if !ok {
+			continue
+		}
+
+		// Only matches on both category and provider ID are adjusted; e.g.
+		// the network egress billed to a node is not part of its cost.
+		query := kubecost.NewCloud(key.category, providerID, start, end, as.Window.Clone())
+		match, fullMatch, err := as.ReconciliationMatch(query)
+		if err != nil || !fullMatch {
+			continue
+		}
+
+		switch match.(type) {
+		case *kubecost.Node, *kubecost.Disk, *kubecost.LoadBalancer:
+			match.SetAdjustment(cost - (match.TotalCost() - match.Adjustment()))
+			adjusted++
+		}
+	}
+
+	return adjusted
+}
+
+// Covers returns true if billing data has been retrieved for every day of the
+// given window, such that assets of the window can be reconciled.
+func (r *Reconciler) Covers(start, end time.Time) bool {
+	if r == nil {
+		return false
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	s := start.UTC()
+	for day := time.Date(s.Year(), s.Month(), s.Day(), 0, 0, 0, 0, time.UTC); day.Before(end); day = day.AddDate(0, 0, 1) {
+		if _, ok := r.days[day.Unix()]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// billedCosts returns the cost billed for each resource between the given
+// times, prorating partial days, or false if any day is missing.
+func (r *Reconciler) billedCosts(start, end time.Time) (map[billingKey]float64, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	billed := map[billingKey]float64{}
+
+	s := start.UTC()
+	for day := time.Date(s.Year(), s.Month(), s.Day(), 0, 0, 0, 0, time.UTC); day.Before(end); day = day.AddDate(0, 0, 1) {
+		costs, ok := r.days[day.Unix()]
+		if !ok {
+			return nil, false
+		}
+
+		overlapStart, overlapEnd := day, day.AddDate(0, 0, 1)
+		if start.After(overlapStart) {
+			overlapStart = start
+		}
+		if end.Before(overlapEnd) {
+			overlapEnd = end
+		}
+		frac := overlapEnd.Sub(overlapStart).Hours() / 24.0
+
+		for key, cost := range costs {
+			billed[key] += cost * frac
+		}
+	}
+
+	return billed, true
+}
+
+// reconcileAllocations scales the CPU, GPU, and RAM costs of each allocation
+// by the ratio of its node's reconciled cost to its unreconciled cost, as
+// idle allocations are, so that allocations reflect the node's bill.
+func reconcileAllocations(as *kubecost.AllocationSet, assetSet *kubecost.AssetSet) {
+	rates := map[nodeKey]float64{}
+	assetSet.Each(func(key string, a kubecost.Asset) {
+		node, ok := a.(*kubecost.Node)
+		if !ok || node.Adjustment() == 0.0 {
+			return
+		}
+
+		// If the adjustment cancels the entire cost of the node, then the
+		// allocations on it cost nothing.
+		rate := 0.0
+		if node.TotalCost()-node.Adjustment() != 0.0 {
+			rate = node.TotalCost() / (node.TotalCost() - node.Adjustment())
+		}
+		rates[newNodeKey(node.Properties().Cluster, node.Properties().Name)] = rate
+	})
+
+	as.Each(func(name string, alloc *kubecost.Allocation) {
+		if alloc.Properties == nil {
+			return
+		}
+
+		rate, ok := rates[newNodeKey(alloc.Properties.Cluster, alloc.Properties.Node)]
+		if !ok {
+			return
+		}
+
+		alloc.CPUCost *= rate
+		alloc.GPUCost *= rate
+		alloc.RAMCost *= rate
+	})
+}
+
+// newReconciler creates and starts a Reconciler for the bill of the given
+// provider, configured by the environment.
+func newReconciler(provider cloud.Provider) *Reconciler {
+	if provider == nil {
+		return nil
+	}
+
+	reconciler, err := NewReconciler(provider.BillingLineItems, ReconcilerConfig{
+		Days:        env.GetReconciliationDays(),
+		RefreshRate: env.GetReconciliationRefreshRate(),
+	})
+	if err != nil {
+		log.Errorf("Init: failed to create reconciler: %s", err)
+		return nil
+	}
+
+	reconciler.Start()
+
+	return reconciler
+}
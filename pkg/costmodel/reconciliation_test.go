@@ -0,0 +1,187 @@
+package costmodel
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/cloud"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+)
+
+// mockBillingLineItems returns a retrieve function which returns one line
+// item per-day, from the given first day until the end, for each of the given
+// daily costs, keyed by "category/providerID".
+func mockBillingLineItems(first time.Time, costs map[string]float64) func(start, end time.Time) ([]*cloud.BillingLineItem, error) {
+	return func(start, end time.Time) ([]*cloud.BillingLineItem, error) {
+		items := []*cloud.BillingLineItem{}
+		for day := first; day.Before(end); day = day.AddDate(0, 0, 1) {
+			if day.Before(start) {
+				continue
+			}
+			for _, category := range []string{kubecost.ComputeCategory, kubecost.StorageCategory, kubecost.NetworkCategory} {
+				for _, providerID := range []string{"i-node1", "i-node2", "vol-disk1"} {
+					cost, ok := costs[fmt.Sprintf("%s/%s", category, providerID)]
+					if !ok {
+						continue
+					}
+					items = append(items, &cloud.BillingLineItem{
+						Start:      day,
+						End:        day.AddDate(0, 0, 1),
+						Category:   category,
+						ProviderID: providerID,
+						Cost:       cost,
+					})
+				}
+			}
+		}
+		return items, nil
+	}
+}
+
+func TestReconciler_ReconcileAssets(t *testing.T) {
+	today := time.Date(2021, time.March, 10, 0, 0, 0, 0, time.UTC)
+
+	// Bills are available until yesterday, but yesterday's is incomplete
+	costs := map[string]float64{
+		kubecost.ComputeCategory + "/i-node1":   48.0,
+		kubecost.NetworkCategory + "/i-node1":   5.0,
+		kubecost.StorageCategory + "/vol-disk1": 2.4,
+	}
+	r, err := NewReconciler(mockBillingLineItems(today.AddDate(0, 0, -5), costs), ReconcilerConfig{Days: 7, RefreshRate: time.Hour})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	r.Run(today.Add(6 * time.Hour))
+
+	newAssetSet := func(start, end time.Time) *kubecost.AssetSet {
+		window := kubecost.NewWindow(&start, &end)
+		hours := end.Sub(start).Hours()
+
+		node1 := kubecost.NewNode("node1", "cluster1", "i-node1", start, end, window)
+		node1.CPUCost = 1.5 * hours
+		node1.RAMCost = 0.5 * hours
+		node2 := kubecost.NewNode("node2", "cluster1", "i-node2", start, end, window)
+		node2.CPUCost = 1.0 * hours
+		disk1 := kubecost.NewDisk("disk1", "cluster1", "vol-disk1", start, end, window)
+		disk1.Cost = 0.2 * hours
+
+		return kubecost.NewAssetSet(start, end, node1, node2, disk1)
+	}
+
+	// A complete day is adjusted to the billed cost; the network cost billed
+	// to node1 is not part of its cost, and node2 is not billed
+	start := today.AddDate(0, 0, -3)
+	as := newAssetSet(start, start.AddDate(0, 0, 1))
+	if n := r.ReconcileAssets(as); n != 2 {
+		t.Fatalf("expected 2 assets adjusted; got %d", n)
+	}
+	as.Each(func(key string, a kubecost.Asset) {
+		expected := map[string]float64{"node1": 48.0, "node2": 24.0, "disk1": 2.4}[a.Properties().Name]
+		if math.Abs(a.TotalCost()-expected) > 1e-9 {
+			t.Fatalf("%s: expected total cost %f; got %f", a.Properties().Name, expected, a.TotalCost())
+		}
+	})
+
+	// A partial day spanning two days is prorated
+	start = today.AddDate(0, 0, -3).Add(18 * time.Hour)
+	as = newAssetSet(start, start.Add(12*time.Hour))
+	r.ReconcileAssets(as)
+	as.Each(func(key string, a kubecost.Asset) {
+		if a.Properties().Name == "node1" && math.Abs(a.TotalCost()-24.0) > 1e-9 {
+			t.Fatalf("prorated: expected total cost 24; got %f", a.TotalCost())
+		}
+	})
+
+	// Yesterday's bill is incomplete, and the days before the bill are
+	// missing, so neither are adjusted
+	for _, start := range []time.Time{today.AddDate(0, 0, -1), today.AddDate(0, 0, -6)} {
+		as = newAssetSet(start, start.AddDate(0, 0, 1))
+		if n := r.ReconcileAssets(as); n != 0 {
+			t.Fatalf("%s: expected no assets adjusted; got %d", start, n)
+		}
+	}
+
+	// Failing to retrieve the bill keeps the previous data
+	r.retrieve = func(start, end time.Time) ([]*cloud.BillingLineItem, error) {
+		return nil, fmt.Errorf("unavailable")
+	}
+	r.Run(today.Add(7 * time.Hour))
+	start = today.AddDate(0, 0, -3)
+	if n := r.ReconcileAssets(newAssetSet(start, start.AddDate(0, 0, 1))); n != 2 {
+		t.Fatalf("after error: expected 2 assets adjusted; got %d", n)
+	}
+}
+
+func TestReconciler_Covers(t *testing.T) {
+	today := time.Date(2021, time.March, 10, 0, 0, 0, 0, time.UTC)
+
+	costs := map[string]float64{kubecost.ComputeCategory + "/i-node1": 48.0}
+	r, err := NewReconciler(mockBillingLineItems(today.AddDate(0, 0, -5), costs), ReconcilerConfig{Days: 7, RefreshRate: time.Hour})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	r.Run(today.Add(6 * time.Hour))
+
+	// Billing data covers the 5th through the 8th; the 9th is incomplete
+	cases := []struct {
+		start, end time.Time
+		expected   bool
+	}{
+		{today.AddDate(0, 0, -5), today.AddDate(0, 0, -1), true},
+		{today.AddDate(0, 0, -3).Add(18 * time.Hour), today.AddDate(0, 0, -2).Add(6 * time.Hour), true},
+		{today.AddDate(0, 0, -2), today, false},
+		{today.AddDate(0, 0, -6), today.AddDate(0, 0, -4), false},
+	}
+	for _, c := range cases {
+		if covers := r.Covers(c.start, c.end); covers != c.expected {
+			t.Errorf("[%s, %s): expected covers %t; got %t", c.start, c.end, c.expected, covers)
+		}
+	}
+
+	// Reconciliation may not be enabled
+	var nilReconciler *Reconciler
+	if nilReconciler.Covers(today.AddDate(0, 0, -5), today.AddDate(0, 0, -1)) {
+		t.Errorf("expected nil Reconciler to cover nothing")
+	}
+}
+
+func TestReconcileAllocations(t *testing.T) {
+	start := time.Date(2021, time.March, 7, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 1)
+	window := kubecost.NewWindow(&start, &end)
+
+	node1 := kubecost.NewNode("node1", "cluster1", "i-node1", start, end, window)
+	node1.CPUCost = 36.0
+	node1.RAMCost = 12.0
+	node1.SetAdjustment(-12.0)
+	node2 := kubecost.NewNode("node2", "cluster1", "i-node2", start, end, window)
+	node2.CPUCost = 24.0
+	assetSet := kubecost.NewAssetSet(start, end, node1, node2)
+
+	newAlloc := func(name, node string) *kubecost.Allocation {
+		return &kubecost.Allocation{
+			Name:       name,
+			Properties: &kubecost.AllocationProperties{Cluster: "cluster1", Node: node},
+			Window:     window.Clone(),
+			Start:      start,
+			End:        end,
+			CPUCost:    8.0,
+			GPUCost:    4.0,
+			RAMCost:    2.0,
+		}
+	}
+	as := kubecost.NewAllocationSet(start, end, newAlloc("a", "node1"), newAlloc("b", "node2"))
+
+	reconcileAllocations(as, assetSet)
+
+	a := as.Get("a")
+	if a.CPUCost != 6.0 || a.GPUCost != 3.0 || a.RAMCost != 1.5 {
+		t.Fatalf("a: expected costs scaled by 0.75; got %f, %f, %f", a.CPUCost, a.GPUCost, a.RAMCost)
+	}
+	b := as.Get("b")
+	if b.CPUCost != 8.0 || b.GPUCost != 4.0 || b.RAMCost != 2.0 {
+		t.Fatalf("b: expected costs unchanged; got %f, %f, %f", b.CPUCost, b.GPUCost, b.RAMCost)
+	}
+}
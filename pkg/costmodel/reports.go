@@ -0,0 +1,689 @@
+package costmodel
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/errors"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/storage"
+	"github.com/kubecost/cost-model/pkg/util"
+	"github.com/kubecost/cost-model/pkg/util/cron"
+	"github.com/kubecost/cost-model/pkg/util/json"
+	"github.com/kubecost/cost-model/pkg/util/retry"
+)
+
+// Status values of a ReportDelivery
+const (
+	ReportDeliverySucceeded = "succeeded"
+	ReportDeliveryFailed    = "failed"
+)
+
+// Supported types of ReportDestination
+const (
+	ReportDestinationFile    = "file"
+	ReportDestinationS3      = "s3"
+	ReportDestinationWebhook = "webhook"
+)
+
+const (
+	// reportHistoryLength is the number of deliveries kept in the history of
+	// each report.
+	reportHistoryLength = 50
+
+	// reportDefaultMaxAttempts is the number of attempts made to run and
+	// deliver a report if the report does not configure it.
+	reportDefaultMaxAttempts = 3
+
+	// reportDefaultRetryDelay is the delay before the first retry of a failed
+	// report, which grows with jitter after each subsequent attempt.
+	reportDefaultRetryDelay = time.Minute
+
+	// reportTimeFormat is the format of the window start and end times in the
+	// file names of delivered reports.
+	reportTimeFormat = "20060102T150405"
+)
+
+var reportNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// ReportConfig defines an allocation report which is run on a schedule and
+// delivered to a destination. For example:
+//   {
+//     "name": "daily-namespace-costs",
+//     "schedule": "0 1 * * *",
+//     "query": {"window": "yesterday", "aggregate": "namespace", "filterClusters": "prod"},
+//     "format": "csv",
+//     "destination": {"type": "s3", "bucket": "reports", "path": "kubecost"}
+//   }
+type ReportConfig struct {
+	// Name uniquely identifies the report, and names its files
+	Name string `json:"name"`
+
+	// Schedule is a cron expression, evaluated in the configured UTC offset;
+	// e.g. "0 1 * * *" or "@daily"
+	Schedule string `json:"schedule"`
+
+	// Query holds the parameters of the /allocation/compute query to run,
+	// which must include the window. Relative windows, such as "yesterday"
+	// or "7d", are resolved at the time the report is scheduled to run.
+	Query map[string]string `json:"query"`
+
+	// Format is one of "csv" (default), "json", or "parquet"
+	Format string `json:"format,omitempty"`
+
+	// Destination defines where the report is delivered
+	Destination ReportDestination `json:"destination"`
+
+	// MaxAttempts is the number of times to try running and delivering the
+	// report before recording a failure. Defaults to 3.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+}
+
+// ReportDestination defines where a report is delivered: a local directory
+// ("file"), an S3 bucket ("s3"), or an HTTP endpoint ("webhook").
+type ReportDestination struct {
+	Type string `json:"type"`
+
+	// Path is the directory of a "file" destination, or the key prefix
+	// within the bucket of an "s3" destination. Reports are written to
+	// "<path>/<name>/<start>-<end>.<format>".
+	Path string `json:"path,omitempty"`
+
+	// Bucket, Region, Endpoint, Insecure, AccessKeyID and SecretAccessKey
+	// configure an "s3" destination. See storage.S3Config.
+	Bucket          string `json:"bucket,omitempty"`
+	Region          string `json:"region,omitempty"`
+	Endpoint        string `json:"endpoint,omitempty"`
+	Insecure        bool   `json:"insecure,omitempty"`
+	AccessKeyID     string `json:"accessKeyID,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+
+	// URL and Headers configure a "webhook" destination, to which reports
+	// are sent by POST request.
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// ReportDelivery records an attempt to run and deliver a report.
+type ReportDelivery struct {
+	ScheduledAt time.Time `json:"scheduledAt"`
+	CompletedAt time.Time `json:"completedAt"`
+	Window      string    `json:"window"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	Location    string    `json:"location,omitempty"`
+	Size        string    `json:"size,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// ReportStatus describes the schedule, destination, and recent deliveries of
+// a report. History is ordered from most to least recent.
+type ReportStatus struct {
+	Name        string            `json:"name"`
+	Schedule    string            `json:"schedule"`
+	Format      string            `json:"format"`
+	Destination string            `json:"destination"`
+	Running     bool              `json:"running"`
+	NextRun     time.Time         `json:"nextRun"`
+	History     []*ReportDelivery `json:"history"`
+}
+
+// LoadReportConfigs reads the list of ReportConfigs from the JSON file at
+// the given path. If the file does not exist, it returns no configs.
+func LoadReportConfigs(configPath string) ([]*ReportConfig, error) {
+	exists, err := util.FileExists(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	configs := []*ReportConfig{}
+	err = json.Unmarshal(data, &configs)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", configPath, err)
+	}
+
+	return configs, nil
+}
+
+// reportQueryFunc runs a query, given the parameters accepted by
+// /allocation/compute, returning the resulting AllocationSetRange and the
+// currency of its costs.
+type reportQueryFunc func(qp util.QueryParams) (*kubecost.AllocationSetRange, string, error)
+
+// reportDeliverer delivers the rendered data of a report to a destination.
+type reportDeliverer interface {
+	// deliver delivers the given data, of the given content type, under the
+	// given name, returning the location to which it was delivered.
+	deliver(name string, data []byte, contentType string, headers map[string]string) (string, error)
+
+	// String describes the destination.
+	String() string
+}
+
+// storageDeliverer delivers reports by writing them to a Storage.
+type storageDeliverer struct {
+	store storage.Storage
+}
+
+func (sd *storageDeliverer) deliver(name string, data []byte, contentType string, headers map[string]string) (string, error) {
+	err := sd.store.Write(name, data)
+	if err != nil {
+		return "", err
+	}
+	return sd.store.FullPath(name), nil
+}
+
+func (sd *storageDeliverer) String() string {
+	return sd.store.FullPath("")
+}
+
+// webhookDeliverer delivers reports by POST request to a URL.
+type webhookDeliverer struct {
+	client  *http.Client
+	url     string
+	headers map[string]string
+}
+
+func (wd *webhookDeliverer) deliver(name string, data []byte, contentType string, headers map[string]string) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, wd.url, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range wd.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := wd.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("webhook responded with status %s", resp.Status)
+	}
+
+	return wd.String(), nil
+}
+
+// String returns the URL without its query, which may contain secrets.
+func (wd *webhookDeliverer) String() string {
+	u, err := url.Parse(wd.url)
+	if err != nil {
+		return ""
+	}
+	u.RawQuery = ""
+	u.User = nil
+	return u.String()
+}
+
+// newReportDeliverer creates the reportDeliverer of the given destination.
+func newReportDeliverer(dest ReportDestination) (reportDeliverer, error) {
+	switch strings.ToLower(dest.Type) {
+	case ReportDestinationFile:
+		if dest.Path == "" {
+			return nil, fmt.Errorf("path is required for %s destination", ReportDestinationFile)
+		}
+		return &storageDeliverer{store: storage.NewFileStorage(dest.Path)}, nil
+	case ReportDestinationS3:
+		store, err := storage.NewS3Storage(storage.S3Config{
+			Bucket:          dest.Bucket,
+			Prefix:          dest.Path,
+			Region:          dest.Region,
+			Endpoint:        dest.Endpoint,
+			Insecure:        dest.Insecure,
+			AccessKeyID:     dest.AccessKeyID,
+			SecretAccessKey: dest.SecretAccessKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &storageDeliverer{store: store}, nil
+	case ReportDestinationWebhook:
+		u, err := url.Parse(dest.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("illegal webhook url: %s", dest.URL)
+		}
+		return &webhookDeliverer{
+			client:  &http.Client{Timeout: time.Minute},
+			url:     dest.URL,
+			headers: dest.Headers,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported destination type: %s", dest.Type)
+}
+
+// report is a ReportConfig and its schedule, destination, and state.
+type report struct {
+	config    *ReportConfig
+	schedule  *cron.Schedule
+	format    string
+	deliverer reportDeliverer
+	nextRun   time.Time
+	running   bool
+	history   []*ReportDelivery
+}
+
+// Reporter runs each of a set of reports on its schedule, delivering it to
+// its destination, and records the history of deliveries.
+type Reporter struct {
+	lock       sync.RWMutex
+	reports    []*report
+	query      reportQueryFunc
+	loc        *time.Location
+	history    storage.Storage
+	retryDelay time.Duration
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+// NewReporter creates a Reporter of the given reports, which runs queries
+// with the given function and evaluates schedules in the given location. If
+// a history Storage is given, then the history of each report is loaded
+// from, and saved to, that Storage.
+func NewReporter(configs []*ReportConfig, query reportQueryFunc, loc *time.Location, history storage.Storage) (*Reporter, error) {
+	if query == nil {
+		return nil, fmt.Errorf("Reporter: query is nil")
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r := &Reporter{
+		query:      query,
+		loc:        loc,
+		history:    history,
+		retryDelay: reportDefaultRetryDelay,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+
+	names := map[string]bool{}
+	for _, config := range configs {
+		if !reportNameRegex.MatchString(config.Name) {
+			return nil, fmt.Errorf("Reporter: illegal report name: %q", config.Name)
+		}
+		if names[config.Name] {
+			return nil, fmt.Errorf("Reporter: duplicate report name: %s", config.Name)
+		}
+		names[config.Name] = true
+
+		schedule, err := cron.Parse(config.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("Reporter: %s: %s", config.Name, err)
+		}
+
+		if config.Query["window"] == "" {
+			return nil, fmt.Errorf("Reporter: %s: query window is required", config.Name)
+		}
+
+		format := strings.ToLower(config.Format)
+		if format == "" {
+			format = ExportFormatCSV
+		}
+		if format != ExportFormatCSV && format != ExportFormatJSON && format != ExportFormatParquet {
+			return nil, fmt.Errorf("Reporter: %s: unsupported format: %s", config.Name, config.Format)
+		}
+
+		deliverer, err := newReportDeliverer(config.Destination)
+		if err != nil {
+			return nil, fmt.Errorf("Reporter: %s: %s", config.Name, err)
+		}
+
+		rep := &report{
+			config:    config,
+			schedule:  schedule,
+			format:    format,
+			deliverer: deliverer,
+			history:   []*ReportDelivery{},
+		}
+		r.loadHistory(rep)
+
+		r.reports = append(r.reports, rep)
+	}
+
+	return r, nil
+}
+
+// Start runs each report on its schedule in the background until Stop is
+// called.
+func (r *Reporter) Start() {
+	go func() {
+		defer errors.HandlePanic()
+
+		for {
+			next := r.runDue(time.Now())
+
+			wait := time.Hour
+			if !next.IsZero() {
+				wait = time.Until(next)
+			}
+
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+}
+
+// Stop stops the background scheduling started by Start, as well as any
+// pending retries.
+func (r *Reporter) Stop() {
+	r.cancel()
+}
+
+// runDue starts running, in the background, every report which is due as of
+// the given time, and returns the earliest time at which any report is next
+// due, or the zero time if no report is ever due.
+func (r *Reporter) runDue(now time.Time) time.Time {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now = now.In(r.loc)
+
+	next := time.Time{}
+	for _, rep := range r.reports {
+		if rep.nextRun.IsZero() {
+			rep.nextRun = rep.schedule.Next(now)
+		} else if !now.Before(rep.nextRun) {
+			scheduledAt := rep.nextRun
+			rep.nextRun = rep.schedule.Next(now)
+
+			if rep.running {
+				log.Warningf("Reporter: %s: skipping run scheduled at %s; previous run still in progress", rep.config.Name, scheduledAt)
+			} else {
+				rep.running = true
+				go func(rep *report, scheduledAt time.Time) {
+					defer errors.HandlePanic()
+					r.run(rep, scheduledAt)
+				}(rep, scheduledAt)
+			}
+		}
+
+		if !rep.nextRun.IsZero() && (next.IsZero() || rep.nextRun.Before(next)) {
+			next = rep.nextRun
+		}
+	}
+
+	return next
+}
+
+// run runs and delivers the given report as scheduled at the given time,
+// retrying until it succeeds or the maximum number of attempts is reached,
+// then records the delivery in the report's history.
+func (r *Reporter) run(rep *report, scheduledAt time.Time) *ReportDelivery {
+	defer func() {
+		r.lock.Lock()
+		rep.running = false
+		r.lock.Unlock()
+	}()
+
+	delivery := &ReportDelivery{
+		ScheduledAt: scheduledAt,
+		Window:      rep.config.Query["window"],
+	}
+
+	maxAttempts := rep.config.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = reportDefaultMaxAttempts
+	}
+
+	// Resolve the window relative to the scheduled time, once, so that every
+	// attempt queries the same window, regardless of when it runs.
+	window, err := kubecost.ParseWindowAt(rep.config.Query["window"], scheduledAt.In(r.loc))
+	if err == nil && (window.Start() == nil || window.End() == nil) {
+		err = fmt.Errorf("illegal window: %s", window)
+	}
+
+	if err == nil {
+		delivery.Window = window.String()
+
+		_, err = retry.Retry(r.ctx, func() (interface{}, error) {
+			delivery.Attempts++
+
+			location, size, err := r.deliver(rep, window)
+			if err != nil {
+				log.Warningf("Reporter: %s: attempt %d of %d failed: %s", rep.config.Name, delivery.Attempts, maxAttempts, err)
+				return nil, err
+			}
+
+			delivery.Location = location
+			delivery.Size = size
+			return nil, nil
+		}, uint(maxAttempts), r.retryDelay)
+	}
+
+	delivery.CompletedAt = time.Now().In(r.loc)
+	if err != nil {
+		delivery.Status = ReportDeliveryFailed
+		delivery.Error = err.Error()
+		log.Errorf("Reporter: %s: failed to deliver report for %s: %s", rep.config.Name, delivery.Window, err)
+	} else {
+		delivery.Status = ReportDeliverySucceeded
+		log.Infof("Reporter: %s: delivered report for %s to %s", rep.config.Name, delivery.Window, delivery.Location)
+	}
+
+	r.lock.Lock()
+	rep.history = append([]*ReportDelivery{delivery}, rep.history...)
+	if len(rep.history) > reportHistoryLength {
+		rep.history = rep.history[:reportHistoryLength]
+	}
+	r.lock.Unlock()
+
+	r.saveHistory(rep)
+
+	return delivery
+}
+
+// deliver runs the query of the given report over the given window, renders
+// the result in the report's format, and delivers it to the report's
+// destination, returning the location and size of the delivered report.
+func (r *Reporter) deliver(rep *report, window kubecost.Window) (string, string, error) {
+	values := url.Values{}
+	for k, v := range rep.config.Query {
+		values.Set(k, v)
+	}
+	values.Set("window", fmt.Sprintf("%d,%d", window.Start().Unix(), window.End().Unix()))
+
+	asr, currency, err := r.query(util.NewQueryParams(values))
+	if err != nil {
+		return "", "", fmt.Errorf("error querying allocation: %s", err)
+	}
+
+	buf := &bytes.Buffer{}
+	contentType := "application/json"
+	switch rep.format {
+	case ExportFormatCSV:
+		contentType = "text/csv"
+		err = writeExportCSV(buf, newAllocationExportTable(asr, currency))
+	case ExportFormatParquet:
+		contentType = "application/octet-stream"
+		err = writeExportParquet(buf, newAllocationExportTable(asr, currency))
+	default:
+		var data []byte
+		data, err = json.Marshal(asr)
+		buf.Write(data)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("error rendering %s: %s", rep.format, err)
+	}
+
+	start := window.Start().In(r.loc).Format(reportTimeFormat)
+	end := window.End().In(r.loc).Format(reportTimeFormat)
+	name := path.Join(rep.config.Name, fmt.Sprintf("%s-%s.%s", start, end, rep.format))
+
+	location, err := rep.deliverer.deliver(name, buf.Bytes(), contentType, map[string]string{
+		"X-Report-Name":   rep.config.Name,
+		"X-Report-Window": window.String(),
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("error delivering to %s: %s", rep.deliverer, err)
+	}
+
+	return location, util.FormatBytes(int64(buf.Len())), nil
+}
+
+// historyPath returns the path of the file, within the history Storage, in
+// which the history of the given report is stored.
+func (r *Reporter) historyPath(rep *report) string {
+	return path.Join("history", rep.config.Name+".json")
+}
+
+// loadHistory loads the history of the given report, if any.
+func (r *Reporter) loadHistory(rep *report) {
+	if r.history == nil {
+		return
+	}
+
+	data, err := r.history.Read(r.historyPath(rep))
+	if err != nil {
+		if !storage.IsNotExist(err) {
+			log.Warningf("Reporter: %s: error loading history: %s", rep.config.Name, err)
+		}
+		return
+	}
+
+	history := []*ReportDelivery{}
+	err = json.Unmarshal(data, &history)
+	if err != nil {
+		log.Warningf("Reporter: %s: error decoding history: %s", rep.config.Name, err)
+		return
+	}
+	rep.history = history
+}
+
+// saveHistory saves the history of the given report, if there is a history
+// Storage.
+func (r *Reporter) saveHistory(rep *report) {
+	if r.history == nil {
+		return
+	}
+
+	r.lock.RLock()
+	data, err := json.Marshal(rep.history)
+	r.lock.RUnlock()
+	if err != nil {
+		log.Warningf("Reporter: %s: error encoding history: %s", rep.config.Name, err)
+		return
+	}
+
+	err = r.history.Write(r.historyPath(rep), data)
+	if err != nil {
+		log.Warningf("Reporter: %s: error saving history: %s", rep.config.Name, err)
+	}
+}
+
+// Status returns the ReportStatus of each report.
+func (r *Reporter) Status() []*ReportStatus {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	statuses := []*ReportStatus{}
+	for _, rep := range r.reports {
+		statuses = append(statuses, &ReportStatus{
+			Name:        rep.config.Name,
+			Schedule:    rep.schedule.String(),
+			Format:      rep.format,
+			Destination: rep.deliverer.String(),
+			Running:     rep.running,
+			NextRun:     rep.nextRun,
+			History:     append([]*ReportDelivery{}, rep.history...),
+		})
+	}
+
+	return statuses
+}
+
+// newReporter creates and starts a Reporter of the reports configured by the
+// file at the configured path. If there are no reports, or the Reporter
+// cannot be created, it returns nil.
+func newReporter(a *Accesses) *Reporter {
+	configs, err := LoadReportConfigs(env.GetReportsConfigPath())
+	if err != nil {
+		log.Errorf("Init: failed to load report configs: %s", err)
+		return nil
+	}
+	if len(configs) == 0 {
+		return nil
+	}
+
+	query := func(qp util.QueryParams) (*kubecost.AllocationSetRange, string, error) {
+		q, err := a.parseAllocationQuery(qp)
+		if err != nil {
+			return nil, "", err
+		}
+
+		currency, rate, err := a.parseCurrency(qp)
+		if err != nil {
+			return nil, "", err
+		}
+
+		asr, err := a.queryAllocation(q)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if rate != 1.0 {
+			asr.ScaleCosts(rate)
+		}
+
+		return asr, currency, nil
+	}
+
+	loc := time.FixedZone("", int(env.GetParsedUTCOffset().Seconds()))
+	history := storage.NewFileStorage(env.GetReportsPath())
+
+	reporter, err := NewReporter(configs, query, loc, history)
+	if err != nil {
+		log.Errorf("Init: failed to create reporter: %s", err)
+		return nil
+	}
+
+	reporter.Start()
+	log.Infof("Init: started %d scheduled reports", len(configs))
+
+	return reporter
+}
+
+// ReportStatusHandler returns the ReportStatus of each scheduled report.
+func (a *Accesses) ReportStatusHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if a.Reporter == nil {
+		w.Write(WrapData([]*ReportStatus{}, nil))
+		return
+	}
+
+	w.Write(WrapData(a.Reporter.Status(), nil))
+}
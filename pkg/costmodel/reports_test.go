@@ -0,0 +1,314 @@
+package costmodel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/storage"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+// newTestReportQuery returns a reportQueryFunc which fails the given number
+// of times, then returns a single allocation over the queried window.
+func newTestReportQuery(t *testing.T, failures int) reportQueryFunc {
+	return func(qp util.QueryParams) (*kubecost.AllocationSetRange, string, error) {
+		if failures > 0 {
+			failures--
+			return nil, "", fmt.Errorf("query failed")
+		}
+
+		window, err := kubecost.ParseWindowUTC(qp.Get("window", ""))
+		if err != nil {
+			t.Fatalf("unexpected window: %s", err)
+		}
+		if qp.Get("aggregate", "") != "namespace" {
+			t.Fatalf("expected aggregate namespace; got %s", qp.Get("aggregate", ""))
+		}
+
+		alloc := &kubecost.Allocation{
+			Name:       "kubecost",
+			Start:      *window.Start(),
+			End:        *window.End(),
+			Properties: &kubecost.AllocationProperties{Namespace: "kubecost"},
+			CPUCost:    1.0,
+		}
+		as := kubecost.NewAllocationSet(*window.Start(), *window.End(), alloc)
+		return kubecost.NewAllocationSetRange(as), "USD", nil
+	}
+}
+
+func newTestReportConfig(name string, dest ReportDestination) *ReportConfig {
+	return &ReportConfig{
+		Name:     name,
+		Schedule: "@daily",
+		Query: map[string]string{
+			// 2021-03-01T00:00:00Z to 2021-03-02T00:00:00Z
+			"window":    "1614556800,1614643200",
+			"aggregate": "namespace",
+		},
+		Destination: dest,
+	}
+}
+
+func TestNewReporter_Errors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reports")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dest := ReportDestination{Type: ReportDestinationFile, Path: dir}
+	query := newTestReportQuery(t, 0)
+
+	cases := map[string]func(c *ReportConfig){
+		"illegal name":     func(c *ReportConfig) { c.Name = "../costs" },
+		"illegal schedule": func(c *ReportConfig) { c.Schedule = "daily" },
+		"missing window":   func(c *ReportConfig) { delete(c.Query, "window") },
+		"illegal format":   func(c *ReportConfig) { c.Format = "xml" },
+		"missing path":     func(c *ReportConfig) { c.Destination.Path = "" },
+		"illegal webhook": func(c *ReportConfig) {
+			c.Destination = ReportDestination{Type: ReportDestinationWebhook, URL: "ftp://host"}
+		},
+		"illegal dest. type": func(c *ReportConfig) { c.Destination.Type = "email" },
+	}
+
+	for name, modify := range cases {
+		config := newTestReportConfig("costs", dest)
+		modify(config)
+
+		_, err := NewReporter([]*ReportConfig{config}, query, time.UTC, nil)
+		if err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	configs := []*ReportConfig{newTestReportConfig("costs", dest), newTestReportConfig("costs", dest)}
+	_, err = NewReporter(configs, query, time.UTC, nil)
+	if err == nil {
+		t.Errorf("duplicate name: expected error")
+	}
+}
+
+func TestReporter_RunFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reports")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestReportConfig("costs", ReportDestination{Type: ReportDestinationFile, Path: filepath.Join(dir, "out")})
+	history := storage.NewFileStorage(filepath.Join(dir, "state"))
+
+	reporter, err := NewReporter([]*ReportConfig{config}, newTestReportQuery(t, 0), time.UTC, history)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	scheduledAt := time.Date(2021, time.March, 2, 0, 0, 0, 0, time.UTC)
+	delivery := reporter.run(reporter.reports[0], scheduledAt)
+	if delivery.Status != ReportDeliverySucceeded {
+		t.Fatalf("expected success; got %s: %s", delivery.Status, delivery.Error)
+	}
+	if delivery.Attempts != 1 {
+		t.Fatalf("expected 1 attempt; got %d", delivery.Attempts)
+	}
+
+	expectedPath := filepath.Join(dir, "out", "costs", "20210301T000000-20210302T000000.csv")
+	if delivery.Location != expectedPath {
+		t.Fatalf("expected location %s; got %s", expectedPath, delivery.Location)
+	}
+
+	data, err := ioutil.ReadFile(expectedPath)
+	if err != nil {
+		t.Fatalf("unexpected error reading report: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "windowStart,windowEnd,name") || !strings.Contains(lines[1], "kubecost") {
+		t.Fatalf("unexpected report contents: %s", data)
+	}
+
+	// History is persisted, so a new Reporter picks it up
+	reporter, err = NewReporter([]*ReportConfig{config}, newTestReportQuery(t, 0), time.UTC, history)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	status := reporter.Status()
+	if len(status) != 1 || len(status[0].History) != 1 {
+		t.Fatalf("expected 1 report with 1 delivery; got %+v", status)
+	}
+	if !status[0].History[0].ScheduledAt.Equal(scheduledAt) || status[0].History[0].Status != ReportDeliverySucceeded {
+		t.Fatalf("unexpected history: %+v", status[0].History[0])
+	}
+}
+
+func TestReporter_RunRelativeWindow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reports")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestReportConfig("costs", ReportDestination{Type: ReportDestinationFile, Path: dir})
+	config.Query["window"] = "yesterday"
+
+	loc := time.FixedZone("", -7*60*60)
+	reporter, err := NewReporter([]*ReportConfig{config}, newTestReportQuery(t, 0), loc, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// A run scheduled at 1am, long before it actually runs, reports on the
+	// day before it was scheduled, in the configured UTC offset
+	scheduledAt := time.Date(2021, time.March, 2, 1, 0, 0, 0, loc)
+	delivery := reporter.run(reporter.reports[0], scheduledAt)
+	if delivery.Status != ReportDeliverySucceeded {
+		t.Fatalf("expected success; got %s: %s", delivery.Status, delivery.Error)
+	}
+
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, loc)
+	end := time.Date(2021, time.March, 2, 0, 0, 0, 0, loc)
+	expected := kubecost.NewClosedWindow(start, end)
+	if delivery.Window != expected.String() {
+		t.Fatalf("expected window %s; got %s", expected, delivery.Window)
+	}
+}
+
+func TestReporter_RunWebhook(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		// Fail the first request to exercise retries
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			t.Errorf("expected POST; got %s", r.Method)
+		}
+		if r.Header.Get("Content-Type") != "text/csv" {
+			t.Errorf("expected CSV; got %s", r.Header.Get("Content-Type"))
+		}
+		if r.Header.Get("X-Report-Name") != "costs" || r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if !strings.Contains(string(body), "kubecost") {
+			t.Errorf("unexpected body: %s", body)
+		}
+	}))
+	defer server.Close()
+
+	config := newTestReportConfig("costs", ReportDestination{
+		Type:    ReportDestinationWebhook,
+		URL:     server.URL + "/hook?secret=abc",
+		Headers: map[string]string{"Authorization": "Bearer token"},
+	})
+
+	// Fail the first query, too, so that it takes three attempts
+	reporter, err := NewReporter([]*ReportConfig{config}, newTestReportQuery(t, 1), time.UTC, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	reporter.retryDelay = time.Millisecond
+
+	delivery := reporter.run(reporter.reports[0], time.Now())
+	if delivery.Status != ReportDeliverySucceeded {
+		t.Fatalf("expected success; got %s: %s", delivery.Status, delivery.Error)
+	}
+	if delivery.Attempts != 3 {
+		t.Fatalf("expected 3 attempts; got %d", delivery.Attempts)
+	}
+	if delivery.Location != server.URL+"/hook" {
+		t.Fatalf("expected location without query; got %s", delivery.Location)
+	}
+}
+
+func TestReporter_RunFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	config := newTestReportConfig("costs", ReportDestination{Type: ReportDestinationWebhook, URL: server.URL})
+	config.MaxAttempts = 2
+
+	reporter, err := NewReporter([]*ReportConfig{config}, newTestReportQuery(t, 0), time.UTC, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	reporter.retryDelay = time.Millisecond
+
+	delivery := reporter.run(reporter.reports[0], time.Now())
+	if delivery.Status != ReportDeliveryFailed {
+		t.Fatalf("expected failure; got %s", delivery.Status)
+	}
+	if delivery.Attempts != 2 {
+		t.Fatalf("expected 2 attempts; got %d", delivery.Attempts)
+	}
+	if !strings.Contains(delivery.Error, "500") {
+		t.Fatalf("expected error to contain status; got %s", delivery.Error)
+	}
+
+	status := reporter.Status()
+	if status[0].Running || len(status[0].History) != 1 {
+		t.Fatalf("unexpected status: %+v", status[0])
+	}
+}
+
+func TestReporter_RunDue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reports")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	hourly := newTestReportConfig("hourly", ReportDestination{Type: ReportDestinationFile, Path: dir})
+	hourly.Schedule = "@hourly"
+	daily := newTestReportConfig("daily", ReportDestination{Type: ReportDestinationFile, Path: dir})
+
+	reporter, err := NewReporter([]*ReportConfig{hourly, daily}, newTestReportQuery(t, 0), time.UTC, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The first call only schedules the reports
+	now := time.Date(2021, time.March, 1, 22, 30, 0, 0, time.UTC)
+	next := reporter.runDue(now)
+	if expected := time.Date(2021, time.March, 1, 23, 0, 0, 0, time.UTC); !next.Equal(expected) {
+		t.Fatalf("expected next run at %s; got %s", expected, next)
+	}
+
+	// Only the hourly report is due
+	now = time.Date(2021, time.March, 1, 23, 0, 5, 0, time.UTC)
+	next = reporter.runDue(now)
+	if expected := time.Date(2021, time.March, 2, 0, 0, 0, 0, time.UTC); !next.Equal(expected) {
+		t.Fatalf("expected next run at %s; got %s", expected, next)
+	}
+
+	// Wait for the background run of the hourly report to finish
+	for i := 0; i < 100; i++ {
+		status := reporter.Status()
+		if len(status[0].History) > 0 && !status[0].Running {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	status := reporter.Status()
+	if len(status[0].History) != 1 || !status[0].History[0].ScheduledAt.Equal(time.Date(2021, time.March, 1, 23, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected hourly report to run once; got %+v", status[0].History)
+	}
+	if len(status[1].History) != 0 {
+		t.Fatalf("expected daily report not to run; got %+v", status[1].History)
+	}
+}
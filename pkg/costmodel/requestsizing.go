@@ -0,0 +1,374 @@
+package costmodel
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/prom"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+const (
+	queryFmtCPUUsageQuantile = `max(quantile_over_time(%f, rate(container_cpu_usage_seconds_total{container_name!="", container_name!="POD", instance!=""}[5m])[%s:%s]%s)) by (container_name, pod_name, namespace, instance, cluster_id)`
+	queryFmtRAMUsageQuantile = `max(quantile_over_time(%f, container_memory_working_set_bytes{container_name!="", container_name!="POD", instance!=""}[%s]%s)) by (container_name, pod_name, namespace, instance, cluster_id)`
+)
+
+// Defaults for request sizing, which recommends requests at the 95th
+// percentile of usage, plus 20% headroom, but no smaller than 10 millicores
+// and 20MiB.
+const (
+	DefaultRequestSizingPercentile = 0.95
+	DefaultRequestSizingHeadroom   = 0.2
+	MinRequestSizingCPUCores       = 0.01
+	MinRequestSizingRAMBytes       = 20 * 1024 * 1024
+)
+
+// RequestSizingConfig configures the computation of request sizing
+// recommendations.
+type RequestSizingConfig struct {
+	// Percentile of usage, between 0 and 1, on which to base recommendations
+	Percentile float64
+
+	// Headroom is the fraction of the usage percentile added to it to arrive
+	// at the recommended request; e.g. 0.2 recommends 120% of usage
+	Headroom float64
+}
+
+// RequestSizingRecommendation recommends CPU and RAM requests for a container
+// of a controller, or of a pod which has no controller, and estimates the
+// monthly savings of adopting them, based on the cost of the requested
+// resources on the nodes the container ran on.
+type RequestSizingRecommendation struct {
+	Cluster                    string  `json:"cluster"`
+	Namespace                  string  `json:"namespace"`
+	ControllerKind             string  `json:"controllerKind"`
+	Controller                 string  `json:"controller"`
+	Pod                        string  `json:"pod,omitempty"`
+	Container                  string  `json:"container"`
+	Replicas                   float64 `json:"replicas"`
+	CPUCoreRequest             float64 `json:"cpuCoreRequest"`
+	CPUCoreUsage               float64 `json:"cpuCoreUsage"`
+	RecommendedCPUCoreRequest  float64 `json:"recommendedCpuCoreRequest"`
+	RAMBytesRequest            float64 `json:"ramBytesRequest"`
+	RAMBytesUsage              float64 `json:"ramBytesUsage"`
+	RecommendedRAMBytesRequest float64 `json:"recommendedRamBytesRequest"`
+	CurrentMonthlyCost         float64 `json:"currentMonthlyCost"`
+	RecommendedMonthlyCost     float64 `json:"recommendedMonthlyCost"`
+	MonthlySavings             float64 `json:"monthlySavings"`
+}
+
+// requestSizingKey identifies a container of a controller, or of a pod which
+// has no controller.
+type requestSizingKey struct {
+	Cluster        string
+	Namespace      string
+	ControllerKind string
+	Controller     string
+	Pod            string
+	Container      string
+}
+
+// requestSizingTotals accumulates the Allocations of a requestSizingKey.
+type requestSizingTotals struct {
+	minutes           float64
+	cpuRequestMinutes float64
+	ramRequestMinutes float64
+	cpuUsage          float64
+	ramUsage          float64
+	cpuCost           float64
+	cpuCoreHours      float64
+	ramCost           float64
+	ramGiBHours       float64
+}
+
+// ComputeRequestSizing computes request sizing recommendations for each
+// container over the given window, from percentiles of usage queried at the
+// given resolution. Only Allocations matching every given filter are
+// considered.
+func (a *Accesses) ComputeRequestSizing(window kubecost.Window, resolution time.Duration, config RequestSizingConfig, filterFuncs []kubecost.AllocationMatchFunc) ([]*RequestSizingRecommendation, error) {
+	if window.IsOpen() || window.IsNegative() {
+		return nil, fmt.Errorf("illegal window: %s", window)
+	}
+	start, end := *window.Start(), *window.End()
+
+	as, err := a.computeAllocation(start, end, env.GetETLResolution())
+	if err != nil {
+		return nil, fmt.Errorf("error computing allocation: %s", err)
+	}
+
+	durStr, offStr, err := window.DurationOffsetForPrometheus()
+	if err != nil {
+		return nil, fmt.Errorf("illegal window: %s", err)
+	}
+	resStr := util.DurationString(resolution)
+
+	ctx := prom.NewContext(a.PrometheusClient)
+	resChCPUUsage := ctx.Query(fmt.Sprintf(queryFmtCPUUsageQuantile, config.Percentile, durStr, resStr, offStr))
+	resChRAMUsage := ctx.Query(fmt.Sprintf(queryFmtRAMUsageQuantile, config.Percentile, durStr, offStr))
+
+	resCPUUsage, _ := resChCPUUsage.Await()
+	resRAMUsage, _ := resChRAMUsage.Await()
+	if ctx.HasErrors() {
+		return nil, ctx.ErrorCollection()
+	}
+
+	cpuUsage := buildContainerUsageMap(resCPUUsage)
+	ramUsage := buildContainerUsageMap(resRAMUsage)
+
+	if len(filterFuncs) > 0 {
+		filtered := kubecost.NewAllocationSet(start, end)
+		as.Each(func(name string, alloc *kubecost.Allocation) {
+			for _, ff := range filterFuncs {
+				if !ff(alloc) {
+					return
+				}
+			}
+			filtered.Set(alloc)
+		})
+		as = filtered
+	}
+
+	return buildRequestSizingRecommendations(as, cpuUsage, ramUsage, config), nil
+}
+
+// buildContainerUsageMap maps each container of the given usage query results
+// to its value.
+func buildContainerUsageMap(resUsage []*prom.QueryResult) map[containerKey]float64 {
+	usage := map[containerKey]float64{}
+
+	for _, res := range resUsage {
+		key, err := resultPodKey(res, "cluster_id", "namespace", "pod_name")
+		if err != nil {
+			log.DedupedWarningf(10, "ComputeRequestSizing: usage result missing field: %s", err)
+			continue
+		}
+
+		container, err := res.GetString("container_name")
+		if err != nil {
+			log.DedupedWarningf(10, "ComputeRequestSizing: usage result missing 'container_name': %s", key)
+			continue
+		}
+
+		if len(res.Values) == 0 {
+			continue
+		}
+
+		usage[newContainerKey(key.Cluster, key.Namespace, key.Pod, container)] = res.Values[0].Value
+	}
+
+	return usage
+}
+
+// buildRequestSizingRecommendations groups the container Allocations of the
+// given set by controller and container, and recommends requests for each
+// group from the highest usage percentile of its pods. Containers without
+// usage percentiles fall back to their maximum, then average, usage. Results
+// are sorted by descending monthly savings.
+func buildRequestSizingRecommendations(as *kubecost.AllocationSet, cpuUsage, ramUsage map[containerKey]float64, config RequestSizingConfig) []*RequestSizingRecommendation {
+	windowMinutes := as.End().Sub(as.Start()).Minutes()
+	if windowMinutes <= 0 {
+		return []*RequestSizingRecommendation{}
+	}
+
+	totals := map[requestSizingKey]*requestSizingTotals{}
+
+	as.Each(func(name string, alloc *kubecost.Allocation) {
+		if alloc.IsIdle() || alloc.IsUnallocated() || strings.Contains(name, kubecost.UnmountedSuffix) || alloc.Properties == nil {
+			return
+		}
+		props := alloc.Properties
+		if props.Container == "" || props.Pod == "" {
+			return
+		}
+
+		key := requestSizingKey{
+			Cluster:        props.Cluster,
+			Namespace:      props.Namespace,
+			ControllerKind: props.ControllerKind,
+			Controller:     props.Controller,
+			Container:      props.Container,
+		}
+		if props.Controller == "" {
+			key.Pod = props.Pod
+		}
+
+		if _, ok := totals[key]; !ok {
+			totals[key] = &requestSizingTotals{}
+		}
+		t := totals[key]
+
+		minutes := alloc.Minutes()
+		t.minutes += minutes
+		t.cpuRequestMinutes += alloc.CPUCoreRequestAverage * minutes
+		t.ramRequestMinutes += alloc.RAMBytesRequestAverage * minutes
+		t.cpuCost += alloc.CPUCost
+		t.cpuCoreHours += alloc.CPUCoreHours
+		t.ramCost += alloc.RAMCost
+		t.ramGiBHours += alloc.RAMByteHours / 1024 / 1024 / 1024
+
+		ck := newContainerKey(props.Cluster, props.Namespace, props.Pod, props.Container)
+
+		cpu, ok := cpuUsage[ck]
+		if !ok {
+			cpu = alloc.CPUCoreUsageAverage
+			if alloc.RawAllocationOnly != nil && alloc.RawAllocationOnly.CPUCoreUsageMax > 0 {
+				cpu = alloc.RawAllocationOnly.CPUCoreUsageMax
+			}
+		}
+		if cpu > t.cpuUsage {
+			t.cpuUsage = cpu
+		}
+
+		ram, ok := ramUsage[ck]
+		if !ok {
+			ram = alloc.RAMBytesUsageAverage
+			if alloc.RawAllocationOnly != nil && alloc.RawAllocationOnly.RAMBytesUsageMax > 0 {
+				ram = alloc.RawAllocationOnly.RAMBytesUsageMax
+			}
+		}
+		if ram > t.ramUsage {
+			t.ramUsage = ram
+		}
+	})
+
+	recs := []*RequestSizingRecommendation{}
+
+	for key, t := range totals {
+		if t.minutes <= 0 {
+			continue
+		}
+
+		// Cost per core-hour and GiB-hour of the resources allocated to the
+		// container, which reflects the prices of the nodes it ran on
+		costPerCPUHr := 0.0
+		if t.cpuCoreHours > 0 {
+			costPerCPUHr = t.cpuCost / t.cpuCoreHours
+		}
+		costPerRAMGiBHr := 0.0
+		if t.ramGiBHours > 0 {
+			costPerRAMGiBHr = t.ramCost / t.ramGiBHours
+		}
+
+		rec := &RequestSizingRecommendation{
+			Cluster:         key.Cluster,
+			Namespace:       key.Namespace,
+			ControllerKind:  key.ControllerKind,
+			Controller:      key.Controller,
+			Pod:             key.Pod,
+			Container:       key.Container,
+			Replicas:        t.minutes / windowMinutes,
+			CPUCoreRequest:  t.cpuRequestMinutes / t.minutes,
+			CPUCoreUsage:    t.cpuUsage,
+			RAMBytesRequest: t.ramRequestMinutes / t.minutes,
+			RAMBytesUsage:   t.ramUsage,
+		}
+
+		rec.RecommendedCPUCoreRequest = recommendRequest(t.cpuUsage, config.Headroom, MinRequestSizingCPUCores)
+		rec.RecommendedRAMBytesRequest = recommendRequest(t.ramUsage, config.Headroom, MinRequestSizingRAMBytes)
+
+		monthlyCost := func(cpuCores, ramBytes float64) float64 {
+			hourly := cpuCores*costPerCPUHr + (ramBytes/1024/1024/1024)*costPerRAMGiBHr
+			return hourly * rec.Replicas * util.HoursPerMonth
+		}
+		rec.CurrentMonthlyCost = monthlyCost(rec.CPUCoreRequest, rec.RAMBytesRequest)
+		rec.RecommendedMonthlyCost = monthlyCost(rec.RecommendedCPUCoreRequest, rec.RecommendedRAMBytesRequest)
+		rec.MonthlySavings = rec.CurrentMonthlyCost - rec.RecommendedMonthlyCost
+
+		recs = append(recs, rec)
+	}
+
+	sort.Slice(recs, func(i, j int) bool {
+		if recs[i].MonthlySavings != recs[j].MonthlySavings {
+			return recs[i].MonthlySavings > recs[j].MonthlySavings
+		}
+		return recommendationName(recs[i]) < recommendationName(recs[j])
+	})
+
+	return recs
+}
+
+// recommendRequest returns the given usage plus the given fraction of
+// headroom, but no less than the given minimum.
+func recommendRequest(usage, headroom, min float64) float64 {
+	req := usage * (1.0 + headroom)
+	if req < min {
+		return min
+	}
+	return req
+}
+
+// recommendationName uniquely names a RequestSizingRecommendation, for
+// stable ordering.
+func recommendationName(rec *RequestSizingRecommendation) string {
+	return fmt.Sprintf("%s/%s/%s:%s/%s/%s", rec.Cluster, rec.Namespace, rec.ControllerKind, rec.Controller, rec.Pod, rec.Container)
+}
+
+// RequestSizingHandler recommends CPU and RAM requests for each container
+// from percentiles of its usage, and estimates the monthly savings of
+// adopting them.
+func (a *Accesses) RequestSizingHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	qp := util.NewQueryParams(r.URL.Query())
+
+	// Window is an optional parameter, defaulting to the past week, over
+	// which usage is measured.
+	window, err := kubecost.ParseWindowWithOffset(qp.Get("window", "7d"), env.GetParsedUTCOffset())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid 'window' parameter: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// Resolution is an optional parameter, defaulting to 5m, at which usage
+	// is sampled for computing percentiles.
+	resolution := qp.GetDuration("resolution", 5*time.Minute)
+
+	// Percentile and headroom are optional parameters, expressed in percent,
+	// which determine the recommended requests.
+	// Example: "percentile=90&headroom=15"
+	percentile := qp.GetFloat64("percentile", DefaultRequestSizingPercentile*100.0) / 100.0
+	if percentile <= 0.0 || percentile > 1.0 {
+		http.Error(w, fmt.Sprintf("Invalid 'percentile' parameter: %s", qp.Get("percentile", "")), http.StatusBadRequest)
+		return
+	}
+
+	headroom := qp.GetFloat64("headroom", DefaultRequestSizingHeadroom*100.0) / 100.0
+	if headroom < 0.0 {
+		http.Error(w, fmt.Sprintf("Invalid 'headroom' parameter: %s", qp.Get("headroom", "")), http.StatusBadRequest)
+		return
+	}
+
+	filterFuncs, err := ParseAllocationFilters(qp)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid filter parameter: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	recs, err := a.ComputeRequestSizing(window, resolution, RequestSizingConfig{
+		Percentile: percentile,
+		Headroom:   headroom,
+	}, filterFuncs)
+	if err != nil {
+		WriteError(w, InternalServerError(err.Error()))
+		return
+	}
+
+	totalSavings := 0.0
+	for _, rec := range recs {
+		if rec.MonthlySavings > 0 {
+			totalSavings += rec.MonthlySavings
+		}
+	}
+
+	w.Write(WrapData(map[string]interface{}{
+		"recommendations":     recs,
+		"totalMonthlySavings": totalSavings,
+	}, nil))
+}
@@ -0,0 +1,106 @@
+package costmodel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+func TestBuildRequestSizingRecommendations(t *testing.T) {
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	gib := 1024.0 * 1024.0 * 1024.0
+
+	// newAlloc returns a container allocation requesting 2 cores at $0.05 per
+	// core-hour and 4GiB at $0.01 per GiB-hour, for the given duration
+	newAlloc := func(controller, pod, container string, hours float64) *kubecost.Allocation {
+		props := &kubecost.AllocationProperties{
+			Cluster:   "cluster1",
+			Node:      "node1",
+			Namespace: "web",
+			Pod:       pod,
+			Container: container,
+		}
+		if controller != "" {
+			props.ControllerKind = "deployment"
+			props.Controller = controller
+		}
+		return &kubecost.Allocation{
+			Name:                   "cluster1/node1/web/" + pod + "/" + container,
+			Properties:             props,
+			Start:                  start,
+			End:                    start.Add(time.Duration(hours * float64(time.Hour))),
+			CPUCoreRequestAverage:  2.0,
+			CPUCoreUsageAverage:    0.2,
+			CPUCoreHours:           2.0 * hours,
+			CPUCost:                2.0 * hours * 0.05,
+			RAMBytesRequestAverage: 4.0 * gib,
+			RAMBytesUsageAverage:   gib,
+			RAMByteHours:           4.0 * gib * hours,
+			RAMCost:                4.0 * hours * 0.01,
+		}
+	}
+
+	as := kubecost.NewAllocationSet(start, end,
+		newAlloc("api", "api-1", "nginx", 24.0),
+		newAlloc("api", "api-2", "nginx", 12.0),
+		newAlloc("", "debug", "shell", 24.0),
+	)
+	as.Set(&kubecost.Allocation{Name: kubecost.IdleSuffix, Start: start, End: end, CPUCost: 100.0})
+
+	cpuUsage := map[containerKey]float64{
+		newContainerKey("cluster1", "web", "api-1", "nginx"): 0.5,
+		newContainerKey("cluster1", "web", "api-2", "nginx"): 1.0,
+	}
+	ramUsage := map[containerKey]float64{
+		newContainerKey("cluster1", "web", "api-1", "nginx"): 2.0 * gib,
+	}
+
+	recs := buildRequestSizingRecommendations(as, cpuUsage, ramUsage, RequestSizingConfig{Percentile: 0.95, Headroom: 0.2})
+	if len(recs) != 2 {
+		t.Fatalf("expected 2 recommendations; got %d", len(recs))
+	}
+
+	// 1.5 replicas; the highest percentile of either pod, plus 20%
+	debug, api := recs[0], recs[1]
+	if api.Controller != "api" || api.Container != "nginx" || api.Pod != "" {
+		t.Fatalf("unexpected recommendation: %+v", api)
+	}
+	if api.Replicas != 1.5 || api.CPUCoreRequest != 2.0 || api.RAMBytesRequest != 4.0*gib {
+		t.Fatalf("unexpected current requests: %+v", api)
+	}
+	if !util.IsApproximately(api.RecommendedCPUCoreRequest, 1.2) || !util.IsApproximately(api.RecommendedRAMBytesRequest, 2.4*gib) {
+		t.Fatalf("unexpected recommended requests: %+v", api)
+	}
+
+	// (2 cores * $0.05 + 4GiB * $0.01) * 1.5 replicas * 730 hours
+	if !util.IsApproximately(api.CurrentMonthlyCost, 0.14*1.5*730.0) {
+		t.Fatalf("expected current monthly cost %f; got %f", 0.14*1.5*730.0, api.CurrentMonthlyCost)
+	}
+	expSavings := ((2.0-1.2)*0.05 + (4.0-2.4)*0.01) * 1.5 * 730.0
+	if !util.IsApproximately(api.MonthlySavings, expSavings) {
+		t.Fatalf("expected monthly savings %f; got %f", expSavings, api.MonthlySavings)
+	}
+
+	// Without percentiles, the bare pod falls back to average usage
+	if debug.Pod != "debug" || debug.Controller != "" {
+		t.Fatalf("unexpected recommendation: %+v", debug)
+	}
+	if !util.IsApproximately(debug.RecommendedCPUCoreRequest, 0.24) || !util.IsApproximately(debug.RecommendedRAMBytesRequest, 1.2*gib) {
+		t.Fatalf("unexpected recommended requests: %+v", debug)
+	}
+	if debug.MonthlySavings <= api.MonthlySavings {
+		t.Fatalf("expected recommendations sorted by savings; got %f before %f", debug.MonthlySavings, api.MonthlySavings)
+	}
+}
+
+func TestRecommendRequest(t *testing.T) {
+	if req := recommendRequest(1.0, 0.2, 0.01); !util.IsApproximately(req, 1.2) {
+		t.Fatalf("expected 1.2; got %f", req)
+	}
+	if req := recommendRequest(0.0, 0.2, 0.01); req != 0.01 {
+		t.Fatalf("expected minimum 0.01; got %f", req)
+	}
+}
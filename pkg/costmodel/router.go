@@ -17,16 +17,21 @@ import (
 
 	sentry "github.com/getsentry/sentry-go"
 
+	"github.com/kubecost/cost-model/pkg/billing"
+	"github.com/kubecost/cost-model/pkg/budgets"
 	"github.com/kubecost/cost-model/pkg/cloud"
 	"github.com/kubecost/cost-model/pkg/clustercache"
 	cm "github.com/kubecost/cost-model/pkg/clustermanager"
 	"github.com/kubecost/cost-model/pkg/costmodel/clusters"
+	"github.com/kubecost/cost-model/pkg/currency"
 	"github.com/kubecost/cost-model/pkg/env"
 	"github.com/kubecost/cost-model/pkg/errors"
+	"github.com/kubecost/cost-model/pkg/etl"
 	"github.com/kubecost/cost-model/pkg/kubecost"
 	"github.com/kubecost/cost-model/pkg/log"
 	"github.com/kubecost/cost-model/pkg/prom"
 	"github.com/kubecost/cost-model/pkg/thanos"
+	"github.com/kubecost/cost-model/pkg/util"
 	"github.com/kubecost/cost-model/pkg/util/json"
 	prometheus "github.com/prometheus/client_golang/api"
 	prometheusClient "github.com/prometheus/client_golang/api"
@@ -75,6 +80,18 @@ type Accesses struct {
 	ClusterCostsCache *cache.Cache
 	CacheExpiration   map[time.Duration]time.Duration
 	AggAPI            Aggregator
+	AllocationETL     *etl.AllocationETL
+	Reporter          *Reporter
+	BudgetManager     *budgets.BudgetManager
+	AnomalyDetector   *AnomalyDetector
+	CurrencyConverter *currency.Converter
+	LabelConfig       *kubecost.LabelConfig
+	BillingIngester   *billing.Ingester
+	// AssetsCache stores the AssetSets computed by computeAssets
+	AssetsCache *cache.Cache
+	// ExternalAssetsCache stores the out-of-cluster costs retrieved by
+	// queryExternalAssets
+	ExternalAssetsCache *cache.Cache
 	// SettingsCache stores current state of app settings
 	SettingsCache *cache.Cache
 	// settingsSubscribers tracks channels through which changes to different
@@ -127,22 +144,44 @@ func (a *Accesses) ClusterCostsFromCacheHandler(w http.ResponseWriter, r *http.R
 	offset := "1m"
 	pClient := a.GetPrometheusClient(true)
 
+	currency, rate, err := a.parseCurrency(util.NewQueryParams(r.URL.Query()))
+	if err != nil {
+		w.Write(WrapData(nil, err))
+		return
+	}
+
 	key := fmt.Sprintf("%s:%s", durationHrs, offset)
+	message := "clusterCosts cache hit"
+	var clusterCosts map[string]*ClusterCosts
 	if data, valid := a.ClusterCostsCache.Get(key); valid {
-		clusterCosts := data.(map[string]*ClusterCosts)
-		w.Write(WrapDataWithMessage(clusterCosts, nil, "clusterCosts cache hit"))
+		clusterCosts = data.(map[string]*ClusterCosts)
 	} else {
-		data, err := a.ComputeClusterCosts(pClient, a.CloudProvider, durationHrs, offset, true)
-		w.Write(WrapDataWithMessage(data, err, fmt.Sprintf("clusterCosts cache miss: %s", key)))
+		message = fmt.Sprintf("clusterCosts cache miss: %s", key)
+		clusterCosts, err = a.ComputeClusterCosts(pClient, a.CloudProvider, durationHrs, offset, true)
+		if err != nil {
+			w.Write(WrapDataWithMessage(clusterCosts, err, message))
+			return
+		}
 	}
+
+	// Cached costs are scaled as copies, leaving the cache unchanged
+	resp, _ := json.Marshal(&Response{
+		Code:     http.StatusOK,
+		Status:   "success",
+		Data:     scaleClusterCosts(clusterCosts, rate),
+		Message:  message,
+		Currency: currency,
+	})
+	w.Write(resp)
 }
 
 type Response struct {
-	Code    int         `json:"code"`
-	Status  string      `json:"status"`
-	Data    interface{} `json:"data"`
-	Message string      `json:"message,omitempty"`
-	Warning string      `json:"warning,omitempty"`
+	Code     int         `json:"code"`
+	Status   string      `json:"status"`
+	Data     interface{} `json:"data"`
+	Message  string      `json:"message,omitempty"`
+	Warning  string      `json:"warning,omitempty"`
+	Currency string      `json:"currency,omitempty"`
 }
 
 // FilterFunc is a filter that returns true iff the given CostData should be filtered out, and the environment that was used as the filter criteria, if it was an aggregate
@@ -397,6 +436,31 @@ func WrapDataWithMessageAndWarning(data interface{}, err error, message, warning
 	return resp
 }
 
+// WrapDataWithCurrency wraps the given data, stamping the response with the
+// currency of its costs.
+func WrapDataWithCurrency(data interface{}, err error, currency string) []byte {
+	var resp []byte
+
+	if err != nil {
+		klog.V(1).Infof("Error returned to client: %s", err.Error())
+		resp, _ = json.Marshal(&Response{
+			Code:    http.StatusInternalServerError,
+			Status:  "error",
+			Message: err.Error(),
+			Data:    data,
+		})
+	} else {
+		resp, _ = json.Marshal(&Response{
+			Code:     http.StatusOK,
+			Status:   "success",
+			Data:     data,
+			Currency: currency,
+		})
+	}
+
+	return resp
+}
+
 // RefreshPricingData needs to be called when a new node joins the fleet, since we cache the relevant subsets of pricing data to avoid storing the whole thing.
 func (a *Accesses) RefreshPricingData(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	w.Header().Set("Content-Type", "application/json")
@@ -453,8 +517,18 @@ func (a *Accesses) ClusterCosts(w http.ResponseWriter, r *http.Request, ps httpr
 		client = a.PrometheusClient
 	}
 
+	currency, rate, err := a.parseCurrency(util.NewQueryParams(r.URL.Query()))
+	if err != nil {
+		w.Write(WrapData(nil, err))
+		return
+	}
+
 	data, err := a.ComputeClusterCosts(client, a.CloudProvider, window, offset, true)
-	w.Write(WrapData(data, err))
+	if err != nil {
+		w.Write(WrapData(nil, err))
+		return
+	}
+	w.Write(WrapDataWithCurrency(scaleClusterCosts(data, rate), nil, currency))
 }
 
 func (a *Accesses) ClusterCostsOverTime(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -466,8 +540,19 @@ func (a *Accesses) ClusterCostsOverTime(w http.ResponseWriter, r *http.Request,
 	window := r.URL.Query().Get("window")
 	offset := r.URL.Query().Get("offset")
 
+	currency, rate, err := a.parseCurrency(util.NewQueryParams(r.URL.Query()))
+	if err != nil {
+		w.Write(WrapData(nil, err))
+		return
+	}
+
 	data, err := ClusterCostsOverTime(a.PrometheusClient, a.CloudProvider, start, end, window, offset)
-	w.Write(WrapData(data, err))
+	if err != nil {
+		w.Write(WrapData(data, err))
+		return
+	}
+	scaleTotals(data, rate)
+	w.Write(WrapDataWithCurrency(data, nil, currency))
 }
 
 func (a *Accesses) CostDataModelRange(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -1065,12 +1150,75 @@ func Initialize(additionalConfigWatchers ...ConfigWatchers) *Accesses {
 
 	a.MetricsEmitter.Start()
 
+	// Compute and store allocation data in the background unless explicitly
+	// disabled, so that /allocation/compute need not query Prometheus
+	if env.IsETLEnabled() {
+		log.Infof("Init: allocation ETL enabled")
+		a.AllocationETL = newAllocationETL(a.Model)
+	} else {
+		log.Infof("Init: allocation ETL disabled")
+	}
+
+	// Run and deliver scheduled reports, if any are configured
+	a.Reporter = newReporter(a)
+
+	// Convert costs to requested currencies at configured exchange rates
+	a.CurrencyConverter = newCurrencyConverter()
+
+	// Attribute out-of-cluster costs by the configured external labels
+	labelConfig, err := LoadLabelConfig(env.GetLabelConfigPath())
+	if err != nil {
+		log.Errorf("Init: failed to load label config: %s", err)
+		labelConfig = &kubecost.LabelConfig{}
+	}
+	a.LabelConfig = labelConfig
+
+	// Ingest billing exports in a standard schema, if configured
+	a.BillingIngester = newBillingIngester()
+
+	// Cache computed assets for as long as aggregated responses
+	a.AssetsCache = cache.New(time.Minute*10, time.Minute*20)
+
+	// Cache out-of-cluster costs for the interval at which reconciliation
+	// refreshes billing data
+	a.ExternalAssetsCache = cache.New(env.GetReconciliationRefreshRate(), 2*env.GetReconciliationRefreshRate())
+
+	// Evaluate budgets against allocations in the background
+	a.BudgetManager = newBudgetManager(a)
+	budgetEndpoints := budgets.NewBudgetEndpoints(a.BudgetManager)
+
+	// Detect daily spend anomalies in the background, if enabled
+	if env.IsAnomalyDetectionEnabled() {
+		log.Infof("Init: anomaly detection enabled")
+		a.AnomalyDetector = newAnomalyDetector(a)
+	} else {
+		log.Infof("Init: anomaly detection disabled")
+	}
+
+	// Reconcile asset costs with the cloud provider's bill, if enabled
+	if env.IsReconciliationEnabled() {
+		log.Infof("Init: billing reconciliation enabled")
+		a.Model.Reconciler = newReconciler(a.CloudProvider)
+	} else {
+		log.Infof("Init: billing reconciliation disabled")
+	}
+
 	managerEndpoints := cm.NewClusterManagerEndpoints(a.ClusterManager)
 
 	a.Router.GET("/costDataModel", a.CostDataModel)
 	a.Router.GET("/costDataModelRange", a.CostDataModelRange)
 	a.Router.GET("/aggregatedCostModel", a.AggregateCostModelHandler)
 	a.Router.GET("/allocation/compute", a.ComputeAllocationHandler)
+	a.Router.GET("/assets/compute", a.ComputeAssetsHandler)
+	a.Router.GET("/etl/status", a.ETLStatusHandler)
+	a.Router.GET("/reports/status", a.ReportStatusHandler)
+	a.Router.GET("/anomalies", a.AnomaliesHandler)
+	a.Router.GET("/forecast", a.ForecastHandler)
+	a.Router.GET("/savings/requestSizing", a.RequestSizingHandler)
+	a.Router.GET("/savings/nodeSizing", a.NodeSizingHandler)
+	a.Router.GET("/savings/abandoned", a.AbandonedHandler)
+	a.Router.GET("/savings/commitments", a.CommitmentsHandler)
+	a.Router.GET("/savings/spotReadiness", a.SpotReadinessHandler)
 	a.Router.GET("/outOfClusterCosts", a.OutOfClusterCostsWithCache)
 	a.Router.GET("/allNodePricing", a.GetAllNodePricing)
 	a.Router.POST("/refreshPricing", a.RefreshPricingData)
@@ -1090,5 +1238,10 @@ func Initialize(additionalConfigWatchers ...ConfigWatchers) *Accesses {
 	a.Router.PUT("/clusters", managerEndpoints.PutCluster)
 	a.Router.DELETE("/clusters/:id", managerEndpoints.DeleteCluster)
 
+	a.Router.GET("/budgets", budgetEndpoints.GetAllBudgets)
+	a.Router.PUT("/budgets", budgetEndpoints.PutBudget)
+	a.Router.DELETE("/budgets/:id", budgetEndpoints.DeleteBudget)
+	a.Router.GET("/budgets/status", budgetEndpoints.GetBudgetStatus)
+
 	return a
 }
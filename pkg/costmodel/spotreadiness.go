@@ -0,0 +1,339 @@
+package costmodel
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/prom"
+	"github.com/kubecost/cost-model/pkg/util"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Reasons a controller is not ready to run on spot nodes
+const (
+	spotReasonNoController  = "pods without a controller are not rescheduled when their node is reclaimed"
+	spotReasonStatefulSet   = "StatefulSet pods keep a stable identity and storage, so wait for their node to be replaced"
+	spotReasonSingleReplica = "a single replica is unavailable while it is rescheduled"
+	spotReasonLocalStorage  = "volume %s is stored on the node, so is lost when the node is reclaimed"
+	spotReasonPDB           = "PodDisruptionBudget %s allows no disruptions, so blocks draining the node"
+)
+
+// SpotReadiness describes whether a controller's pods can run on spot nodes,
+// which may be reclaimed at short notice, and how much doing so would save.
+// Bare pods, which have no controller, are reported by Pod.
+type SpotReadiness struct {
+	Cluster        string   `json:"cluster"`
+	Namespace      string   `json:"namespace"`
+	ControllerKind string   `json:"controllerKind"`
+	Controller     string   `json:"controller"`
+	Pod            string   `json:"pod,omitempty"`
+	Replicas       int32    `json:"replicas"`
+	SpotReady      bool     `json:"spotReady"`
+	Reasons        []string `json:"reasons"`
+
+	// MonthlyCost is the CPU and RAM cost of the controller's pods on
+	// on-demand nodes, which would cost SpotMonthlyCost on spot nodes
+	MonthlyCost     float64 `json:"monthlyCost"`
+	SpotMonthlyCost float64 `json:"spotMonthlyCost"`
+	MonthlySavings  float64 `json:"monthlySavings"`
+}
+
+// SpotReadinessReport lists the spot readiness of each controller, and the
+// savings of moving every spot-ready controller to spot nodes.
+type SpotReadinessReport struct {
+	Controllers         []*SpotReadiness `json:"controllers"`
+	TotalMonthlySavings float64          `json:"totalMonthlySavings"`
+	Warnings            []string         `json:"warnings"`
+}
+
+// spotController is the pod template and replica count of a controller.
+type spotController struct {
+	Replicas int32
+	Labels   map[string]string
+	Volumes  []v1.Volume
+}
+
+// ComputeSpotReadiness classifies each of this cluster's controllers running
+// over the given window as spot-ready or not, estimating the savings of moving
+// those on on-demand nodes to spot nodes at custom spot prices.
+func (a *Accesses) ComputeSpotReadiness(window kubecost.Window) (*SpotReadinessReport, error) {
+	if window.IsOpen() || window.IsNegative() {
+		return nil, fmt.Errorf("illegal window: %s", window)
+	}
+	start, end := *window.Start(), *window.End()
+
+	as, err := a.computeAllocation(start, end, env.GetETLResolution())
+	if err != nil {
+		return nil, fmt.Errorf("error computing allocation: %s", err)
+	}
+
+	durStr, offStr, err := window.DurationOffsetForPrometheus()
+	if err != nil {
+		return nil, fmt.Errorf("illegal window: %s", err)
+	}
+
+	ctx := prom.NewContext(a.PrometheusClient)
+	resNodeIsSpot, _ := ctx.Query(fmt.Sprintf(queryFmtNodeIsSpot, durStr, offStr)).Await()
+	if ctx.HasErrors() {
+		return nil, ctx.ErrorCollection()
+	}
+
+	spotNodes := map[nodeKey]bool{}
+	for _, res := range resNodeIsSpot {
+		cluster, err := res.GetString("cluster_id")
+		if err != nil {
+			cluster = env.GetClusterID()
+		}
+		node, err := res.GetString("node")
+		if err != nil || len(res.Values) == 0 {
+			continue
+		}
+		spotNodes[newNodeKey(cluster, node)] = res.Values[0].Value > 0
+	}
+
+	spotPricing := a.Model.getCustomNodePricing(true)
+	if spotPricing == nil {
+		return nil, fmt.Errorf("error getting custom spot pricing")
+	}
+
+	cache := a.Model.Cache
+	controllers := buildSpotControllers(env.GetClusterID(), cache.GetAllDeployments(), cache.GetAllStatefulSets(), cache.GetAllPods())
+
+	return buildSpotReadiness(as, spotNodes, controllers, cache.GetAllPodDisruptionBudgets(), spotPricing), nil
+}
+
+// buildSpotControllers returns the pod template and replica count of each
+// Deployment and StatefulSet in the given cluster. Jobs, which are not cached,
+// are described by the first of their pods, and counted by their pods.
+func buildSpotControllers(cluster string, deployments []*appsv1.Deployment, statefulSets []*appsv1.StatefulSet, pods []*v1.Pod) map[controllerKey]*spotController {
+	controllers := map[controllerKey]*spotController{}
+
+	for _, d := range deployments {
+		replicas := int32(1)
+		if d.Spec.Replicas != nil {
+			replicas = *d.Spec.Replicas
+		}
+		key := newControllerKey(cluster, d.Namespace, "deployment", d.Name)
+		controllers[key] = &spotController{
+			Replicas: replicas,
+			Labels:   d.Spec.Template.Labels,
+			Volumes:  d.Spec.Template.Spec.Volumes,
+		}
+	}
+
+	for _, ss := range statefulSets {
+		replicas := int32(1)
+		if ss.Spec.Replicas != nil {
+			replicas = *ss.Spec.Replicas
+		}
+		key := newControllerKey(cluster, ss.Namespace, "statefulset", ss.Name)
+		controllers[key] = &spotController{
+			Replicas: replicas,
+			Labels:   ss.Spec.Template.Labels,
+			Volumes:  ss.Spec.Template.Spec.Volumes,
+		}
+	}
+
+	for _, pod := range pods {
+		for _, owner := range pod.OwnerReferences {
+			if owner.Kind != "Job" {
+				continue
+			}
+			key := newControllerKey(cluster, pod.Namespace, "job", owner.Name)
+			if c, ok := controllers[key]; ok {
+				c.Replicas++
+				continue
+			}
+			controllers[key] = &spotController{
+				Replicas: 1,
+				Labels:   pod.Labels,
+				Volumes:  pod.Spec.Volumes,
+			}
+		}
+	}
+
+	return controllers
+}
+
+// buildSpotReadiness checks the spot readiness of each controller in the
+// given allocations, and totals the CPU and RAM costs of their allocations on
+// on-demand nodes, priced, alternatively, at the given spot pricing. Idle
+// and unmounted allocations, DaemonSets, which run on every node, and
+// controllers of other clusters, which are not cached, are skipped.
+func buildSpotReadiness(as *kubecost.AllocationSet, spotNodes map[nodeKey]bool, controllers map[controllerKey]*spotController, pdbs []*policyv1beta1.PodDisruptionBudget, spotPricing *NodePricing) *SpotReadinessReport {
+	report := &SpotReadinessReport{
+		Controllers: []*SpotReadiness{},
+		Warnings:    []string{},
+	}
+
+	hours := as.End().Sub(as.Start()).Hours()
+	if hours <= 0 {
+		return report
+	}
+	monthly := util.HoursPerMonth / hours
+
+	readiness := map[controllerKey]*SpotReadiness{}
+	otherClusters := map[string]bool{}
+
+	as.Each(func(name string, alloc *kubecost.Allocation) {
+		if alloc.IsIdle() || alloc.IsUnallocated() || alloc.Properties == nil {
+			return
+		}
+		props := alloc.Properties
+		if props.ControllerKind == "daemonset" || props.Pod == "" {
+			return
+		}
+
+		key := newControllerKey(props.Cluster, props.Namespace, props.ControllerKind, props.Controller)
+		if props.Controller == "" {
+			key = newControllerKey(props.Cluster, props.Namespace, "", props.Pod)
+		}
+
+		r, ok := readiness[key]
+		if !ok {
+			r = &SpotReadiness{
+				Cluster:        props.Cluster,
+				Namespace:      props.Namespace,
+				ControllerKind: props.ControllerKind,
+				Controller:     props.Controller,
+			}
+			if props.Controller == "" {
+				r.Pod = props.Pod
+				r.Replicas = 1
+				r.Reasons = []string{spotReasonNoController}
+			} else {
+				c, ok := controllers[key]
+				if !ok {
+					if props.Cluster != env.GetClusterID() {
+						otherClusters[props.Cluster] = true
+					}
+					return
+				}
+				r.Replicas = c.Replicas
+				r.Reasons = checkSpotReadiness(props.Namespace, props.ControllerKind, c, pdbs)
+			}
+			r.SpotReady = len(r.Reasons) == 0
+			readiness[key] = r
+		}
+
+		if spotNodes[newNodeKey(props.Cluster, props.Node)] {
+			return
+		}
+		r.MonthlyCost += (alloc.CPUCost + alloc.RAMCost) * monthly
+		r.SpotMonthlyCost += (alloc.CPUCoreHours*spotPricing.CostPerCPUHr + alloc.RAMByteHours/1024.0/1024.0/1024.0*spotPricing.CostPerRAMGiBHr) * monthly
+	})
+
+	for _, r := range readiness {
+		if r.MonthlyCost > r.SpotMonthlyCost {
+			r.MonthlySavings = r.MonthlyCost - r.SpotMonthlyCost
+		}
+		if r.SpotReady {
+			report.TotalMonthlySavings += r.MonthlySavings
+		}
+		report.Controllers = append(report.Controllers, r)
+	}
+
+	sort.Slice(report.Controllers, func(i, j int) bool {
+		ci, cj := report.Controllers[i], report.Controllers[j]
+		if ci.MonthlySavings != cj.MonthlySavings {
+			return ci.MonthlySavings > cj.MonthlySavings
+		}
+		return fmt.Sprintf("%s/%s/%s%s", ci.Cluster, ci.Namespace, ci.Controller, ci.Pod) < fmt.Sprintf("%s/%s/%s%s", cj.Cluster, cj.Namespace, cj.Controller, cj.Pod)
+	})
+
+	for cluster := range otherClusters {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("controllers of cluster %s are not cached by this cluster, so are not reported", cluster))
+	}
+	sort.Strings(report.Warnings)
+
+	return report
+}
+
+// checkSpotReadiness returns the reasons the given controller cannot run on
+// spot nodes, if any.
+func checkSpotReadiness(namespace, kind string, c *spotController, pdbs []*policyv1beta1.PodDisruptionBudget) []string {
+	reasons := []string{}
+
+	if kind == "statefulset" {
+		reasons = append(reasons, spotReasonStatefulSet)
+	}
+
+	// Jobs run to completion, so are only interrupted by losing a pod
+	if kind != "job" && c.Replicas < 2 {
+		reasons = append(reasons, spotReasonSingleReplica)
+	}
+
+	for _, volume := range c.Volumes {
+		if volume.EmptyDir != nil || volume.HostPath != nil {
+			reasons = append(reasons, fmt.Sprintf(spotReasonLocalStorage, volume.Name))
+		}
+	}
+
+	for _, pdb := range pdbs {
+		if pdb.Namespace != namespace || pdb.Spec.Selector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil {
+			log.Warningf("SpotReadiness: illegal selector in PodDisruptionBudget %s/%s: %s", pdb.Namespace, pdb.Name, err)
+			continue
+		}
+		if selector.Empty() || !selector.Matches(labels.Set(c.Labels)) {
+			continue
+		}
+		if pdbAllowsNoDisruptions(pdb, c.Replicas) {
+			reasons = append(reasons, fmt.Sprintf(spotReasonPDB, pdb.Name))
+		}
+	}
+
+	return reasons
+}
+
+// pdbAllowsNoDisruptions returns true if the given PodDisruptionBudget would
+// never allow evicting one of the given number of replicas.
+func pdbAllowsNoDisruptions(pdb *policyv1beta1.PodDisruptionBudget, replicas int32) bool {
+	if pdb.Spec.MaxUnavailable != nil {
+		maxUnavailable, err := intstr.GetValueFromIntOrPercent(pdb.Spec.MaxUnavailable, int(replicas), true)
+		return err == nil && maxUnavailable <= 0
+	}
+	if pdb.Spec.MinAvailable != nil {
+		minAvailable, err := intstr.GetValueFromIntOrPercent(pdb.Spec.MinAvailable, int(replicas), true)
+		return err == nil && minAvailable >= int(replicas)
+	}
+	return false
+}
+
+// SpotReadinessHandler reports which controllers are ready to run on spot
+// nodes, and the savings of moving them there.
+func (a *Accesses) SpotReadinessHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	qp := util.NewQueryParams(r.URL.Query())
+
+	// Window is an optional parameter, defaulting to the past week, over
+	// which controller costs are observed.
+	window, err := kubecost.ParseWindowWithOffset(qp.Get("window", "7d"), env.GetParsedUTCOffset())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid 'window' parameter: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	report, err := a.ComputeSpotReadiness(window)
+	if err != nil {
+		WriteError(w, InternalServerError(err.Error()))
+		return
+	}
+
+	w.Write(WrapData(report, nil))
+}
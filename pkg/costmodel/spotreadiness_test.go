@@ -0,0 +1,181 @@
+package costmodel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/env"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/util"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestBuildSpotControllers(t *testing.T) {
+	replicas := int32(3)
+	deployments := []*appsv1.Deployment{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "api"},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Template: v1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "api"}}},
+			},
+		},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "worker"}},
+	}
+	statefulSets := []*appsv1.StatefulSet{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "db"}},
+	}
+	newJobPod := func(name string) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "batch",
+			Name:            name,
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Job", Name: "report"}},
+		}}
+	}
+	pods := []*v1.Pod{newJobPod("report-a"), newJobPod("report-b"), {ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "debug"}}}
+
+	controllers := buildSpotControllers("cluster1", deployments, statefulSets, pods)
+	if len(controllers) != 4 {
+		t.Fatalf("expected 4 controllers; got %d", len(controllers))
+	}
+	if c := controllers[newControllerKey("cluster1", "web", "deployment", "api")]; c == nil || c.Replicas != 3 || c.Labels["app"] != "api" {
+		t.Fatalf("unexpected controller: %+v", c)
+	}
+	if c := controllers[newControllerKey("cluster1", "web", "deployment", "worker")]; c == nil || c.Replicas != 1 {
+		t.Fatalf("expected default of 1 replica; got %+v", c)
+	}
+	if c := controllers[newControllerKey("cluster1", "web", "statefulset", "db")]; c == nil {
+		t.Fatalf("expected statefulset")
+	}
+	if c := controllers[newControllerKey("cluster1", "batch", "job", "report")]; c == nil || c.Replicas != 2 {
+		t.Fatalf("expected job of 2 pods; got %+v", c)
+	}
+}
+
+func TestCheckSpotReadiness(t *testing.T) {
+	newPDB := func(name string, minAvailable, maxUnavailable *intstr.IntOrString) *policyv1beta1.PodDisruptionBudget {
+		return &policyv1beta1.PodDisruptionBudget{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: name},
+			Spec: policyv1beta1.PodDisruptionBudgetSpec{
+				Selector:       &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}},
+				MinAvailable:   minAvailable,
+				MaxUnavailable: maxUnavailable,
+			},
+		}
+	}
+	one, zero, all := intstr.FromInt(1), intstr.FromInt(0), intstr.FromString("100%")
+	pdbs := []*policyv1beta1.PodDisruptionBudget{
+		newPDB("api", &one, nil),
+		newPDB("cache", nil, &zero),
+		newPDB("queue", &all, nil),
+	}
+
+	cases := map[string]struct {
+		kind       string
+		controller *spotController
+		reasons    int
+	}{
+		"ready":          {"deployment", &spotController{Replicas: 3, Labels: map[string]string{"app": "api"}}, 0},
+		"single replica": {"deployment", &spotController{Replicas: 1}, 1},
+		"statefulset":    {"statefulset", &spotController{Replicas: 3}, 1},
+		"job":            {"job", &spotController{Replicas: 1}, 0},
+		"local storage": {"deployment", &spotController{Replicas: 2, Volumes: []v1.Volume{
+			{Name: "scratch", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+			{Name: "config", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{}}},
+		}}, 1},
+		"max unavailable": {"deployment", &spotController{Replicas: 3, Labels: map[string]string{"app": "cache"}}, 1},
+		"min available":   {"deployment", &spotController{Replicas: 3, Labels: map[string]string{"app": "queue"}}, 1},
+	}
+
+	for name, c := range cases {
+		reasons := checkSpotReadiness("web", c.kind, c.controller, pdbs)
+		if len(reasons) != c.reasons {
+			t.Fatalf("%s: expected %d reasons; got %v", name, c.reasons, reasons)
+		}
+	}
+
+	// PodDisruptionBudgets of other namespaces do not apply
+	if reasons := checkSpotReadiness("batch", "deployment", &spotController{Replicas: 3, Labels: map[string]string{"app": "cache"}}, pdbs); len(reasons) != 0 {
+		t.Fatalf("expected no reasons; got %v", reasons)
+	}
+}
+
+func TestBuildSpotReadiness(t *testing.T) {
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	cluster := env.GetClusterID()
+
+	// newAlloc returns a container allocation of 1 core at $0.03 per core-hour
+	// and 1GiB at $0.004 per GiB-hour, over the day
+	newAlloc := func(clusterID, node, kind, controller, pod string) *kubecost.Allocation {
+		return &kubecost.Allocation{
+			Name: clusterID + "/" + node + "/web/" + pod + "/main",
+			Properties: &kubecost.AllocationProperties{
+				Cluster:        clusterID,
+				Node:           node,
+				Namespace:      "web",
+				ControllerKind: kind,
+				Controller:     controller,
+				Pod:            pod,
+				Container:      "main",
+			},
+			Start:        start,
+			End:          end,
+			CPUCoreHours: 24.0,
+			CPUCost:      24.0 * 0.03,
+			RAMByteHours: 24.0 * 1024.0 * 1024.0 * 1024.0,
+			RAMCost:      24.0 * 0.004,
+		}
+	}
+
+	as := kubecost.NewAllocationSet(start, end,
+		newAlloc(cluster, "node1", "deployment", "api", "api-1"),
+		newAlloc(cluster, "node2", "deployment", "api", "api-2"),
+		newAlloc(cluster, "spot1", "deployment", "api", "api-3"),
+		newAlloc(cluster, "node1", "statefulset", "db", "db-0"),
+		newAlloc(cluster, "node1", "daemonset", "agent", "agent-1"),
+		newAlloc(cluster, "node1", "", "", "debug"),
+		newAlloc("other", "node1", "deployment", "api", "api-1"),
+	)
+
+	controllers := map[controllerKey]*spotController{
+		newControllerKey(cluster, "web", "deployment", "api"): {Replicas: 3},
+		newControllerKey(cluster, "web", "statefulset", "db"): {Replicas: 3},
+	}
+	spotNodes := map[nodeKey]bool{newNodeKey(cluster, "spot1"): true}
+	spotPricing := &NodePricing{CostPerCPUHr: 0.01, CostPerRAMGiBHr: 0.001}
+
+	report := buildSpotReadiness(as, spotNodes, controllers, nil, spotPricing)
+	if len(report.Controllers) != 3 {
+		t.Fatalf("expected 3 controllers; got %d", len(report.Controllers))
+	}
+	if len(report.Warnings) != 1 {
+		t.Fatalf("expected a warning about the other cluster; got %v", report.Warnings)
+	}
+
+	// Two pods on on-demand nodes, and one already on a spot node
+	api := report.Controllers[0]
+	if api.Controller != "api" || !api.SpotReady || api.Replicas != 3 {
+		t.Fatalf("unexpected readiness: %+v", api)
+	}
+	if !util.IsApproximately(api.MonthlyCost, 2.0*0.034*730.0) || !util.IsApproximately(api.SpotMonthlyCost, 2.0*0.011*730.0) {
+		t.Fatalf("unexpected costs: %+v", api)
+	}
+	if !util.IsApproximately(report.TotalMonthlySavings, api.MonthlySavings) {
+		t.Fatalf("expected total savings of spot-ready controllers %f; got %f", api.MonthlySavings, report.TotalMonthlySavings)
+	}
+
+	// Ties are sorted by name
+	db, debug := report.Controllers[1], report.Controllers[2]
+	if db.Controller != "db" || db.SpotReady || len(db.Reasons) != 1 {
+		t.Fatalf("unexpected readiness: %+v", db)
+	}
+	if debug.Pod != "debug" || debug.SpotReady || debug.Reasons[0] != spotReasonNoController {
+		t.Fatalf("unexpected readiness: %+v", debug)
+	}
+}
@@ -0,0 +1,121 @@
+package currency
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/log"
+)
+
+// Rates are exchange rates relative to a base currency; i.e. the amount of
+// each currency equal to one unit of the base currency. Currencies are
+// identified by their ISO 4217 codes, e.g. "USD".
+type Rates struct {
+	Base  string             `json:"base"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// Rate returns the amount of the given currency equal to one unit of the
+// base currency.
+func (r *Rates) Rate(code string) (float64, bool) {
+	code = Normalize(code)
+	if code == Normalize(r.Base) {
+		return 1.0, true
+	}
+	for c, rate := range r.Rates {
+		if Normalize(c) == code && rate > 0 {
+			return rate, true
+		}
+	}
+	return 0.0, false
+}
+
+// RateSource provides exchange rates; e.g. from a file or a remote API.
+type RateSource interface {
+	// Name describes the source, e.g. for reporting purposes
+	Name() string
+
+	// Rates returns the latest exchange rates
+	Rates() (*Rates, error)
+}
+
+// Normalize returns the given currency code in upper case, without
+// surrounding whitespace.
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Converter converts costs between currencies at the exchange rates of a
+// RateSource, which are cached for the refresh interval.
+type Converter struct {
+	lock      sync.Mutex
+	source    RateSource
+	refresh   time.Duration
+	rates     *Rates
+	refreshed time.Time
+}
+
+// NewConverter creates a Converter with rates from the given source,
+// refreshed at most once per the given interval.
+func NewConverter(source RateSource, refresh time.Duration) *Converter {
+	return &Converter{
+		source:  source,
+		refresh: refresh,
+	}
+}
+
+// Rate returns the rate by which to multiply a cost in the "from" currency to
+// convert it to the "to" currency.
+func (c *Converter) Rate(from, to string) (float64, error) {
+	from, to = Normalize(from), Normalize(to)
+	if from == to {
+		return 1.0, nil
+	}
+
+	rates, err := c.latest()
+	if err != nil {
+		return 0.0, err
+	}
+
+	fromRate, ok := rates.Rate(from)
+	if !ok {
+		return 0.0, fmt.Errorf("no exchange rate for %s", from)
+	}
+	toRate, ok := rates.Rate(to)
+	if !ok {
+		return 0.0, fmt.Errorf("no exchange rate for %s", to)
+	}
+
+	return toRate / fromRate, nil
+}
+
+// latest returns the cached rates, refreshing them from the source if they
+// are older than the refresh interval. If refreshing fails, the cached rates
+// are returned, if there are any.
+func (c *Converter) latest() (*Rates, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.rates != nil && time.Since(c.refreshed) < c.refresh {
+		return c.rates, nil
+	}
+
+	if c.source == nil {
+		return nil, fmt.Errorf("no exchange rate source is configured")
+	}
+
+	rates, err := c.source.Rates()
+	if err != nil {
+		if c.rates != nil {
+			log.Warningf("Currency: error refreshing rates from %s; using rates from %s: %s", c.source.Name(), c.refreshed.Format(time.RFC3339), err)
+			return c.rates, nil
+		}
+		return nil, fmt.Errorf("error getting exchange rates from %s: %s", c.source.Name(), err)
+	}
+
+	c.rates = rates
+	c.refreshed = time.Now()
+	return c.rates, nil
+}
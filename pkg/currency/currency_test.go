@@ -0,0 +1,97 @@
+package currency
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testRateSource struct {
+	rates *Rates
+	err   error
+	calls int
+}
+
+func (trs *testRateSource) Name() string {
+	return "test"
+}
+
+func (trs *testRateSource) Rates() (*Rates, error) {
+	trs.calls++
+	return trs.rates, trs.err
+}
+
+func TestConverter_Rate(t *testing.T) {
+	source := &testRateSource{
+		rates: &Rates{Base: "USD", Rates: map[string]float64{"EUR": 0.8, "GBP": 0.5}},
+	}
+	c := NewConverter(source, time.Hour)
+
+	rate, err := c.Rate("usd", " EUR ")
+	if err != nil || rate != 0.8 {
+		t.Fatalf("expected USD to EUR rate 0.8; got %f, %v", rate, err)
+	}
+
+	// Cross rates are taken through the base currency
+	rate, err = c.Rate("GBP", "EUR")
+	if err != nil || rate != 1.6 {
+		t.Fatalf("expected GBP to EUR rate 1.6; got %f, %v", rate, err)
+	}
+
+	if rate, err = c.Rate("JPY", "JPY"); err != nil || rate != 1.0 {
+		t.Fatalf("expected JPY to JPY rate 1.0; got %f, %v", rate, err)
+	}
+
+	if _, err = c.Rate("USD", "JPY"); err == nil {
+		t.Fatalf("expected error for missing rate")
+	}
+
+	if source.calls != 1 {
+		t.Fatalf("expected rates cached; got %d calls", source.calls)
+	}
+
+	// Stale rates are used when refreshing fails
+	c.refreshed = time.Now().Add(-2 * time.Hour)
+	source.err = fmt.Errorf("unavailable")
+	if rate, err = c.Rate("USD", "EUR"); err != nil || rate != 0.8 {
+		t.Fatalf("expected cached USD to EUR rate 0.8; got %f, %v", rate, err)
+	}
+
+	c = NewConverter(source, time.Hour)
+	if _, err = c.Rate("USD", "EUR"); err == nil {
+		t.Fatalf("expected error without rates")
+	}
+}
+
+func TestFileRateSource_Rates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "currency")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "rates.json")
+	err = ioutil.WriteFile(path, []byte(`{"base": "EUR", "rates": {"USD": 1.25}}`), 0644)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rates, err := NewFileRateSource(path).Rates()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if rate, ok := rates.Rate("usd"); !ok || rate != 1.25 {
+		t.Fatalf("expected USD rate 1.25; got %f", rate)
+	}
+
+	if _, err = parseRates([]byte(`{"rates": {"USD": 1.25}}`)); err == nil {
+		t.Fatalf("expected error for missing base currency")
+	}
+
+	if _, err = NewFileRateSource(filepath.Join(dir, "missing.json")).Rates(); err == nil {
+		t.Fatalf("expected error for missing file")
+	}
+}
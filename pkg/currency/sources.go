@@ -0,0 +1,93 @@
+package currency
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/util/json"
+)
+
+// FileRateSource reads exchange rates from a JSON file of the form
+// {"base": "USD", "rates": {"EUR": 0.84, "GBP": 0.72}}.
+type FileRateSource struct {
+	path string
+}
+
+// NewFileRateSource creates a FileRateSource reading the file at the given
+// path.
+func NewFileRateSource(path string) *FileRateSource {
+	return &FileRateSource{
+		path: path,
+	}
+}
+
+// Name returns the path of the file.
+func (frs *FileRateSource) Name() string {
+	return frs.path
+}
+
+// Rates reads and parses the file.
+func (frs *FileRateSource) Rates() (*Rates, error) {
+	data, err := ioutil.ReadFile(frs.path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRates(data)
+}
+
+// URLRateSource requests exchange rates from an HTTP API responding with JSON
+// of the same form as a FileRateSource, as many public APIs do.
+type URLRateSource struct {
+	url    string
+	client *http.Client
+}
+
+// NewURLRateSource creates a URLRateSource requesting the given URL.
+func NewURLRateSource(url string) *URLRateSource {
+	return &URLRateSource{
+		url:    url,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Name returns the URL.
+func (urs *URLRateSource) Name() string {
+	return urs.url
+}
+
+// Rates requests and parses the URL.
+func (urs *URLRateSource) Rates() (*Rates, error) {
+	resp, err := urs.client.Get(urs.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRates(data)
+}
+
+// parseRates parses the given JSON, which must define a base currency.
+func parseRates(data []byte) (*Rates, error) {
+	rates := &Rates{}
+	err := json.Unmarshal(data, rates)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing rates: %s", err)
+	}
+	if rates.Base == "" {
+		return nil, fmt.Errorf("error parsing rates: missing base currency")
+	}
+
+	return rates, nil
+}
@@ -66,6 +66,38 @@ const (
 	ETLEnabledEnvVar             = "ETL_ENABLED"
 	ETLMaxBatchHours             = "ETL_MAX_BATCH_HOURS"
 	ETLResolutionSeconds         = "ETL_RESOLUTION_SECONDS"
+	ETLDailyStoreDurationDays    = "ETL_DAILY_STORE_DURATION_DAYS"
+	ETLHourlyStoreDurationHours  = "ETL_HOURLY_STORE_DURATION_HOURS"
+	ETLRefreshRateMinutes        = "ETL_REFRESH_RATE_MINUTES"
+	ETLPathEnvVar                = "ETL_PATH"
+	ETLBackupStorageEnvVar       = "ETL_BACKUP_STORAGE"
+	ETLBackupPathEnvVar          = "ETL_BACKUP_PATH"
+	ETLBackupS3BucketEnvVar      = "ETL_BACKUP_S3_BUCKET"
+	ETLBackupS3RegionEnvVar      = "ETL_BACKUP_S3_REGION"
+	ETLBackupS3EndpointEnvVar    = "ETL_BACKUP_S3_ENDPOINT"
+	ETLBackupS3InsecureEnvVar    = "ETL_BACKUP_S3_INSECURE"
+	ETLBackupS3AccessKeyIDEnvVar = "ETL_BACKUP_S3_ACCESS_KEY_ID"
+	ETLBackupS3SecretKeyEnvVar   = "ETL_BACKUP_S3_SECRET_ACCESS_KEY"
+	ETLBackupRetentionDays       = "ETL_BACKUP_RETENTION_DAYS"
+	ReportsConfigPathEnvVar      = "REPORTS_CONFIG_PATH"
+	ReportsPathEnvVar            = "REPORTS_PATH"
+	BudgetsEvaluationMinutes     = "BUDGETS_EVALUATION_INTERVAL_MINUTES"
+	BudgetsDBPathEnvVar          = "BUDGETS_DB_PATH"
+	AnomalyDetectionEnabled      = "ANOMALY_DETECTION_ENABLED"
+	AnomalyBaselineDays          = "ANOMALY_BASELINE_DAYS"
+	AnomalyLookbackDays          = "ANOMALY_LOOKBACK_DAYS"
+	AnomalyMethod                = "ANOMALY_METHOD"
+	AnomalyThreshold             = "ANOMALY_THRESHOLD"
+	AnomalyMinCost               = "ANOMALY_MIN_COST"
+	AnomalyRefreshRateMinutes    = "ANOMALY_REFRESH_RATE_MINUTES"
+	CurrencyRatesPathEnvVar      = "CURRENCY_RATES_PATH"
+	CurrencyRatesURLEnvVar       = "CURRENCY_RATES_URL"
+	CurrencyRatesRefreshMinutes  = "CURRENCY_RATES_REFRESH_MINUTES"
+	ReconciliationEnabled        = "RECONCILIATION_ENABLED"
+	ReconciliationDays           = "RECONCILIATION_DAYS"
+	ReconciliationRefreshMinutes = "RECONCILIATION_REFRESH_RATE_MINUTES"
+	LabelConfigPathEnvVar        = "LABEL_CONFIG_PATH"
+	BillingConfigPathEnvVar      = "BILLING_CONFIG_PATH"
 	LegacyExternalAPIDisabledVar = "LEGACY_EXTERNAL_API_DISABLED"
 )
 
@@ -373,6 +405,216 @@ func GetETLResolution() time.Duration {
 	return secs * time.Second
 }
 
+// GetETLDailyStoreDuration returns the duration of history, ending now, for
+// which the ETL computes and stores daily sets. Defaults to 91 days.
+func GetETLDailyStoreDuration() time.Duration {
+	days := time.Duration(GetInt64(ETLDailyStoreDurationDays, 91))
+	return days * 24 * time.Hour
+}
+
+// GetETLHourlyStoreDuration returns the duration of history, ending now, for
+// which the ETL computes and stores hourly sets. Defaults to 49 hours.
+func GetETLHourlyStoreDuration() time.Duration {
+	hrs := time.Duration(GetInt64(ETLHourlyStoreDurationHours, 49))
+	return hrs * time.Hour
+}
+
+// GetETLRefreshRate returns the interval at which the ETL recomputes any
+// incomplete sets. Defaults to 10 minutes.
+func GetETLRefreshRate() time.Duration {
+	mins := time.Duration(GetInt64(ETLRefreshRateMinutes, 10))
+	return mins * time.Minute
+}
+
+// GetETLPath returns the directory in which the ETL stores its files.
+// Defaults to "etl/" within the configured config path.
+func GetETLPath() string {
+	return Get(ETLPathEnvVar, GetConfigPathWithDefault("/var/configs/")+"etl/")
+}
+
+// GetETLBackupStorage returns the type of storage to which ETL files are
+// backed up: "file", "s3", or empty for no backup.
+func GetETLBackupStorage() string {
+	return Get(ETLBackupStorageEnvVar, "")
+}
+
+// GetETLBackupPath returns the directory of a "file" ETL backup, or the key
+// prefix within the bucket of an "s3" ETL backup.
+func GetETLBackupPath() string {
+	return Get(ETLBackupPathEnvVar, "")
+}
+
+// GetETLBackupS3Bucket returns the bucket of an "s3" ETL backup.
+func GetETLBackupS3Bucket() string {
+	return Get(ETLBackupS3BucketEnvVar, "")
+}
+
+// GetETLBackupS3Region returns the region of the bucket of an "s3" ETL
+// backup.
+func GetETLBackupS3Region() string {
+	return Get(ETLBackupS3RegionEnvVar, "us-east-1")
+}
+
+// GetETLBackupS3Endpoint returns the custom endpoint of an "s3" ETL backup,
+// for use with S3-compatible services; e.g. "minio.kubecost:9000".
+func GetETLBackupS3Endpoint() string {
+	return Get(ETLBackupS3EndpointEnvVar, "")
+}
+
+// IsETLBackupS3Insecure returns true if TLS should be disabled when
+// connecting to the custom endpoint of an "s3" ETL backup.
+func IsETLBackupS3Insecure() bool {
+	return GetBool(ETLBackupS3InsecureEnvVar, false)
+}
+
+// GetETLBackupS3AccessKeyID returns the access key ID of an "s3" ETL backup.
+// If empty, the default AWS credential chain is used.
+func GetETLBackupS3AccessKeyID() string {
+	return Get(ETLBackupS3AccessKeyIDEnvVar, "")
+}
+
+// GetETLBackupS3SecretAccessKey returns the secret access key of an "s3" ETL
+// backup.
+func GetETLBackupS3SecretAccessKey() string {
+	return Get(ETLBackupS3SecretKeyEnvVar, "")
+}
+
+// GetETLBackupRetention returns the duration of history, ending now, for
+// which ETL files are kept in the backup, independently of the stores'
+// durations. Defaults to 0, which keeps backups indefinitely.
+func GetETLBackupRetention() time.Duration {
+	days := time.Duration(GetInt64(ETLBackupRetentionDays, 0))
+	return days * 24 * time.Hour
+}
+
+// GetReportsConfigPath returns the path of the JSON file defining scheduled
+// reports. Defaults to "reports.json" within the configured config path.
+func GetReportsConfigPath() string {
+	return Get(ReportsConfigPathEnvVar, GetConfigPathWithDefault("/var/configs/")+"reports.json")
+}
+
+// GetReportsPath returns the directory in which the delivery history of
+// scheduled reports is stored. Defaults to "reports/" within the configured
+// config path.
+func GetReportsPath() string {
+	return Get(ReportsPathEnvVar, GetConfigPathWithDefault("/var/configs/")+"reports/")
+}
+
+// GetBudgetsEvaluationInterval returns the interval at which budgets are
+// evaluated against allocations. Defaults to 60 minutes.
+func GetBudgetsEvaluationInterval() time.Duration {
+	mins := time.Duration(GetInt64(BudgetsEvaluationMinutes, 60))
+	return mins * time.Minute
+}
+
+// GetBudgetsDBPath returns the path of the database in which budgets and
+// their statuses are stored. Defaults to "budgets.db" within the configured
+// config path.
+func GetBudgetsDBPath() string {
+	return Get(BudgetsDBPathEnvVar, GetConfigPathWithDefault("/var/configs/")+"budgets.db")
+}
+
+// IsAnomalyDetectionEnabled returns true if daily spend anomalies should be
+// detected in the background. Defaults to true if the ETL is enabled, which
+// serves the daily allocations that anomalies are detected from.
+func IsAnomalyDetectionEnabled() bool {
+	return GetBool(AnomalyDetectionEnabled, IsETLEnabled())
+}
+
+// GetAnomalyBaselineDays returns the number of days preceding each day
+// against which that day's spend is compared. Defaults to 14.
+func GetAnomalyBaselineDays() int {
+	return GetInt(AnomalyBaselineDays, 14)
+}
+
+// GetAnomalyLookbackDays returns the number of most recent complete days in
+// which anomalies are detected. Defaults to 7.
+func GetAnomalyLookbackDays() int {
+	return GetInt(AnomalyLookbackDays, 7)
+}
+
+// GetAnomalyMethod returns the method by which the baseline of daily spend
+// is summarized: "mad" (median absolute deviation) or "stddev" (mean and
+// standard deviation). Defaults to "mad".
+func GetAnomalyMethod() string {
+	return Get(AnomalyMethod, "mad")
+}
+
+// GetAnomalyThreshold returns the score, in units of the baseline's
+// deviation, above which a day's spend is anomalous. Defaults to 3.5.
+func GetAnomalyThreshold() float64 {
+	return GetFloat64(AnomalyThreshold, 3.5)
+}
+
+// GetAnomalyMinCost returns the minimum increase in daily spend over the
+// baseline for a day to be anomalous, which suppresses anomalies in trivial
+// spend. Defaults to 1.0.
+func GetAnomalyMinCost() float64 {
+	return GetFloat64(AnomalyMinCost, 1.0)
+}
+
+// GetAnomalyRefreshRate returns the interval at which anomalies are
+// detected. Defaults to 60 minutes.
+func GetAnomalyRefreshRate() time.Duration {
+	mins := time.Duration(GetInt64(AnomalyRefreshRateMinutes, 60))
+	return mins * time.Minute
+}
+
+// GetCurrencyRatesPath returns the path of the JSON file of exchange rates
+// by which costs are converted to requested currencies.
+func GetCurrencyRatesPath() string {
+	return Get(CurrencyRatesPathEnvVar, GetConfigPathWithDefault("/var/configs/")+"currency-rates.json")
+}
+
+// GetCurrencyRatesURL returns the URL of an API responding with exchange
+// rates, which, if set, is used instead of the exchange rates file.
+func GetCurrencyRatesURL() string {
+	return Get(CurrencyRatesURLEnvVar, "")
+}
+
+// GetCurrencyRatesRefreshInterval returns the interval at which exchange
+// rates are refreshed. Defaults to 60 minutes.
+func GetCurrencyRatesRefreshInterval() time.Duration {
+	mins := time.Duration(GetInt64(CurrencyRatesRefreshMinutes, 60))
+	return mins * time.Minute
+}
+
+// IsReconciliationEnabled returns true if the costs of assets should be
+// reconciled with the cloud provider's bill. Defaults to false, as it
+// requires billing data, e.g. Athena or BigQuery, to be configured.
+func IsReconciliationEnabled() bool {
+	return GetBool(ReconciliationEnabled, false)
+}
+
+// GetReconciliationDays returns the number of most recent complete days of
+// billing data which are retained for, and refreshed by, reconciliation.
+// Defaults to 7.
+func GetReconciliationDays() int {
+	return int(GetInt64(ReconciliationDays, 7))
+}
+
+// GetReconciliationRefreshRate returns the interval at which billing data is
+// refreshed for reconciliation. Defaults to 360 minutes.
+func GetReconciliationRefreshRate() time.Duration {
+	mins := time.Duration(GetInt64(ReconciliationRefreshMinutes, 360))
+	return mins * time.Minute
+}
+
+// GetLabelConfigPath returns the path of the JSON file configuring the labels
+// which represent Kubernetes concepts, e.g. the tag by which out-of-cluster
+// costs are attributed to namespaces. Defaults to "labels.json" within the
+// configured config path.
+func GetLabelConfigPath() string {
+	return Get(LabelConfigPathEnvVar, GetConfigPathWithDefault("/var/configs/")+"labels.json")
+}
+
+// GetBillingConfigPath returns the path of the JSON file configuring the
+// ingestion of billing exports in a standard column schema, e.g. FOCUS, from
+// storage. Defaults to "billing.json" within the configured config path.
+func GetBillingConfigPath() string {
+	return Get(BillingConfigPathEnvVar, GetConfigPathWithDefault("/var/configs/")+"billing.json")
+}
+
 func LegacyExternalCostsAPIDisabled() bool {
 	return GetBool(LegacyExternalAPIDisabledVar, false)
 }
@@ -0,0 +1,264 @@
+package etl
+
+import (
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/errors"
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/storage"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+const (
+	// DailyStoreName is the name of the store of daily AllocationSets
+	DailyStoreName = "daily"
+
+	// HourlyStoreName is the name of the store of hourly AllocationSets
+	HourlyStoreName = "hourly"
+
+	// completeBuffer is the time after the end of a window after which a set
+	// computed for that window is considered complete and is never
+	// recomputed. This allows for late-arriving Prometheus data.
+	completeBuffer = 10 * time.Minute
+)
+
+// AllocationComputer computes the AllocationSet for the window defined by
+// the given start and end times, querying at the given resolution; e.g.
+// costmodel.CostModel.
+type AllocationComputer interface {
+	ComputeAllocation(start, end time.Time, resolution time.Duration) (*kubecost.AllocationSet, error)
+}
+
+// AllocationETLConfig configures an AllocationETL.
+type AllocationETLConfig struct {
+	// Path is the local directory in which the daily and hourly stores keep
+	// their files, each in its own sub-directory
+	Path string
+
+	// Backup is an optional Storage to which every file is also written,
+	// and from which any missing files are restored when the ETL is created;
+	// e.g. an S3Storage, so that data outlives both the local disk and the
+	// Prometheus retention period.
+	Backup storage.Storage
+
+	// BackupDuration is the duration of history, ending now, to retain in
+	// the backup. Sets which age out of the stores are kept in the backup
+	// until they age out of this duration; zero keeps them indefinitely.
+	BackupDuration time.Duration
+
+	// DailyDuration and HourlyDuration are the durations of history, ending
+	// now, to retain in the daily and hourly stores, respectively. A zero
+	// duration disables the store.
+	DailyDuration  time.Duration
+	HourlyDuration time.Duration
+
+	// Resolution is the resolution at which sets are computed
+	Resolution time.Duration
+
+	// MaxBatch is the maximum batch size used by the AllocationComputer,
+	// which is reported in the status
+	MaxBatch time.Duration
+
+	// RefreshRate is the interval at which incomplete sets are recomputed
+	RefreshRate time.Duration
+
+	// UTCOffset determines the boundaries of the daily sets
+	UTCOffset time.Duration
+}
+
+// AllocationETL is a background process which periodically computes daily
+// and hourly AllocationSets, stores them on disk, and serves them in place of
+// re-computing the sets from Prometheus.
+type AllocationETL struct {
+	computer  AllocationComputer
+	config    AllocationETLConfig
+	stores    map[string]*allocationStore
+	startTime time.Time
+	runLock   sync.Mutex
+	stop      chan struct{}
+}
+
+// NewAllocationETL creates an AllocationETL with the given computer and
+// config, loading any previously stored sets from disk, after restoring any
+// missing sets from the backup. The ETL does not run until Start is called.
+func NewAllocationETL(computer AllocationComputer, config AllocationETLConfig) (*AllocationETL, error) {
+	if computer == nil {
+		return nil, fmt.Errorf("AllocationETL: computer is nil")
+	}
+	if config.Resolution <= 0 {
+		return nil, fmt.Errorf("AllocationETL: illegal resolution: %s", config.Resolution)
+	}
+	if config.RefreshRate <= 0 {
+		return nil, fmt.Errorf("AllocationETL: illegal refresh rate: %s", config.RefreshRate)
+	}
+
+	loc := time.FixedZone("", int(config.UTCOffset.Seconds()))
+
+	etl := &AllocationETL{
+		computer: computer,
+		config:   config,
+		stores:   map[string]*allocationStore{},
+	}
+
+	steps := map[string]time.Duration{
+		DailyStoreName:  24 * time.Hour,
+		HourlyStoreName: time.Hour,
+	}
+	durations := map[string]time.Duration{
+		DailyStoreName:  config.DailyDuration,
+		HourlyStoreName: config.HourlyDuration,
+	}
+
+	files := storage.NewFileStorage(config.Path)
+
+	for name, step := range steps {
+		if durations[name] <= 0 {
+			continue
+		}
+
+		store := newAllocationStore(name, step, durations[name], path.Join("allocation", name), files, config.Backup, loc)
+
+		err := store.load()
+		if err != nil {
+			return nil, fmt.Errorf("AllocationETL: %s", err)
+		}
+
+		etl.stores[name] = store
+	}
+
+	return etl, nil
+}
+
+// Start runs the ETL in the background, immediately and then at the
+// configured refresh rate, until Stop is called.
+func (etl *AllocationETL) Start() {
+	etl.startTime = time.Now()
+	etl.stop = make(chan struct{})
+
+	go func(stop chan struct{}) {
+		defer errors.HandlePanic()
+
+		for {
+			etl.Run(time.Now())
+
+			select {
+			case <-stop:
+				return
+			case <-time.After(etl.config.RefreshRate):
+			}
+		}
+	}(etl.stop)
+}
+
+// Stop stops the background ETL started by Start.
+func (etl *AllocationETL) Stop() {
+	if etl.stop != nil {
+		close(etl.stop)
+		etl.stop = nil
+	}
+}
+
+// Run computes and stores every set of each store which is missing or
+// incomplete as of the given time, then deletes every set that has aged out
+// of its store's duration.
+func (etl *AllocationETL) Run(now time.Time) {
+	etl.runLock.Lock()
+	defer etl.runLock.Unlock()
+
+	for _, name := range []string{DailyStoreName, HourlyStoreName} {
+		store, ok := etl.stores[name]
+		if !ok {
+			continue
+		}
+
+		windows := []kubecost.Window{}
+		for _, w := range store.windows(now) {
+			if store.needsCompute(w, completeBuffer) {
+				windows = append(windows, w)
+			}
+		}
+
+		store.Lock()
+		store.progress = 0.0
+		store.Unlock()
+
+		// Record each set as computed at the start of the run, rather than on
+		// completion, so that data arriving mid-run is never missed.
+		for i, w := range windows {
+			as, err := etl.computer.ComputeAllocation(*w.Start(), *w.End(), etl.config.Resolution)
+			if err != nil {
+				log.Warningf("ETL: %s: error computing allocation for %s: %s", name, w, err)
+			} else if err = store.save(as, now); err != nil {
+				log.Warningf("ETL: %s: error saving allocation for %s: %s", name, w, err)
+			}
+
+			store.Lock()
+			store.progress = float64(i+1) / float64(len(windows))
+			store.Unlock()
+		}
+
+		store.prune(kubecost.RoundBack(now.In(store.loc).Add(-store.duration), store.step))
+		if store.backup != nil && etl.config.BackupDuration > 0 {
+			store.pruneBackup(kubecost.RoundBack(now.In(store.loc).Add(-etl.config.BackupDuration), store.step))
+		}
+
+		store.Lock()
+		store.lastRun = now
+		store.progress = 1.0
+		store.Unlock()
+
+		log.Infof("ETL: %s: computed %d allocation sets", name, len(windows))
+	}
+}
+
+// ComputeAllocation returns the AllocationSet for the window defined by the
+// given start and end times, accumulated from the stored daily or hourly
+// sets, if they fully cover the window. Otherwise, it returns false.
+func (etl *AllocationETL) ComputeAllocation(start, end time.Time) (*kubecost.AllocationSet, bool) {
+	if etl == nil {
+		return nil, false
+	}
+
+	for _, name := range []string{DailyStoreName, HourlyStoreName} {
+		store, ok := etl.stores[name]
+		if !ok {
+			continue
+		}
+
+		if as, ok := store.query(start, end); ok {
+			return as, true
+		}
+	}
+
+	return nil, false
+}
+
+// Status returns the ETLStatus of each store, keyed by store name.
+func (etl *AllocationETL) Status() map[string]*kubecost.ETLStatus {
+	status := map[string]*kubecost.ETLStatus{}
+
+	for name, store := range etl.stores {
+		coverage := store.coverage()
+
+		store.RLock()
+		status[name] = &kubecost.ETLStatus{
+			Coverage:    coverage,
+			LastRun:     store.lastRun,
+			Progress:    store.progress,
+			RefreshRate: etl.config.RefreshRate.String(),
+			Resolution:  etl.config.Resolution.String(),
+			MaxBatch:    etl.config.MaxBatch.String(),
+			StartTime:   etl.startTime,
+			UTCOffset:   util.FormatUTCOffset(etl.config.UTCOffset),
+		}
+		store.RUnlock()
+
+		status[name].Backup = store.backupStatus()
+	}
+
+	return status
+}
@@ -0,0 +1,248 @@
+package etl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/storage"
+)
+
+// mockAllocationComputer returns a set with a single allocation costing one
+// dollar per hour, and counts the number of calls made.
+type mockAllocationComputer struct {
+	sync.Mutex
+	calls int
+}
+
+func (mac *mockAllocationComputer) ComputeAllocation(start, end time.Time, resolution time.Duration) (*kubecost.AllocationSet, error) {
+	mac.Lock()
+	mac.calls++
+	mac.Unlock()
+
+	alloc := &kubecost.Allocation{
+		Name: "cluster1/namespace1/pod1/container1",
+		Properties: &kubecost.AllocationProperties{
+			Cluster:   "cluster1",
+			Namespace: "namespace1",
+			Pod:       "pod1",
+			Container: "container1",
+		},
+		Window:  kubecost.NewWindow(&start, &end),
+		Start:   start,
+		End:     end,
+		CPUCost: end.Sub(start).Hours(),
+	}
+
+	return kubecost.NewAllocationSet(start, end, alloc), nil
+}
+
+func newTestAllocationETL(t *testing.T, dir string, computer AllocationComputer) *AllocationETL {
+	return newTestAllocationETLWithBackup(t, dir, nil, computer)
+}
+
+func newTestAllocationETLWithBackup(t *testing.T, dir string, backup storage.Storage, computer AllocationComputer) *AllocationETL {
+	allocETL, err := NewAllocationETL(computer, AllocationETLConfig{
+		Path:           dir,
+		Backup:         backup,
+		DailyDuration:  3 * 24 * time.Hour,
+		HourlyDuration: 6 * time.Hour,
+		Resolution:     time.Minute,
+		MaxBatch:       6 * time.Hour,
+		RefreshRate:    10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return allocETL
+}
+
+func TestAllocationETL_Run(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Run the ETL at 12:30 on the fourth day, long after the last run of each
+	// of the earlier windows, so that only the current windows are incomplete
+	now := time.Date(2021, 4, 4, 12, 30, 0, 0, time.UTC)
+
+	computer := &mockAllocationComputer{}
+	allocETL := newTestAllocationETL(t, dir, computer)
+	allocETL.Run(now)
+
+	// 4 daily sets: three full days plus today; 7 hourly sets: six full hours
+	// plus the current hour
+	if computer.calls != 11 {
+		t.Fatalf("expected 11 computations; got %d", computer.calls)
+	}
+
+	files, _ := ioutil.ReadDir(filepath.Join(dir, "allocation", DailyStoreName))
+	if len(files) != 4 {
+		t.Fatalf("expected 4 daily files; got %d", len(files))
+	}
+	files, _ = ioutil.ReadDir(filepath.Join(dir, "allocation", HourlyStoreName))
+	if len(files) != 7 {
+		t.Fatalf("expected 7 hourly files; got %d", len(files))
+	}
+
+	// Serve a two-day window from the daily store
+	start := time.Date(2021, 4, 2, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2021, 4, 4, 0, 0, 0, 0, time.UTC)
+	as, ok := allocETL.ComputeAllocation(start, end)
+	if !ok {
+		t.Fatalf("expected daily store to cover %s", kubecost.NewWindow(&start, &end))
+	}
+	if as.TotalCost() != 48.0 {
+		t.Fatalf("expected total cost 48.0; got %f", as.TotalCost())
+	}
+	if !as.Start().Equal(start) || !as.End().Equal(end) {
+		t.Fatalf("expected window %s; got %s", kubecost.NewWindow(&start, &end), as.Window)
+	}
+
+	// Mutating the result must not mutate the store
+	as.Delete("cluster1/namespace1/pod1/container1")
+	as, _ = allocETL.ComputeAllocation(start, end)
+	if as.TotalCost() != 48.0 {
+		t.Fatalf("expected total cost 48.0 after mutation; got %f", as.TotalCost())
+	}
+
+	// Serve a two-hour window from the hourly store
+	start = time.Date(2021, 4, 4, 8, 0, 0, 0, time.UTC)
+	end = time.Date(2021, 4, 4, 10, 0, 0, 0, time.UTC)
+	as, ok = allocETL.ComputeAllocation(start, end)
+	if !ok {
+		t.Fatalf("expected hourly store to cover %s", kubecost.NewWindow(&start, &end))
+	}
+	if as.TotalCost() != 2.0 {
+		t.Fatalf("expected total cost 2.0; got %f", as.TotalCost())
+	}
+
+	// Unaligned windows and windows outside of the stores are not served
+	start = time.Date(2021, 4, 4, 8, 30, 0, 0, time.UTC)
+	if _, ok = allocETL.ComputeAllocation(start, end); ok {
+		t.Fatalf("expected unaligned window not to be served")
+	}
+	start = time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	end = time.Date(2021, 3, 2, 0, 0, 0, 0, time.UTC)
+	if _, ok = allocETL.ComputeAllocation(start, end); ok {
+		t.Fatalf("expected uncovered window not to be served")
+	}
+
+	// Running again recomputes only the sets which were incomplete
+	computer.calls = 0
+	allocETL.Run(now.Add(time.Minute))
+	if computer.calls != 2 {
+		t.Fatalf("expected 2 computations; got %d", computer.calls)
+	}
+
+	status := allocETL.Status()
+	if status[DailyStoreName] == nil || status[HourlyStoreName] == nil {
+		t.Fatalf("expected status for each store; got %v", status)
+	}
+	if status[DailyStoreName].Progress != 1.0 {
+		t.Fatalf("expected progress 1.0; got %f", status[DailyStoreName].Progress)
+	}
+	expStart := time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)
+	if !status[DailyStoreName].Coverage.Start().Equal(expStart) {
+		t.Fatalf("expected coverage to start at %s; got %s", expStart, status[DailyStoreName].Coverage)
+	}
+}
+
+func TestAllocationETL_Load(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2021, 4, 4, 12, 30, 0, 0, time.UTC)
+
+	newTestAllocationETL(t, dir, &mockAllocationComputer{}).Run(now)
+
+	// A new ETL restores the stored sets from disk
+	computer := &mockAllocationComputer{}
+	allocETL := newTestAllocationETL(t, dir, computer)
+
+	start := time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2021, 4, 4, 0, 0, 0, 0, time.UTC)
+	as, ok := allocETL.ComputeAllocation(start, end)
+	if !ok {
+		t.Fatalf("expected restored daily store to cover %s", kubecost.NewWindow(&start, &end))
+	}
+	if as.TotalCost() != 72.0 {
+		t.Fatalf("expected total cost 72.0; got %f", as.TotalCost())
+	}
+}
+
+func TestAllocationETL_Backup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	localDir := filepath.Join(dir, "local")
+	backup := storage.NewFileStorage(filepath.Join(dir, "backup"))
+
+	now := time.Date(2021, 4, 4, 12, 30, 0, 0, time.UTC)
+
+	newTestAllocationETLWithBackup(t, localDir, backup, &mockAllocationComputer{}).Run(now)
+
+	files, err := backup.List("allocation/daily")
+	if err != nil || len(files) != 4 {
+		t.Fatalf("expected 4 daily backup files; got (%d, %v)", len(files), err)
+	}
+
+	// Lose the local disk entirely, then restore from the backup
+	os.RemoveAll(localDir)
+
+	computer := &mockAllocationComputer{}
+	allocETL := newTestAllocationETLWithBackup(t, localDir, backup, computer)
+
+	start := time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2021, 4, 4, 0, 0, 0, 0, time.UTC)
+	as, ok := allocETL.ComputeAllocation(start, end)
+	if !ok {
+		t.Fatalf("expected restored daily store to cover %s", kubecost.NewWindow(&start, &end))
+	}
+	if as.TotalCost() != 72.0 {
+		t.Fatalf("expected total cost 72.0; got %f", as.TotalCost())
+	}
+
+	localFiles, _ := ioutil.ReadDir(filepath.Join(localDir, "allocation", DailyStoreName))
+	if len(localFiles) != 4 {
+		t.Fatalf("expected 4 restored daily files; got %d", len(localFiles))
+	}
+
+	status := allocETL.Status()
+	if status[DailyStoreName].Backup == nil || status[DailyStoreName].Backup.FileCount != 4 {
+		t.Fatalf("expected backup status with 4 files; got %+v", status[DailyStoreName].Backup)
+	}
+
+	// Sets which age out of the store are kept in the backup, unless they
+	// also age out of the backup's duration
+	agedOut := "allocation/daily/" + allocETL.stores[DailyStoreName].fileName(start, start.Add(24*time.Hour))
+	allocETL.Run(now.Add(24 * time.Hour))
+	if ok, _ := allocETL.stores[DailyStoreName].files.Exists(agedOut); ok {
+		t.Fatalf("expected aged-out set to be deleted from local disk")
+	}
+	if ok, _ := backup.Exists(agedOut); !ok {
+		t.Fatalf("expected aged-out set to be kept in backup")
+	}
+
+	allocETL.config.BackupDuration = 3 * 24 * time.Hour
+	allocETL.Run(now.Add(24 * time.Hour))
+	if ok, _ := backup.Exists(agedOut); ok {
+		t.Fatalf("expected set older than the backup duration to be deleted from backup")
+	}
+	if ok, _ := backup.Exists("allocation/daily/" + allocETL.stores[DailyStoreName].fileName(end, end.Add(24*time.Hour))); !ok {
+		t.Fatalf("expected recent set to be kept in backup")
+	}
+}
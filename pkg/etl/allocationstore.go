@@ -0,0 +1,415 @@
+package etl
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kubecost/cost-model/pkg/kubecost"
+	"github.com/kubecost/cost-model/pkg/log"
+	"github.com/kubecost/cost-model/pkg/storage"
+	"github.com/kubecost/cost-model/pkg/util"
+)
+
+// allocationStore holds the AllocationSets of a single step (e.g. daily or
+// hourly) in memory, keyed by start time, and persists each set to its own
+// file on local disk using the binary codecs. If a backup Storage is given,
+// each file is also written to the backup, from which missing files are
+// restored on load.
+type allocationStore struct {
+	sync.RWMutex
+	name     string
+	step     time.Duration
+	duration time.Duration
+	dir      string
+	files    *storage.FileStorage
+	backup   storage.Storage
+	loc      *time.Location
+	sets     map[int64]*allocationStoreEntry
+	lastRun  time.Time
+	progress float64
+}
+
+// allocationStoreEntry is a stored AllocationSet and the time at which it was
+// computed, which determines whether or not it must be recomputed.
+type allocationStoreEntry struct {
+	set        *kubecost.AllocationSet
+	computedAt time.Time
+}
+
+// newAllocationStore creates a store of AllocationSets of the given step,
+// retained for the given duration, in the given directory of the given local
+// FileStorage and, optionally, of the given backup Storage.
+func newAllocationStore(name string, step, duration time.Duration, dir string, files *storage.FileStorage, backup storage.Storage, loc *time.Location) *allocationStore {
+	return &allocationStore{
+		name:     name,
+		step:     step,
+		duration: duration,
+		dir:      dir,
+		files:    files,
+		backup:   backup,
+		loc:      loc,
+		sets:     map[int64]*allocationStoreEntry{},
+	}
+}
+
+// windows returns the windows of the store's step which cover the store's
+// duration, ending with the window containing the given time.
+func (s *allocationStore) windows(now time.Time) []kubecost.Window {
+	windows := []kubecost.Window{}
+
+	end := kubecost.RoundForward(now.In(s.loc), s.step)
+	start := kubecost.RoundBack(now.In(s.loc).Add(-s.duration), s.step)
+	for start.Before(end) {
+		wStart := start
+		wEnd := start.Add(s.step)
+		windows = append(windows, kubecost.NewWindow(&wStart, &wEnd))
+		start = wEnd
+	}
+
+	return windows
+}
+
+// fileName returns the name of the file in which the set of the given window
+// is stored; i.e. "<start>-<end>" in unix seconds.
+func (s *allocationStore) fileName(start, end time.Time) string {
+	return fmt.Sprintf("%d-%d", start.Unix(), end.Unix())
+}
+
+// filePath returns the path, relative to the root of storage, of the file
+// with the given name.
+func (s *allocationStore) filePath(name string) string {
+	return path.Join(s.dir, name)
+}
+
+// parseFileName returns the start and end times encoded in the given file
+// name, as generated by fileName.
+func (s *allocationStore) parseFileName(name string) (time.Time, time.Time, error) {
+	parts := strings.Split(name, "-")
+	if len(parts) != 2 {
+		return time.Time{}, time.Time{}, fmt.Errorf("illegal file name: %s", name)
+	}
+
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("illegal file name: %s", name)
+	}
+
+	end, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("illegal file name: %s", name)
+	}
+
+	return time.Unix(start, 0).In(s.loc), time.Unix(end, 0).In(s.loc), nil
+}
+
+// load reads every AllocationSet file in the store's directory into memory,
+// using each file's modification time as the time it was computed. If there
+// is a backup, then any file which is missing locally is first restored from
+// the backup.
+func (s *allocationStore) load() error {
+	if s.backup != nil {
+		err := s.restore()
+		if err != nil {
+			log.Warningf("ETL: %s: error restoring from backup %s: %s", s.name, s.backup.FullPath(s.dir), err)
+		}
+	}
+
+	files, err := s.files.List(s.dir)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	for _, file := range files {
+		start, end, err := s.parseFileName(file.Name)
+		if err != nil || end.Sub(start) != s.step {
+			log.Warningf("ETL: %s: skipping unrecognized file %s", s.name, file.Name)
+			continue
+		}
+
+		data, err := s.files.Read(s.filePath(file.Name))
+		if err != nil {
+			log.Warningf("ETL: %s: %s", s.name, err)
+			continue
+		}
+
+		as := &kubecost.AllocationSet{}
+		err = as.UnmarshalBinary(data)
+		if err != nil {
+			log.Warningf("ETL: %s: error decoding file %s: %s", s.name, file.Name, err)
+			continue
+		}
+
+		s.sets[start.Unix()] = &allocationStoreEntry{
+			set:        as,
+			computedAt: file.ModTime,
+		}
+	}
+
+	return nil
+}
+
+// restore copies every file from the backup which is missing locally, using
+// the backup's modification time as the time the set was computed.
+func (s *allocationStore) restore() error {
+	backupFiles, err := s.backup.List(s.dir)
+	if err != nil {
+		return err
+	}
+
+	localFiles, err := s.files.List(s.dir)
+	if err != nil {
+		return err
+	}
+	localNames := map[string]bool{}
+	for _, file := range localFiles {
+		localNames[file.Name] = true
+	}
+
+	restored := 0
+	for _, file := range backupFiles {
+		if _, _, err := s.parseFileName(file.Name); err != nil {
+			continue
+		}
+		if localNames[file.Name] {
+			continue
+		}
+
+		data, err := s.backup.Read(s.filePath(file.Name))
+		if err != nil {
+			log.Warningf("ETL: %s: %s", s.name, err)
+			continue
+		}
+
+		err = s.writeLocal(file.Name, data, file.ModTime)
+		if err != nil {
+			log.Warningf("ETL: %s: %s", s.name, err)
+			continue
+		}
+
+		restored++
+	}
+
+	if restored > 0 {
+		log.Infof("ETL: %s: restored %d files from backup %s", s.name, restored, s.backup.FullPath(s.dir))
+	}
+
+	return nil
+}
+
+// writeLocal writes the given data to the local file of the given name,
+// setting its modification time to the given time.
+func (s *allocationStore) writeLocal(name string, data []byte, modTime time.Time) error {
+	err := s.files.Write(s.filePath(name), data)
+	if err != nil {
+		return err
+	}
+
+	err = os.Chtimes(s.files.FullPath(s.filePath(name)), modTime, modTime)
+	if err != nil {
+		log.Warningf("ETL: %s: error setting modification time of %s: %s", s.name, name, err)
+	}
+
+	return nil
+}
+
+// needsCompute returns true if the set of the given window has not been
+// computed since the given buffer elapsed after the end of the window.
+func (s *allocationStore) needsCompute(window kubecost.Window, buffer time.Duration) bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	entry, ok := s.sets[window.Start().Unix()]
+	if !ok {
+		return true
+	}
+
+	return !entry.computedAt.After(window.End().Add(buffer))
+}
+
+// save stores the given AllocationSet in memory, writes it to local disk,
+// and, if there is a backup, writes it to the backup.
+func (s *allocationStore) save(as *kubecost.AllocationSet, computedAt time.Time) error {
+	data, err := as.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("error encoding set %s: %s", as.Window, err)
+	}
+
+	name := s.fileName(as.Start(), as.End())
+
+	err = s.writeLocal(name, data, computedAt)
+	if err != nil {
+		return err
+	}
+
+	if s.backup != nil {
+		err = s.backup.Write(s.filePath(name), data)
+		if err != nil {
+			log.Warningf("ETL: %s: error backing up %s: %s", s.name, name, err)
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.sets[as.Start().Unix()] = &allocationStoreEntry{
+		set:        as,
+		computedAt: computedAt,
+	}
+
+	return nil
+}
+
+// prune deletes, from memory and local disk, every set that starts before the
+// given time. Backups are retained independently; see pruneBackup.
+func (s *allocationStore) prune(before time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	for key, entry := range s.sets {
+		if !entry.set.Start().Before(before) {
+			continue
+		}
+
+		filePath := s.filePath(s.fileName(entry.set.Start(), entry.set.End()))
+		err := s.files.Remove(filePath)
+		if err != nil && !storage.IsNotExist(err) {
+			log.Warningf("ETL: %s: %s", s.name, err)
+			continue
+		}
+
+		delete(s.sets, key)
+	}
+}
+
+// pruneBackup deletes, from the backup, every file of a set that starts
+// before the given time.
+func (s *allocationStore) pruneBackup(before time.Time) {
+	files, err := s.backup.List(s.dir)
+	if err != nil {
+		log.Warningf("ETL: %s: %s", s.name, err)
+		return
+	}
+
+	for _, file := range files {
+		start, _, err := s.parseFileName(file.Name)
+		if err != nil || !start.Before(before) {
+			continue
+		}
+
+		err = s.backup.Remove(s.filePath(file.Name))
+		if err != nil && !storage.IsNotExist(err) {
+			log.Warningf("ETL: %s: %s", s.name, err)
+		}
+	}
+}
+
+// query returns a single AllocationSet accumulated from the stored sets
+// which exactly cover the given window. If the window is not aligned to the
+// store's step, or if any set in the window is missing, it returns false.
+func (s *allocationStore) query(start, end time.Time) (*kubecost.AllocationSet, bool) {
+	if !start.Before(end) {
+		return nil, false
+	}
+	if !kubecost.RoundBack(start.In(s.loc), s.step).Equal(start) || !kubecost.RoundBack(end.In(s.loc), s.step).Equal(end) {
+		return nil, false
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+
+	// Clone each set so that the stored sets are never mutated by the
+	// accumulation or by the caller.
+	asr := kubecost.NewAllocationSetRange()
+	for t := start; t.Before(end); t = t.Add(s.step) {
+		entry, ok := s.sets[t.Unix()]
+		if !ok {
+			return nil, false
+		}
+		asr.Append(entry.set.Clone())
+	}
+
+	as, err := asr.Accumulate()
+	if err != nil {
+		log.Warningf("ETL: %s: error accumulating sets for %s: %s", s.name, kubecost.NewWindow(&start, &end), err)
+		return nil, false
+	}
+	if as.IsEmpty() {
+		as = kubecost.NewAllocationSet(start, end)
+	}
+
+	return as, true
+}
+
+// coverage returns the window spanning every stored set.
+func (s *allocationStore) coverage() kubecost.Window {
+	s.RLock()
+	defer s.RUnlock()
+
+	keys := []int64{}
+	for key := range s.sets {
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return kubecost.NewWindow(nil, nil)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	start := s.sets[keys[0]].set.Start()
+	end := s.sets[keys[len(keys)-1]].set.End()
+
+	return kubecost.NewWindow(&start, &end)
+}
+
+// backupStatus returns the DirectoryStatus of the store's backup directory,
+// or nil if there is no backup.
+func (s *allocationStore) backupStatus() *kubecost.DirectoryStatus {
+	if s.backup == nil {
+		return nil
+	}
+
+	status := &kubecost.DirectoryStatus{
+		Path:  s.backup.FullPath(s.dir),
+		Files: []kubecost.FileStatus{},
+	}
+
+	files, err := s.backup.List(s.dir)
+	if err != nil {
+		log.Warningf("ETL: %s: %s", s.name, err)
+		return status
+	}
+
+	size := int64(0)
+	for _, file := range files {
+		size += file.Size
+		if file.ModTime.After(status.LastModified) {
+			status.LastModified = file.ModTime
+		}
+
+		fileStatus := kubecost.FileStatus{
+			Name:         file.Name,
+			Size:         util.FormatBytes(file.Size),
+			LastModified: file.ModTime,
+		}
+		if start, end, err := s.parseFileName(file.Name); err == nil {
+			fileStatus.Details = map[string]string{
+				"window": kubecost.NewWindow(&start, &end).String(),
+			}
+		} else {
+			fileStatus.Warnings = []string{"unrecognized file"}
+		}
+		status.Files = append(status.Files, fileStatus)
+	}
+	status.Size = util.FormatBytes(size)
+	status.FileCount = len(files)
+
+	return status
+}
@@ -50,27 +50,35 @@ const ShareNone = "__none__"
 // TODO:CLEANUP consider dropping name in favor of just AllocationProperties and an
 // Assets-style key() function for AllocationSet.
 type Allocation struct {
-	Name                   string                `json:"name"`
-	Properties             *AllocationProperties `json:"properties,omitempty"`
-	Window                 Window                `json:"window"`
-	Start                  time.Time             `json:"start"`
-	End                    time.Time             `json:"end"`
-	CPUCoreHours           float64               `json:"cpuCoreHours"`
-	CPUCoreRequestAverage  float64               `json:"cpuCoreRequestAverage"`
-	CPUCoreUsageAverage    float64               `json:"cpuCoreUsageAverage"`
-	CPUCost                float64               `json:"cpuCost"`
-	GPUHours               float64               `json:"gpuHours"`
-	GPUCost                float64               `json:"gpuCost"`
-	NetworkCost            float64               `json:"networkCost"`
-	LoadBalancerCost       float64               `json:"loadBalancerCost"`
-	PVByteHours            float64               `json:"pvByteHours"`
-	PVCost                 float64               `json:"pvCost"`
-	RAMByteHours           float64               `json:"ramByteHours"`
-	RAMBytesRequestAverage float64               `json:"ramByteRequestAverage"`
-	RAMBytesUsageAverage   float64               `json:"ramByteUsageAverage"`
-	RAMCost                float64               `json:"ramCost"`
-	SharedCost             float64               `json:"sharedCost"`
-	ExternalCost           float64               `json:"externalCost"`
+	Name                       string                `json:"name"`
+	Properties                 *AllocationProperties `json:"properties,omitempty"`
+	Window                     Window                `json:"window"`
+	Start                      time.Time             `json:"start"`
+	End                        time.Time             `json:"end"`
+	CPUCoreHours               float64               `json:"cpuCoreHours"`
+	CPUCoreRequestAverage      float64               `json:"cpuCoreRequestAverage"`
+	CPUCoreUsageAverage        float64               `json:"cpuCoreUsageAverage"`
+	CPUCost                    float64               `json:"cpuCost"`
+	GPUHours                   float64               `json:"gpuHours"`
+	GPUCost                    float64               `json:"gpuCost"`
+	GPUUsageAverage            float64               `json:"gpuUsageAverage"`           // @bingen:field[version=12]
+	GPUMemoryBytesUsageAverage float64               `json:"gpuMemoryByteUsageAverage"` // @bingen:field[version=12]
+	NetworkCost                float64               `json:"networkCost"`
+	LoadBalancerCost           float64               `json:"loadBalancerCost"`
+	PVByteHours                float64               `json:"pvByteHours"`
+	PVCost                     float64               `json:"pvCost"`
+	RAMByteHours               float64               `json:"ramByteHours"`
+	RAMBytesRequestAverage     float64               `json:"ramByteRequestAverage"`
+	RAMBytesUsageAverage       float64               `json:"ramByteUsageAverage"`
+	RAMCost                    float64               `json:"ramCost"`
+	SharedCost                 float64               `json:"sharedCost"`
+	ExternalCost               float64               `json:"externalCost"`
+
+	// ExtendedResourceCosts maps the names of extended resources, e.g.
+	// "hugepages-2Mi" or vendor devices, to the cost of the Allocation's
+	// requests for them. It is nil if none are priced.
+	// @bingen:field[version=12]
+	ExtendedResourceCosts map[string]float64 `json:"extendedResourceCosts,omitempty"`
 
 	// RawAllocationOnly is a pointer so if it is not present it will be
 	// marshalled as null rather than as an object with Go default values.
@@ -101,8 +109,10 @@ type Allocation struct {
 // then this type would be unnecessary and its fields would go into the regular Allocation
 // and not in the AggregatedAllocation.
 type RawAllocationOnlyData struct {
-	CPUCoreUsageMax  float64 `json:"cpuCoreUsageMax"`
-	RAMBytesUsageMax float64 `json:"ramByteUsageMax"`
+	CPUCoreUsageMax        float64 `json:"cpuCoreUsageMax"`
+	RAMBytesUsageMax       float64 `json:"ramByteUsageMax"`
+	GPUUsageMax            float64 `json:"gpuUsageMax"`           // @bingen:field[version=12]
+	GPUMemoryBytesUsageMax float64 `json:"gpuMemoryByteUsageMax"` // @bingen:field[version=12]
 }
 
 // AllocationMatchFunc is a function that can be used to match Allocations by
@@ -135,29 +145,44 @@ func (a *Allocation) Clone() *Allocation {
 	}
 
 	return &Allocation{
-		Name:                   a.Name,
-		Properties:             a.Properties.Clone(),
-		Window:                 a.Window.Clone(),
-		Start:                  a.Start,
-		End:                    a.End,
-		CPUCoreHours:           a.CPUCoreHours,
-		CPUCoreRequestAverage:  a.CPUCoreRequestAverage,
-		CPUCoreUsageAverage:    a.CPUCoreUsageAverage,
-		CPUCost:                a.CPUCost,
-		GPUHours:               a.GPUHours,
-		GPUCost:                a.GPUCost,
-		NetworkCost:            a.NetworkCost,
-		LoadBalancerCost:       a.LoadBalancerCost,
-		PVByteHours:            a.PVByteHours,
-		PVCost:                 a.PVCost,
-		RAMByteHours:           a.RAMByteHours,
-		RAMBytesRequestAverage: a.RAMBytesRequestAverage,
-		RAMBytesUsageAverage:   a.RAMBytesUsageAverage,
-		RAMCost:                a.RAMCost,
-		SharedCost:             a.SharedCost,
-		ExternalCost:           a.ExternalCost,
-		RawAllocationOnly:      a.RawAllocationOnly.Clone(),
+		Name:                       a.Name,
+		Properties:                 a.Properties.Clone(),
+		Window:                     a.Window.Clone(),
+		Start:                      a.Start,
+		End:                        a.End,
+		CPUCoreHours:               a.CPUCoreHours,
+		CPUCoreRequestAverage:      a.CPUCoreRequestAverage,
+		CPUCoreUsageAverage:        a.CPUCoreUsageAverage,
+		CPUCost:                    a.CPUCost,
+		GPUHours:                   a.GPUHours,
+		GPUCost:                    a.GPUCost,
+		GPUUsageAverage:            a.GPUUsageAverage,
+		GPUMemoryBytesUsageAverage: a.GPUMemoryBytesUsageAverage,
+		NetworkCost:                a.NetworkCost,
+		LoadBalancerCost:           a.LoadBalancerCost,
+		PVByteHours:                a.PVByteHours,
+		PVCost:                     a.PVCost,
+		RAMByteHours:               a.RAMByteHours,
+		RAMBytesRequestAverage:     a.RAMBytesRequestAverage,
+		RAMBytesUsageAverage:       a.RAMBytesUsageAverage,
+		RAMCost:                    a.RAMCost,
+		SharedCost:                 a.SharedCost,
+		ExternalCost:               a.ExternalCost,
+		ExtendedResourceCosts:      cloneExtendedResourceCosts(a.ExtendedResourceCosts),
+		RawAllocationOnly:          a.RawAllocationOnly.Clone(),
+	}
+}
+
+func cloneExtendedResourceCosts(costs map[string]float64) map[string]float64 {
+	if costs == nil {
+		return nil
+	}
+
+	clone := make(map[string]float64, len(costs))
+	for resource, cost := range costs {
+		clone[resource] = cost
 	}
+	return clone
 }
 
 // Clone returns a deep copy of the given RawAllocationOnlyData
@@ -167,8 +192,10 @@ func (r *RawAllocationOnlyData) Clone() *RawAllocationOnlyData {
 	}
 
 	return &RawAllocationOnlyData{
-		CPUCoreUsageMax:  r.CPUCoreUsageMax,
-		RAMBytesUsageMax: r.RAMBytesUsageMax,
+		CPUCoreUsageMax:        r.CPUCoreUsageMax,
+		RAMBytesUsageMax:       r.RAMBytesUsageMax,
+		GPUUsageMax:            r.GPUUsageMax,
+		GPUMemoryBytesUsageMax: r.GPUMemoryBytesUsageMax,
 	}
 }
 
@@ -208,6 +235,12 @@ func (a *Allocation) Equal(that *Allocation) bool {
 	if !util.IsApproximately(a.GPUCost, that.GPUCost) {
 		return false
 	}
+	if !util.IsApproximately(a.GPUUsageAverage, that.GPUUsageAverage) {
+		return false
+	}
+	if !util.IsApproximately(a.GPUMemoryBytesUsageAverage, that.GPUMemoryBytesUsageAverage) {
+		return false
+	}
 	if !util.IsApproximately(a.NetworkCost, that.NetworkCost) {
 		return false
 	}
@@ -232,6 +265,15 @@ func (a *Allocation) Equal(that *Allocation) bool {
 	if !util.IsApproximately(a.ExternalCost, that.ExternalCost) {
 		return false
 	}
+	if len(a.ExtendedResourceCosts) != len(that.ExtendedResourceCosts) {
+		return false
+	}
+	for resource, cost := range a.ExtendedResourceCosts {
+		thatCost, ok := that.ExtendedResourceCosts[resource]
+		if !ok || !util.IsApproximately(cost, thatCost) {
+			return false
+		}
+	}
 
 	if a.RawAllocationOnly == nil && that.RawAllocationOnly != nil {
 		return false
@@ -247,6 +289,12 @@ func (a *Allocation) Equal(that *Allocation) bool {
 		if !util.IsApproximately(a.RawAllocationOnly.RAMBytesUsageMax, that.RawAllocationOnly.RAMBytesUsageMax) {
 			return false
 		}
+		if !util.IsApproximately(a.RawAllocationOnly.GPUUsageMax, that.RawAllocationOnly.GPUUsageMax) {
+			return false
+		}
+		if !util.IsApproximately(a.RawAllocationOnly.GPUMemoryBytesUsageMax, that.RawAllocationOnly.GPUMemoryBytesUsageMax) {
+			return false
+		}
 	}
 
 	return true
@@ -254,7 +302,16 @@ func (a *Allocation) Equal(that *Allocation) bool {
 
 // TotalCost is the total cost of the Allocation
 func (a *Allocation) TotalCost() float64 {
-	return a.CPUCost + a.GPUCost + a.RAMCost + a.PVCost + a.NetworkCost + a.SharedCost + a.ExternalCost + a.LoadBalancerCost
+	return a.CPUCost + a.GPUCost + a.RAMCost + a.PVCost + a.NetworkCost + a.SharedCost + a.ExternalCost + a.LoadBalancerCost + a.ExtendedResourceCost()
+}
+
+// ExtendedResourceCost is the sum of the Allocation's extended resource costs
+func (a *Allocation) ExtendedResourceCost() float64 {
+	cost := 0.0
+	for _, c := range a.ExtendedResourceCosts {
+		cost += c
+	}
+	return cost
 }
 
 // CPUEfficiency is the ratio of usage to request. If there is no request and
@@ -287,6 +344,17 @@ func (a *Allocation) RAMEfficiency() float64 {
 	return 1.0
 }
 
+// GPUEfficiency is the ratio of usage, in GPUs' worth of utilization, to
+// GPUs allocated. Unlike CPU and RAM, GPUs cannot be used without being
+// requested, so if none are allocated, then efficiency is zero.
+func (a *Allocation) GPUEfficiency() float64 {
+	if a.GPUs() > 0 {
+		return a.GPUUsageAverage / a.GPUs()
+	}
+
+	return 0.0
+}
+
 // TotalEfficiency is the cost-weighted average of CPU and RAM efficiency. If
 // there is no cost at all, then efficiency is zero.
 func (a *Allocation) TotalEfficiency() float64 {
@@ -307,6 +375,14 @@ func (a *Allocation) CPUCores() float64 {
 	return a.CPUCoreHours / (a.Minutes() / 60.0)
 }
 
+// GPUs converts the Allocation's GPUHours into average GPUs
+func (a *Allocation) GPUs() float64 {
+	if a.Minutes() <= 0.0 {
+		return 0.0
+	}
+	return a.GPUHours / (a.Minutes() / 60.0)
+}
+
 // RAMBytes converts the Allocation's RAMByteHours into average RAMBytes
 func (a *Allocation) RAMBytes() float64 {
 	if a.Minutes() <= 0.0 {
@@ -340,6 +416,9 @@ func (a *Allocation) MarshalJSON() ([]byte, error) {
 	jsonEncodeFloat64(buffer, "cpuEfficiency", a.CPUEfficiency(), ",")
 	jsonEncodeFloat64(buffer, "gpuHours", a.GPUHours, ",")
 	jsonEncodeFloat64(buffer, "gpuCost", a.GPUCost, ",")
+	jsonEncodeFloat64(buffer, "gpuUsageAverage", a.GPUUsageAverage, ",")
+	jsonEncodeFloat64(buffer, "gpuMemoryByteUsageAverage", a.GPUMemoryBytesUsageAverage, ",")
+	jsonEncodeFloat64(buffer, "gpuEfficiency", a.GPUEfficiency(), ",")
 	jsonEncodeFloat64(buffer, "networkCost", a.NetworkCost, ",")
 	jsonEncodeFloat64(buffer, "loadBalancerCost", a.LoadBalancerCost, ",")
 	jsonEncodeFloat64(buffer, "pvBytes", a.PVBytes(), ",")
@@ -353,6 +432,9 @@ func (a *Allocation) MarshalJSON() ([]byte, error) {
 	jsonEncodeFloat64(buffer, "ramEfficiency", a.RAMEfficiency(), ",")
 	jsonEncodeFloat64(buffer, "sharedCost", a.SharedCost, ",")
 	jsonEncodeFloat64(buffer, "externalCost", a.ExternalCost, ",")
+	if len(a.ExtendedResourceCosts) > 0 {
+		jsonEncode(buffer, "extendedResourceCosts", a.ExtendedResourceCosts, ",")
+	}
 	jsonEncodeFloat64(buffer, "totalCost", a.TotalCost(), ",")
 	jsonEncodeFloat64(buffer, "totalEfficiency", a.TotalEfficiency(), ",")
 	jsonEncode(buffer, "rawAllocationOnly", a.RawAllocationOnly, "")
@@ -392,6 +474,26 @@ func (a *Allocation) Minutes() float64 {
 	return a.End.Sub(a.Start).Minutes()
 }
 
+// ScaleCosts multiplies each of the Allocation's costs by the given factor;
+// e.g. to convert them to another currency. Resource usage is unchanged.
+func (a *Allocation) ScaleCosts(factor float64) {
+	if a == nil {
+		return
+	}
+
+	a.CPUCost *= factor
+	a.GPUCost *= factor
+	a.NetworkCost *= factor
+	a.LoadBalancerCost *= factor
+	a.PVCost *= factor
+	a.RAMCost *= factor
+	a.SharedCost *= factor
+	a.ExternalCost *= factor
+	for resource := range a.ExtendedResourceCosts {
+		a.ExtendedResourceCosts[resource] *= factor
+	}
+}
+
 // Share adds the TotalCost of the given Allocation to the SharedCost of the
 // receiving Allocation. No Start, End, Window, or AllocationProperties are considered.
 // Neither Allocation is mutated; a new Allocation is always returned.
@@ -441,6 +543,12 @@ func (a *Allocation) add(that *Allocation) {
 	ramUseByteMins := a.RAMBytesUsageAverage * a.Minutes()
 	ramUseByteMins += that.RAMBytesUsageAverage * that.Minutes()
 
+	gpuUseMins := a.GPUUsageAverage * a.Minutes()
+	gpuUseMins += that.GPUUsageAverage * that.Minutes()
+
+	gpuMemUseByteMins := a.GPUMemoryBytesUsageAverage * a.Minutes()
+	gpuMemUseByteMins += that.GPUMemoryBytesUsageAverage * that.Minutes()
+
 	// Expand Start and End to be the "max" of among the given Allocations
 	if that.Start.Before(a.Start) {
 		a.Start = that.Start
@@ -456,11 +564,15 @@ func (a *Allocation) add(that *Allocation) {
 		a.CPUCoreUsageAverage = cpuUseCoreMins / a.Minutes()
 		a.RAMBytesRequestAverage = ramReqByteMins / a.Minutes()
 		a.RAMBytesUsageAverage = ramUseByteMins / a.Minutes()
+		a.GPUUsageAverage = gpuUseMins / a.Minutes()
+		a.GPUMemoryBytesUsageAverage = gpuMemUseByteMins / a.Minutes()
 	} else {
 		a.CPUCoreRequestAverage = 0.0
 		a.CPUCoreUsageAverage = 0.0
 		a.RAMBytesRequestAverage = 0.0
 		a.RAMBytesUsageAverage = 0.0
+		a.GPUUsageAverage = 0.0
+		a.GPUMemoryBytesUsageAverage = 0.0
 	}
 
 	// Sum all cumulative resource fields
@@ -478,6 +590,12 @@ func (a *Allocation) add(that *Allocation) {
 	a.LoadBalancerCost += that.LoadBalancerCost
 	a.SharedCost += that.SharedCost
 	a.ExternalCost += that.ExternalCost
+	for resource, cost := range that.ExtendedResourceCosts {
+		if a.ExtendedResourceCosts == nil {
+			a.ExtendedResourceCosts = map[string]float64{}
+		}
+		a.ExtendedResourceCosts[resource] += cost
+	}
 
 	// Any data that is in a "raw allocation only" is not valid in any
 	// sort of cumulative Allocation (like one that is added).
@@ -1660,6 +1778,21 @@ func (as *AllocationSet) Resolution() time.Duration {
 	return as.Window.Duration()
 }
 
+// ScaleCosts multiplies the costs of each Allocation in the set by the given
+// factor. See Allocation.ScaleCosts.
+func (as *AllocationSet) ScaleCosts(factor float64) {
+	if as == nil {
+		return
+	}
+
+	as.Lock()
+	defer as.Unlock()
+
+	for _, a := range as.allocations {
+		a.ScaleCosts(factor)
+	}
+}
+
 // Set uses the given Allocation to overwrite the existing entry in the
 // AllocationSet under the Allocation's name.
 func (as *AllocationSet) Set(alloc *Allocation) error {
@@ -1942,6 +2075,21 @@ func (asr *AllocationSetRange) MarshalJSON() ([]byte, error) {
 	return json.Marshal(asr.allocations)
 }
 
+// ScaleCosts multiplies the costs of each Allocation in each set of the range
+// by the given factor. See Allocation.ScaleCosts.
+func (asr *AllocationSetRange) ScaleCosts(factor float64) {
+	if asr == nil {
+		return
+	}
+
+	asr.RLock()
+	defer asr.RUnlock()
+
+	for _, as := range asr.allocations {
+		as.ScaleCosts(factor)
+	}
+}
+
 // Slice copies the underlying slice of AllocationSets, maintaining order,
 // and returns the copied slice.
 func (asr *AllocationSetRange) Slice() []*AllocationSet {
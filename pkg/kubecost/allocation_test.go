@@ -105,24 +105,26 @@ func TestAllocation_Add(t *testing.T) {
 	e1 := time.Date(2021, time.January, 1, 12, 0, 0, 0, time.UTC)
 	hrs1 := e1.Sub(s1).Hours()
 	a1 := &Allocation{
-		Start:                  s1,
-		End:                    e1,
-		Properties:             &AllocationProperties{},
-		CPUCoreHours:           2.0 * hrs1,
-		CPUCoreRequestAverage:  2.0,
-		CPUCoreUsageAverage:    1.0,
-		CPUCost:                2.0 * hrs1 * cpuPrice,
-		GPUHours:               1.0 * hrs1,
-		GPUCost:                1.0 * hrs1 * gpuPrice,
-		PVByteHours:            100.0 * gib * hrs1,
-		PVCost:                 100.0 * hrs1 * pvPrice,
-		RAMByteHours:           8.0 * gib * hrs1,
-		RAMBytesRequestAverage: 8.0 * gib,
-		RAMBytesUsageAverage:   4.0 * gib,
-		RAMCost:                8.0 * hrs1 * ramPrice,
-		SharedCost:             2.00,
-		ExternalCost:           1.00,
-		RawAllocationOnly:      &RawAllocationOnlyData{},
+		Start:                      s1,
+		End:                        e1,
+		Properties:                 &AllocationProperties{},
+		CPUCoreHours:               2.0 * hrs1,
+		CPUCoreRequestAverage:      2.0,
+		CPUCoreUsageAverage:        1.0,
+		CPUCost:                    2.0 * hrs1 * cpuPrice,
+		GPUHours:                   1.0 * hrs1,
+		GPUCost:                    1.0 * hrs1 * gpuPrice,
+		GPUUsageAverage:            0.5,
+		GPUMemoryBytesUsageAverage: 4.0 * gib,
+		PVByteHours:                100.0 * gib * hrs1,
+		PVCost:                     100.0 * hrs1 * pvPrice,
+		RAMByteHours:               8.0 * gib * hrs1,
+		RAMBytesRequestAverage:     8.0 * gib,
+		RAMBytesUsageAverage:       4.0 * gib,
+		RAMCost:                    8.0 * hrs1 * ramPrice,
+		SharedCost:                 2.00,
+		ExternalCost:               1.00,
+		RawAllocationOnly:          &RawAllocationOnlyData{},
 	}
 	a1b := a1.Clone()
 
@@ -232,6 +234,15 @@ func TestAllocation_Add(t *testing.T) {
 		t.Fatalf("Allocation.Add: expected %f; actual %f", 8.00*gib, act.RAMBytesUsageAverage)
 	}
 
+	// GPU usage = (0.5*12.0 + 0.0*18.0)/(24.0) = 0.25
+	// GPU memory usage = (4.0*12.0 + 0.0*18.0)/(24.0) = 2.00
+	if !util.IsApproximately(0.25, act.GPUUsageAverage) {
+		t.Fatalf("Allocation.Add: expected %f; actual %f", 0.25, act.GPUUsageAverage)
+	}
+	if !util.IsApproximately(2.00*gib, act.GPUMemoryBytesUsageAverage) {
+		t.Fatalf("Allocation.Add: expected %f; actual %f", 2.00*gib, act.GPUMemoryBytesUsageAverage)
+	}
+
 	// Efficiency should be computed accurately from new request/usage
 	// CPU efficiency = 1.25/1.75 = 0.7142857
 	// RAM efficiency = 8.00/4.00 = 2.0000000
@@ -246,11 +257,69 @@ func TestAllocation_Add(t *testing.T) {
 		t.Fatalf("Allocation.Add: expected %f; actual %f", 1.6493506, act.TotalEfficiency())
 	}
 
+	// GPU efficiency = 0.25/(12.0/24.0) = 0.5
+	if !util.IsApproximately(0.5, act.GPUEfficiency()) {
+		t.Fatalf("Allocation.Add: expected %f; actual %f", 0.5, act.GPUEfficiency())
+	}
+
 	if act.RawAllocationOnly != nil {
 		t.Errorf("Allocation.Add: Raw only data must be nil after an add")
 	}
 }
 
+func TestAllocation_ExtendedResourceCosts(t *testing.T) {
+	start := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	a1 := NewUnitAllocation("a1", start, day, nil)
+	a1.ExtendedResourceCosts = map[string]float64{"hugepages-2Mi": 1.0, "example.com/fpga": 2.0}
+	a2 := NewUnitAllocation("a2", start, day, nil)
+	a2.ExtendedResourceCosts = map[string]float64{"example.com/fpga": 3.0}
+	a3 := NewUnitAllocation("a3", start, day, nil)
+
+	// Unit allocations cost 6.0, plus extended resources
+	if !util.IsApproximately(a1.TotalCost(), 9.0) {
+		t.Fatalf("Allocation.TotalCost: expected %f; actual %f", 9.0, a1.TotalCost())
+	}
+
+	act, err := a1.Add(a2)
+	if err != nil {
+		t.Fatalf("Allocation.Add: unexpected error: %s", err)
+	}
+	act, err = act.Add(a3)
+	if err != nil {
+		t.Fatalf("Allocation.Add: unexpected error: %s", err)
+	}
+	if !util.IsApproximately(act.ExtendedResourceCosts["hugepages-2Mi"], 1.0) {
+		t.Fatalf("Allocation.Add: expected %f; actual %f", 1.0, act.ExtendedResourceCosts["hugepages-2Mi"])
+	}
+	if !util.IsApproximately(act.ExtendedResourceCosts["example.com/fpga"], 5.0) {
+		t.Fatalf("Allocation.Add: expected %f; actual %f", 5.0, act.ExtendedResourceCosts["example.com/fpga"])
+	}
+	if !util.IsApproximately(act.TotalCost(), 24.0) {
+		t.Fatalf("Allocation.Add: expected %f; actual %f", 24.0, act.TotalCost())
+	}
+
+	// Adding must not mutate either Allocation's costs
+	if !util.IsApproximately(a1.ExtendedResourceCosts["example.com/fpga"], 2.0) {
+		t.Fatalf("Allocation.Add: mutated receiver: %f", a1.ExtendedResourceCosts["example.com/fpga"])
+	}
+
+	act.ScaleCosts(2.0)
+	if !util.IsApproximately(act.ExtendedResourceCost(), 12.0) {
+		t.Fatalf("Allocation.ScaleCosts: expected %f; actual %f", 12.0, act.ExtendedResourceCost())
+	}
+
+	// Clones must not share extended resource costs
+	clone := a1.Clone()
+	if !a1.Equal(clone) {
+		t.Fatalf("Allocation.Clone: expected %+v; actual %+v", a1, clone)
+	}
+	clone.ExtendedResourceCosts["example.com/fpga"] = 4.0
+	if a1.Equal(clone) {
+		t.Fatalf("Allocation.Equal: expected extended resource costs to differ")
+	}
+}
+
 func TestAllocation_Share(t *testing.T) {
 	cpuPrice := 0.02
 	gpuPrice := 2.00
@@ -1882,6 +1951,27 @@ func TestAllocationSetRange_Accumulate(t *testing.T) {
 // TODO niko/etl
 // func TestAllocationSetRange_Get(t *testing.T) {}
 
+func TestAllocationSetRange_ScaleCosts(t *testing.T) {
+	today := time.Now().UTC().Truncate(day)
+	yesterday := today.Add(-day)
+
+	asr := NewAllocationSetRange(
+		NewAllocationSet(yesterday, today, NewUnitAllocation("a", yesterday, day, nil)),
+		NewAllocationSet(today, today.Add(day), NewUnitAllocation("a", today, day, nil)),
+	)
+	asr.ScaleCosts(2.0)
+
+	asr.Each(func(i int, as *AllocationSet) {
+		a := as.Get("a")
+		if a.CPUCost != 2.0 || a.RAMCost != 2.0 || a.PVCost != 2.0 || a.TotalCost() != 12.0 {
+			t.Fatalf("expected costs doubled; got %+v", a)
+		}
+		if a.CPUCoreHours != 1.0 {
+			t.Fatalf("expected usage unchanged; got %f", a.CPUCoreHours)
+		}
+	})
+}
+
 func TestAllocationSetRange_InsertRange(t *testing.T) {
 	// Set up
 	ago2d := time.Now().UTC().Truncate(day).Add(-2 * day)
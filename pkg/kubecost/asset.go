@@ -37,6 +37,7 @@ type Asset interface {
 	// Monetary values
 	Adjustment() float64
 	SetAdjustment(float64)
+	ScaleCosts(float64)
 	TotalCost() float64
 
 	// Temporal values
@@ -473,6 +474,12 @@ func (a *Any) SetAdjustment(adj float64) {
 	a.adjustment = adj
 }
 
+// ScaleCosts multiplies the Asset's costs by the given factor
+func (a *Any) ScaleCosts(factor float64) {
+	a.Cost *= factor
+	a.adjustment *= factor
+}
+
 // TotalCost returns the Asset's TotalCost
 func (a *Any) TotalCost() float64 {
 	return a.Cost + a.adjustment
@@ -674,6 +681,13 @@ func (ca *Cloud) SetAdjustment(adj float64) {
 	ca.adjustment = adj
 }
 
+// ScaleCosts multiplies the Asset's costs by the given factor
+func (ca *Cloud) ScaleCosts(factor float64) {
+	ca.Cost *= factor
+	ca.Credit *= factor
+	ca.adjustment *= factor
+}
+
 // TotalCost returns the Asset's total cost
 func (ca *Cloud) TotalCost() float64 {
 	return ca.Cost + ca.adjustment + ca.Credit
@@ -914,6 +928,11 @@ func (cm *ClusterManagement) SetAdjustment(float64) {
 	return
 }
 
+// ScaleCosts multiplies the Asset's costs by the given factor
+func (cm *ClusterManagement) ScaleCosts(factor float64) {
+	cm.Cost *= factor
+}
+
 // TotalCost returns the Asset's total cost
 func (cm *ClusterManagement) TotalCost() float64 {
 	return cm.Cost
@@ -1122,6 +1141,12 @@ func (d *Disk) SetAdjustment(adj float64) {
 	d.adjustment = adj
 }
 
+// ScaleCosts multiplies the Asset's costs by the given factor
+func (d *Disk) ScaleCosts(factor float64) {
+	d.Cost *= factor
+	d.adjustment *= factor
+}
+
 // TotalCost returns the Asset's total cost
 func (d *Disk) TotalCost() float64 {
 	return d.Cost + d.adjustment
@@ -1462,6 +1487,12 @@ func (n *Network) SetAdjustment(adj float64) {
 	n.adjustment = adj
 }
 
+// ScaleCosts multiplies the Asset's costs by the given factor
+func (n *Network) ScaleCosts(factor float64) {
+	n.Cost *= factor
+	n.adjustment *= factor
+}
+
 // TotalCost returns the Asset's total cost
 func (n *Network) TotalCost() float64 {
 	return n.Cost + n.adjustment
@@ -1729,6 +1760,14 @@ func (n *Node) SetAdjustment(adj float64) {
 	n.adjustment = adj
 }
 
+// ScaleCosts multiplies the Asset's costs by the given factor
+func (n *Node) ScaleCosts(factor float64) {
+	n.CPUCost *= factor
+	n.GPUCost *= factor
+	n.RAMCost *= factor
+	n.adjustment *= factor
+}
+
 // TotalCost returns the Asset's total cost
 func (n *Node) TotalCost() float64 {
 	return ((n.CPUCost + n.RAMCost) * (1.0 - n.Discount)) + n.GPUCost + n.adjustment
@@ -2122,6 +2161,12 @@ func (lb *LoadBalancer) SetAdjustment(adj float64) {
 	lb.adjustment = adj
 }
 
+// ScaleCosts multiplies the Asset's costs by the given factor
+func (lb *LoadBalancer) ScaleCosts(factor float64) {
+	lb.Cost *= factor
+	lb.adjustment *= factor
+}
+
 // TotalCost returns the total cost of the Asset
 func (lb *LoadBalancer) TotalCost() float64 {
 	return lb.Cost + lb.adjustment
@@ -2354,6 +2399,11 @@ func (sa *SharedAsset) SetAdjustment(float64) {
 	return
 }
 
+// ScaleCosts multiplies the Asset's costs by the given factor
+func (sa *SharedAsset) ScaleCosts(factor float64) {
+	sa.Cost *= factor
+}
+
 // TotalCost returns the Asset's total cost
 func (sa *SharedAsset) TotalCost() float64 {
 	return sa.Cost
@@ -2805,6 +2855,21 @@ func (as *AssetSet) MarshalJSON() ([]byte, error) {
 	return json.Marshal(as.assets)
 }
 
+// ScaleCosts multiplies the costs of each Asset in the set by the given
+// factor; e.g. to convert them to another currency.
+func (as *AssetSet) ScaleCosts(factor float64) {
+	if as == nil {
+		return
+	}
+
+	as.Lock()
+	defer as.Unlock()
+
+	for _, a := range as.assets {
+		a.ScaleCosts(factor)
+	}
+}
+
 func (as *AssetSet) Set(asset Asset, aggregateBy []string) error {
 	if as.IsEmpty() {
 		as.Lock()
@@ -3005,6 +3070,21 @@ func (asr *AssetSetRange) MarshalJSON() ([]byte, error) {
 	return json.Marshal(asr.assets)
 }
 
+// ScaleCosts multiplies the costs of each Asset in each set of the range by
+// the given factor.
+func (asr *AssetSetRange) ScaleCosts(factor float64) {
+	if asr == nil {
+		return
+	}
+
+	asr.RLock()
+	defer asr.RUnlock()
+
+	for _, as := range asr.assets {
+		as.ScaleCosts(factor)
+	}
+}
+
 func (asr *AssetSetRange) UTCOffset() time.Duration {
 	if asr.Length() == 0 {
 		return 0
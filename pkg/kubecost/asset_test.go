@@ -1023,6 +1023,37 @@ func TestAssetSetRange_Accumulate(t *testing.T) {
 	}, nil)
 }
 
+func TestAssetSetRange_ScaleCosts(t *testing.T) {
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(day)
+	window := NewWindow(&start, &end)
+
+	node := NewNode("node1", "cluster1", "node1", start, end, window)
+	node.CPUCost = 4.0
+	node.RAMCost = 2.0
+	node.SetAdjustment(-1.0)
+
+	disk := NewDisk("disk1", "cluster1", "disk1", start, end, window)
+	disk.Cost = 3.0
+
+	cloud := NewCloud(ComputeCategory, "bucket1", start, end, window)
+	cloud.Cost = 10.0
+	cloud.Credit = -2.0
+
+	asr := NewAssetSetRange(NewAssetSet(start, end, node, disk, cloud))
+	asr.ScaleCosts(0.5)
+
+	if node.CPUCost != 2.0 || node.RAMCost != 1.0 || node.Adjustment() != -0.5 || node.TotalCost() != 2.5 {
+		t.Fatalf("unexpected node costs: %f, %f, %f", node.CPUCost, node.RAMCost, node.Adjustment())
+	}
+	if disk.TotalCost() != 1.5 {
+		t.Fatalf("expected disk cost 1.5; got %f", disk.TotalCost())
+	}
+	if cloud.Cost != 5.0 || cloud.Credit != -1.0 {
+		t.Fatalf("unexpected cloud costs: %f, %f", cloud.Cost, cloud.Credit)
+	}
+}
+
 func TestAssetToExternalAllocation(t *testing.T) {
 	var asset Asset
 	var alloc *Allocation
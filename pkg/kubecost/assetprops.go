@@ -110,6 +110,15 @@ const GCPProvider = "GCP"
 // AzureProvider describes the provider Azure
 const AzureProvider = "Azure"
 
+// AlibabaProvider describes the provider Alibaba
+const AlibabaProvider = "Alibaba"
+
+// OracleProvider describes the provider Oracle
+const OracleProvider = "Oracle"
+
+// DigitalOceanProvider describes the provider DigitalOcean
+const DigitalOceanProvider = "DigitalOcean"
+
 // NilProvider describes unknown provider
 const NilProvider = "-"
 
@@ -126,6 +135,12 @@ func ParseProvider(str string) string {
 		return GCPProvider
 	case "azure":
 		return AzureProvider
+	case "alibaba", "ack", "alicloud":
+		return AlibabaProvider
+	case "oracle", "oci", "oke":
+		return OracleProvider
+	case "digitalocean", "doks":
+		return DigitalOceanProvider
 	default:
 		return NilProvider
 	}
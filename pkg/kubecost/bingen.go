@@ -26,4 +26,8 @@ package kubecost
 // @bingen:generate:AllocationAnnotations
 // @bingen:generate:RawAllocationOnlyData
 
-//go:generate bingen -package=kubecost -version=11 -buffer=github.com/kubecost/cost-model/pkg/util
+// Fields added since version 11, the oldest version unmarshaled, are annotated
+// with the version which added them, e.g. @bingen:field[version=12], and are
+// left zero when unmarshaling older versions.
+
+//go:generate bingen -package=kubecost -version=12 -buffer=github.com/kubecost/cost-model/pkg/util
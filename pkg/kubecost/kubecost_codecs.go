@@ -25,7 +25,11 @@ const (
 	GeneratorPackageName string = "kubecost"
 
 	// CodecVersion is the version passed into the generator
-	CodecVersion uint8 = 11
+	CodecVersion uint8 = 12
+
+	// MinCodecVersion is the oldest version which can be unmarshaled. Fields
+	// added since are left zero.
+	MinCodecVersion uint8 = 11
 )
 
 //--------------------------------------------------------------------------
@@ -160,22 +164,38 @@ func (target *Allocation) MarshalBinary() (data []byte, err error) {
 	buff.WriteBytes(d)
 	// --- [end][write][reference](time.Time) ---
 
-	buff.WriteFloat64(target.CPUCoreHours)           // write float64
-	buff.WriteFloat64(target.CPUCoreRequestAverage)  // write float64
-	buff.WriteFloat64(target.CPUCoreUsageAverage)    // write float64
-	buff.WriteFloat64(target.CPUCost)                // write float64
-	buff.WriteFloat64(target.GPUHours)               // write float64
-	buff.WriteFloat64(target.GPUCost)                // write float64
-	buff.WriteFloat64(target.NetworkCost)            // write float64
-	buff.WriteFloat64(target.LoadBalancerCost)       // write float64
-	buff.WriteFloat64(target.PVByteHours)            // write float64
-	buff.WriteFloat64(target.PVCost)                 // write float64
-	buff.WriteFloat64(target.RAMByteHours)           // write float64
-	buff.WriteFloat64(target.RAMBytesRequestAverage) // write float64
-	buff.WriteFloat64(target.RAMBytesUsageAverage)   // write float64
-	buff.WriteFloat64(target.RAMCost)                // write float64
-	buff.WriteFloat64(target.SharedCost)             // write float64
-	buff.WriteFloat64(target.ExternalCost)           // write float64
+	buff.WriteFloat64(target.CPUCoreHours)               // write float64
+	buff.WriteFloat64(target.CPUCoreRequestAverage)      // write float64
+	buff.WriteFloat64(target.CPUCoreUsageAverage)        // write float64
+	buff.WriteFloat64(target.CPUCost)                    // write float64
+	buff.WriteFloat64(target.GPUHours)                   // write float64
+	buff.WriteFloat64(target.GPUCost)                    // write float64
+	buff.WriteFloat64(target.GPUUsageAverage)            // write float64
+	buff.WriteFloat64(target.GPUMemoryBytesUsageAverage) // write float64
+	buff.WriteFloat64(target.NetworkCost)                // write float64
+	buff.WriteFloat64(target.LoadBalancerCost)           // write float64
+	buff.WriteFloat64(target.PVByteHours)                // write float64
+	buff.WriteFloat64(target.PVCost)                     // write float64
+	buff.WriteFloat64(target.RAMByteHours)               // write float64
+	buff.WriteFloat64(target.RAMBytesRequestAverage)     // write float64
+	buff.WriteFloat64(target.RAMBytesUsageAverage)       // write float64
+	buff.WriteFloat64(target.RAMCost)                    // write float64
+	buff.WriteFloat64(target.SharedCost)                 // write float64
+	buff.WriteFloat64(target.ExternalCost)               // write float64
+	if target.ExtendedResourceCosts == nil {
+		buff.WriteUInt8(uint8(0)) // write nil byte
+	} else {
+		buff.WriteUInt8(uint8(1)) // write non-nil byte
+
+		// --- [begin][write][map](map[string]float64) ---
+		buff.WriteInt(len(target.ExtendedResourceCosts)) // map length
+		for v, z := range target.ExtendedResourceCosts {
+			buff.WriteString(v)  // write string
+			buff.WriteFloat64(z) // write float64
+		}
+		// --- [end][write][map](map[string]float64) ---
+
+	}
 	if target.RawAllocationOnly == nil {
 		buff.WriteUInt8(uint8(0)) // write nil byte
 	} else {
@@ -214,8 +234,8 @@ func (target *Allocation) UnmarshalBinary(data []byte) (err error) {
 
 	// Codec Version Check
 	version := buff.ReadUInt8()
-	if version != CodecVersion {
-		return fmt.Errorf("Invalid Version Unmarshaling Allocation. Expected %d, got %d", CodecVersion, version)
+	if version < MinCodecVersion || version > CodecVersion {
+		return fmt.Errorf("Invalid Version Unmarshaling Allocation. Expected %d to %d, got %d", MinCodecVersion, CodecVersion, version)
 	}
 
 	a := buff.ReadString() // read string
@@ -287,48 +307,87 @@ func (target *Allocation) UnmarshalBinary(data []byte) (err error) {
 	u := buff.ReadFloat64() // read float64
 	target.GPUCost = u
 
-	w := buff.ReadFloat64() // read float64
-	target.NetworkCost = w
+	if version >= 12 {
+		w := buff.ReadFloat64() // read float64
+		target.GPUUsageAverage = w
+	} else {
+		target.GPUUsageAverage = float64(0) // default
+	}
 
-	x := buff.ReadFloat64() // read float64
-	target.LoadBalancerCost = x
+	if version >= 12 {
+		x := buff.ReadFloat64() // read float64
+		target.GPUMemoryBytesUsageAverage = x
+	} else {
+		target.GPUMemoryBytesUsageAverage = float64(0) // default
+	}
 
 	y := buff.ReadFloat64() // read float64
-	target.PVByteHours = y
+	target.NetworkCost = y
 
 	aa := buff.ReadFloat64() // read float64
-	target.PVCost = aa
+	target.LoadBalancerCost = aa
 
 	bb := buff.ReadFloat64() // read float64
-	target.RAMByteHours = bb
+	target.PVByteHours = bb
 
 	cc := buff.ReadFloat64() // read float64
-	target.RAMBytesRequestAverage = cc
+	target.PVCost = cc
 
 	dd := buff.ReadFloat64() // read float64
-	target.RAMBytesUsageAverage = dd
+	target.RAMByteHours = dd
 
 	ee := buff.ReadFloat64() // read float64
-	target.RAMCost = ee
+	target.RAMBytesRequestAverage = ee
 
 	ff := buff.ReadFloat64() // read float64
-	target.SharedCost = ff
+	target.RAMBytesUsageAverage = ff
 
 	gg := buff.ReadFloat64() // read float64
-	target.ExternalCost = gg
+	target.RAMCost = gg
 
+	hh := buff.ReadFloat64() // read float64
+	target.SharedCost = hh
+
+	kk := buff.ReadFloat64() // read float64
+	target.ExternalCost = kk
+
+	if version >= 12 {
+		if buff.ReadUInt8() == uint8(0) {
+			target.ExtendedResourceCosts = nil
+		} else {
+			// --- [begin][read][map](map[string]float64) ---
+			mm := buff.ReadInt() // map len
+			ll := make(map[string]float64, mm)
+			for j := 0; j < mm; j++ {
+				var v string
+				nn := buff.ReadString() // read string
+				v = nn
+
+				var z float64
+				oo := buff.ReadFloat64() // read float64
+				z = oo
+
+				ll[v] = z
+			}
+			target.ExtendedResourceCosts = ll
+			// --- [end][read][map](map[string]float64) ---
+
+		}
+	} else {
+		target.ExtendedResourceCosts = nil // default
+	}
 	if buff.ReadUInt8() == uint8(0) {
 		target.RawAllocationOnly = nil
 	} else {
 		// --- [begin][read][struct](RawAllocationOnlyData) ---
-		hh := &RawAllocationOnlyData{}
-		kk := buff.ReadInt()     // byte array length
-		ll := buff.ReadBytes(kk) // byte array
-		errE := hh.UnmarshalBinary(ll)
+		pp := &RawAllocationOnlyData{}
+		qq := buff.ReadInt()     // byte array length
+		rr := buff.ReadBytes(qq) // byte array
+		errE := pp.UnmarshalBinary(rr)
 		if errE != nil {
 			return errE
 		}
-		target.RawAllocationOnly = hh
+		target.RawAllocationOnly = pp
 		// --- [end][read][struct](RawAllocationOnlyData) ---
 
 	}
@@ -436,8 +495,8 @@ func (target *AllocationProperties) UnmarshalBinary(data []byte) (err error) {
 
 	// Codec Version Check
 	version := buff.ReadUInt8()
-	if version != CodecVersion {
-		return fmt.Errorf("Invalid Version Unmarshaling AllocationProperties. Expected %d, got %d", CodecVersion, version)
+	if version < MinCodecVersion || version > CodecVersion {
+		return fmt.Errorf("Invalid Version Unmarshaling AllocationProperties. Expected %d to %d, got %d", MinCodecVersion, CodecVersion, version)
 	}
 
 	a := buff.ReadString() // read string
@@ -673,8 +732,8 @@ func (target *AllocationSet) UnmarshalBinary(data []byte) (err error) {
 
 	// Codec Version Check
 	version := buff.ReadUInt8()
-	if version != CodecVersion {
-		return fmt.Errorf("Invalid Version Unmarshaling AllocationSet. Expected %d, got %d", CodecVersion, version)
+	if version < MinCodecVersion || version > CodecVersion {
+		return fmt.Errorf("Invalid Version Unmarshaling AllocationSet. Expected %d to %d, got %d", MinCodecVersion, CodecVersion, version)
 	}
 
 	if buff.ReadUInt8() == uint8(0) {
@@ -873,8 +932,8 @@ func (target *AllocationSetRange) UnmarshalBinary(data []byte) (err error) {
 
 	// Codec Version Check
 	version := buff.ReadUInt8()
-	if version != CodecVersion {
-		return fmt.Errorf("Invalid Version Unmarshaling AllocationSetRange. Expected %d, got %d", CodecVersion, version)
+	if version < MinCodecVersion || version > CodecVersion {
+		return fmt.Errorf("Invalid Version Unmarshaling AllocationSetRange. Expected %d to %d, got %d", MinCodecVersion, CodecVersion, version)
 	}
 
 	if buff.ReadUInt8() == uint8(0) {
@@ -1016,8 +1075,8 @@ func (target *Any) UnmarshalBinary(data []byte) (err error) {
 
 	// Codec Version Check
 	version := buff.ReadUInt8()
-	if version != CodecVersion {
-		return fmt.Errorf("Invalid Version Unmarshaling Any. Expected %d, got %d", CodecVersion, version)
+	if version < MinCodecVersion || version > CodecVersion {
+		return fmt.Errorf("Invalid Version Unmarshaling Any. Expected %d to %d, got %d", MinCodecVersion, CodecVersion, version)
 	}
 
 	// --- [begin][read][alias](AssetLabels) ---
@@ -1157,8 +1216,8 @@ func (target *AssetProperties) UnmarshalBinary(data []byte) (err error) {
 
 	// Codec Version Check
 	version := buff.ReadUInt8()
-	if version != CodecVersion {
-		return fmt.Errorf("Invalid Version Unmarshaling AssetProperties. Expected %d, got %d", CodecVersion, version)
+	if version < MinCodecVersion || version > CodecVersion {
+		return fmt.Errorf("Invalid Version Unmarshaling AssetProperties. Expected %d to %d, got %d", MinCodecVersion, CodecVersion, version)
 	}
 
 	a := buff.ReadString() // read string
@@ -1316,8 +1375,8 @@ func (target *AssetSet) UnmarshalBinary(data []byte) (err error) {
 
 	// Codec Version Check
 	version := buff.ReadUInt8()
-	if version != CodecVersion {
-		return fmt.Errorf("Invalid Version Unmarshaling AssetSet. Expected %d, got %d", CodecVersion, version)
+	if version < MinCodecVersion || version > CodecVersion {
+		return fmt.Errorf("Invalid Version Unmarshaling AssetSet. Expected %d to %d, got %d", MinCodecVersion, CodecVersion, version)
 	}
 
 	if buff.ReadUInt8() == uint8(0) {
@@ -1499,8 +1558,8 @@ func (target *AssetSetRange) UnmarshalBinary(data []byte) (err error) {
 
 	// Codec Version Check
 	version := buff.ReadUInt8()
-	if version != CodecVersion {
-		return fmt.Errorf("Invalid Version Unmarshaling AssetSetRange. Expected %d, got %d", CodecVersion, version)
+	if version < MinCodecVersion || version > CodecVersion {
+		return fmt.Errorf("Invalid Version Unmarshaling AssetSetRange. Expected %d to %d, got %d", MinCodecVersion, CodecVersion, version)
 	}
 
 	if buff.ReadUInt8() == uint8(0) {
@@ -1585,8 +1644,8 @@ func (target *Breakdown) UnmarshalBinary(data []byte) (err error) {
 
 	// Codec Version Check
 	version := buff.ReadUInt8()
-	if version != CodecVersion {
-		return fmt.Errorf("Invalid Version Unmarshaling Breakdown. Expected %d, got %d", CodecVersion, version)
+	if version < MinCodecVersion || version > CodecVersion {
+		return fmt.Errorf("Invalid Version Unmarshaling Breakdown. Expected %d to %d, got %d", MinCodecVersion, CodecVersion, version)
 	}
 
 	a := buff.ReadFloat64() // read float64
@@ -1712,8 +1771,8 @@ func (target *Cloud) UnmarshalBinary(data []byte) (err error) {
 
 	// Codec Version Check
 	version := buff.ReadUInt8()
-	if version != CodecVersion {
-		return fmt.Errorf("Invalid Version Unmarshaling Cloud. Expected %d, got %d", CodecVersion, version)
+	if version < MinCodecVersion || version > CodecVersion {
+		return fmt.Errorf("Invalid Version Unmarshaling Cloud. Expected %d to %d, got %d", MinCodecVersion, CodecVersion, version)
 	}
 
 	// --- [begin][read][alias](AssetLabels) ---
@@ -1890,8 +1949,8 @@ func (target *ClusterManagement) UnmarshalBinary(data []byte) (err error) {
 
 	// Codec Version Check
 	version := buff.ReadUInt8()
-	if version != CodecVersion {
-		return fmt.Errorf("Invalid Version Unmarshaling ClusterManagement. Expected %d, got %d", CodecVersion, version)
+	if version < MinCodecVersion || version > CodecVersion {
+		return fmt.Errorf("Invalid Version Unmarshaling ClusterManagement. Expected %d to %d, got %d", MinCodecVersion, CodecVersion, version)
 	}
 
 	// --- [begin][read][alias](AssetLabels) ---
@@ -2076,8 +2135,8 @@ func (target *Disk) UnmarshalBinary(data []byte) (err error) {
 
 	// Codec Version Check
 	version := buff.ReadUInt8()
-	if version != CodecVersion {
-		return fmt.Errorf("Invalid Version Unmarshaling Disk. Expected %d, got %d", CodecVersion, version)
+	if version < MinCodecVersion || version > CodecVersion {
+		return fmt.Errorf("Invalid Version Unmarshaling Disk. Expected %d to %d, got %d", MinCodecVersion, CodecVersion, version)
 	}
 
 	// --- [begin][read][alias](AssetLabels) ---
@@ -2291,8 +2350,8 @@ func (target *LoadBalancer) UnmarshalBinary(data []byte) (err error) {
 
 	// Codec Version Check
 	version := buff.ReadUInt8()
-	if version != CodecVersion {
-		return fmt.Errorf("Invalid Version Unmarshaling LoadBalancer. Expected %d, got %d", CodecVersion, version)
+	if version < MinCodecVersion || version > CodecVersion {
+		return fmt.Errorf("Invalid Version Unmarshaling LoadBalancer. Expected %d to %d, got %d", MinCodecVersion, CodecVersion, version)
 	}
 
 	if buff.ReadUInt8() == uint8(0) {
@@ -2485,8 +2544,8 @@ func (target *Network) UnmarshalBinary(data []byte) (err error) {
 
 	// Codec Version Check
 	version := buff.ReadUInt8()
-	if version != CodecVersion {
-		return fmt.Errorf("Invalid Version Unmarshaling Network. Expected %d, got %d", CodecVersion, version)
+	if version < MinCodecVersion || version > CodecVersion {
+		return fmt.Errorf("Invalid Version Unmarshaling Network. Expected %d to %d, got %d", MinCodecVersion, CodecVersion, version)
 	}
 
 	if buff.ReadUInt8() == uint8(0) {
@@ -2717,8 +2776,8 @@ func (target *Node) UnmarshalBinary(data []byte) (err error) {
 
 	// Codec Version Check
 	version := buff.ReadUInt8()
-	if version != CodecVersion {
-		return fmt.Errorf("Invalid Version Unmarshaling Node. Expected %d, got %d", CodecVersion, version)
+	if version < MinCodecVersion || version > CodecVersion {
+		return fmt.Errorf("Invalid Version Unmarshaling Node. Expected %d to %d, got %d", MinCodecVersion, CodecVersion, version)
 	}
 
 	if buff.ReadUInt8() == uint8(0) {
@@ -2881,8 +2940,10 @@ func (target *RawAllocationOnlyData) MarshalBinary() (data []byte, err error) {
 	buff := util.NewBuffer()
 	buff.WriteUInt8(CodecVersion) // version
 
-	buff.WriteFloat64(target.CPUCoreUsageMax)  // write float64
-	buff.WriteFloat64(target.RAMBytesUsageMax) // write float64
+	buff.WriteFloat64(target.CPUCoreUsageMax)        // write float64
+	buff.WriteFloat64(target.RAMBytesUsageMax)       // write float64
+	buff.WriteFloat64(target.GPUUsageMax)            // write float64
+	buff.WriteFloat64(target.GPUMemoryBytesUsageMax) // write float64
 	return buff.Bytes(), nil
 }
 
@@ -2906,8 +2967,8 @@ func (target *RawAllocationOnlyData) UnmarshalBinary(data []byte) (err error) {
 
 	// Codec Version Check
 	version := buff.ReadUInt8()
-	if version != CodecVersion {
-		return fmt.Errorf("Invalid Version Unmarshaling RawAllocationOnlyData. Expected %d, got %d", CodecVersion, version)
+	if version < MinCodecVersion || version > CodecVersion {
+		return fmt.Errorf("Invalid Version Unmarshaling RawAllocationOnlyData. Expected %d to %d, got %d", MinCodecVersion, CodecVersion, version)
 	}
 
 	a := buff.ReadFloat64() // read float64
@@ -2916,6 +2977,20 @@ func (target *RawAllocationOnlyData) UnmarshalBinary(data []byte) (err error) {
 	b := buff.ReadFloat64() // read float64
 	target.RAMBytesUsageMax = b
 
+	if version >= 12 {
+		c := buff.ReadFloat64() // read float64
+		target.GPUUsageMax = c
+	} else {
+		target.GPUUsageMax = float64(0) // default
+	}
+
+	if version >= 12 {
+		d := buff.ReadFloat64() // read float64
+		target.GPUMemoryBytesUsageMax = d
+	} else {
+		target.GPUMemoryBytesUsageMax = float64(0) // default
+	}
+
 	return nil
 }
 
@@ -3007,8 +3082,8 @@ func (target *SharedAsset) UnmarshalBinary(data []byte) (err error) {
 
 	// Codec Version Check
 	version := buff.ReadUInt8()
-	if version != CodecVersion {
-		return fmt.Errorf("Invalid Version Unmarshaling SharedAsset. Expected %d, got %d", CodecVersion, version)
+	if version < MinCodecVersion || version > CodecVersion {
+		return fmt.Errorf("Invalid Version Unmarshaling SharedAsset. Expected %d to %d, got %d", MinCodecVersion, CodecVersion, version)
 	}
 
 	if buff.ReadUInt8() == uint8(0) {
@@ -3145,8 +3220,8 @@ func (target *Window) UnmarshalBinary(data []byte) (err error) {
 
 	// Codec Version Check
 	version := buff.ReadUInt8()
-	if version != CodecVersion {
-		return fmt.Errorf("Invalid Version Unmarshaling Window. Expected %d, got %d", CodecVersion, version)
+	if version < MinCodecVersion || version > CodecVersion {
+		return fmt.Errorf("Invalid Version Unmarshaling Window. Expected %d to %d, got %d", MinCodecVersion, CodecVersion, version)
 	}
 
 	if buff.ReadUInt8() == uint8(0) {
@@ -1,12 +1,100 @@
 package kubecost
 
 import (
+	"bytes"
 	"testing"
 	"time"
+
+	"github.com/kubecost/cost-model/pkg/util"
 )
 
 func TestAllocation_BinaryEncoding(t *testing.T) {
-	// TODO niko/etl
+	start := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+	a0 := NewUnitAllocation("", start, day, nil)
+	a0.GPUUsageAverage = 0.5
+	a0.GPUMemoryBytesUsageAverage = 1024.0
+	a0.RawAllocationOnly.GPUUsageMax = 0.9
+	a0.RawAllocationOnly.GPUMemoryBytesUsageMax = 2048.0
+	a0.ExtendedResourceCosts = map[string]float64{"hugepages-2Mi": 1.5}
+
+	bs, err := a0.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Allocation.Binary: unexpected error: %s", err)
+	}
+
+	a1 := &Allocation{}
+	err = a1.UnmarshalBinary(bs)
+	if err != nil {
+		t.Fatalf("Allocation.Binary: unexpected error: %s", err)
+	}
+
+	if !a0.Equal(a1) {
+		t.Fatalf("Allocation.Binary: expected %+v; found %+v", a0, a1)
+	}
+}
+
+func TestAllocation_BinaryEncodingV11(t *testing.T) {
+	encode := func(fs ...float64) []byte {
+		buff := util.NewBuffer()
+		for _, f := range fs {
+			buff.WriteFloat64(f)
+		}
+		return buff.Bytes()
+	}
+
+	start := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+	a0 := NewUnitAllocation("", start, day, nil)
+	a0.GPUCost = 0.25
+	a0.GPUUsageAverage = 0.5
+	a0.GPUMemoryBytesUsageAverage = 1024.0
+	a0.ExternalCost = 0.75
+	a0.RawAllocationOnly = nil
+
+	bs, err := a0.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Allocation.Binary: unexpected error: %s", err)
+	}
+
+	// Rewrite as version 11 by dropping the fields added in version 12: the
+	// GPU usage following GPUCost, and the nil byte of ExtendedResourceCosts
+	// following ExternalCost
+	gpu, ext := encode(a0.GPUCost, a0.GPUUsageAverage, a0.GPUMemoryBytesUsageAverage), append(encode(a0.ExternalCost), 0)
+	if !bytes.Contains(bs, gpu) || !bytes.Contains(bs, ext) {
+		t.Fatalf("Allocation.Binary: expected version 12 fields")
+	}
+	bs = bytes.Replace(bs, gpu, encode(a0.GPUCost), 1)
+	bs = bytes.Replace(bs, ext, encode(a0.ExternalCost), 1)
+	bs[0] = 11
+
+	a1 := &Allocation{}
+	err = a1.UnmarshalBinary(bs)
+	if err != nil {
+		t.Fatalf("Allocation.Binary: unexpected error: %s", err)
+	}
+	if a1.GPUCost != 0.25 || a1.ExternalCost != 0.75 || a1.TotalCost() != a0.TotalCost() {
+		t.Fatalf("Allocation.Binary: expected costs of %+v; found %+v", a0, a1)
+	}
+	if a1.GPUUsageAverage != 0.0 || a1.GPUMemoryBytesUsageAverage != 0.0 || a1.ExtendedResourceCosts != nil {
+		t.Fatalf("Allocation.Binary: expected zero version 12 fields; found %+v", a1)
+	}
+
+	raw := util.NewBuffer()
+	raw.WriteUInt8(11)
+	raw.WriteFloat64(2.0)
+	raw.WriteFloat64(1024.0)
+	r1 := &RawAllocationOnlyData{}
+	err = r1.UnmarshalBinary(raw.Bytes())
+	if err != nil {
+		t.Fatalf("RawAllocationOnlyData.Binary: unexpected error: %s", err)
+	}
+	if r1.CPUCoreUsageMax != 2.0 || r1.RAMBytesUsageMax != 1024.0 || r1.GPUUsageMax != 0.0 || r1.GPUMemoryBytesUsageMax != 0.0 {
+		t.Fatalf("RawAllocationOnlyData.Binary: unexpected %+v", r1)
+	}
+
+	bs[0] = 10
+	if err := (&Allocation{}).UnmarshalBinary(bs); err == nil {
+		t.Fatalf("Allocation.Binary: expected error unmarshaling version 10")
+	}
 }
 
 func TestAllocationSet_BinaryEncoding(t *testing.T) {
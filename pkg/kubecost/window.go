@@ -111,6 +111,13 @@ func ParseWindowWithOffset(window string, offset time.Duration) (Window, error)
 	return parseWindow(window, now)
 }
 
+// ParseWindowAt parses the given window string relative to the given moment
+// in time, within the context of its timezone; e.g. "yesterday" is the day
+// before the given time.
+func ParseWindowAt(window string, now time.Time) (Window, error) {
+	return parseWindow(window, now)
+}
+
 // parseWindow generalizes the parsing of window strings, relative to a given
 // moment in time, defined as "now".
 func parseWindow(window string, now time.Time) (Window, error) {
@@ -545,6 +545,27 @@ func TestParseWindowWithOffsetString(t *testing.T) {
 
 }
 
+func TestParseWindowAt(t *testing.T) {
+	loc := time.FixedZone("", 2*60*60)
+	now := time.Date(2021, time.March, 2, 0, 30, 0, 0, loc)
+
+	yesterday, err := ParseWindowAt("yesterday", now)
+	if err != nil {
+		t.Fatalf(`unexpected error parsing "yesterday": %s`, err)
+	}
+	if !yesterday.Start().Equal(time.Date(2021, time.March, 1, 0, 0, 0, 0, loc)) || !yesterday.End().Equal(time.Date(2021, time.March, 2, 0, 0, 0, 0, loc)) {
+		t.Fatalf(`expect: window "yesterday" to be March 1 in UTC+2; actual: %s`, yesterday)
+	}
+
+	week, err := ParseWindowAt("7d", now)
+	if err != nil {
+		t.Fatalf(`unexpected error parsing "7d": %s`, err)
+	}
+	if !week.End().Equal(now) || week.Duration() != 7*24*time.Hour {
+		t.Fatalf(`expect: window "7d" to end at %s; actual: %s`, now, week)
+	}
+}
+
 func TestWindow_DurationOffsetStrings(t *testing.T) {
 	w, err := ParseWindowUTC("1d")
 	if err != nil {
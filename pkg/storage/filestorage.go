@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileStorage is a Storage implementation which stores files on the local
+// file system, within a base directory.
+type FileStorage struct {
+	baseDir string
+}
+
+// NewFileStorage creates a FileStorage rooted at the given base directory.
+func NewFileStorage(baseDir string) *FileStorage {
+	return &FileStorage{
+		baseDir: baseDir,
+	}
+}
+
+// FullPath returns the path on the local file system of the given path.
+func (fs *FileStorage) FullPath(path string) string {
+	return filepath.Join(fs.baseDir, filepath.FromSlash(path))
+}
+
+// Stat returns the StorageInfo of the file at the given path.
+func (fs *FileStorage) Stat(path string) (*StorageInfo, error) {
+	st, err := os.Stat(fs.FullPath(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &DoesNotExistError{Path: path}
+		}
+		return nil, fmt.Errorf("FileStorage: error stating %s: %s", path, err)
+	}
+
+	return &StorageInfo{
+		Name:    st.Name(),
+		Size:    st.Size(),
+		ModTime: st.ModTime(),
+	}, nil
+}
+
+// Read returns the contents of the file at the given path.
+func (fs *FileStorage) Read(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(fs.FullPath(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &DoesNotExistError{Path: path}
+		}
+		return nil, fmt.Errorf("FileStorage: error reading %s: %s", path, err)
+	}
+
+	return data, nil
+}
+
+// Write writes the given data to the file at the given path, creating any
+// missing directories. The data is written to a temporary file first, then
+// renamed, so that a partial write never replaces a complete file.
+func (fs *FileStorage) Write(path string, data []byte) error {
+	fullPath := fs.FullPath(path)
+	dir, name := filepath.Split(fullPath)
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("FileStorage: error creating directory %s: %s", dir, err)
+	}
+
+	tmpPath := filepath.Join(dir, "."+name)
+	err = ioutil.WriteFile(tmpPath, data, 0644)
+	if err != nil {
+		return fmt.Errorf("FileStorage: error writing %s: %s", path, err)
+	}
+
+	err = os.Rename(tmpPath, fullPath)
+	if err != nil {
+		return fmt.Errorf("FileStorage: error renaming %s: %s", path, err)
+	}
+
+	return nil
+}
+
+// Remove deletes the file at the given path.
+func (fs *FileStorage) Remove(path string) error {
+	err := os.Remove(fs.FullPath(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &DoesNotExistError{Path: path}
+		}
+		return fmt.Errorf("FileStorage: error removing %s: %s", path, err)
+	}
+
+	return nil
+}
+
+// Exists returns true if a file exists at the given path.
+func (fs *FileStorage) Exists(path string) (bool, error) {
+	_, err := fs.Stat(path)
+	if err != nil {
+		if IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// List returns the StorageInfo of each file directly within the given
+// directory path, excluding hidden and temporary files. A directory which
+// does not exist contains no files.
+func (fs *FileStorage) List(path string) ([]*StorageInfo, error) {
+	files, err := ioutil.ReadDir(fs.FullPath(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*StorageInfo{}, nil
+		}
+		return nil, fmt.Errorf("FileStorage: error listing %s: %s", path, err)
+	}
+
+	infos := []*StorageInfo{}
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		infos = append(infos, &StorageInfo{
+			Name:    file.Name(),
+			Size:    file.Size(),
+			ModTime: file.ModTime(),
+		})
+	}
+
+	return infos, nil
+}
@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3Config configures an S3Storage.
+type S3Config struct {
+	// Bucket is the name of the bucket in which files are stored
+	Bucket string
+
+	// Prefix is prepended to the key of every file; e.g. "etl/"
+	Prefix string
+
+	// Region is the region of the bucket
+	Region string
+
+	// Endpoint optionally overrides the S3 endpoint, for use with
+	// S3-compatible services such as MinIO; e.g. "minio.local:9000". Setting
+	// an endpoint also enables path-style addressing.
+	Endpoint string
+
+	// Insecure disables TLS when connecting to a custom endpoint
+	Insecure bool
+
+	// AccessKeyID and SecretAccessKey are optional static credentials. If
+	// they are not provided, the default AWS credential chain is used.
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// S3Storage is a Storage implementation which stores files in an S3 or
+// S3-compatible bucket.
+type S3Storage struct {
+	bucket string
+	prefix string
+	client *s3.S3
+}
+
+// NewS3Storage creates an S3Storage with the given config.
+func NewS3Storage(config S3Config) (*S3Storage, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("S3Storage: bucket is required")
+	}
+
+	conf := aws.NewConfig().WithRegion(config.Region).WithCredentialsChainVerboseErrors(true)
+	if config.Endpoint != "" {
+		conf = conf.WithEndpoint(config.Endpoint).WithS3ForcePathStyle(true).WithDisableSSL(config.Insecure)
+	}
+	if config.AccessKeyID != "" && config.SecretAccessKey != "" {
+		conf = conf.WithCredentials(credentials.NewStaticCredentials(config.AccessKeyID, config.SecretAccessKey, ""))
+	}
+
+	sess, err := session.NewSession(conf)
+	if err != nil {
+		return nil, fmt.Errorf("S3Storage: error creating session: %s", err)
+	}
+
+	prefix := strings.Trim(config.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &S3Storage{
+		bucket: config.Bucket,
+		prefix: prefix,
+		client: s3.New(sess),
+	}, nil
+}
+
+// key returns the object key of the given path.
+func (s3s *S3Storage) key(path string) string {
+	return s3s.prefix + strings.TrimPrefix(path, "/")
+}
+
+// FullPath returns the s3:// URI of the given path.
+func (s3s *S3Storage) FullPath(path string) string {
+	return fmt.Sprintf("s3://%s/%s", s3s.bucket, s3s.key(path))
+}
+
+// Stat returns the StorageInfo of the object at the given path.
+func (s3s *S3Storage) Stat(path string) (*StorageInfo, error) {
+	out, err := s3s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s3s.bucket),
+		Key:    aws.String(s3s.key(path)),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, &DoesNotExistError{Path: path}
+		}
+		return nil, fmt.Errorf("S3Storage: error stating %s: %s", path, err)
+	}
+
+	name := path
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		name = path[i+1:]
+	}
+
+	return &StorageInfo{
+		Name:    name,
+		Size:    aws.Int64Value(out.ContentLength),
+		ModTime: aws.TimeValue(out.LastModified),
+	}, nil
+}
+
+// Read returns the contents of the object at the given path.
+func (s3s *S3Storage) Read(path string) ([]byte, error) {
+	out, err := s3s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s3s.bucket),
+		Key:    aws.String(s3s.key(path)),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, &DoesNotExistError{Path: path}
+		}
+		return nil, fmt.Errorf("S3Storage: error reading %s: %s", path, err)
+	}
+	defer out.Body.Close()
+
+	data, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, fmt.Errorf("S3Storage: error reading %s: %s", path, err)
+	}
+
+	return data, nil
+}
+
+// Write uploads the given data to the object at the given path, replacing
+// any existing object.
+func (s3s *S3Storage) Write(path string, data []byte) error {
+	_, err := s3s.client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s3s.bucket),
+		Key:    aws.String(s3s.key(path)),
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		return fmt.Errorf("S3Storage: error writing %s: %s", path, err)
+	}
+
+	return nil
+}
+
+// Remove deletes the object at the given path.
+func (s3s *S3Storage) Remove(path string) error {
+	_, err := s3s.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s3s.bucket),
+		Key:    aws.String(s3s.key(path)),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return &DoesNotExistError{Path: path}
+		}
+		return fmt.Errorf("S3Storage: error removing %s: %s", path, err)
+	}
+
+	return nil
+}
+
+// Exists returns true if an object exists at the given path.
+func (s3s *S3Storage) Exists(path string) (bool, error) {
+	_, err := s3s.Stat(path)
+	if err != nil {
+		if IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// List returns the StorageInfo of each object directly within the given
+// directory path.
+func (s3s *S3Storage) List(path string) ([]*StorageInfo, error) {
+	prefix := strings.TrimSuffix(s3s.key(path), "/") + "/"
+
+	infos := []*StorageInfo{}
+	err := s3s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket:    aws.String(s3s.bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	}, func(out *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range out.Contents {
+			name := strings.TrimPrefix(aws.StringValue(obj.Key), prefix)
+			if name == "" {
+				continue
+			}
+
+			infos = append(infos, &StorageInfo{
+				Name:    name,
+				Size:    aws.Int64Value(obj.Size),
+				ModTime: aws.TimeValue(obj.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("S3Storage: error listing %s: %s", path, err)
+	}
+
+	return infos, nil
+}
+
+// isS3NotFound returns true if the given error is an S3 error indicating
+// that the requested object does not exist.
+func isS3NotFound(err error) bool {
+	if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == http.StatusNotFound {
+		return true
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound"
+	}
+	return false
+}
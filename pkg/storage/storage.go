@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// DoesNotExistError is returned by Storage implementations when the
+// requested path does not exist.
+type DoesNotExistError struct {
+	Path string
+}
+
+// Error returns the error message
+func (dnee *DoesNotExistError) Error() string {
+	return fmt.Sprintf("path does not exist: %s", dnee.Path)
+}
+
+// IsNotExist returns true if the given error indicates that a path does not
+// exist in storage.
+func IsNotExist(err error) bool {
+	_, ok := err.(*DoesNotExistError)
+	return ok
+}
+
+// StorageInfo describes a single file in storage.
+type StorageInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage provides a simple, flat API for reading, writing, listing, and
+// removing files, independent of where the files are stored; e.g. on local
+// disk or in an S3-compatible bucket. Paths are always slash-separated and
+// relative to the root of the storage.
+type Storage interface {
+	// FullPath returns the storage-specific full path of the given path,
+	// e.g. for reporting purposes.
+	FullPath(path string) string
+
+	// Stat returns the StorageInfo of the file at the given path.
+	Stat(path string) (*StorageInfo, error)
+
+	// Read returns the contents of the file at the given path.
+	Read(path string) ([]byte, error)
+
+	// Write writes the given data to the file at the given path, replacing
+	// any existing file.
+	Write(path string, data []byte) error
+
+	// Remove deletes the file at the given path.
+	Remove(path string) error
+
+	// Exists returns true if a file exists at the given path.
+	Exists(path string) (bool, error)
+
+	// List returns the StorageInfo of each file directly within the given
+	// directory path.
+	List(path string) ([]*StorageInfo, error)
+}
@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockS3Server is a minimal, in-memory stand-in for an S3-compatible service
+// such as MinIO, supporting path-style PutObject, GetObject, HeadObject,
+// DeleteObject, and ListObjectsV2 requests against a single bucket.
+type mockS3Server struct {
+	sync.Mutex
+	bucket  string
+	objects map[string][]byte
+	times   map[string]time.Time
+}
+
+type mockS3ListResult struct {
+	XMLName        xml.Name           `xml:"ListBucketResult"`
+	Name           string             `xml:"Name"`
+	Prefix         string             `xml:"Prefix"`
+	KeyCount       int                `xml:"KeyCount"`
+	IsTruncated    bool               `xml:"IsTruncated"`
+	Contents       []mockS3ListObject `xml:"Contents"`
+	CommonPrefixes []mockS3ListPrefix `xml:"CommonPrefixes"`
+}
+
+type mockS3ListObject struct {
+	Key          string `xml:"Key"`
+	Size         int64  `xml:"Size"`
+	LastModified string `xml:"LastModified"`
+}
+
+type mockS3ListPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+func newMockS3Server(bucket string) *mockS3Server {
+	return &mockS3Server{
+		bucket:  bucket,
+		objects: map[string][]byte{},
+		times:   map[string]time.Time{},
+	}
+}
+
+func (m *mockS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if path != m.bucket && !strings.HasPrefix(path, m.bucket+"/") {
+		m.notFound(w, "NoSuchBucket")
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(path, m.bucket), "/")
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		m.list(w, r.URL.Query().Get("prefix"), r.URL.Query().Get("delimiter"))
+	case r.Method == http.MethodPut:
+		data, _ := ioutil.ReadAll(r.Body)
+		m.objects[key] = data
+		m.times[key] = time.Now().UTC().Truncate(time.Second)
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := m.objects[key]
+		if !ok {
+			m.notFound(w, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Last-Modified", m.times[key].Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case r.Method == http.MethodDelete:
+		delete(m.objects, key)
+		delete(m.times, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (m *mockS3Server) list(w http.ResponseWriter, prefix, delimiter string) {
+	result := mockS3ListResult{
+		Name:   m.bucket,
+		Prefix: prefix,
+	}
+
+	keys := []string{}
+	for key := range m.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	prefixes := map[string]bool{}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		rest := strings.TrimPrefix(key, prefix)
+		if delimiter != "" && strings.Contains(rest, delimiter) {
+			p := prefix + rest[:strings.Index(rest, delimiter)+len(delimiter)]
+			if !prefixes[p] {
+				prefixes[p] = true
+				result.CommonPrefixes = append(result.CommonPrefixes, mockS3ListPrefix{Prefix: p})
+			}
+			continue
+		}
+
+		result.Contents = append(result.Contents, mockS3ListObject{
+			Key:          key,
+			Size:         int64(len(m.objects[key])),
+			LastModified: m.times[key].Format(time.RFC3339),
+		})
+	}
+	result.KeyCount = len(result.Contents)
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (m *mockS3Server) notFound(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte("<Error><Code>" + code + "</Code><Message>not found</Message></Error>"))
+}
+
+// testStorage runs the same sequence of operations against any Storage
+// implementation.
+func testStorage(t *testing.T, s Storage) {
+	exists, err := s.Exists("dir/file1")
+	if err != nil || exists {
+		t.Fatalf("expected (false, nil); got (%t, %v)", exists, err)
+	}
+
+	_, err = s.Read("dir/file1")
+	if !IsNotExist(err) {
+		t.Fatalf("expected DoesNotExistError; got %v", err)
+	}
+
+	infos, err := s.List("dir")
+	if err != nil || len(infos) != 0 {
+		t.Fatalf("expected empty listing; got (%v, %v)", infos, err)
+	}
+
+	for _, path := range []string{"dir/file1", "dir/file2", "dir/sub/file3"} {
+		err = s.Write(path, []byte("data:"+path))
+		if err != nil {
+			t.Fatalf("unexpected error writing %s: %s", path, err)
+		}
+	}
+
+	// Overwrite an existing file
+	err = s.Write("dir/file1", []byte("hello"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	data, err := s.Read("dir/file1")
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("expected (hello, nil); got (%s, %v)", data, err)
+	}
+
+	info, err := s.Stat("dir/file1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if info.Name != "file1" || info.Size != 5 || info.ModTime.IsZero() {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+
+	infos, err = s.List("dir")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	names := []string{}
+	for _, info := range infos {
+		names = append(names, info.Name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "file1,file2" {
+		t.Fatalf("expected [file1 file2]; got %v", names)
+	}
+
+	err = s.Remove("dir/file1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	exists, err = s.Exists("dir/file1")
+	if err != nil || exists {
+		t.Fatalf("expected (false, nil) after remove; got (%t, %v)", exists, err)
+	}
+}
+
+func TestFileStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	testStorage(t, NewFileStorage(dir))
+}
+
+func TestS3Storage(t *testing.T) {
+	server := httptest.NewServer(newMockS3Server("kubecost"))
+	defer server.Close()
+
+	s, err := NewS3Storage(S3Config{
+		Bucket:          "kubecost",
+		Prefix:          "/etl/",
+		Region:          "us-east-1",
+		Endpoint:        strings.TrimPrefix(server.URL, "http://"),
+		Insecure:        true,
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if s.FullPath("dir/file1") != "s3://kubecost/etl/dir/file1" {
+		t.Fatalf("unexpected full path: %s", s.FullPath("dir/file1"))
+	}
+
+	testStorage(t, s)
+}
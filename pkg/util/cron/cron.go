@@ -0,0 +1,207 @@
+// Package cron parses standard five-field cron expressions and computes the
+// times at which they are next due.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// descriptors are the supported shorthands for common expressions.
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// field describes the legal range of values of a single field.
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// Schedule is a parsed cron expression, holding the set of matching values of
+// each field as a bit set.
+type Schedule struct {
+	expr   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	// domStar and dowStar record whether the day of month and day of week
+	// fields are unrestricted, which determines how they are combined.
+	domStar bool
+	dowStar bool
+}
+
+// Parse parses a cron expression of the form
+//   <minute> <hour> <day of month> <month> <day of week>
+// where each field is "*", a value, a range "a-b", or a comma-separated list
+// thereof, optionally followed by a step "/n"; e.g. "*/15 9-17 * * 1-5".
+// Day of week 7 is accepted as Sunday. The descriptors @yearly, @annually,
+// @monthly, @weekly, @daily, @midnight, and @hourly are also accepted.
+func Parse(expr string) (*Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if d, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("cron: expected %d fields; got %d in %q", len(fields), len(parts), expr)
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, part := range parts {
+		f := fields[i]
+		max := f.max
+		if i == 4 {
+			// Allow 7 as an alias of Sunday
+			max = 7
+		}
+
+		b, err := parseField(part, f.min, max)
+		if err != nil {
+			return nil, fmt.Errorf("cron: illegal %s field %q: %s", f.name, part, err)
+		}
+		bits[i] = b
+	}
+
+	// Fold Sunday as 7 into Sunday as 0
+	if bits[4]&(1<<7) != 0 {
+		bits[4] = (bits[4] &^ (1 << 7)) | 1
+	}
+
+	return &Schedule{
+		expr:    expr,
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: strings.HasPrefix(parts[2], "*"),
+		dowStar: strings.HasPrefix(parts[4], "*"),
+	}, nil
+}
+
+// parseField parses a comma-separated list of values, ranges, and steps into
+// a bit set of the values in the given range.
+func parseField(s string, min, max int) (uint64, error) {
+	var bits uint64
+
+	for _, term := range strings.Split(s, ",") {
+		rng, step := term, 1
+		if i := strings.Index(term, "/"); i >= 0 {
+			rng = term[:i]
+			n, err := strconv.Atoi(term[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("illegal step %q", term[i+1:])
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			lo, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("illegal value %q", bounds[0])
+			}
+			hi, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return 0, fmt.Errorf("illegal value %q", bounds[1])
+			}
+		default:
+			v, err := strconv.Atoi(rng)
+			if err != nil {
+				return 0, fmt.Errorf("illegal value %q", rng)
+			}
+			lo = v
+			hi = v
+			if step > 1 {
+				// "a/n" means every n starting at a
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%d-%d out of range %d-%d", lo, hi, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+// String returns the expression from which the Schedule was parsed.
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// Next returns the earliest time, strictly after the given time, at which
+// the Schedule is due, evaluated in the location of the given time. If no
+// such time exists within five years (e.g. "0 0 31 2 *"), then it returns
+// the zero time.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// dayMatches returns true if the day of the given time matches the Schedule.
+// As is standard, if both the day of month and day of week are restricted,
+// then a day matches if either field matches.
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,81 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule_Next(t *testing.T) {
+	// Monday, March 1, 2021
+	from := time.Date(2021, time.March, 1, 10, 30, 15, 0, time.UTC)
+
+	cases := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2021, time.March, 1, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2021, time.March, 1, 10, 45, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2021, time.March, 2, 10, 30, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2021, time.March, 1, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2021, time.March, 2, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2021, time.March, 7, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 9-17 * * 1-5", time.Date(2021, time.March, 1, 11, 0, 0, 0, time.UTC)},
+		{"0 6 * * 6,7", time.Date(2021, time.March, 6, 6, 0, 0, 0, time.UTC)},
+		{"0 0 15 * 5", time.Date(2021, time.March, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2021, time.March, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+
+	for _, c := range cases {
+		s, err := Parse(c.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.expr, err)
+			continue
+		}
+
+		actual := s.Next(from)
+		if !actual.Equal(c.expected) {
+			t.Errorf("%s: expected %s; got %s", c.expr, c.expected, actual)
+		}
+	}
+}
+
+func TestSchedule_NextInLocation(t *testing.T) {
+	loc := time.FixedZone("UTC-6", -6*60*60)
+	from := time.Date(2021, time.March, 1, 23, 0, 0, 0, loc)
+
+	s, err := Parse("@daily")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := time.Date(2021, time.March, 2, 0, 0, 0, 0, loc)
+	if actual := s.Next(from); !actual.Equal(expected) {
+		t.Fatalf("expected %s; got %s", expected, actual)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	exprs := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@never",
+	}
+
+	for _, expr := range exprs {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Thrift compact protocol type identifiers, as used in field and list
+// headers.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes the subset of the Thrift compact protocol required to
+// write Parquet metadata; i.e. structs of integers, strings, lists, and
+// nested structs. Fields must be written in increasing order of id within
+// each struct.
+type thriftWriter struct {
+	buf     bytes.Buffer
+	lastIDs []int16
+	lastID  int16
+}
+
+// structBegin begins a nested struct, saving the field id state of the
+// enclosing struct.
+func (tw *thriftWriter) structBegin() {
+	tw.lastIDs = append(tw.lastIDs, tw.lastID)
+	tw.lastID = 0
+}
+
+// structEnd writes the stop field and restores the field id state of the
+// enclosing struct.
+func (tw *thriftWriter) structEnd() {
+	tw.buf.WriteByte(0)
+	tw.lastID = tw.lastIDs[len(tw.lastIDs)-1]
+	tw.lastIDs = tw.lastIDs[:len(tw.lastIDs)-1]
+}
+
+func (tw *thriftWriter) fieldHeader(id int16, typ byte) {
+	delta := id - tw.lastID
+	if delta > 0 && delta <= 15 {
+		tw.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		tw.buf.WriteByte(typ)
+		tw.writeVarint(zigzag(int64(id)))
+	}
+	tw.lastID = id
+}
+
+func (tw *thriftWriter) listHeader(size int, elemType byte) {
+	if size < 15 {
+		tw.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		tw.buf.WriteByte(0xF0 | elemType)
+		tw.writeVarint(uint64(size))
+	}
+}
+
+func (tw *thriftWriter) writeVarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	tw.buf.Write(b[:n])
+}
+
+func (tw *thriftWriter) writeString(s string) {
+	tw.writeVarint(uint64(len(s)))
+	tw.buf.WriteString(s)
+}
+
+func (tw *thriftWriter) i32Field(id int16, v int32) {
+	tw.fieldHeader(id, thriftI32)
+	tw.writeVarint(zigzag(int64(v)))
+}
+
+func (tw *thriftWriter) i64Field(id int16, v int64) {
+	tw.fieldHeader(id, thriftI64)
+	tw.writeVarint(zigzag(v))
+}
+
+func (tw *thriftWriter) stringField(id int16, s string) {
+	tw.fieldHeader(id, thriftBinary)
+	tw.writeString(s)
+}
+
+func (tw *thriftWriter) i32ListField(id int16, vs []int32) {
+	tw.fieldHeader(id, thriftList)
+	tw.listHeader(len(vs), thriftI32)
+	for _, v := range vs {
+		tw.writeVarint(zigzag(int64(v)))
+	}
+}
+
+func (tw *thriftWriter) stringListField(id int16, ss []string) {
+	tw.fieldHeader(id, thriftList)
+	tw.listHeader(len(ss), thriftBinary)
+	for _, s := range ss {
+		tw.writeString(s)
+	}
+}
+
+// structListField writes a list of n structs, each of which is written by
+// calling the given function with its index between structBegin and
+// structEnd.
+func (tw *thriftWriter) structListField(id int16, n int, f func(i int)) {
+	tw.fieldHeader(id, thriftList)
+	tw.listHeader(n, thriftStruct)
+	for i := 0; i < n; i++ {
+		tw.structBegin()
+		f(i)
+		tw.structEnd()
+	}
+}
+
+// structField writes a nested struct, which is written by calling the given
+// function between structBegin and structEnd.
+func (tw *thriftWriter) structField(id int16, f func()) {
+	tw.fieldHeader(id, thriftStruct)
+	tw.structBegin()
+	f()
+	tw.structEnd()
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
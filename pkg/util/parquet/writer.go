@@ -0,0 +1,380 @@
+// Package parquet implements a minimal, dependency-free writer of Apache
+// Parquet files. It supports flat schemas of string, double, and timestamp
+// columns, which may be optional, written with PLAIN encoding and no
+// compression. Rows are buffered only until a row group is full, at which
+// point the row group is written out, so that large tables can be streamed.
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// ColumnType is the logical type of a column.
+type ColumnType int
+
+const (
+	// String columns hold UTF-8 strings
+	String ColumnType = iota
+
+	// Double columns hold 64-bit floating point numbers
+	Double
+
+	// Timestamp columns hold times, stored in milliseconds since the epoch
+	Timestamp
+)
+
+// Column describes a single column of a Parquet file. Optional columns may
+// hold null values.
+type Column struct {
+	Name     string
+	Type     ColumnType
+	Optional bool
+}
+
+// DefaultRowGroupSize is the number of rows buffered per row group if no
+// positive size is given to NewWriter.
+const DefaultRowGroupSize = 10000
+
+// Parquet enumerations, as defined by parquet.thrift
+const (
+	typeInt64     = 2
+	typeDouble    = 5
+	typeByteArray = 6
+
+	repetitionRequired = 0
+	repetitionOptional = 1
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	codecUncompressed = 0
+
+	pageTypeData = 0
+)
+
+var magic = []byte("PAR1")
+
+// columnBuffer holds the encoded values and definition levels of a column
+// for the current row group.
+type columnBuffer struct {
+	values    bytes.Buffer
+	defLevels []byte
+	numValues int
+}
+
+// rowGroup records the metadata of a row group which has been written.
+type rowGroup struct {
+	numRows int64
+	size    int64
+	chunks  []columnChunk
+}
+
+// columnChunk records the metadata of a column chunk which has been written.
+type columnChunk struct {
+	offset    int64
+	size      int64
+	numValues int64
+}
+
+// Writer writes rows to a Parquet file.
+type Writer struct {
+	w            io.Writer
+	columns      []Column
+	rowGroupSize int
+	buffers      []*columnBuffer
+	numRows      int
+	offset       int64
+	rowGroups    []rowGroup
+	closed       bool
+}
+
+// NewWriter creates a Writer of the given columns to the given io.Writer,
+// buffering up to the given number of rows per row group. It writes the
+// Parquet header immediately.
+func NewWriter(w io.Writer, columns []Column, rowGroupSize int) (*Writer, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("parquet: no columns")
+	}
+	if rowGroupSize <= 0 {
+		rowGroupSize = DefaultRowGroupSize
+	}
+
+	pw := &Writer{
+		w:            w,
+		columns:      columns,
+		rowGroupSize: rowGroupSize,
+		buffers:      make([]*columnBuffer, len(columns)),
+	}
+	for i := range pw.buffers {
+		pw.buffers[i] = &columnBuffer{}
+	}
+
+	err := pw.write(magic)
+	if err != nil {
+		return nil, err
+	}
+
+	return pw, nil
+}
+
+// Write appends a row, which must have one value per column. Values must be
+// of type string, float64, or time.Time for String, Double, and Timestamp
+// columns, respectively, or nil for null values of optional columns.
+func (pw *Writer) Write(row []interface{}) error {
+	if pw.closed {
+		return fmt.Errorf("parquet: write to closed writer")
+	}
+	if len(row) != len(pw.columns) {
+		return fmt.Errorf("parquet: expected %d values; got %d", len(pw.columns), len(row))
+	}
+
+	for i, col := range pw.columns {
+		buf := pw.buffers[i]
+
+		if row[i] == nil {
+			if !col.Optional {
+				return fmt.Errorf("parquet: null value for required column %s", col.Name)
+			}
+			buf.defLevels = append(buf.defLevels, 0)
+			buf.numValues++
+			continue
+		}
+
+		switch col.Type {
+		case String:
+			s, ok := row[i].(string)
+			if !ok {
+				return fmt.Errorf("parquet: expected string for column %s; got %T", col.Name, row[i])
+			}
+			binary.Write(&buf.values, binary.LittleEndian, uint32(len(s)))
+			buf.values.WriteString(s)
+		case Double:
+			f, ok := row[i].(float64)
+			if !ok {
+				return fmt.Errorf("parquet: expected float64 for column %s; got %T", col.Name, row[i])
+			}
+			binary.Write(&buf.values, binary.LittleEndian, math.Float64bits(f))
+		case Timestamp:
+			t, ok := row[i].(time.Time)
+			if !ok {
+				return fmt.Errorf("parquet: expected time.Time for column %s; got %T", col.Name, row[i])
+			}
+			binary.Write(&buf.values, binary.LittleEndian, t.UnixNano()/int64(time.Millisecond))
+		}
+
+		if col.Optional {
+			buf.defLevels = append(buf.defLevels, 1)
+		}
+		buf.numValues++
+	}
+
+	pw.numRows++
+	if pw.numRows >= pw.rowGroupSize {
+		return pw.flush()
+	}
+
+	return nil
+}
+
+// Close writes any buffered rows and the Parquet footer. It does not close
+// the underlying io.Writer.
+func (pw *Writer) Close() error {
+	if pw.closed {
+		return nil
+	}
+
+	err := pw.flush()
+	if err != nil {
+		return err
+	}
+	pw.closed = true
+
+	footer := pw.footer()
+	err = pw.write(footer)
+	if err != nil {
+		return err
+	}
+
+	length := make([]byte, 4)
+	binary.LittleEndian.PutUint32(length, uint32(len(footer)))
+	err = pw.write(length)
+	if err != nil {
+		return err
+	}
+
+	return pw.write(magic)
+}
+
+// flush writes the buffered rows as a row group, consisting of one column
+// chunk, of a single data page, per column.
+func (pw *Writer) flush() error {
+	if pw.numRows == 0 {
+		return nil
+	}
+
+	rg := rowGroup{
+		numRows: int64(pw.numRows),
+		chunks:  make([]columnChunk, len(pw.columns)),
+	}
+
+	for i, col := range pw.columns {
+		buf := pw.buffers[i]
+
+		page := bytes.Buffer{}
+		if col.Optional {
+			levels := encodeDefinitionLevels(buf.defLevels)
+			binary.Write(&page, binary.LittleEndian, uint32(len(levels)))
+			page.Write(levels)
+		}
+		page.Write(buf.values.Bytes())
+
+		tw := &thriftWriter{}
+		tw.structBegin()
+		tw.i32Field(1, pageTypeData)
+		tw.i32Field(2, int32(page.Len()))
+		tw.i32Field(3, int32(page.Len()))
+		tw.structField(5, func() {
+			tw.i32Field(1, int32(buf.numValues))
+			tw.i32Field(2, encodingPlain)
+			tw.i32Field(3, encodingRLE)
+			tw.i32Field(4, encodingRLE)
+		})
+		tw.structEnd()
+
+		chunk := columnChunk{
+			offset:    pw.offset,
+			size:      int64(tw.buf.Len() + page.Len()),
+			numValues: int64(buf.numValues),
+		}
+
+		err := pw.write(tw.buf.Bytes())
+		if err != nil {
+			return err
+		}
+		err = pw.write(page.Bytes())
+		if err != nil {
+			return err
+		}
+
+		rg.chunks[i] = chunk
+		rg.size += chunk.size
+
+		pw.buffers[i] = &columnBuffer{}
+	}
+
+	pw.rowGroups = append(pw.rowGroups, rg)
+	pw.numRows = 0
+
+	return nil
+}
+
+// footer encodes the FileMetaData of the file.
+func (pw *Writer) footer() []byte {
+	numRows := int64(0)
+	for _, rg := range pw.rowGroups {
+		numRows += rg.numRows
+	}
+
+	tw := &thriftWriter{}
+	tw.structBegin()
+	tw.i32Field(1, 1)
+	tw.structListField(2, len(pw.columns)+1, func(i int) {
+		if i == 0 {
+			tw.stringField(4, "schema")
+			tw.i32Field(5, int32(len(pw.columns)))
+			return
+		}
+
+		col := pw.columns[i-1]
+		tw.i32Field(1, physicalType(col.Type))
+		if col.Optional {
+			tw.i32Field(3, repetitionOptional)
+		} else {
+			tw.i32Field(3, repetitionRequired)
+		}
+		tw.stringField(4, col.Name)
+		switch col.Type {
+		case String:
+			tw.i32Field(6, convertedUTF8)
+		case Timestamp:
+			tw.i32Field(6, convertedTimestampMillis)
+		}
+	})
+	tw.i64Field(3, numRows)
+	tw.structListField(4, len(pw.rowGroups), func(i int) {
+		rg := pw.rowGroups[i]
+
+		tw.structListField(1, len(rg.chunks), func(j int) {
+			chunk := rg.chunks[j]
+			col := pw.columns[j]
+
+			tw.i64Field(2, chunk.offset)
+			tw.structField(3, func() {
+				tw.i32Field(1, physicalType(col.Type))
+				tw.i32ListField(2, []int32{encodingPlain, encodingRLE})
+				tw.stringListField(3, []string{col.Name})
+				tw.i32Field(4, codecUncompressed)
+				tw.i64Field(5, chunk.numValues)
+				tw.i64Field(6, chunk.size)
+				tw.i64Field(7, chunk.size)
+				tw.i64Field(9, chunk.offset)
+			})
+		})
+		tw.i64Field(2, rg.size)
+		tw.i64Field(3, rg.numRows)
+	})
+	tw.stringField(6, "kubecost cost-model")
+	tw.structEnd()
+
+	return tw.buf.Bytes()
+}
+
+func (pw *Writer) write(data []byte) error {
+	n, err := pw.w.Write(data)
+	pw.offset += int64(n)
+	if err != nil {
+		return fmt.Errorf("parquet: %s", err)
+	}
+	return nil
+}
+
+func physicalType(t ColumnType) int32 {
+	switch t {
+	case Double:
+		return typeDouble
+	case Timestamp:
+		return typeInt64
+	}
+	return typeByteArray
+}
+
+// encodeDefinitionLevels encodes the given definition levels, each of which
+// is 0 or 1, using the RLE/bit-packing hybrid encoding with a bit width of
+// one. Only RLE runs are used, one per run of equal levels.
+func encodeDefinitionLevels(levels []byte) []byte {
+	buf := bytes.Buffer{}
+	var varint [binary.MaxVarintLen64]byte
+
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+
+		n := binary.PutUvarint(varint[:], uint64(j-i)<<1)
+		buf.Write(varint[:n])
+		buf.WriteByte(levels[i])
+
+		i = j
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,424 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestWriter(t *testing.T) {
+	columns := []Column{
+		{Name: "name", Type: String},
+		{Name: "cost", Type: Double},
+		{Name: "start", Type: Timestamp},
+		{Name: "label", Type: String, Optional: true},
+	}
+
+	buf := &bytes.Buffer{}
+	pw, err := NewWriter(buf, columns, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	rows := [][]interface{}{
+		{"a", 1.0, start, "x"},
+		{"b", 2.0, start, nil},
+		{"c", 3.0, start, "z"},
+	}
+	for _, row := range rows {
+		err = pw.Write(row)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	err = pw.Close()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	b := buf.Bytes()
+	if string(b[:4]) != "PAR1" || string(b[len(b)-4:]) != "PAR1" {
+		t.Fatalf("expected magic bytes at start and end")
+	}
+
+	footerLen := int(binary.LittleEndian.Uint32(b[len(b)-8 : len(b)-4]))
+	if footerLen <= 0 || footerLen > len(b)-12 {
+		t.Fatalf("illegal footer length: %d", footerLen)
+	}
+
+	// Three rows with a row group size of two makes two row groups
+	if len(pw.rowGroups) != 2 {
+		t.Fatalf("expected 2 row groups; got %d", len(pw.rowGroups))
+	}
+	if pw.rowGroups[0].numRows != 2 || pw.rowGroups[1].numRows != 1 {
+		t.Fatalf("expected row groups of 2 and 1 rows; got %d and %d", pw.rowGroups[0].numRows, pw.rowGroups[1].numRows)
+	}
+
+	// The first column chunk immediately follows the magic bytes
+	if pw.rowGroups[0].chunks[0].offset != 4 {
+		t.Fatalf("expected first chunk at offset 4; got %d", pw.rowGroups[0].chunks[0].offset)
+	}
+
+	// Reading the file back, as a Parquet reader would, returns the rows
+	// written, including the null in the optional column
+	read, err := readFile(b)
+	if err != nil {
+		t.Fatalf("unexpected error reading file: %s", err)
+	}
+	if len(read) != len(rows) {
+		t.Fatalf("expected %d rows; got %d", len(rows), len(read))
+	}
+	for i, row := range rows {
+		for j, value := range row {
+			if ts, ok := value.(time.Time); ok {
+				value = ts.UnixNano() / int64(time.Millisecond)
+			}
+			if read[i][j] != value {
+				t.Fatalf("row %d, column %s: expected %v; got %v", i, columns[j].Name, value, read[i][j])
+			}
+		}
+	}
+}
+
+func TestWriter_Errors(t *testing.T) {
+	_, err := NewWriter(&bytes.Buffer{}, []Column{}, 0)
+	if err == nil {
+		t.Fatalf("expected error for no columns")
+	}
+
+	pw, err := NewWriter(&bytes.Buffer{}, []Column{{Name: "name", Type: String}}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := map[string][]interface{}{
+		"wrong length":  {"a", "b"},
+		"wrong type":    {1.0},
+		"required null": {nil},
+	}
+	for name, row := range cases {
+		if err := pw.Write(row); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	pw.Close()
+	if err := pw.Write([]interface{}{"a"}); err == nil {
+		t.Errorf("expected error writing to closed writer")
+	}
+}
+
+func TestEncodeDefinitionLevels(t *testing.T) {
+	// Runs of 1, 1, 0, 1 are encoded as (2<<1, 1), (1<<1, 0), (1<<1, 1)
+	expected := []byte{4, 1, 2, 0, 2, 1}
+	actual := encodeDefinitionLevels([]byte{1, 1, 0, 1})
+	if !bytes.Equal(actual, expected) {
+		t.Fatalf("expected %v; got %v", expected, actual)
+	}
+}
+
+// readFile decodes the rows of the given Parquet file, independently of the
+// Writer, following the Parquet format specification: the footer and page
+// headers are decoded as generic Thrift compact protocol structs, definition
+// levels with the RLE/bit-packing hybrid encoding, and values with the PLAIN
+// encoding. Null values are nil; strings are strings, doubles float64, and
+// timestamps int64 milliseconds.
+func readFile(b []byte) ([][]interface{}, error) {
+	if len(b) < 12 || string(b[:4]) != "PAR1" || string(b[len(b)-4:]) != "PAR1" {
+		return nil, fmt.Errorf("missing magic bytes")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(b[len(b)-8 : len(b)-4]))
+	footerStart := len(b) - 8 - footerLen
+	if footerStart < 4 {
+		return nil, fmt.Errorf("illegal footer length: %d", footerLen)
+	}
+
+	tr := &thriftReader{b: b[:len(b)-8], pos: footerStart}
+	meta, err := tr.readStruct()
+	if err != nil {
+		return nil, fmt.Errorf("error reading footer: %s", err)
+	}
+	if tr.pos != len(b)-8 {
+		return nil, fmt.Errorf("footer of %d bytes; read %d", footerLen, tr.pos-footerStart)
+	}
+
+	// The schema is a root element followed by one element per column
+	schema := meta[2].([]interface{})
+	root := schema[0].(map[int16]interface{})
+	if int(root[5].(int64)) != len(schema)-1 {
+		return nil, fmt.Errorf("root has %d children; schema has %d columns", root[5], len(schema)-1)
+	}
+	types := []int64{}
+	optional := []bool{}
+	for _, elem := range schema[1:] {
+		e := elem.(map[int16]interface{})
+		types = append(types, e[1].(int64))
+		optional = append(optional, e[3].(int64) == repetitionOptional)
+	}
+
+	rows := [][]interface{}{}
+	for _, rgValue := range meta[4].([]interface{}) {
+		rg := rgValue.(map[int16]interface{})
+		numRows := int(rg[3].(int64))
+
+		columns := [][]interface{}{}
+		for i, ccValue := range rg[1].([]interface{}) {
+			cc := ccValue.(map[int16]interface{})
+			cmd := cc[3].(map[int16]interface{})
+			if cmd[1].(int64) != types[i] || cmd[4].(int64) != codecUncompressed {
+				return nil, fmt.Errorf("column %d: unexpected chunk metadata: %v", i, cmd)
+			}
+
+			values, err := readPage(b, int(cmd[9].(int64)), types[i], optional[i])
+			if err != nil {
+				return nil, fmt.Errorf("column %d: %s", i, err)
+			}
+			if len(values) != numRows || int64(len(values)) != cmd[5].(int64) {
+				return nil, fmt.Errorf("column %d: expected %d values; got %d", i, numRows, len(values))
+			}
+			columns = append(columns, values)
+		}
+
+		for r := 0; r < numRows; r++ {
+			row := []interface{}{}
+			for _, values := range columns {
+				row = append(row, values[r])
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	if int64(len(rows)) != meta[3].(int64) {
+		return nil, fmt.Errorf("footer has %d rows; row groups have %d", meta[3], len(rows))
+	}
+
+	return rows, nil
+}
+
+// readPage decodes the values of the data page at the given offset.
+func readPage(b []byte, offset int, typ int64, optional bool) ([]interface{}, error) {
+	tr := &thriftReader{b: b, pos: offset}
+	header, err := tr.readStruct()
+	if err != nil {
+		return nil, fmt.Errorf("error reading page header: %s", err)
+	}
+	if header[1].(int64) != pageTypeData {
+		return nil, fmt.Errorf("unexpected page type %d", header[1])
+	}
+	size := int(header[3].(int64))
+	if tr.pos+size > len(b) {
+		return nil, fmt.Errorf("page of %d bytes exceeds file", size)
+	}
+	page := b[tr.pos : tr.pos+size]
+	dph := header[5].(map[int16]interface{})
+	numValues := int(dph[1].(int64))
+	if dph[2].(int64) != encodingPlain {
+		return nil, fmt.Errorf("unexpected encoding %d", dph[2])
+	}
+
+	levels := make([]int, numValues)
+	for i := range levels {
+		levels[i] = 1
+	}
+	if optional {
+		n := int(binary.LittleEndian.Uint32(page))
+		levels, err = decodeHybrid(page[4:4+n], 1, numValues)
+		if err != nil {
+			return nil, err
+		}
+		page = page[4+n:]
+	}
+
+	values := []interface{}{}
+	for _, level := range levels {
+		if level == 0 {
+			values = append(values, nil)
+			continue
+		}
+		switch typ {
+		case typeByteArray:
+			n := int(binary.LittleEndian.Uint32(page))
+			values = append(values, string(page[4:4+n]))
+			page = page[4+n:]
+		case typeDouble:
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(page)))
+			page = page[8:]
+		case typeInt64:
+			values = append(values, int64(binary.LittleEndian.Uint64(page)))
+			page = page[8:]
+		default:
+			return nil, fmt.Errorf("unexpected type %d", typ)
+		}
+	}
+	if len(page) != 0 {
+		return nil, fmt.Errorf("%d bytes left in page", len(page))
+	}
+
+	return values, nil
+}
+
+// decodeHybrid decodes n values of the given bit width encoded with the
+// RLE/bit-packing hybrid encoding.
+func decodeHybrid(b []byte, bitWidth, n int) ([]int, error) {
+	values := []int{}
+	byteWidth := (bitWidth + 7) / 8
+	for len(values) < n {
+		header, k := binary.Uvarint(b)
+		if k <= 0 {
+			return nil, fmt.Errorf("illegal run header")
+		}
+		b = b[k:]
+
+		if header&1 == 0 {
+			// RLE run of a single value
+			value := 0
+			for i := 0; i < byteWidth; i++ {
+				value |= int(b[i]) << (8 * uint(i))
+			}
+			b = b[byteWidth:]
+			for i := uint64(0); i < header>>1; i++ {
+				values = append(values, value)
+			}
+		} else {
+			// Bit-packed run of groups of 8 values, least significant bit first
+			count := int(header>>1) * 8
+			for i := 0; i < count; i++ {
+				value := 0
+				for j := 0; j < bitWidth; j++ {
+					bit := i*bitWidth + j
+					value |= int(b[bit/8]>>(uint(bit)%8)&1) << uint(j)
+				}
+				values = append(values, value)
+			}
+			b = b[int(header>>1)*bitWidth:]
+		}
+	}
+	if len(b) != 0 {
+		return nil, fmt.Errorf("%d bytes left after levels", len(b))
+	}
+	return values[:n], nil
+}
+
+// thriftReader decodes Thrift compact protocol values generically: structs
+// as maps of field ids to values, lists as slices, integers as int64, and
+// binaries as strings.
+type thriftReader struct {
+	b   []byte
+	pos int
+}
+
+func (tr *thriftReader) readByte() (byte, error) {
+	if tr.pos >= len(tr.b) {
+		return 0, fmt.Errorf("unexpected end of data")
+	}
+	tr.pos++
+	return tr.b[tr.pos-1], nil
+}
+
+func (tr *thriftReader) readVarint() (uint64, error) {
+	v, n := binary.Uvarint(tr.b[tr.pos:])
+	if n <= 0 {
+		return 0, fmt.Errorf("illegal varint at %d", tr.pos)
+	}
+	tr.pos += n
+	return v, nil
+}
+
+func (tr *thriftReader) readZigzag() (int64, error) {
+	v, err := tr.readVarint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+func (tr *thriftReader) readStruct() (map[int16]interface{}, error) {
+	fields := map[int16]interface{}{}
+	lastID := int16(0)
+	for {
+		h, err := tr.readByte()
+		if err != nil {
+			return nil, err
+		}
+		if h == 0 {
+			return fields, nil
+		}
+
+		id := lastID + int16(h>>4)
+		if h>>4 == 0 {
+			v, err := tr.readZigzag()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+		lastID = id
+
+		typ := h & 0x0F
+		switch typ {
+		case 1, 2:
+			fields[id] = typ == 1
+		default:
+			fields[id], err = tr.readValue(typ)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (tr *thriftReader) readValue(typ byte) (interface{}, error) {
+	switch typ {
+	case 1, 2:
+		b, err := tr.readByte()
+		return b == 1, err
+	case 3:
+		b, err := tr.readByte()
+		return int64(int8(b)), err
+	case 4, 5, 6:
+		return tr.readZigzag()
+	case 7:
+		if tr.pos+8 > len(tr.b) {
+			return nil, fmt.Errorf("unexpected end of data")
+		}
+		tr.pos += 8
+		return math.Float64frombits(binary.LittleEndian.Uint64(tr.b[tr.pos-8:])), nil
+	case thriftBinary:
+		n, err := tr.readVarint()
+		if err != nil {
+			return nil, err
+		}
+		if tr.pos+int(n) > len(tr.b) {
+			return nil, fmt.Errorf("unexpected end of data")
+		}
+		tr.pos += int(n)
+		return string(tr.b[tr.pos-int(n) : tr.pos]), nil
+	case thriftList, 10:
+		h, err := tr.readByte()
+		if err != nil {
+			return nil, err
+		}
+		size := int(h >> 4)
+		if size == 15 {
+			n, err := tr.readVarint()
+			if err != nil {
+				return nil, err
+			}
+			size = int(n)
+		}
+		list := []interface{}{}
+		for i := 0; i < size; i++ {
+			v, err := tr.readValue(h & 0x0F)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case thriftStruct:
+		return tr.readStruct()
+	}
+	return nil, fmt.Errorf("unsupported type %d", typ)
+}
@@ -3,6 +3,8 @@ package test
 import (
 	"fmt"
 	"math"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
@@ -429,3 +431,390 @@ func TestNodePriceFromCSVByClass(t *testing.T) {
 	}
 
 }
+
+func TestGPUShare(t *testing.T) {
+	cases := []struct {
+		resource string
+		labels   map[string]string
+		expected float64
+	}{
+		{"nvidia.com/gpu", nil, 1.0},
+		{"nvidia.com/mig-3g.20gb", nil, 3.0 / 7.0},
+		{"nvidia_com_mig_1g_5gb", nil, 1.0 / 7.0},
+		{"nvidia.com/gpu", map[string]string{cloud.GPUReplicasLabel: "4"}, 0.25},
+		{"nvidia.com/mig-2g.10gb", map[string]string{cloud.GPUReplicasLabel: "2"}, 1.0 / 7.0},
+		{"nvidia.com/gpu", map[string]string{cloud.MIGStrategyLabel: "single", cloud.GPUProductLabel: "A100-SXM4-40GB-MIG-7g.40gb"}, 1.0},
+		{"nvidia.com/gpu", map[string]string{cloud.MIGStrategyLabel: "single", cloud.GPUProductLabel: "A100-SXM4-40GB-MIG-1g.5gb"}, 1.0 / 7.0},
+		{"nvidia.com/gpu", map[string]string{cloud.GPUProductLabel: "A100-SXM4-40GB"}, 1.0},
+	}
+
+	for _, c := range cases {
+		if share := cloud.GPUShare(c.resource, c.labels); math.Abs(share-c.expected) > 1e-9 {
+			t.Errorf("GPUShare(%s, %v): expected %f; got %f", c.resource, c.labels, c.expected, share)
+		}
+	}
+
+	if !cloud.IsGPUResource("nvidia_com_mig_1g_5gb") || cloud.IsGPUResource("nvidia.com/gpu.shared") {
+		t.Errorf("IsGPUResource: unexpected result")
+	}
+}
+
+func TestSetCustomPricingMapField(t *testing.T) {
+	c := &cloud.CustomPricing{}
+
+	err := cloud.SetCustomPricingMapField(c, "extendedResources", map[string]string{"hugepages-2Mi": "0.01"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if c.ExtendedResources["hugepages-2Mi"] != "0.01" {
+		t.Errorf("expected extended resource price 0.01; got %v", c.ExtendedResources)
+	}
+
+	err = cloud.SetCustomPricingMapField(c, "sharedCost", map[string]string{"monitoring": "100"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if c.SharedCosts["monitoring"] != "100" {
+		t.Errorf("expected shared cost 100; got %v", c.SharedCosts)
+	}
+
+	if err = cloud.SetCustomPricingMapField(c, "CPU", map[string]string{}); err == nil {
+		t.Errorf("expected error setting non-map field")
+	}
+	if err = cloud.SetCustomPricingMapField(c, "noSuchField", map[string]string{}); err == nil {
+		t.Errorf("expected error setting missing field")
+	}
+}
+
+func TestNodePriceFromAlibabaPriceList(t *testing.T) {
+	os.Setenv("CONFIG_PATH", "../configs/")
+	c := &cloud.Alibaba{
+		PricingLocation: "testdata/alibaba_pricing.json",
+		Config:          cloud.NewProviderConfig("alibaba.json"),
+	}
+	err := c.DownloadPricingData()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	n := &v1.Node{}
+	n.Spec.ProviderID = "alicloud://cn-hangzhou.i-bp1abc"
+	n.Labels = map[string]string{
+		v1.LabelZoneRegion:   "cn-hangzhou",
+		v1.LabelInstanceType: "ecs.g6.large",
+	}
+	k := c.GetKey(n.Labels, n)
+	if k.ID() != "i-bp1abc" {
+		t.Errorf("expected ID i-bp1abc; got %s", k.ID())
+	}
+	node, err := c.NodePricing(k)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if node.Cost != "0.085" || node.IsSpot() {
+		t.Errorf("expected on-demand price 0.085; got %s, %s", node.Cost, node.UsageType)
+	}
+
+	n.Labels["kubernetes.io/os"] = "windows"
+	node, _ = c.NodePricing(c.GetKey(n.Labels, n))
+	if node.Cost != "0.103" {
+		t.Errorf("expected windows price 0.103; got %s", node.Cost)
+	}
+	delete(n.Labels, "kubernetes.io/os")
+
+	// Spot nodes are priced by the config
+	n.Labels[cloud.AlibabaSpotLabel] = cloud.AlibabaSpotLabelValue
+	node, _ = c.NodePricing(c.GetKey(n.Labels, n))
+	if !node.IsSpot() || node.Cost != "" || node.VCPUCost != "0.006655" {
+		t.Errorf("expected spot price from config; got %+v", node)
+	}
+	delete(n.Labels, cloud.AlibabaSpotLabel)
+
+	// Instance types missing from the price list fall back to the config
+	n.Labels[v1.LabelInstanceType] = "ecs.unknown"
+	node, _ = c.NodePricing(c.GetKey(n.Labels, n))
+	if node.Cost != "" || node.VCPUCost != "0.031611" || !node.UsesBaseCPUPrice {
+		t.Errorf("expected default price from config; got %+v", node)
+	}
+
+	pv := &v1.PersistentVolume{}
+	pv.Labels = map[string]string{v1.LabelZoneRegion: "cn-hangzhou"}
+	pv.Spec.CSI = &v1.CSIPersistentVolumeSource{VolumeHandle: "d-bp1disk"}
+	pvk := c.GetPVKey(pv, map[string]string{"type": "cloud_essd,cloud_ssd"}, "")
+	if pvk.ID() != "d-bp1disk" {
+		t.Errorf("expected PV ID d-bp1disk; got %s", pvk.ID())
+	}
+	pvPrice, err := c.PVPricing(pvk)
+	if err != nil || pvPrice.Cost != "0.000208" {
+		t.Errorf("expected essd price 0.000208; got %+v, %v", pvPrice, err)
+	}
+	pvPrice, _ = c.PVPricing(c.GetPVKey(pv, map[string]string{"type": "cloud_auto"}, ""))
+	if pvPrice.Cost != "0.00005479452" {
+		t.Errorf("expected default storage price; got %s", pvPrice.Cost)
+	}
+
+	if id := c.ParsePVID("d-bp1disk"); id != "d-bp1disk" {
+		t.Errorf("expected PV ID d-bp1disk; got %s", id)
+	}
+	if id := c.ParseID("i-bp1abc"); id != "i-bp1abc" {
+		t.Errorf("expected ID i-bp1abc; got %s", id)
+	}
+
+	lb, err := c.LoadBalancerPricing()
+	if err != nil || lb.Cost != 0.021 {
+		t.Errorf("expected load balancer price 0.021 from config; got %+v, %v", lb, err)
+	}
+
+	if _, err := cloud.ParseAlibabaPriceList(strings.NewReader("not json")); err == nil {
+		t.Errorf("expected error parsing invalid price list")
+	}
+
+	// Without a price list, nodes are priced by the config, and the pricing
+	// source reports that none is configured
+	c = &cloud.Alibaba{
+		Config: cloud.NewProviderConfig("alibaba.json"),
+	}
+	err = c.DownloadPricingData()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	n.Labels[v1.LabelInstanceType] = "ecs.g6.large"
+	node, _ = c.NodePricing(c.GetKey(n.Labels, n))
+	if node.Cost != "" || node.VCPUCost != "0.031611" {
+		t.Errorf("expected default price from config; got %+v", node)
+	}
+	ps := c.PricingSourceStatus()[cloud.AlibabaPriceListPricingSource]
+	if ps.Available || !strings.Contains(ps.Error, "alibabaPricingURL") {
+		t.Errorf("expected unavailable price list; got %+v", ps)
+	}
+}
+
+func TestNodePriceFromOraclePriceList(t *testing.T) {
+	os.Setenv("CONFIG_PATH", "../configs/")
+	c := &cloud.Oracle{
+		PricingLocation: "testdata/oracle_pricing.json",
+		Config:          cloud.NewProviderConfig("oracle.json"),
+	}
+	err := c.DownloadPricingData()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	n := &v1.Node{}
+	n.Spec.ProviderID = "ocid1.instance.oc1.iad.abc"
+	n.Labels = map[string]string{v1.LabelInstanceType: "VM.Standard.E4.Flex"}
+	k := c.GetKey(n.Labels, n)
+	if k.ID() != "ocid1.instance.oc1.iad.abc" {
+		t.Errorf("expected ID ocid1.instance.oc1.iad.abc; got %s", k.ID())
+	}
+
+	// An OCPU is two vCPUs on x86 shapes and one on Arm shapes
+	cases := []struct {
+		shape       string
+		preemptible bool
+		cpu         string
+		ram         string
+	}{
+		{"VM.Standard.E4.Flex", false, "0.012500", "0.001500"},
+		{"VM.Standard.E4.Flex", true, "0.006250", "0.000750"},
+		{"VM.Standard.A1.Flex", false, "0.010000", "0.001500"},
+	}
+	for _, tc := range cases {
+		n.Labels = map[string]string{v1.LabelInstanceType: tc.shape}
+		if tc.preemptible {
+			n.Labels[cloud.OraclePreemptibleLabel] = cloud.OraclePreemptibleLabelValue
+		}
+		node, err := c.NodePricing(c.GetKey(n.Labels, n))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if node.VCPUCost != tc.cpu || node.RAMCost != tc.ram || node.IsSpot() != tc.preemptible {
+			t.Errorf("%s: expected prices %s, %s; got %+v", tc.shape, tc.cpu, tc.ram, node)
+		}
+	}
+
+	// Shapes missing from the price list fall back to the config
+	n.Labels = map[string]string{v1.LabelInstanceType: "VM.Standard2.4"}
+	node, _ := c.NodePricing(c.GetKey(n.Labels, n))
+	if node.VCPUCost != "0.0125" || !node.UsesBaseCPUPrice {
+		t.Errorf("expected default price from config; got %+v", node)
+	}
+
+	pv := &v1.PersistentVolume{}
+	pv.Spec.CSI = &v1.CSIPersistentVolumeSource{VolumeHandle: "ocid1.volume.oc1.iad.abc"}
+	pvPrice, err := c.PVPricing(c.GetPVKey(pv, map[string]string{"vpusPerGB": "20"}, ""))
+	if err != nil || pvPrice.Cost != "0.0000815068" {
+		t.Errorf("expected higher performance volume price 0.0000815068; got %+v, %v", pvPrice, err)
+	}
+	pvPrice, _ = c.PVPricing(c.GetPVKey(pv, map[string]string{}, ""))
+	if pvPrice.Cost != "0.0000582192" {
+		t.Errorf("expected balanced volume price 0.0000582192; got %s", pvPrice.Cost)
+	}
+
+	lb, _ := c.LoadBalancerPricing()
+	if lb.Cost != 0.0113 {
+		t.Errorf("expected load balancer price 0.0113; got %f", lb.Cost)
+	}
+
+	if id := c.ParseID("oci://ocid1.instance.oc1.iad.abc"); id != "ocid1.instance.oc1.iad.abc" {
+		t.Errorf("expected ID ocid1.instance.oc1.iad.abc; got %s", id)
+	}
+
+	// Flexible shapes of both series are offered in every region, in 6 sizes
+	// of 3 ratios of memory to vCPUs
+	shapes, _ := c.InstanceShapes()
+	if len(shapes) != 36 {
+		t.Fatalf("expected 18 sizes of 2 series; got %d shapes", len(shapes))
+	}
+	expected := map[string]cloud.InstanceShape{
+		"VM.Standard.E4.Flex (1 OCPU, 4 GB)": {CPUCores: 2, RAMBytes: 4 * 1024 * 1024 * 1024, HourlyCost: 0.031},
+		"VM.Standard.A1.Flex (2 OCPU, 4 GB)": {CPUCores: 2, RAMBytes: 4 * 1024 * 1024 * 1024, HourlyCost: 0.026},
+	}
+	for _, shape := range shapes {
+		if shape.Region != "" {
+			t.Errorf("expected shape in every region; got %+v", shape)
+		}
+		if e, ok := expected[shape.InstanceType]; ok {
+			if shape.CPUCores != e.CPUCores || shape.RAMBytes != e.RAMBytes || math.Abs(shape.HourlyCost-e.HourlyCost) > 1e-9 {
+				t.Errorf("unexpected shape: %+v", shape)
+			}
+			delete(expected, shape.InstanceType)
+		}
+	}
+	if len(expected) > 0 {
+		t.Errorf("missing shapes: %v", expected)
+	}
+}
+
+func TestGCPInstanceShapes(t *testing.T) {
+	c := &cloud.GCP{
+		Pricing: map[string]*cloud.GCPPricing{
+			"us-central1,n1standard,ondemand":    {Node: &cloud.Node{VCPUCost: "0.031611", RAMCost: "0.004237"}},
+			"us-central1,n1standard,preemptible": {Node: &cloud.Node{VCPUCost: "0.00698", RAMCost: "0.00094"}},
+			"us-east1,e2standard,ondemand":       {Node: &cloud.Node{VCPUCost: "0.021811", RAMCost: "0.002923"}},
+			"us-east1,c2standard,ondemand":       {Node: &cloud.Node{VCPUCost: "0.03398"}},
+		},
+	}
+
+	shapes, err := c.InstanceShapes()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Machine types are priced by the vCPUs and RAM of their family; the c2
+	// family is missing a RAM price, so is not listed
+	counts := map[string]int{}
+	for _, shape := range shapes {
+		counts[shape.Region]++
+
+		switch shape.Region + "/" + shape.InstanceType {
+		case "us-central1/n1-highmem-4":
+			if shape.CPUCores != 4 || shape.RAMBytes != 26*1024*1024*1024 || math.Abs(shape.HourlyCost-(4*0.031611+26*0.004237)) > 1e-9 {
+				t.Errorf("unexpected shape: %+v", shape)
+			}
+		case "us-east1/e2-standard-8":
+			if shape.CPUCores != 8 || shape.RAMBytes != 32*1024*1024*1024 || math.Abs(shape.HourlyCost-(8*0.021811+32*0.002923)) > 1e-9 {
+				t.Errorf("unexpected shape: %+v", shape)
+			}
+		}
+		if strings.HasPrefix(shape.InstanceType, "c2-") || (shape.Region == "us-east1" && !strings.HasPrefix(shape.InstanceType, "e2-")) {
+			t.Errorf("unexpected shape: %+v", shape)
+		}
+	}
+	if counts["us-central1"] != 22 || counts["us-east1"] != 14 {
+		t.Errorf("expected 22 n1 machine types in us-central1 and 14 e2 in us-east1; got %v", counts)
+	}
+}
+
+func TestNodePriceFromDigitalOceanSizes(t *testing.T) {
+	os.Setenv("CONFIG_PATH", "../configs/")
+	c := &cloud.DigitalOcean{
+		PricingLocation: "testdata/digitalocean_sizes.json",
+		Config:          cloud.NewProviderConfig("digitalocean.json"),
+	}
+	err := c.DownloadPricingData()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	n := &v1.Node{}
+	n.Spec.ProviderID = "digitalocean://12345678"
+	n.Labels = map[string]string{
+		v1.LabelZoneRegion:   "nyc1",
+		v1.LabelInstanceType: "s-2vcpu-4gb",
+	}
+	k := c.GetKey(n.Labels, n)
+	if k.ID() != "12345678" {
+		t.Errorf("expected ID 12345678; got %s", k.ID())
+	}
+	node, err := c.NodePricing(k)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if node.Cost != "0.03571" || node.VCPU != "2" {
+		t.Errorf("expected price 0.03571 for 2 vCPUs; got %+v", node)
+	}
+
+	n.Labels[v1.LabelInstanceType] = "s-unknown"
+	node, _ = c.NodePricing(c.GetKey(n.Labels, n))
+	if node.Cost != "" || node.VCPUCost != "0.017857" || !node.UsesBaseCPUPrice {
+		t.Errorf("expected default price from config; got %+v", node)
+	}
+
+	pvPrice, err := c.PVPricing(c.GetPVKey(&v1.PersistentVolume{}, map[string]string{}, ""))
+	if err != nil || pvPrice.Cost != "0.000136986" {
+		t.Errorf("expected volume price 0.000136986; got %+v, %v", pvPrice, err)
+	}
+
+	shapes, _ := c.InstanceShapes()
+	if len(shapes) != 8 {
+		t.Fatalf("expected 2 sizes in 4 regions; got %d shapes", len(shapes))
+	}
+	for _, shape := range shapes {
+		if shape.InstanceType == "s-2vcpu-4gb" && (shape.CPUCores != 2 || shape.RAMBytes != 4*1024*1024*1024 || shape.HourlyCost != 0.03571) {
+			t.Errorf("unexpected shape: %+v", shape)
+		}
+	}
+
+	if _, _, err := cloud.ParseDigitalOceanSizes(strings.NewReader(`{"sizes": "invalid"}`)); err == nil {
+		t.Errorf("expected error parsing invalid sizes")
+	}
+}
+
+func TestNodePriceFromDigitalOceanDefaultConfig(t *testing.T) {
+	os.Setenv("CONFIG_PATH", "../configs/")
+	c := &cloud.DigitalOcean{
+		Config: cloud.NewProviderConfig("digitalocean.json"),
+	}
+	err := c.DownloadPricingData()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	n := &v1.Node{}
+	n.Spec.ProviderID = "digitalocean://12345678"
+	n.Labels = map[string]string{
+		v1.LabelZoneRegion:   "nyc1",
+		v1.LabelInstanceType: "s-4vcpu-8gb",
+	}
+	node, _ := c.NodePricing(c.GetKey(n.Labels, n))
+	if node.Cost != "0.07143" || node.UsesBaseCPUPrice {
+		t.Errorf("expected droplet price 0.07143 without a token; got %+v", node)
+	}
+
+	// Sizes that cannot be refreshed from the API fall back to the shipped list
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	c.PricingLocation = server.URL
+	err = c.DownloadPricingData()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	node, _ = c.NodePricing(c.GetKey(n.Labels, n))
+	if node.Cost != "0.07143" {
+		t.Errorf("expected droplet price 0.07143 after failing to reach the API; got %+v", node)
+	}
+}